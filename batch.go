@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// An EvictedItem is an item removed from the cache, as delivered to a batch
+// handler. See RegisterEvictionBatchHandler.
+type EvictedItem struct {
+	Key    string
+	Value  interface{}
+	Reason EvictionReason
+}
+
+// RegisterEvictionBatchHandler makes the cache deliver removed items to f in
+// batches instead of calling an OnEvicted function for each, e.g. to write
+// them to a message queue with one request per batch. Items are collected in
+// the order they are removed, and delivered from a dedicated goroutine once
+// maxBatch have been collected, or maxDelay after the first of them was, which
+// ever comes first. Each batch holds at most maxBatch items.
+//
+// The batch handler replaces any OnEvicted function, and is replaced by one
+// set later; registering another batch handler delivers the items collected
+// for the previous one first. Close delivers the items collected so far and
+// stops the goroutine, after which items are delivered to f as they are
+// removed, from the goroutine removing them. f must not be nil.
+func (c *cache) RegisterEvictionBatchHandler(f func(batch []EvictedItem), maxBatch int, maxDelay time.Duration) {
+	if maxBatch < 1 {
+		maxBatch = 1
+	}
+	b := &evictionBatcher{
+		c:        c,
+		f:        f,
+		maxBatch: maxBatch,
+		maxDelay: maxDelay,
+		first:    make(chan struct{}, 1),
+		full:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	c.goroutines.helper(b.run)
+	c.mu.Lock()
+	old := c.batcher
+	c.batcher = b
+	c.onEvicted = b.add
+	c.mu.Unlock()
+	if old != nil {
+		old.close()
+	}
+}
+
+type evictionBatcher struct {
+	c        *cache
+	f        func([]EvictedItem)
+	maxBatch int
+	maxDelay time.Duration
+
+	mu      sync.Mutex
+	pending []EvictedItem
+	closed  bool
+
+	first chan struct{} // an item was added to an empty batch
+	full  chan struct{} // maxBatch items are pending
+	stop  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+// Collects a removed item. Used as the cache's OnEvicted function.
+func (b *evictionBatcher) add(k string, v interface{}, reason EvictionReason) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		b.deliver([]EvictedItem{{k, v, reason}})
+		return
+	}
+	b.pending = append(b.pending, EvictedItem{k, v, reason})
+	n := len(b.pending)
+	b.mu.Unlock()
+	if n == 1 {
+		signal(b.first)
+	}
+	if n >= b.maxBatch {
+		signal(b.full)
+	}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (b *evictionBatcher) run() {
+	var (
+		timer   *time.Timer
+		timeout <-chan time.Time
+	)
+	stopTimer := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+	}
+	for {
+		select {
+		case <-b.first:
+			if timeout == nil {
+				timer = time.NewTimer(b.maxDelay)
+				timeout = timer.C
+			}
+		case <-b.full:
+			if b.flush(false) == 0 {
+				stopTimer()
+			}
+		case <-timeout:
+			timer, timeout = nil, nil
+			b.flush(true)
+		case <-b.stop:
+			stopTimer()
+			b.flush(true)
+			close(b.done)
+			return
+		}
+	}
+}
+
+// Delivers the pending items in batches of at most maxBatch. Unless all is set,
+// a final batch of fewer items is left pending. Returns the number of items
+// left.
+func (b *evictionBatcher) flush(all bool) int {
+	for {
+		b.mu.Lock()
+		n := len(b.pending)
+		if n == 0 || (!all && n < b.maxBatch) {
+			b.mu.Unlock()
+			return n
+		}
+		if n > b.maxBatch {
+			n = b.maxBatch
+		}
+		batch := b.pending[:n:n]
+		b.pending = b.pending[n:]
+		b.mu.Unlock()
+		b.deliver(batch)
+	}
+}
+
+// Calls f, recovering from (and logging) any panic.
+func (b *evictionBatcher) deliver(batch []EvictedItem) {
+	defer func() {
+		if x := recover(); x != nil {
+			b.c.logf("recovered from panic in eviction batch handler: %v", x)
+		}
+	}()
+	b.f(batch)
+}
+
+// Delivers the pending items and stops the dispatch goroutine. Items removed
+// after that are delivered immediately.
+func (b *evictionBatcher) close() {
+	b.once.Do(func() {
+		close(b.stop)
+		<-b.done
+		b.mu.Lock()
+		b.closed = true
+		pending := b.pending
+		b.pending = nil
+		b.mu.Unlock()
+		// Items added between the final flush and closed being set.
+		for len(pending) > 0 {
+			n := len(pending)
+			if n > b.maxBatch {
+				n = b.maxBatch
+			}
+			b.deliver(pending[:n])
+			pending = pending[n:]
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches [][]EvictedItem
+}
+
+func (r *batchRecorder) handle(batch []EvictedItem) {
+	r.mu.Lock()
+	r.batches = append(r.batches, append([]EvictedItem(nil), batch...))
+	r.mu.Unlock()
+}
+
+func (r *batchRecorder) get() [][]EvictedItem {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]EvictedItem(nil), r.batches...)
+}
+
+func TestEvictionBatchMaxBatch(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	r := &batchRecorder{}
+	tc.RegisterEvictionBatchHandler(r.handle, 10, time.Hour)
+	for i := 0; i < 25; i++ {
+		k := strconv.Itoa(i)
+		tc.Set(k, i, DefaultExpiration)
+		tc.Delete(k)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(r.get()) < 2 && time.Now().Before(deadline) {
+		<-time.After(time.Millisecond)
+	}
+	batches := r.get()
+	if len(batches) != 2 {
+		t.Fatalf("%d batches were delivered, not 2", len(batches))
+	}
+	// Items are delivered in the order they were removed.
+	i := 0
+	for _, b := range batches {
+		if len(b) != 10 {
+			t.Errorf("batch has %d items, not 10", len(b))
+		}
+		for _, it := range b {
+			if it.Key != strconv.Itoa(i) || it.Value != i || it.Reason != EvictionReasonDeleted {
+				t.Errorf("item %d is %+v", i, it)
+			}
+			i++
+		}
+	}
+}
+
+func TestEvictionBatchMaxDelay(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	r := &batchRecorder{}
+	tc.RegisterEvictionBatchHandler(r.handle, 100, 20*time.Millisecond)
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Delete("foo")
+	tc.Set("bar", 2, DefaultExpiration)
+	tc.Delete("bar")
+	if n := len(r.get()); n != 0 {
+		t.Errorf("%d batches were delivered before maxDelay", n)
+	}
+	<-time.After(200 * time.Millisecond)
+	batches := r.get()
+	if len(batches) != 1 || len(batches[0]) != 2 || batches[0][0].Key != "foo" || batches[0][1].Key != "bar" {
+		t.Errorf("delivered %v, not one batch of foo and bar", batches)
+	}
+}
+
+func TestEvictionBatchFlushOnClose(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	r := &batchRecorder{}
+	tc.RegisterEvictionBatchHandler(r.handle, 4, time.Hour)
+	for i := 0; i < 10; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	tc.Flush()
+	tc.Close()
+	n := 0
+	for _, b := range r.get() {
+		if len(b) > 4 {
+			t.Errorf("batch has %d items, more than 4", len(b))
+		}
+		n += len(b)
+	}
+	if n != 10 {
+		t.Errorf("%d items were delivered by Close, not 10", n)
+	}
+	// After Close, items are delivered as they are removed.
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Delete("foo")
+	if b := r.get(); len(b[len(b)-1]) != 1 || b[len(b)-1][0].Key != "foo" {
+		t.Errorf("foo wasn't delivered right away after Close: %v", b)
+	}
+}
+
+func TestEvictionBatchReplacedByOnEvicted(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	r := &batchRecorder{}
+	tc.RegisterEvictionBatchHandler(r.handle, 100, time.Hour)
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Delete("foo")
+	var evicted []string
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = append(evicted, k)
+	})
+	// The pending batch is delivered when the handler is replaced.
+	if b := r.get(); len(b) != 1 || b[0][0].Key != "foo" {
+		t.Errorf("delivered %v, not foo", b)
+	}
+	tc.Set("bar", 2, DefaultExpiration)
+	tc.Delete("bar")
+	if len(evicted) != 1 || evicted[0] != "bar" || len(r.get()) != 1 {
+		t.Errorf("bar went to the wrong handler: %v, %v", evicted, r.get())
+	}
+}
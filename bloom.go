@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+// A Bloom filter over the keys in a cache. Bits are read and set atomically so
+// that Get can consult the filter without taking the cache's lock. Deleted keys
+// can't be removed from the filter; they leave it stale-positive until it is
+// rebuilt.
+type bloomFilter struct {
+	bits     []uint64
+	m        uint64 // number of bits
+	k        uint64 // number of hash functions
+	limit    uint64 // insertions after which the false positive rate is exceeded
+	inserted uint64 // atomic
+	removed  uint64 // atomic
+}
+
+func newBloomFilter(n int, p float64) *bloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{
+		bits:  make([]uint64, (m+63)/64),
+		m:     m,
+		k:     k,
+		limit: uint64(n),
+	}
+}
+
+// FNV-1a, split into the two halves used for double hashing.
+func bloomHash(key string) (uint64, uint64) {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h, h>>32 | 1
+}
+
+func (f *bloomFilter) add(key string) {
+	h1, h2 := bloomHash(key)
+	for i := uint64(0); i < f.k; i++ {
+		b := (h1 + i*h2) % f.m
+		atomic.OrUint64(&f.bits[b/64], 1<<(b%64))
+	}
+	atomic.AddUint64(&f.inserted, 1)
+}
+
+// Returns false if key was definitely never added to the filter.
+func (f *bloomFilter) mayContain(key string) bool {
+	h1, h2 := bloomHash(key)
+	for i := uint64(0); i < f.k; i++ {
+		b := (h1 + i*h2) % f.m
+		if atomic.LoadUint64(&f.bits[b/64])&(1<<(b%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if so many keys were added that the filter's estimated false
+// positive rate exceeds the rate it was sized for.
+func (f *bloomFilter) saturated() bool {
+	return atomic.LoadUint64(&f.inserted) > f.limit
+}
+
+// EnableBloomFilter makes the cache maintain a Bloom filter of its keys, sized
+// for expectedItems keys at the given false positive rate (e.g. 0.01). Get
+// consults the filter without locking and returns a miss right away for keys
+// that were definitely never set, which speeds up workloads where most lookups
+// miss. Pass expectedItems < 1 to disable the filter. Otherwise,
+// falsePositiveRate must be greater than 0 and less than 1, or
+// EnableBloomFilter panics.
+//
+// Keys that are deleted or expire stay in the filter until it is rebuilt, which
+// happens during DeleteExpired (and so during janitor sweeps) and whenever more
+// keys are added than the filter was sized for.
+func (c *cache) EnableBloomFilter(expectedItems int, falsePositiveRate float64) {
+	if expectedItems >= 1 && !(falsePositiveRate > 0 && falsePositiveRate < 1) {
+		panic(fmt.Sprintf("go-cache: EnableBloomFilter: false positive rate must be in (0, 1), not %v", falsePositiveRate))
+	}
+	c.mu.Lock()
+	if expectedItems < 1 {
+		c.bloom.Store(nil)
+		c.bloomSize = 0
+	} else {
+		c.bloomSize = expectedItems
+		c.bloomRate = falsePositiveRate
+		c.rebuildBloom()
+	}
+	c.mu.Unlock()
+}
+
+// Adds k to the Bloom filter, if any, rebuilding it if it is saturated. c.mu
+// must be held.
+func (c *cache) bloomAdd(k string) {
+	f := c.bloom.Load()
+	if f == nil {
+		return
+	}
+	f.add(k)
+	if f.saturated() {
+		c.rebuildBloom()
+	}
+}
+
+// Notes that a key was removed from the cache, leaving the filter stale.
+func (c *cache) bloomRemove() {
+	if f := c.bloom.Load(); f != nil {
+		atomic.AddUint64(&f.removed, 1)
+	}
+}
+
+// Rebuilds the Bloom filter from the keys currently in the cache if any were
+// removed since it was built. c.mu must be held.
+func (c *cache) refreshBloom() {
+	if f := c.bloom.Load(); f != nil && atomic.LoadUint64(&f.removed) > 0 {
+		c.rebuildBloom()
+	}
+}
+
+// Replaces the Bloom filter with a new one containing exactly the keys
+// currently in the cache. c.mu must be held.
+func (c *cache) rebuildBloom() {
+	n := c.bloomSize
+	if 2*len(c.items) > n {
+		n = 2 * len(c.items)
+	}
+	f := newBloomFilter(n, c.bloomRate)
+	for k := range c.items {
+		f.add(k)
+	}
+	c.bloom.Store(f)
+}
+
+// EnableBloomFilter enables a Bloom filter on every shard, each sized for its
+// share of expectedItems. See the cache's EnableBloomFilter.
+func (sc *shardedCache) EnableBloomFilter(expectedItems int, falsePositiveRate float64) {
+	n := expectedItems / len(sc.cs)
+	if expectedItems > 0 && n < 1 {
+		n = 1
+	}
+	for _, v := range sc.cs {
+		v.EnableBloomFilter(n, falsePositiveRate)
+	}
+}
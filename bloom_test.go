@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBloomFilterNoFalseNegatives(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("before", 0, DefaultExpiration)
+	tc.EnableBloomFilter(100, 0.01)
+	if _, found := tc.Get("before"); !found {
+		t.Error("item set before enabling the filter was not found")
+	}
+	// Add many more keys than the filter was sized for, forcing rebuilds.
+	for i := 0; i < 10000; i++ {
+		tc.Set("foo"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+	for i := 0; i < 10000; i++ {
+		k := "foo" + strconv.Itoa(i)
+		if x, found := tc.Get(k); !found || x.(int) != i {
+			t.Fatalf("%s was not found", k)
+		}
+	}
+	if err := tc.Add("bar", 1, DefaultExpiration); err != nil {
+		t.Fatal("Couldn't add bar:", err)
+	}
+	if _, found := tc.Get("bar"); !found {
+		t.Error("bar was not found after Add")
+	}
+}
+
+func TestBloomFilterWriteCoalescing(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithWriteCoalescing(time.Hour))
+	defer tc.Close()
+	tc.EnableBloomFilter(100, 0.01)
+	tc.Set("k", 1, DefaultExpiration)
+	if x, found := tc.Get("k"); !found || x != 1 {
+		t.Errorf("got (%v, %v) for a buffered write, want (1, true)", x, found)
+	}
+	tc.commitPending(false)
+	if x, found := tc.Get("k"); !found || x != 1 {
+		t.Errorf("got (%v, %v) once stored, want (1, true)", x, found)
+	}
+}
+
+func TestBloomFilterMisses(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.EnableBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		tc.Set("foo"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+	f := tc.bloom.Load()
+	fp := 0
+	for i := 0; i < 10000; i++ {
+		if f.mayContain("bar" + strconv.Itoa(i)) {
+			fp++
+		}
+	}
+	if fp > 500 {
+		t.Errorf("false positive rate is too high: %d/10000", fp)
+	}
+}
+
+func TestBloomFilterRebuild(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.EnableBloomFilter(100, 0.01)
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Set("bar", 2, 1*time.Millisecond)
+	tc.Delete("foo")
+	<-time.After(5 * time.Millisecond)
+	tc.DeleteExpired()
+	f := tc.bloom.Load()
+	if f.mayContain("foo") || f.mayContain("bar") {
+		t.Error("filter still contains removed keys after DeleteExpired")
+	}
+	tc.Set("baz", 3, DefaultExpiration)
+	if _, found := tc.Get("baz"); !found {
+		t.Error("baz was not found after rebuild")
+	}
+	tc.Flush()
+	if tc.bloom.Load().mayContain("baz") {
+		t.Error("filter still contains baz after Flush")
+	}
+	tc.Set("baz", 3, DefaultExpiration)
+	if _, found := tc.Get("baz"); !found {
+		t.Error("baz was not found after Flush")
+	}
+}
+
+func TestShardedBloomFilter(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	tc.EnableBloomFilter(100, 0.01)
+	for _, v := range shardedKeys {
+		tc.Set(v, "value", DefaultExpiration)
+	}
+	for _, v := range shardedKeys {
+		if _, found := tc.Get(v); !found {
+			t.Errorf("%q was not found", v)
+		}
+	}
+}
+
+func BenchmarkCacheGetMostlyMisses(b *testing.B) {
+	benchmarkCacheGetMostlyMisses(b, false)
+}
+
+func BenchmarkCacheGetMostlyMissesBloomFilter(b *testing.B) {
+	benchmarkCacheGetMostlyMisses(b, true)
+}
+
+func benchmarkCacheGetMostlyMisses(b *testing.B, bloom bool) {
+	b.StopTimer()
+	tc := New(NoExpiration, 0)
+	if bloom {
+		tc.EnableBloomFilter(10000, 0.01)
+	}
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = "foo" + strconv.Itoa(i)
+		// 5% of the looked up keys exist.
+		if i%20 == 0 {
+			tc.Set(keys[i], i, DefaultExpiration)
+		}
+	}
+	b.StartTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			tc.Get(keys[i%len(keys)])
+			i++
+		}
+	})
+}
+
+func TestBloomFilterInvalidRate(t *testing.T) {
+	for _, rate := range []float64{0, 1, -0.1, 1.5} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("EnableBloomFilter(100, %v) didn't panic", rate)
+				}
+			}()
+			New(DefaultExpiration, 0).EnableBloomFilter(100, rate)
+		}()
+	}
+	// The rate doesn't matter when disabling the filter.
+	tc := New(DefaultExpiration, 0)
+	tc.EnableBloomFilter(0, 0)
+	for _, rate := range []float64{0.0001, 0.9999} {
+		tc.EnableBloomFilter(100, rate)
+		tc.Set("foo", 1, DefaultExpiration)
+		if _, found := tc.Get("foo"); !found {
+			t.Errorf("rate %v: foo wasn't found", rate)
+		}
+	}
+}
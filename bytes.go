@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"time"
+)
+
+// WithCopyBytes makes SetBytes store a copy of the given bytes, and GetBytes
+// return a copy of the stored ones, so that the cached buffer can't be
+// modified through a slice held by a caller. It costs an allocation and a copy
+// of the whole value per call; without it, callers must not modify the bytes
+// they pass to SetBytes or get from GetBytes.
+func WithCopyBytes() Option {
+	return func(o *options) {
+		o.copyBytes = true
+	}
+}
+
+// SetBytes sets an item holding b, like Set. Together with GetBytes, it makes
+// caching serialized values, e.g. HTTP response bodies, explicit. Large values
+// are compressed if the cache was created with WithValueCompression.
+func (c *cache) SetBytes(k string, b []byte, d time.Duration) {
+	c.Set(k, c.bytes(b), d)
+}
+
+// GetBytes gets an item set with SetBytes, or otherwise holding a []byte.
+// Returns nil and false if the item wasn't found, has expired, or holds a
+// value of another type.
+func (c *cache) GetBytes(k string) ([]byte, bool) {
+	x, found := c.Get(k)
+	if !found {
+		return nil, false
+	}
+	b, ok := x.([]byte)
+	if !ok {
+		return nil, false
+	}
+	return c.bytes(b), true
+}
+
+// Returns a copy of b if the cache was created with WithCopyBytes, or b
+// otherwise.
+func (c *cache) bytes(b []byte) []byte {
+	if !c.copyBytes || b == nil {
+		return b
+	}
+	return append(make([]byte, 0, len(b)), b...)
+}
+
+// SetBytes sets an item holding b in the shard owning k. See the cache's
+// SetBytes.
+func (sc *shardedCache) SetBytes(k string, b []byte, d time.Duration) {
+	sc.Set(k, sc.bucket(k).bytes(b), d)
+}
+
+// GetBytes gets an item holding a []byte from the shard owning k. See the
+// cache's GetBytes.
+func (sc *shardedCache) GetBytes(k string) ([]byte, bool) {
+	return sc.bucket(k).GetBytes(k)
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+type bytesStore interface {
+	Set(k string, x interface{}, d time.Duration)
+	SetBytes(k string, b []byte, d time.Duration)
+	GetBytes(k string) ([]byte, bool)
+}
+
+func testBytes(t *testing.T, tc bytesStore) {
+	tc.SetBytes("body", []byte("hello"), DefaultExpiration)
+	if b, found := tc.GetBytes("body"); !found || string(b) != "hello" {
+		t.Errorf("GetBytes returned %q, %v", b, found)
+	}
+	tc.Set("string", "hello", DefaultExpiration)
+	if b, found := tc.GetBytes("string"); found || b != nil {
+		t.Errorf("GetBytes of a string returned %q, %v", b, found)
+	}
+	if _, found := tc.GetBytes("missing"); found {
+		t.Error("GetBytes found a missing item")
+	}
+}
+
+func TestBytes(t *testing.T) {
+	testBytes(t, New(DefaultExpiration, 0))
+}
+
+func TestShardedBytes(t *testing.T) {
+	testBytes(t, NewSharded(DefaultExpiration, 0, 2))
+}
+
+func TestBytesAliasing(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	b := []byte("hello")
+	tc.SetBytes("body", b, DefaultExpiration)
+	b[0] = 'j'
+	if got, _ := tc.GetBytes("body"); string(got) != "jello" {
+		t.Errorf("got %q; without WithCopyBytes, the caller's buffer should be stored", got)
+	}
+}
+
+func testCopyBytes(t *testing.T, tc bytesStore) {
+	b := []byte("hello")
+	tc.SetBytes("body", b, DefaultExpiration)
+	b[0] = 'j'
+	got, _ := tc.GetBytes("body")
+	got[1] = 'a'
+	if got, _ := tc.GetBytes("body"); string(got) != "hello" {
+		t.Errorf("the cached bytes were modified through a caller's slice: %q", got)
+	}
+}
+
+func TestCopyBytes(t *testing.T) {
+	testCopyBytes(t, New(DefaultExpiration, 0, WithCopyBytes()))
+}
+
+func TestShardedCopyBytes(t *testing.T) {
+	testCopyBytes(t, NewSharded(DefaultExpiration, 0, 2, WithCopyBytes()))
+}
+
+func TestBytesCompressed(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithValueCompression(16, GzipCodec{}))
+	body := bytes.Repeat([]byte("abc"), 100)
+	tc.SetBytes("body", body, DefaultExpiration)
+	if _, ok := tc.items["body"].Object.(compressedValue); !ok {
+		t.Error("the bytes weren't compressed")
+	}
+	if b, found := tc.GetBytes("body"); !found || !bytes.Equal(b, body) {
+		t.Errorf("GetBytes returned %d bytes, %v", len(b), found)
+	}
+}
+
+func BenchmarkGetBytes(b *testing.B) {
+	benchmarkGetBytes(b)
+}
+
+func BenchmarkGetBytesCopy(b *testing.B) {
+	benchmarkGetBytes(b, WithCopyBytes())
+}
+
+func benchmarkGetBytes(b *testing.B, opts ...Option) {
+	tc := New(DefaultExpiration, 0, opts...)
+	tc.SetBytes("body", make([]byte, 4096), DefaultExpiration)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tc.GetBytes("body")
+	}
+}
@@ -1,7 +1,6 @@
 package cache
 
 import (
-	"encoding/gob"
 	"fmt"
 	"io"
 	"os"
@@ -15,6 +14,29 @@ import (
 type Item struct {
 	Object     interface{}
 	Expiration int64
+	// Cost is how long Object took to compute, if it was set with SetWithCost.
+	Cost time.Duration
+	// Created is when the item was set, in Unix nanoseconds, if stats were
+	// enabled at the time (see EnableStats.)
+	Created int64
+	// Timestamp is the time recorded for the item, in Unix nanoseconds, if
+	// it was set with SetIfNewer.
+	Timestamp int64
+	// Meta is the metadata attached to the item, if it was set with
+	// SetWithMeta.
+	Meta map[string]string
+	// Priority is the item's priority, if it was set with SetWithPriority.
+	Priority Priority
+	// Once is set on items stored by ComputeOnce. They aren't evicted to
+	// make room for other items, and the flag is saved along with the item
+	// by Save and SaveFile.
+	Once bool
+	// Changes on every write to the item. See GetVersioned.
+	version uint64
+	// The item's size, if the cache has a sizer. See WithSizeAccounting.
+	size int64
+	// When the item was set with SetDebounced, in Unix nanoseconds.
+	debounced int64
 }
 
 // Expired Returns true if the item has expired.
@@ -41,11 +63,68 @@ type Cache struct {
 }
 
 type cache struct {
-	defaultExpiration time.Duration
-	items             map[string]Item
-	mu                sync.RWMutex
-	onEvicted         func(string, interface{})
-	janitor           *janitor
+	defaultExpiration  time.Duration
+	items              map[string]Item
+	mu                 sync.RWMutex
+	onEvicted          func(string, interface{}, EvictionReason)
+	onReplaced         func(string, interface{}, interface{})
+	onSet              func(string, interface{})
+	logger             Logger
+	tags               map[string]map[string]struct{}
+	keyTags            map[string][]string
+	bloom              atomic.Pointer[bloomFilter]
+	bloomSize          int
+	bloomRate          float64
+	flightMu           sync.Mutex
+	flights            map[string]*flight
+	maxItems           int
+	evictor            evictor
+	pinned             map[string]*pinEntry
+	prioritized        map[string]struct{}
+	stats              *stats
+	removeLazyOnError  bool
+	lazyErrorTTL       time.Duration
+	compressThreshold  int
+	codec              Codec
+	version            uint64
+	syncDir            bool
+	eagerCleanup       bool
+	reloader           *fileReloader
+	closeOnce          sync.Once
+	clock              Clock
+	cloner             func(interface{}) interface{}
+	immutable          bool
+	copyBytes          bool
+	maxTagsPerItem     int
+	maxTags            int
+	disk               *diskTier
+	sortByExpiration   bool
+	sweepChunk         int
+	name               string
+	keepTTLFallback    bool
+	goroutines         *goroutines
+	tombstones         map[string]int64
+	tombstoneRetention time.Duration
+	strictTombstones   bool
+	chainSkipErrors    bool
+	reaper             *Reaper
+	coalesceInterval   time.Duration
+	coalescer          *coalescer
+	decodeFallback     DecodeFallback
+	hitRate            *rollingCounter
+	valueCodec         ValueCodec
+	watermarks         *watermarks
+	batcher            *evictionBatcher
+	expirations        *expirationStream
+	scans              scanner
+	janitor            *Janitor
+	mayExpire          atomic.Bool
+	shardCount         *uint32
+	sizer              func(string, interface{}) int64
+	reportSize         func(int64)
+	accounted          int64
+	watchers           *keyWatchers
+	droppedKeyEvents   uint64
 }
 
 // Add an item to the cache, replacing any existing item. If the duration is 0
@@ -58,30 +137,120 @@ func (c *cache) Set(k string, x interface{}, d time.Duration) {
 		d = c.defaultExpiration
 	}
 	if d > 0 {
-		e = time.Now().Add(d).UnixNano()
+		e = c.now().Add(d).UnixNano()
 	}
+	if c.coalescer != nil && c.tombstones == nil && !isLazy(x) && c.coalescer.put(k, x, e) {
+		return
+	}
+	x = c.compress(x)
 	c.mu.Lock()
-	c.items[k] = Item{
+	if c.tombstones != nil {
+		if c.tombstoneRejects(k, 0) {
+			c.mu.Unlock()
+			return
+		}
+		delete(c.tombstones, k)
+	}
+	if c.coalescer != nil {
+		// x wasn't buffered, e.g. as it's lazy, so a buffered write is
+		// older.
+		c.coalescer.remove(k)
+	}
+	old, live := c.liveItem(k)
+	if c.keyTags != nil {
+		c.untag(k)
+	}
+	evictedItems := c.overwrite(k)
+	if c.evictor != nil {
+		evictedItems = append(evictedItems, c.makeRoom(k)...)
+	}
+	item := Item{
 		Object:     x,
 		Expiration: e,
 	}
+	c.noteExpiration(e)
+	if c.stats != nil {
+		c.stats.ttls.observe(d)
+		item.Created = c.now().UnixNano()
+	}
+	item.version = c.nextVersion()
+	c.account(k, &item)
+	c.countNew(k)
+	c.items[k] = item
+	c.pinStored(k)
+	c.bloomAdd(k)
+	evictedItems = c.noteSet(evictedItems, k, old, live, x)
 	// TODO: Calls to mu.Unlock are currently not deferred because defer
 	// adds ~200 ns (as of go1.)
 	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
 }
 
-func (c *cache) set(k string, x interface{}, d time.Duration) {
+// Records that the cache holds an item that expires at e, if e is set, so that
+// a sharded cache's janitor doesn't skip it. c.mu must be held.
+func (c *cache) noteExpiration(e int64) {
+	if e > 0 && !c.mayExpire.Load() {
+		c.mayExpire.Store(true)
+	}
+}
+
+// Like Set, but c.mu must be held. The OnEvicted callbacks for any items
+// evicted to make room for k, and the watchers' event for setting it, must be
+// run, using notifyEvicted, once c.mu has been released.
+func (c *cache) set(k string, x interface{}, d time.Duration) []keyAndValue {
 	var e int64
 	if d == DefaultExpiration {
 		d = c.defaultExpiration
 	}
 	if d > 0 {
-		e = time.Now().Add(d).UnixNano()
+		e = c.now().Add(d).UnixNano()
 	}
-	c.items[k] = Item{
-		Object:     x,
+	return c.setExpiring(k, x, e, d)
+}
+
+// Like set, but takes the expiration time e, in Unix nanoseconds (0 if the
+// item never expires), and the duration d it was computed from, for stats.
+func (c *cache) setExpiring(k string, x interface{}, e int64, d time.Duration) []keyAndValue {
+	if c.coalescer != nil {
+		// The buffered write is older, and would otherwise be stored over
+		// x later.
+		c.coalescer.remove(k)
+	}
+	return c.store(k, x, e, d)
+}
+
+// Like setExpiring, but leaves any buffered write to k alone.
+func (c *cache) store(k string, x interface{}, e int64, d time.Duration) []keyAndValue {
+	if c.tombstones != nil {
+		if c.tombstoneRejects(k, 0) {
+			return nil
+		}
+		delete(c.tombstones, k)
+	}
+	old, live := c.liveItem(k)
+	if c.keyTags != nil {
+		c.untag(k)
+	}
+	evictedItems := c.overwrite(k)
+	if c.evictor != nil {
+		evictedItems = append(evictedItems, c.makeRoom(k)...)
+	}
+	item := Item{
+		Object:     c.compress(x),
 		Expiration: e,
 	}
+	c.noteExpiration(e)
+	if c.stats != nil {
+		c.stats.ttls.observe(d)
+		item.Created = c.now().UnixNano()
+	}
+	item.version = c.nextVersion()
+	c.account(k, &item)
+	c.countNew(k)
+	c.items[k] = item
+	c.pinStored(k)
+	c.bloomAdd(k)
+	return c.noteSet(evictedItems, k, old, live, item.Object)
 }
 
 // Add an item to the cache, replacing any existing item, using the default
@@ -91,51 +260,121 @@ func (c *cache) SetDefault(k string, x interface{}) {
 }
 
 // Add an item to the cache only if an item doesn't already exist for the given
-// key, or if the existing item has expired. Returns an error otherwise.
+// key, or if the existing item has expired. Returns a *CacheError wrapping
+// ErrItemExists otherwise.
 func (c *cache) Add(k string, x interface{}, d time.Duration) error {
+	c.flushPending(k)
+	x = c.compress(x)
 	c.mu.Lock()
+	if c.tombstones != nil && c.tombstoneRejects(k, 0) {
+		c.mu.Unlock()
+		return keyError("Add", k, ErrTombstoned, "Item %s was deleted too recently")
+	}
 	_, found := c.get(k)
 	if found {
 		c.mu.Unlock()
-		return fmt.Errorf("Item %s already exists", k)
+		return keyError("Add", k, ErrItemExists, "Item %s already exists")
 	}
-	c.set(k, x, d)
+	evictedItems := c.set(k, x, d)
 	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
 	return nil
 }
 
 // Set a new value for the cache key only if it already exists, and the existing
 // item hasn't expired. Returns an error otherwise.
 func (c *cache) Replace(k string, x interface{}, d time.Duration) error {
+	c.flushPending(k)
+	x = c.compress(x)
 	c.mu.Lock()
+	if c.tombstoned(k) {
+		c.mu.Unlock()
+		return keyError("Replace", k, ErrTombstoned, "Item %s was deleted too recently")
+	}
 	_, found := c.get(k)
 	if !found {
 		c.mu.Unlock()
-		return fmt.Errorf("Item %s doesn't exist", k)
+		return keyError("Replace", k, ErrKeyNotFound, "Item %s doesn't exist")
 	}
-	c.set(k, x, d)
+	evictedItems := c.set(k, x, d)
 	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
 	return nil
 }
 
+// SetIfNewer sets an item like Set, recording ts as its timestamp, only if no
+// unexpired item exists for the given key or ts is after the existing item's
+// timestamp. Returns whether the item was set. Items set other than with
+// SetIfNewer have no timestamp, and are always replaced. See also
+// WithDeleteTombstones.
+func (c *cache) SetIfNewer(k string, x interface{}, ts time.Time, d time.Duration) bool {
+	x = c.compress(x)
+	c.mu.Lock()
+	if c.tombstones != nil && c.tombstoneRejects(k, ts.UnixNano()) {
+		c.mu.Unlock()
+		return false
+	}
+	ov, found := c.items[k]
+	if found && !c.expired(ov) && ts.UnixNano() <= ov.Timestamp {
+		c.mu.Unlock()
+		return false
+	}
+	if c.tombstones != nil {
+		// ts is after the deletion, so the write is allowed even if the
+		// tombstones are strict.
+		delete(c.tombstones, k)
+	}
+	evictedItems := c.set(k, x, d)
+	item := c.items[k]
+	item.Timestamp = ts.UnixNano()
+	c.items[k] = item
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+	return true
+}
+
 // Get an item from the cache. Returns the item or nil, and a bool indicating
 // whether the key was found.
 func (c *cache) Get(k string) (interface{}, bool) {
+	x, found := c.lookup(k)
+	c.recordLookup(found)
+	return x, found
+}
+
+func (c *cache) lookup(k string) (interface{}, bool) {
+	// Buffered writes aren't in the Bloom filter, so they are looked up
+	// first.
+	if c.coalescer != nil {
+		if p, found := c.getPending(k); found {
+			return c.value(k, p.x)
+		}
+	}
+	if f := c.bloom.Load(); f != nil && c.disk == nil && !f.mayContain(k) {
+		return nil, false
+	}
 	c.mu.RLock()
 	// "Inlining" of get and Expired
 	item, found := c.items[k]
 	if !found {
 		c.mu.RUnlock()
+		if c.disk != nil {
+			if item, found = c.getFromDisk(k); found {
+				return c.value(k, item.Object)
+			}
+		}
 		return nil, false
 	}
 	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
+		if c.now().UnixNano() > item.Expiration {
 			c.mu.RUnlock()
 			return nil, false
 		}
 	}
+	if c.evictor != nil {
+		c.evictor.Access(k)
+	}
 	c.mu.RUnlock()
-	return item.Object, true
+	return c.value(k, item.Object)
 }
 
 // GetWithExpiration returns an item and its expiration time from the cache.
@@ -143,29 +382,90 @@ func (c *cache) Get(k string) (interface{}, bool) {
 // never expires a zero value for time.Time is returned), and a bool indicating
 // whether the key was found.
 func (c *cache) GetWithExpiration(k string) (interface{}, time.Time, bool) {
+	x, t, found := c.lookupWithExpiration(k)
+	c.recordLookup(found)
+	return x, t, found
+}
+
+func (c *cache) lookupWithExpiration(k string) (interface{}, time.Time, bool) {
+	x, item, found := c.lookupItem(k)
+	if !found || item.Expiration <= 0 {
+		return x, time.Time{}, found
+	}
+	return x, time.Unix(0, item.Expiration), true
+}
+
+// Like lookupWithExpiration, but returns the item the value was read from. A
+// buffered write is returned as an item with only its expiration time set.
+func (c *cache) lookupItem(k string) (interface{}, Item, bool) {
+	if c.coalescer != nil {
+		if p, found := c.getPending(k); found {
+			x, found := c.value(k, p.x)
+			return x, Item{Expiration: p.e}, found
+		}
+	}
 	c.mu.RLock()
 	// "Inlining" of get and Expired
 	item, found := c.items[k]
+	c.mu.RUnlock()
 	if !found {
-		c.mu.RUnlock()
-		return nil, time.Time{}, false
+		if c.disk == nil {
+			return nil, Item{}, false
+		}
+		if item, found = c.getFromDisk(k); !found {
+			return nil, Item{}, false
+		}
+	}
+	if item.Expiration > 0 && c.now().UnixNano() > item.Expiration {
+		return nil, Item{}, false
+	}
+	x, found := c.value(k, item.Object)
+	if !found {
+		return nil, Item{}, false
 	}
+	return x, item, true
+}
 
-	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
-			c.mu.RUnlock()
-			return nil, time.Time{}, false
-		}
+// A Result is the outcome of looking up one key. See GetOrdered.
+type Result struct {
+	Value interface{}
+	Found bool
+}
 
-		// Return the item and the expiration time
-		c.mu.RUnlock()
-		return item.Object, time.Unix(0, item.Expiration), true
+// GetOrdered gets the items with the given keys from the cache. The returned
+// slice has one Result per key, in the same order as keys, so that it can be
+// used directly where the order matters, e.g. when rendering a list. The
+// items are read while holding the cache's read lock once, rather than once
+// per key.
+func (c *cache) GetOrdered(keys []string) []Result {
+	res := make([]Result, len(keys))
+	objs := make([]interface{}, len(keys))
+	now := c.now().UnixNano()
+	c.mu.RLock()
+	for i, k := range keys {
+		item, found := c.items[k]
+		if !found || (item.Expiration > 0 && now > item.Expiration) {
+			continue
+		}
+		if c.evictor != nil {
+			c.evictor.Access(k)
+		}
+		objs[i] = item.Object
+		res[i].Found = true
 	}
-
-	// If expiration <= 0 (i.e. no expiration time set) then return the item
-	// and a zeroed time.Time
 	c.mu.RUnlock()
-	return item.Object, time.Time{}, true
+	for i, k := range keys {
+		if !res[i].Found {
+			if c.disk != nil {
+				if item, found := c.getFromDisk(k); found {
+					res[i].Value, res[i].Found = c.value(k, item.Object)
+				}
+			}
+			continue
+		}
+		res[i].Value, res[i].Found = c.value(k, objs[i])
+	}
+	return res
 }
 
 func (c *cache) get(k string) (interface{}, bool) {
@@ -175,7 +475,7 @@ func (c *cache) get(k string) (interface{}, bool) {
 	}
 	// "Inlining" of Expired
 	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
+		if c.now().UnixNano() > item.Expiration {
 			return nil, false
 		}
 	}
@@ -188,46 +488,76 @@ func (c *cache) get(k string) (interface{}, bool) {
 // possible to increment it by n. To retrieve the incremented value, use one
 // of the specialized methods, e.g. IncrementInt64.
 func (c *cache) Increment(k string, n int64) error {
+	_, err := c.increment(k, n)
+	return err
+}
+
+// IncrementReturn increments an item like Increment, and returns its new value
+// converted to an int64, which truncates floating point values and wraps
+// unsigned ones that are too large. The value is read while the item is
+// locked, so unlike a Get after Increment, it can't include other increments.
+func (c *cache) IncrementReturn(k string, n int64) (int64, error) {
+	return c.increment(k, n)
+}
+
+func (c *cache) increment(k string, n int64) (int64, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return fmt.Errorf("Item %s not found", k)
+		return 0, keyError("Increment", k, ErrKeyNotFound, "Item %s not found")
 	}
-	switch v.Object.(type) {
+	var nv int64
+	switch x := v.Object.(type) {
 	case int:
-		v.Object = v.Object.(int) + int(n)
+		x += int(n)
+		v.Object, nv = x, int64(x)
 	case int8:
-		v.Object = v.Object.(int8) + int8(n)
+		x += int8(n)
+		v.Object, nv = x, int64(x)
 	case int16:
-		v.Object = v.Object.(int16) + int16(n)
+		x += int16(n)
+		v.Object, nv = x, int64(x)
 	case int32:
-		v.Object = v.Object.(int32) + int32(n)
+		x += int32(n)
+		v.Object, nv = x, int64(x)
 	case int64:
-		v.Object = v.Object.(int64) + n
+		x += n
+		v.Object, nv = x, x
 	case uint:
-		v.Object = v.Object.(uint) + uint(n)
+		x += uint(n)
+		v.Object, nv = x, int64(x)
 	case uintptr:
-		v.Object = v.Object.(uintptr) + uintptr(n)
+		x += uintptr(n)
+		v.Object, nv = x, int64(x)
 	case uint8:
-		v.Object = v.Object.(uint8) + uint8(n)
+		x += uint8(n)
+		v.Object, nv = x, int64(x)
 	case uint16:
-		v.Object = v.Object.(uint16) + uint16(n)
+		x += uint16(n)
+		v.Object, nv = x, int64(x)
 	case uint32:
-		v.Object = v.Object.(uint32) + uint32(n)
+		x += uint32(n)
+		v.Object, nv = x, int64(x)
 	case uint64:
-		v.Object = v.Object.(uint64) + uint64(n)
+		x += uint64(n)
+		v.Object, nv = x, int64(x)
 	case float32:
-		v.Object = v.Object.(float32) + float32(n)
+		x += float32(n)
+		v.Object, nv = x, int64(x)
 	case float64:
-		v.Object = v.Object.(float64) + float64(n)
+		x += float64(n)
+		v.Object, nv = x, int64(x)
 	default:
 		c.mu.Unlock()
-		return fmt.Errorf("The value for %s is not an integer", k)
+		return 0, keyError("Increment", k, ErrWrongType, "The value for %s is not an integer")
 	}
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
-	return nil
+	return nv, nil
 }
 
 // Increment an item of type float32 or float64 by n. Returns an error if the
@@ -236,11 +566,12 @@ func (c *cache) Increment(k string, n int64) error {
 // value. To retrieve the incremented value, use one of the specialized methods,
 // e.g. IncrementFloat64.
 func (c *cache) IncrementFloat(k string, n float64) error {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return fmt.Errorf("Item %s not found", k)
+		return keyError("IncrementFloat", k, ErrKeyNotFound, "Item %s not found")
 	}
 	switch v.Object.(type) {
 	case float32:
@@ -249,8 +580,10 @@ func (c *cache) IncrementFloat(k string, n float64) error {
 		v.Object = v.Object.(float64) + n
 	default:
 		c.mu.Unlock()
-		return fmt.Errorf("The value for %s does not have type float32 or float64", k)
+		return keyError("IncrementFloat", k, ErrWrongType, "The value for %s does not have type float32 or float64")
 	}
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nil
@@ -260,19 +593,22 @@ func (c *cache) IncrementFloat(k string, n float64) error {
 // not an int, or if it was not found. If there is no error, the incremented
 // value is returned.
 func (c *cache) IncrementInt(k string, n int) (int, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("IncrementInt", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(int)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int", k)
+		return 0, keyError("IncrementInt", k, ErrWrongType, "The value for %s is not an int")
 	}
 	nv := rv + n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -282,19 +618,22 @@ func (c *cache) IncrementInt(k string, n int) (int, error) {
 // not an int8, or if it was not found. If there is no error, the incremented
 // value is returned.
 func (c *cache) IncrementInt8(k string, n int8) (int8, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("IncrementInt8", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(int8)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int8", k)
+		return 0, keyError("IncrementInt8", k, ErrWrongType, "The value for %s is not an int8")
 	}
 	nv := rv + n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -304,19 +643,22 @@ func (c *cache) IncrementInt8(k string, n int8) (int8, error) {
 // not an int16, or if it was not found. If there is no error, the incremented
 // value is returned.
 func (c *cache) IncrementInt16(k string, n int16) (int16, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("IncrementInt16", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(int16)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int16", k)
+		return 0, keyError("IncrementInt16", k, ErrWrongType, "The value for %s is not an int16")
 	}
 	nv := rv + n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -326,19 +668,22 @@ func (c *cache) IncrementInt16(k string, n int16) (int16, error) {
 // not an int32, or if it was not found. If there is no error, the incremented
 // value is returned.
 func (c *cache) IncrementInt32(k string, n int32) (int32, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("IncrementInt32", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(int32)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int32", k)
+		return 0, keyError("IncrementInt32", k, ErrWrongType, "The value for %s is not an int32")
 	}
 	nv := rv + n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -348,19 +693,22 @@ func (c *cache) IncrementInt32(k string, n int32) (int32, error) {
 // not an int64, or if it was not found. If there is no error, the incremented
 // value is returned.
 func (c *cache) IncrementInt64(k string, n int64) (int64, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("IncrementInt64", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(int64)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int64", k)
+		return 0, keyError("IncrementInt64", k, ErrWrongType, "The value for %s is not an int64")
 	}
 	nv := rv + n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -370,19 +718,22 @@ func (c *cache) IncrementInt64(k string, n int64) (int64, error) {
 // not an uint, or if it was not found. If there is no error, the incremented
 // value is returned.
 func (c *cache) IncrementUint(k string, n uint) (uint, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("IncrementUint", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(uint)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint", k)
+		return 0, keyError("IncrementUint", k, ErrWrongType, "The value for %s is not an uint")
 	}
 	nv := rv + n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -392,19 +743,22 @@ func (c *cache) IncrementUint(k string, n uint) (uint, error) {
 // is not an uintptr, or if it was not found. If there is no error, the
 // incremented value is returned.
 func (c *cache) IncrementUintptr(k string, n uintptr) (uintptr, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("IncrementUintptr", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(uintptr)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uintptr", k)
+		return 0, keyError("IncrementUintptr", k, ErrWrongType, "The value for %s is not an uintptr")
 	}
 	nv := rv + n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -414,19 +768,22 @@ func (c *cache) IncrementUintptr(k string, n uintptr) (uintptr, error) {
 // is not an uint8, or if it was not found. If there is no error, the
 // incremented value is returned.
 func (c *cache) IncrementUint8(k string, n uint8) (uint8, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("IncrementUint8", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(uint8)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint8", k)
+		return 0, keyError("IncrementUint8", k, ErrWrongType, "The value for %s is not an uint8")
 	}
 	nv := rv + n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -436,19 +793,22 @@ func (c *cache) IncrementUint8(k string, n uint8) (uint8, error) {
 // is not an uint16, or if it was not found. If there is no error, the
 // incremented value is returned.
 func (c *cache) IncrementUint16(k string, n uint16) (uint16, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("IncrementUint16", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(uint16)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint16", k)
+		return 0, keyError("IncrementUint16", k, ErrWrongType, "The value for %s is not an uint16")
 	}
 	nv := rv + n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -458,19 +818,22 @@ func (c *cache) IncrementUint16(k string, n uint16) (uint16, error) {
 // is not an uint32, or if it was not found. If there is no error, the
 // incremented value is returned.
 func (c *cache) IncrementUint32(k string, n uint32) (uint32, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("IncrementUint32", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(uint32)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint32", k)
+		return 0, keyError("IncrementUint32", k, ErrWrongType, "The value for %s is not an uint32")
 	}
 	nv := rv + n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -480,19 +843,22 @@ func (c *cache) IncrementUint32(k string, n uint32) (uint32, error) {
 // is not an uint64, or if it was not found. If there is no error, the
 // incremented value is returned.
 func (c *cache) IncrementUint64(k string, n uint64) (uint64, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("IncrementUint64", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(uint64)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint64", k)
+		return 0, keyError("IncrementUint64", k, ErrWrongType, "The value for %s is not an uint64")
 	}
 	nv := rv + n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -502,19 +868,22 @@ func (c *cache) IncrementUint64(k string, n uint64) (uint64, error) {
 // is not an float32, or if it was not found. If there is no error, the
 // incremented value is returned.
 func (c *cache) IncrementFloat32(k string, n float32) (float32, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("IncrementFloat32", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(float32)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an float32", k)
+		return 0, keyError("IncrementFloat32", k, ErrWrongType, "The value for %s is not an float32")
 	}
 	nv := rv + n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -524,19 +893,22 @@ func (c *cache) IncrementFloat32(k string, n float32) (float32, error) {
 // is not an float64, or if it was not found. If there is no error, the
 // incremented value is returned.
 func (c *cache) IncrementFloat64(k string, n float64) (float64, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("IncrementFloat64", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(float64)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an float64", k)
+		return 0, keyError("IncrementFloat64", k, ErrWrongType, "The value for %s is not an float64")
 	}
 	nv := rv + n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -550,11 +922,12 @@ func (c *cache) IncrementFloat64(k string, n float64) (float64, error) {
 func (c *cache) Decrement(k string, n int64) error {
 	// TODO: Implement Increment and Decrement more cleanly.
 	// (Cannot do Increment(k, n*-1) for uints.)
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return fmt.Errorf("Item not found")
+		return keyError("Decrement", k, ErrKeyNotFound, "Item %s not found")
 	}
 	switch v.Object.(type) {
 	case int:
@@ -585,8 +958,10 @@ func (c *cache) Decrement(k string, n int64) error {
 		v.Object = v.Object.(float64) - float64(n)
 	default:
 		c.mu.Unlock()
-		return fmt.Errorf("The value for %s is not an integer", k)
+		return keyError("Decrement", k, ErrWrongType, "The value for %s is not an integer")
 	}
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nil
@@ -598,11 +973,12 @@ func (c *cache) Decrement(k string, n int64) error {
 // value. To retrieve the decremented value, use one of the specialized methods,
 // e.g. DecrementFloat64.
 func (c *cache) DecrementFloat(k string, n float64) error {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return fmt.Errorf("Item %s not found", k)
+		return keyError("DecrementFloat", k, ErrKeyNotFound, "Item %s not found")
 	}
 	switch v.Object.(type) {
 	case float32:
@@ -611,8 +987,10 @@ func (c *cache) DecrementFloat(k string, n float64) error {
 		v.Object = v.Object.(float64) - n
 	default:
 		c.mu.Unlock()
-		return fmt.Errorf("The value for %s does not have type float32 or float64", k)
+		return keyError("DecrementFloat", k, ErrWrongType, "The value for %s does not have type float32 or float64")
 	}
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nil
@@ -622,19 +1000,22 @@ func (c *cache) DecrementFloat(k string, n float64) error {
 // not an int, or if it was not found. If there is no error, the decremented
 // value is returned.
 func (c *cache) DecrementInt(k string, n int) (int, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("DecrementInt", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(int)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int", k)
+		return 0, keyError("DecrementInt", k, ErrWrongType, "The value for %s is not an int")
 	}
 	nv := rv - n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -644,19 +1025,22 @@ func (c *cache) DecrementInt(k string, n int) (int, error) {
 // not an int8, or if it was not found. If there is no error, the decremented
 // value is returned.
 func (c *cache) DecrementInt8(k string, n int8) (int8, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("DecrementInt8", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(int8)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int8", k)
+		return 0, keyError("DecrementInt8", k, ErrWrongType, "The value for %s is not an int8")
 	}
 	nv := rv - n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -666,19 +1050,22 @@ func (c *cache) DecrementInt8(k string, n int8) (int8, error) {
 // not an int16, or if it was not found. If there is no error, the decremented
 // value is returned.
 func (c *cache) DecrementInt16(k string, n int16) (int16, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("DecrementInt16", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(int16)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int16", k)
+		return 0, keyError("DecrementInt16", k, ErrWrongType, "The value for %s is not an int16")
 	}
 	nv := rv - n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -688,19 +1075,22 @@ func (c *cache) DecrementInt16(k string, n int16) (int16, error) {
 // not an int32, or if it was not found. If there is no error, the decremented
 // value is returned.
 func (c *cache) DecrementInt32(k string, n int32) (int32, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("DecrementInt32", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(int32)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int32", k)
+		return 0, keyError("DecrementInt32", k, ErrWrongType, "The value for %s is not an int32")
 	}
 	nv := rv - n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -710,19 +1100,22 @@ func (c *cache) DecrementInt32(k string, n int32) (int32, error) {
 // not an int64, or if it was not found. If there is no error, the decremented
 // value is returned.
 func (c *cache) DecrementInt64(k string, n int64) (int64, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("DecrementInt64", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(int64)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an int64", k)
+		return 0, keyError("DecrementInt64", k, ErrWrongType, "The value for %s is not an int64")
 	}
 	nv := rv - n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -732,19 +1125,22 @@ func (c *cache) DecrementInt64(k string, n int64) (int64, error) {
 // not an uint, or if it was not found. If there is no error, the decremented
 // value is returned.
 func (c *cache) DecrementUint(k string, n uint) (uint, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("DecrementUint", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(uint)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint", k)
+		return 0, keyError("DecrementUint", k, ErrWrongType, "The value for %s is not an uint")
 	}
 	nv := rv - n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -754,19 +1150,22 @@ func (c *cache) DecrementUint(k string, n uint) (uint, error) {
 // is not an uintptr, or if it was not found. If there is no error, the
 // decremented value is returned.
 func (c *cache) DecrementUintptr(k string, n uintptr) (uintptr, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("DecrementUintptr", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(uintptr)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uintptr", k)
+		return 0, keyError("DecrementUintptr", k, ErrWrongType, "The value for %s is not an uintptr")
 	}
 	nv := rv - n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -776,19 +1175,22 @@ func (c *cache) DecrementUintptr(k string, n uintptr) (uintptr, error) {
 // not an uint8, or if it was not found. If there is no error, the decremented
 // value is returned.
 func (c *cache) DecrementUint8(k string, n uint8) (uint8, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("DecrementUint8", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(uint8)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint8", k)
+		return 0, keyError("DecrementUint8", k, ErrWrongType, "The value for %s is not an uint8")
 	}
 	nv := rv - n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -798,19 +1200,22 @@ func (c *cache) DecrementUint8(k string, n uint8) (uint8, error) {
 // is not an uint16, or if it was not found. If there is no error, the
 // decremented value is returned.
 func (c *cache) DecrementUint16(k string, n uint16) (uint16, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("DecrementUint16", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(uint16)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint16", k)
+		return 0, keyError("DecrementUint16", k, ErrWrongType, "The value for %s is not an uint16")
 	}
 	nv := rv - n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -820,19 +1225,22 @@ func (c *cache) DecrementUint16(k string, n uint16) (uint16, error) {
 // is not an uint32, or if it was not found. If there is no error, the
 // decremented value is returned.
 func (c *cache) DecrementUint32(k string, n uint32) (uint32, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("DecrementUint32", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(uint32)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint32", k)
+		return 0, keyError("DecrementUint32", k, ErrWrongType, "The value for %s is not an uint32")
 	}
 	nv := rv - n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -842,19 +1250,22 @@ func (c *cache) DecrementUint32(k string, n uint32) (uint32, error) {
 // is not an uint64, or if it was not found. If there is no error, the
 // decremented value is returned.
 func (c *cache) DecrementUint64(k string, n uint64) (uint64, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("DecrementUint64", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(uint64)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an uint64", k)
+		return 0, keyError("DecrementUint64", k, ErrWrongType, "The value for %s is not an uint64")
 	}
 	nv := rv - n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -864,19 +1275,22 @@ func (c *cache) DecrementUint64(k string, n uint64) (uint64, error) {
 // is not an float32, or if it was not found. If there is no error, the
 // decremented value is returned.
 func (c *cache) DecrementFloat32(k string, n float32) (float32, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("DecrementFloat32", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(float32)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an float32", k)
+		return 0, keyError("DecrementFloat32", k, ErrWrongType, "The value for %s is not an float32")
 	}
 	nv := rv - n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -886,19 +1300,22 @@ func (c *cache) DecrementFloat32(k string, n float32) (float32, error) {
 // is not an float64, or if it was not found. If there is no error, the
 // decremented value is returned.
 func (c *cache) DecrementFloat64(k string, n float64) (float64, error) {
+	c.flushPending(k)
 	c.mu.Lock()
 	v, found := c.items[k]
-	if !found || v.Expired() {
+	if !found || c.expired(v) {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, keyError("DecrementFloat64", k, ErrKeyNotFound, "Item %s not found")
 	}
 	rv, ok := v.Object.(float64)
 	if !ok {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("The value for %s is not an float64", k)
+		return 0, keyError("DecrementFloat64", k, ErrWrongType, "The value for %s is not an float64")
 	}
 	nv := rv - n
 	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
 	c.items[k] = v
 	c.mu.Unlock()
 	return nv, nil
@@ -906,19 +1323,138 @@ func (c *cache) DecrementFloat64(k string, n float64) (float64, error) {
 
 // Delete an item from the cache. Does nothing if the key is not in the cache.
 func (c *cache) Delete(k string) {
+	c.remove(k, false)
+}
+
+// DeleteAndGet deletes an item from the cache and returns the value it held,
+// and whether it was found. The item is removed and its value read under the
+// same lock, so the value returned is exactly the one removed, and the one
+// passed to OnEvicted with EvictionReasonDeleted, even if another goroutine
+// sets the key at the same time. If the item had expired, it is removed as
+// such and (nil, false) is returned.
+func (c *cache) DeleteAndGet(k string) (interface{}, bool) {
+	x, live, _ := c.remove(k, true)
+	return x, live
+}
+
+// Removes the item stored for k, reporting whether there was one, expired or
+// not. If get is true, also returns the removed value and whether it hadn't
+// expired.
+func (c *cache) remove(k string, get bool) (interface{}, bool, bool) {
+	if c.coalescer != nil {
+		c.coalescer.remove(k)
+	}
 	c.mu.Lock()
+	item, found := c.items[k]
+	reason := EvictionReasonDeleted
+	live := found
+	if found && c.expired(item) {
+		reason = EvictionReasonExpired
+		live = false
+	}
 	v, evicted := c.delete(k)
+	if c.tombstones != nil {
+		c.addTombstone(k)
+	}
+	var spilled []keyAndValue
+	if c.disk != nil {
+		if get && !found {
+			var onDisk bool
+			if item, onDisk = c.disk.read(k); onDisk {
+				live = !c.expired(item)
+			}
+		}
+		var onDisk bool
+		spilled, onDisk = c.dropSpilled(k, EvictionReasonDeleted)
+		found = found || onDisk
+	}
 	c.mu.Unlock()
 	if evicted {
-		c.onEvicted(k, v)
+		spilled = append(spilled, keyAndValue{k, v, reason})
+	}
+	c.notifyEvicted(spilled)
+	if !get || !live {
+		return nil, false, found
+	}
+	return c.removedValue(item.Object), true, found
+}
+
+// Returns the value passed to OnEvicted, and returned by DeleteAndGet, for a
+// removed item whose stored value is x.
+func (c *cache) removedValue(x interface{}) interface{} {
+	if isLazy(x) {
+		// The value was never computed.
+		return nil
+	}
+	if v, err := c.decompress(x); err == nil {
+		return c.cloneRemoved(v)
+	}
+	return x
+}
+
+// Returns the OnEvicted notification owed for the item stored for k, which is
+// about to be overwritten, if it has expired: the new item is then a different
+// entry rather than an update, and the expired one is never notified
+// otherwise. Removes any copy of k from the disk tier. c.mu must be held.
+func (c *cache) overwrite(k string) []keyAndValue {
+	if !c.notifying() && c.disk == nil {
+		return nil
+	}
+	var evictedItems []keyAndValue
+	if old, found := c.items[k]; found && c.notifying() && c.expired(old) {
+		evictedItems = append(evictedItems, keyAndValue{k, old.Object, EvictionReasonExpired})
+	}
+	if c.disk != nil {
+		if exp, found := c.disk.index[k]; found && exp > 0 && c.now().UnixNano() > exp {
+			kv, _ := c.dropSpilled(k, EvictionReasonExpired)
+			evictedItems = append(evictedItems, kv...)
+		} else {
+			c.disk.remove(k)
+		}
+	}
+	return evictedItems
+}
+
+// Counts k towards the ItemCount of the sharded cache c is a shard of, if any,
+// unless it's already in c. c.mu must be held.
+func (c *cache) countNew(k string) {
+	if c.shardCount == nil {
+		return
+	}
+	if _, found := c.items[k]; !found {
+		atomic.AddUint32(c.shardCount, 1)
+	}
+}
+
+// Subtracts the n items being removed from c from the ItemCount of the sharded
+// cache c is a shard of, if any. c.mu must be held.
+func (c *cache) uncount(n int) {
+	if c.shardCount != nil && n > 0 {
+		atomic.AddUint32(c.shardCount, ^uint32(n-1))
 	}
 }
 
 func (c *cache) delete(k string) (interface{}, bool) {
-	if c.onEvicted != nil {
+	if c.shardCount != nil {
+		if _, found := c.items[k]; found {
+			c.uncount(1)
+		}
+	}
+	if c.keyTags != nil {
+		c.untag(k)
+	}
+	c.bloomRemove()
+	if c.evictor != nil {
+		c.evictor.Remove(k)
+	}
+	if c.notifying() || c.stats != nil || c.sizer != nil {
 		if v, found := c.items[k]; found {
 			delete(c.items, k)
-			return v.Object, true
+			c.unaccount(v.size)
+			if c.stats != nil {
+				c.stats.removed(v, c.now().UnixNano())
+			}
+			return v.Object, c.notifying()
 		}
 	}
 	delete(c.items, k)
@@ -926,102 +1462,247 @@ func (c *cache) delete(k string) (interface{}, bool) {
 }
 
 type keyAndValue struct {
-	key   string
-	value interface{}
+	key    string
+	value  interface{}
+	reason EvictionReason
 }
 
 // Delete all expired items from the cache.
 func (c *cache) DeleteExpired() uint32 {
-	var evictedItems []keyAndValue
-	now := time.Now().UnixNano()
+	n, _ := c.deleteExpired(false)
+	return n
+}
+
+// A KV is a key and the value of the item it was associated with.
+type KV struct {
+	Key   string
+	Value interface{}
+}
+
+// DeleteExpiredReturn deletes all expired items from the cache like
+// DeleteExpired, and returns their keys and values. Items set using SetLazy
+// whose values were never computed are returned with a nil Value.
+//
+// The returned slice holds every expired item, so with a large cache this can
+// allocate a lot; DeleteExpired, which only counts the items, should be
+// preferred unless the values are needed.
+func (c *cache) DeleteExpiredReturn() []KV {
+	_, kvs := c.deleteExpired(true)
+	return kvs
+}
+
+func (c *cache) deleteExpired(collect bool) (uint32, []KV) {
+	var (
+		evictedItems []keyAndValue
+		kvs          []KV
+	)
+	now := c.now().UnixNano()
+	if c.sweepChunk > 0 {
+		return c.deleteExpiredChunked(now, collect)
+	}
 	c.mu.Lock()
+	stream := c.expirations
+	collect = collect || stream != nil
 	var deletedCount uint32 = 0
+	expiring := false
 	for k, v := range c.items {
 		// "Inlining" of expired
-		if v.Expiration > 0 && now > v.Expiration {
+		if v.Expiration > 0 && now <= v.Expiration {
+			expiring = true
+		} else if v.Expiration > 0 {
 			atomic.AddUint32(&deletedCount, 1)
+			if collect {
+				kvs = append(kvs, KV{k, v.Object})
+			}
 			ov, evicted := c.delete(k)
 			if evicted {
-				evictedItems = append(evictedItems, keyAndValue{k, ov})
+				evictedItems = append(evictedItems, keyAndValue{k, ov, EvictionReasonExpired})
 			}
 		}
 	}
+	if c.disk != nil {
+		evictedItems = append(evictedItems, c.deleteExpiredSpilled(now)...)
+		expiring = expiring || c.disk.expiring()
+	}
+	if c.tombstones != nil {
+		expiring = c.purgeTombstones(now) || expiring
+	}
+	c.mayExpire.Store(expiring)
+	c.refreshBloom()
 	c.mu.Unlock()
-	for _, v := range evictedItems {
-		c.onEvicted(v.key, v.value)
+	c.finishExpired(evictedItems, kvs, stream)
+	return deletedCount, kvs
+}
+
+// Notifies the removal of the expired items deleted by deleteExpired, and
+// resolves the values in kvs and sends them to stream, if it isn't nil.
+func (c *cache) finishExpired(evictedItems []keyAndValue, kvs []KV, stream *expirationStream) {
+	c.notifyEvicted(evictedItems)
+	for i, kv := range kvs {
+		kvs[i].Value = c.removedValue(kv.Value)
+	}
+	if stream != nil && len(kvs) > 0 {
+		stream.send(kvs)
 	}
-	return deletedCount
 }
 
 // Sets an (optional) function that is called with the key and value when an
-// item is evicted from the cache. (Including when it is deleted manually, but
-// not when it is overwritten.) Set to nil to disable.
+// item is evicted from the cache. (Including when it is deleted manually or by
+// Flush, but not when it is overwritten, unless it had expired.) f is called
+// exactly once for every item that is removed, however it is removed. Set to
+// nil to disable. A panic in f is recovered and reported to the cache's Logger.
 func (c *cache) OnEvicted(f func(string, interface{})) {
+	if f == nil {
+		c.OnEvictedWithReason(nil)
+		return
+	}
+	c.OnEvictedWithReason(func(k string, v interface{}, _ EvictionReason) {
+		f(k, v)
+	})
+}
+
+// Like OnEvicted, but f is also passed the reason the item was removed.
+func (c *cache) OnEvictedWithReason(f func(string, interface{}, EvictionReason)) {
 	c.mu.Lock()
 	c.onEvicted = f
+	b := c.batcher
+	c.batcher = nil
 	c.mu.Unlock()
+	if b != nil {
+		b.close()
+	}
 }
 
-// Write the cache's items (using Gob) to an io.Writer.
+// Write the cache's items (using Gob) to an io.Writer, followed by a checksum
+// that Load verifies.
 //
 // NOTE: This method is deprecated in favor of c.Items() and NewFrom() (see the
 // documentation for NewFrom().)
-func (c *cache) Save(w io.Writer) (err error) {
-	enc := gob.NewEncoder(w)
+func (c *cache) Save(w io.Writer) error {
+	_, err := c.SaveFunc(w, nil)
+	return err
+}
+
+// SaveFunc writes the items for which keep returns true to w like Save, and
+// returns the number of items that were left out. keep is called without any
+// locks held, on a copy of each item taken when SaveFunc was called, so it may
+// use the cache. Expired items that haven't been cleaned up yet are passed to
+// keep too. If keep is nil, all items are written.
+//
+// Items set using SetLazy whose values haven't been computed yet can't be
+// saved, and are neither passed to keep nor counted.
+func (c *cache) SaveFunc(w io.Writer, keep func(k string, it Item) bool) (skipped int, err error) {
 	defer func() {
 		if x := recover(); x != nil {
 			err = fmt.Errorf("Error registering item types with Gob library")
 		}
 	}()
 	c.mu.RLock()
-	defer c.mu.RUnlock()
-	for _, v := range c.items {
-		gob.Register(v.Object)
+	items := make(map[string]Item, len(c.items))
+	now := c.now().UnixNano()
+	for k, v := range c.items {
+		if !isLazy(v.Object) {
+			items[k] = c.withPausedExpiration(k, v, now)
+		}
+	}
+	c.mu.RUnlock()
+	if keep != nil {
+		for k, v := range items {
+			// keep sees the value as Get would return it, while the
+			// stored form is saved.
+			it := v
+			if x, err := c.decompress(v.Object); err == nil {
+				it.Object = x
+			}
+			if !keep(k, it) {
+				delete(items, k)
+				skipped++
+			}
+		}
+	}
+	for k, v := range items {
+		if items[k], err = c.encodeValue(k, v); err != nil {
+			return
+		}
 	}
-	err = enc.Encode(&c.items)
+	err = writeSnapshot(w, items)
 	return
 }
 
 // Save the cache's items to the given filename, creating the file if it
-// doesn't exist, and overwriting it if it does.
+// doesn't exist, and overwriting it if it does. The items are written to a
+// temporary file in the same directory, which is synced and renamed over the
+// destination, so a failed or interrupted save leaves any existing file intact.
+// The existing file's permissions are kept. See WithDirSync.
 //
 // NOTE: This method is deprecated in favor of c.Items() and NewFrom() (see the
 // documentation for NewFrom().)
 func (c *cache) SaveFile(fname string) error {
-	fp, err := os.Create(fname)
-	if err != nil {
-		return err
-	}
-	err = c.Save(fp)
-	if err != nil {
-		fp.Close()
-		return err
-	}
-	return fp.Close()
+	return writeFileAtomic(fname, c.syncDir, c.Save)
 }
 
 // Add (Gob-serialized) cache items from an io.Reader, excluding any items with
-// keys that already exist (and haven't expired) in the current cache.
+// keys that already exist (and haven't expired) in the current cache. Returns
+// ErrCorruptSnapshot, without adding any items, if the snapshot is truncated or
+// its checksum doesn't match. See LoadBestEffort.
 //
 // NOTE: This method is deprecated in favor of c.Items() and NewFrom() (see the
 // documentation for NewFrom().)
 func (c *cache) Load(r io.Reader) error {
-	dec := gob.NewDecoder(r)
-	items := map[string]Item{}
-	err := dec.Decode(&items)
+	items, err := c.readSnapshot(r)
 	if err == nil {
-		c.mu.Lock()
-		defer c.mu.Unlock()
-		for k, v := range items {
-			ov, found := c.items[k]
-			if !found || ov.Expired() {
-				c.items[k] = v
-			}
-		}
+		c.loadItems(items, false)
 	}
 	return err
 }
 
+// Adds items that don't already exist (or have expired) to the cache, skipping
+// items that have expired themselves if skipExpired is set. Returns the number
+// of items added, and skipped because they exist or expired.
+func (c *cache) loadItems(items map[string]Item, skipExpired bool) (added, existing, expired int) {
+	var evictedItems []keyAndValue
+	now := c.now().UnixNano()
+	c.mu.Lock()
+	for k, v := range items {
+		if skipExpired && v.Expiration > 0 && now > v.Expiration {
+			expired++
+			continue
+		}
+		ov, found := c.items[k]
+		if found && !c.expired(ov) {
+			existing++
+			continue
+		}
+		added++
+		evictedItems = append(evictedItems, c.loadItem(k, v)...)
+	}
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+	return
+}
+
+// Stores an item read from a snapshot, replacing any existing item. c.mu must
+// be held, and the OnEvicted callbacks for the returned items must be run once
+// it has been released.
+func (c *cache) loadItem(k string, v Item) []keyAndValue {
+	if c.keyTags != nil {
+		c.untag(k)
+	}
+	evictedItems := c.overwrite(k)
+	if c.evictor != nil {
+		evictedItems = append(evictedItems, c.makeRoom(k)...)
+	}
+	v.version = c.nextVersion()
+	c.account(k, &v)
+	c.countNew(k)
+	c.items[k] = v
+	c.noteExpiration(v.Expiration)
+	c.pinStored(k)
+	c.trackPriority(k, v.Priority)
+	c.bloomAdd(k)
+	return evictedItems
+}
+
 // Load and add cache items from the given filename, excluding any items with
 // keys that already exist in the current cache.
 //
@@ -1045,7 +1726,7 @@ func (c *cache) Items() map[string]Item {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	m := make(map[string]Item, len(c.items))
-	now := time.Now().UnixNano()
+	now := c.now().UnixNano()
 	for k, v := range c.items {
 		// "Inlining" of Expired
 		if v.Expiration > 0 {
@@ -1053,11 +1734,49 @@ func (c *cache) Items() map[string]Item {
 				continue
 			}
 		}
-		m[k] = v
+		if isLazy(v.Object) {
+			continue
+		}
+		x, err := c.decompress(v.Object)
+		if err != nil {
+			continue
+		}
+		v.Object = c.clone(x)
+		v.Meta = copyMeta(v.Meta)
+		m[k] = c.withPausedExpiration(k, v, now)
 	}
 	return m
 }
 
+// Calls f for each unexpired item while holding the read lock, stopping if f
+// returns false. Returns false if iteration was stopped early.
+func (c *cache) itemsFunc(f func(string, Item) bool) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.now().UnixNano()
+	for k, v := range c.items {
+		// "Inlining" of Expired
+		if v.Expiration > 0 {
+			if now > v.Expiration {
+				continue
+			}
+		}
+		if isLazy(v.Object) {
+			continue
+		}
+		x, err := c.decompress(v.Object)
+		if err != nil {
+			continue
+		}
+		v.Object = c.clone(x)
+		v.Meta = copyMeta(v.Meta)
+		if !f(k, c.withPausedExpiration(k, v, now)) {
+			return false
+		}
+	}
+	return true
+}
+
 // Returns the number of items in the cache. This may include items that have
 // expired, but have not yet been cleaned up.
 func (c *cache) ItemCount() int {
@@ -1067,42 +1786,97 @@ func (c *cache) ItemCount() int {
 	return n
 }
 
-// Delete all items from the cache.
+// Len returns the number of items in the cache as an int. Like ItemCount, this
+// may include items that have expired, but have not yet been cleaned up.
+func (c *cache) Len() int {
+	c.mu.RLock()
+	n := len(c.items)
+	c.mu.RUnlock()
+	return n
+}
+
+// Delete all items from the cache, except pinned items (see Pin).
 func (c *cache) Flush() {
+	if c.coalescer != nil {
+		c.coalescer.clear()
+	}
+	var evictedItems []keyAndValue
+	now := c.now().UnixNano()
 	c.mu.Lock()
+	if len(c.pinned) > 0 {
+		evictedItems = c.flushUnpinned(now)
+		c.mu.Unlock()
+		c.notifyEvicted(evictedItems)
+		return
+	}
+	for k, v := range c.items {
+		if c.stats != nil {
+			c.stats.removed(v, now)
+		}
+		if c.notifying() {
+			reason := EvictionReasonDeleted
+			if v.Expiration > 0 && now > v.Expiration {
+				reason = EvictionReasonExpired
+			}
+			evictedItems = append(evictedItems, keyAndValue{k, v.Object, reason})
+		}
+	}
+	c.unaccountAll(c.items)
+	c.uncount(len(c.items))
 	c.items = map[string]Item{}
+	c.prioritized = nil
+	c.tags = nil
+	c.keyTags = nil
+	if c.bloom.Load() != nil {
+		c.rebuildBloom()
+	}
+	if c.evictor != nil {
+		c.evictor.Reset()
+	}
+	if c.disk != nil {
+		evictedItems = append(evictedItems, c.flushSpilled()...)
+	}
 	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
 }
 
-type janitor struct {
-	Interval time.Duration
-	stop     chan bool
-}
-
-func (j *janitor) Run(c *cache) {
-	ticker := time.NewTicker(j.Interval)
-	for {
-		select {
-		case <-ticker.C:
-			c.DeleteExpired()
-		case <-j.stop:
-			ticker.Stop()
-			return
+// Like Flush, but deletes the unpinned items one by one. c.mu must be held.
+func (c *cache) flushUnpinned(now int64) []keyAndValue {
+	var evictedItems []keyAndValue
+	for k, v := range c.items {
+		if c.isPinned(k) {
+			continue
 		}
+		if ov, evicted := c.delete(k); evicted {
+			reason := EvictionReasonDeleted
+			if v.Expiration > 0 && now > v.Expiration {
+				reason = EvictionReasonExpired
+			}
+			evictedItems = append(evictedItems, keyAndValue{k, ov, reason})
+		}
+	}
+	c.refreshBloom()
+	if c.disk != nil {
+		evictedItems = append(evictedItems, c.flushSpilled()...)
 	}
+	return evictedItems
 }
 
 func stopJanitor(c *Cache) {
-	c.janitor.stop <- true
+	c.Close()
 }
 
 func runJanitor(c *cache, ci time.Duration) {
-	j := &janitor{
-		Interval: ci,
-		stop:     make(chan bool),
+	var opts []JanitorOption
+	if c.eagerCleanup {
+		opts = append(opts, WithJanitorSweepOnStart())
+	}
+	if c.reaper != nil {
+		opts = append(opts, WithJanitorReaper(c.reaper))
 	}
-	c.janitor = j
-	go j.Run(c)
+	c.janitor = NewJanitor(ci, func() { c.DeleteExpired() }, opts...)
+	c.janitor.goroutines = c.goroutines
+	c.janitor.Start()
 }
 
 func newCache(de time.Duration, m map[string]Item) *cache {
@@ -1116,8 +1890,7 @@ func newCache(de time.Duration, m map[string]Item) *cache {
 	return c
 }
 
-func newCacheWithJanitor(de time.Duration, ci time.Duration, m map[string]Item) *Cache {
-	c := newCache(de, m)
+func newCacheWithJanitorFrom(c *cache, ci time.Duration) *Cache {
 	// This trick ensures that the janitor goroutine (which--granted it
 	// was enabled--is running DeleteExpired on c forever) does not keep
 	// the returned C object from being garbage collected. When it is
@@ -1126,19 +1899,69 @@ func newCacheWithJanitor(de time.Duration, ci time.Duration, m map[string]Item)
 	C := &Cache{c}
 	if ci > 0 {
 		runJanitor(c, ci)
+	}
+	if c.reloader != nil {
+		runFileReloader(c, c.reloader)
+	}
+	if c.coalesceInterval > 0 {
+		runCoalescer(c, c.coalesceInterval)
+	}
+	if c.watermarks != nil {
+		runWatermarkSweeper(c)
+	}
+	if c.janitor != nil || c.reloader != nil || c.coalescer != nil || c.watermarks != nil {
 		runtime.SetFinalizer(C, stopJanitor)
 	}
 	return C
 }
 
+// Close stops the cache's background goroutines: the janitor, the file reloader
+// if the cache was created with WithFileReload, the sweeper if it was created
+// with WithWatermarks, the flusher if it was created with WithWriteCoalescing,
+// after storing any buffered writes, and the dispatcher of a batch handler (see
+// RegisterEvictionBatchHandler), after delivering the items collected for it.
+// It also closes the channel returned by ExpirationChannel, if any.
+// The cache can still be used, but expired items are no longer deleted
+// automatically. Calling Close more than once has no effect.
+func (c *cache) Close() {
+	c.closeOnce.Do(func() {
+		if c.janitor != nil {
+			c.janitor.Stop()
+		}
+		if c.reloader != nil {
+			c.reloader.stop <- true
+		}
+		if c.watermarks != nil {
+			c.watermarks.sweeper.Stop()
+		}
+		if c.coalescer != nil {
+			c.coalescer.stop <- true
+			<-c.coalescer.done
+		}
+		c.mu.RLock()
+		b, s, w := c.batcher, c.expirations, c.watchers
+		c.mu.RUnlock()
+		if w != nil {
+			w.close()
+		}
+		if b != nil {
+			b.close()
+		}
+		if s != nil {
+			s.close()
+		}
+	})
+}
+
 // New Return a new cache with a given default expiration duration and cleanup
 // interval. If the expiration duration is less than one (or NoExpiration),
 // the items in the cache never expire (by default), and must be deleted
 // manually. If the cleanup interval is less than one, expired items are not
 // deleted from the cache before calling c.DeleteExpired().
-func New(defaultExpiration, cleanupInterval time.Duration) *Cache {
-	items := make(map[string]Item)
-	return newCacheWithJanitor(defaultExpiration, cleanupInterval, items)
+func New(defaultExpiration, cleanupInterval time.Duration, opts ...Option) *Cache {
+	return NewWithOptions(withOptions(opts,
+		WithDefaultExpiration(defaultExpiration),
+		WithCleanupInterval(cleanupInterval))...)
 }
 
 // NewFrom Return a new cache with a given default expiration duration and cleanup
@@ -1162,6 +1985,8 @@ func New(defaultExpiration, cleanupInterval time.Duration) *Cache {
 // gob.Register() the individual types stored in the cache before encoding a
 // map retrieved with c.Items(), and to register those same types before
 // decoding a blob containing an items map.
-func NewFrom(defaultExpiration, cleanupInterval time.Duration, items map[string]Item) *Cache {
-	return newCacheWithJanitor(defaultExpiration, cleanupInterval, items)
+func NewFrom(defaultExpiration, cleanupInterval time.Duration, items map[string]Item, opts ...Option) *Cache {
+	return newFromOptions(items, newOptions(withOptions(opts,
+		WithDefaultExpiration(defaultExpiration),
+		WithCleanupInterval(cleanupInterval))))
 }
@@ -6,6 +6,7 @@ import (
 	"runtime"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -68,44 +69,6 @@ func TestCache(t *testing.T) {
 	}
 }
 
-func TestCacheTimes(t *testing.T) {
-	var found bool
-
-	tc := New(50*time.Millisecond, 1*time.Millisecond)
-	tc.Set("a", 1, DefaultExpiration)
-	tc.Set("b", 2, NoExpiration)
-	tc.Set("c", 3, 20*time.Millisecond)
-	tc.Set("d", 4, 70*time.Millisecond)
-
-	<-time.After(25 * time.Millisecond)
-	_, found = tc.Get("c")
-	if found {
-		t.Error("Found c when it should have been automatically deleted")
-	}
-
-	<-time.After(30 * time.Millisecond)
-	_, found = tc.Get("a")
-	if found {
-		t.Error("Found a when it should have been automatically deleted")
-	}
-
-	_, found = tc.Get("b")
-	if !found {
-		t.Error("Did not find b even though it was set to never expire")
-	}
-
-	_, found = tc.Get("d")
-	if !found {
-		t.Error("Did not find d even though it was set to expire later than the default")
-	}
-
-	<-time.After(20 * time.Millisecond)
-	_, found = tc.Get("d")
-	if found {
-		t.Error("Found d when it should have been automatically deleted (later than the default)")
-	}
-}
-
 func TestNewFrom(t *testing.T) {
 	m := map[string]Item{
 		"a": Item{
@@ -713,6 +676,32 @@ func TestIncrementInt32(t *testing.T) {
 	}
 }
 
+func TestIncrementReturn(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("tint8", int8(1), DefaultExpiration)
+	tc.Set("tuint", uint(1), DefaultExpiration)
+	tc.Set("tfloat64", float64(1.5), DefaultExpiration)
+	tc.Set("tstring", "1", DefaultExpiration)
+	if n, err := tc.IncrementReturn("tint8", 2); err != nil || n != 3 {
+		t.Errorf("IncrementReturn returned %d, %v", n, err)
+	}
+	if n, err := tc.IncrementReturn("tuint", -1); err != nil || n != 0 {
+		t.Errorf("IncrementReturn returned %d, %v", n, err)
+	}
+	if n, err := tc.IncrementReturn("tfloat64", 1); err != nil || n != 2 {
+		t.Errorf("IncrementReturn returned %d, %v", n, err)
+	}
+	if x, _ := tc.Get("tfloat64"); x.(float64) != 2.5 {
+		t.Error("tfloat64 is not 2.5:", x)
+	}
+	if _, err := tc.IncrementReturn("tstring", 1); err == nil {
+		t.Error("Incremented a string")
+	}
+	if _, err := tc.IncrementReturn("missing", 1); err == nil {
+		t.Error("Incremented a missing item")
+	}
+}
+
 func TestIncrementInt64(t *testing.T) {
 	tc := New(DefaultExpiration, 0)
 	tc.Set("tint64", int64(1), DefaultExpiration)
@@ -1150,6 +1139,47 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestDeleteAndGetRace(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	var (
+		mu       sync.Mutex
+		notified = map[interface{}]int{}
+	)
+	tc.OnEvictedWithReason(func(k string, v interface{}, r EvictionReason) {
+		if r == EvictionReasonDeleted {
+			mu.Lock()
+			notified[v]++
+			mu.Unlock()
+		}
+	})
+	const n = 1000
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			tc.Set("foo", i, DefaultExpiration)
+		}
+	}()
+	returned := map[interface{}]int{}
+	for i := 0; i < n; i++ {
+		if x, found := tc.DeleteAndGet("foo"); found {
+			returned[x]++
+		}
+	}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(returned) != len(notified) {
+		t.Fatalf("returned %d values, but %d were notified", len(returned), len(notified))
+	}
+	for x, n := range returned {
+		if notified[x] != n {
+			t.Errorf("%v returned %d times, but notified %d times", x, n, notified[x])
+		}
+	}
+}
+
 func TestItemCount(t *testing.T) {
 	tc := New(DefaultExpiration, 0)
 	tc.Set("foo", "1", DefaultExpiration)
@@ -1284,7 +1314,9 @@ func testFillAndSerialize(t *testing.T, tc *Cache) {
 		t.Fatal("Couldn't save cache to fp:", err)
 	}
 
-	oc := New(DefaultExpiration, 0)
+	// oc's clock is past the expiration time of "expired".
+	clk := &manualClock{t: time.Now().Add(time.Hour)}
+	oc := New(DefaultExpiration, 0, WithClock(clk))
 	err = oc.Load(fp)
 	if err != nil {
 		t.Fatal("Couldn't load cache from fp:", err)
@@ -1314,7 +1346,6 @@ func testFillAndSerialize(t *testing.T, tc *Cache) {
 		t.Error("c is not c")
 	}
 
-	<-time.After(5 * time.Millisecond)
 	_, found = oc.Get("expired")
 	if found {
 		t.Error("expired was found")
@@ -1769,3 +1800,101 @@ func TestGetWithExpiration(t *testing.T) {
 		t.Error("expiration for e is in the past")
 	}
 }
+
+func TestLen(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	if n := tc.Len(); n != 0 {
+		t.Errorf("Len is not 0: %d", n)
+	}
+	tc.Set("foo", "1", DefaultExpiration)
+	tc.Set("bar", "2", DefaultExpiration)
+	tc.Set("baz", "3", DefaultExpiration)
+	if n := tc.Len(); n != 3 {
+		t.Errorf("Len is not 3: %d", n)
+	}
+	tc.Delete("foo")
+	if n := tc.Len(); n != len(tc.items) {
+		t.Errorf("Len %d does not match map length %d", n, len(tc.items))
+	}
+}
+
+func TestEagerCleanup(t *testing.T) {
+	m := map[string]Item{
+		"expired": {Object: 1, Expiration: time.Now().Add(-time.Hour).UnixNano()},
+		"live":    {Object: 2},
+	}
+	tc := NewFrom(DefaultExpiration, 1*time.Hour, m, WithEagerCleanup(true))
+	for i := 0; i < 100 && tc.ItemCount() != 1; i++ {
+		<-time.After(1 * time.Millisecond)
+	}
+	if n := tc.ItemCount(); n != 1 {
+		t.Errorf("ItemCount is %d, not 1: the expired item wasn't purged", n)
+	}
+
+	m = map[string]Item{
+		"expired": {Object: 1, Expiration: time.Now().Add(-time.Hour).UnixNano()},
+	}
+	tc = NewFrom(DefaultExpiration, 1*time.Hour, m, WithEagerCleanup(false))
+	<-time.After(10 * time.Millisecond)
+	if n := tc.ItemCount(); n != 1 {
+		t.Errorf("ItemCount is %d, not 1: the janitor swept before its interval", n)
+	}
+}
+
+func TestOnEvictedExactlyOnce(t *testing.T) {
+	for _, tc := range []*Cache{
+		New(DefaultExpiration, time.Millisecond),
+		NewWithCapacity(DefaultExpiration, time.Millisecond, 20, EvictionPolicyLRU),
+	} {
+		var (
+			inserted int64
+			mu       sync.Mutex
+			notified = map[EvictionReason]int64{}
+		)
+		tc.OnEvictedWithReason(func(k string, v interface{}, reason EvictionReason) {
+			mu.Lock()
+			notified[reason]++
+			mu.Unlock()
+		})
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 2000; i++ {
+					k := strconv.Itoa((g*7 + i) % 50)
+					switch i % 10 {
+					case 0:
+						tc.Delete(k)
+					case 1:
+						tc.DeleteExpired()
+					case 2:
+						if g == 0 {
+							tc.Flush()
+						}
+					default:
+						d := time.Duration(i%3) * time.Millisecond
+						if d == 0 {
+							d = NoExpiration
+						}
+						if tc.Add(k, i, d) == nil {
+							atomic.AddInt64(&inserted, 1)
+						}
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+		tc.Flush()
+		mu.Lock()
+		total := int64(0)
+		for _, n := range notified {
+			total += n
+		}
+		if total != atomic.LoadInt64(&inserted) {
+			t.Errorf("%d items were inserted, but OnEvicted was called %d times: %v", inserted, total, notified)
+		}
+		mu.Unlock()
+		tc.Close()
+	}
+}
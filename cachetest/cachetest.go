@@ -0,0 +1,109 @@
+// Package cachetest provides helpers for testing code that uses go-cache: a
+// manually advanced clock to use with cache.WithClock, a way to run the
+// janitor's cleanup synchronously, and assertions about a cache's contents.
+package cachetest
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// Cache is the part of a cache used by the helpers in this package. Both
+// *cache.Cache and *cache.ShardedCache implement it.
+type Cache interface {
+	cache.Store
+}
+
+// ManualClock is a cache.Clock that only moves when it is told to. It is safe
+// for concurrent use.
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManualClock returns a ManualClock set to t.
+func NewManualClock(t time.Time) *ManualClock {
+	return &ManualClock{now: t}
+}
+
+// Now returns the clock's current time.
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// Set sets the clock to t.
+func (c *ManualClock) Set(t time.Time) {
+	c.mu.Lock()
+	c.now = t
+	c.mu.Unlock()
+}
+
+// RunCleanup deletes all expired items from c right away, as the janitor
+// would on its next sweep.
+func RunCleanup(c Cache) {
+	switch c := c.(type) {
+	case interface{ DeleteExpired() uint32 }:
+		c.DeleteExpired()
+	case interface{ DeleteExpired() }:
+		c.DeleteExpired()
+	}
+}
+
+// AssertContains fails the test if c doesn't hold an unexpired item with the
+// given key whose value deeply equals want.
+func AssertContains(t testing.TB, c Cache, key string, want interface{}) {
+	t.Helper()
+	got, found := c.Get(key)
+	if !found {
+		t.Errorf("cache doesn't contain %s", key)
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s is %v, not %v", key, got, want)
+	}
+}
+
+// AssertMissing fails the test if c holds an unexpired item with the given
+// key.
+func AssertMissing(t testing.TB, c Cache, key string) {
+	t.Helper()
+	if got, found := c.Get(key); found {
+		t.Errorf("cache contains %s: %v", key, got)
+	}
+}
+
+// AssertExpiresWithin fails the test if c doesn't hold an unexpired item with
+// the given key that expires within d.
+func AssertExpiresWithin(t testing.TB, c Cache, key string, d time.Duration) {
+	t.Helper()
+	found := false
+	var ttl time.Duration
+	c.RangeTTL(func(k string, x interface{}, t time.Duration) bool {
+		if k == key {
+			found, ttl = true, t
+			return false
+		}
+		return true
+	})
+	switch {
+	case !found:
+		t.Errorf("cache doesn't contain %s", key)
+	case ttl == cache.NoExpiration:
+		t.Errorf("%s never expires", key)
+	case ttl > d:
+		t.Errorf("%s expires in %v, not within %v", key, ttl, d)
+	}
+}
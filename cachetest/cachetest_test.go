@@ -0,0 +1,52 @@
+package cachetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+func newCaches(clk cache.Clock) map[string]Cache {
+	return map[string]Cache{
+		"Cache":        cache.New(50*time.Millisecond, 0, cache.WithClock(clk)),
+		"ShardedCache": cache.NewSharded(50*time.Millisecond, 0, 4, cache.WithClock(clk)),
+	}
+}
+
+func TestRunCleanup(t *testing.T) {
+	clk := NewManualClock(time.Unix(1000, 0))
+	for name, tc := range newCaches(clk) {
+		t.Run(name, func(t *testing.T) {
+			clk.Set(time.Unix(1000, 0))
+			var evicted []string
+			if c, ok := tc.(*cache.Cache); ok {
+				c.OnEvicted(func(k string, v interface{}) { evicted = append(evicted, k) })
+			}
+			tc.Set("a", 1, cache.DefaultExpiration)
+			tc.Set("b", 2, cache.NoExpiration)
+			clk.Advance(1 * time.Hour)
+			RunCleanup(tc)
+			if name == "Cache" && (len(evicted) != 1 || evicted[0] != "a") {
+				t.Errorf("RunCleanup evicted %v, not [a]", evicted)
+			}
+			n := 0
+			tc.RangeTTL(func(k string, x interface{}, ttl time.Duration) bool {
+				n++
+				return true
+			})
+			if n != 1 {
+				t.Errorf("%d items are left after RunCleanup, not 1", n)
+			}
+		})
+	}
+}
+
+func TestExpiresWithin(t *testing.T) {
+	clk := NewManualClock(time.Unix(1000, 0))
+	tc := cache.New(cache.NoExpiration, 0, cache.WithClock(clk))
+	tc.Set("a", 1, 1*time.Minute)
+	AssertExpiresWithin(t, tc, "a", 1*time.Minute)
+	clk.Advance(30 * time.Second)
+	AssertExpiresWithin(t, tc, "a", 30*time.Second)
+}
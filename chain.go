@@ -0,0 +1,53 @@
+package cache
+
+import "time"
+
+// ChainLoader loads a value for GetOrComputeChain. It returns the value and
+// true if its source has it, false if it doesn't, or an error if the source
+// couldn't be queried.
+type ChainLoader func() (interface{}, bool, error)
+
+// WithChainSkipErrors makes GetOrComputeChain log an error returned by one of
+// its loaders and go on to the next, instead of returning it.
+func WithChainSkipErrors() Option {
+	return func(o *options) {
+		o.chainSkipErrors = true
+	}
+}
+
+// GetOrComputeChain gets an item from the cache, or, if it isn't found, calls
+// loaders in order until one of them reports that it has the value, and stores
+// that value for the duration d (see Set.) This models layered sources, e.g. a
+// local file, then a remote cache, then the origin, without nesting calls to
+// GetOrCompute. The whole chain is run once for concurrent calls for the same
+// missing key, as with GetOrCompute.
+//
+// If a loader returns an error, GetOrComputeChain returns it without calling
+// the rest, unless the cache was created with WithChainSkipErrors. If no
+// loader has the value, nothing is stored and GetOrComputeChain returns a
+// CacheError wrapping ErrKeyNotFound.
+func (c *cache) GetOrComputeChain(k string, d time.Duration, loaders ...ChainLoader) (interface{}, error) {
+	v, _, err := c.getOrCompute(k, d, func() (interface{}, error) {
+		for i, load := range loaders {
+			v, found, err := load()
+			if err != nil {
+				if !c.chainSkipErrors {
+					return nil, err
+				}
+				c.logf("loader %d for %s failed: %v", i, k, err)
+				continue
+			}
+			if found {
+				return v, nil
+			}
+		}
+		return nil, keyError("GetOrComputeChain", k, ErrKeyNotFound, "No loader has %s")
+	})
+	return v, err
+}
+
+// GetOrComputeChain gets an item from the shard owning k, or loads it from the
+// first of loaders that has it. See the cache's GetOrComputeChain.
+func (sc *shardedCache) GetOrComputeChain(k string, d time.Duration, loaders ...ChainLoader) (interface{}, error) {
+	return sc.bucket(k).GetOrComputeChain(k, d, loaders...)
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGetOrComputeChain(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	var calls []string
+	loader := func(name string, x interface{}, found bool) ChainLoader {
+		return func() (interface{}, bool, error) {
+			calls = append(calls, name)
+			return x, found, nil
+		}
+	}
+	x, err := tc.GetOrComputeChain("foo", DefaultExpiration,
+		loader("file", nil, false),
+		loader("redis", "bar", true),
+		loader("origin", "baz", true),
+	)
+	if err != nil || x.(string) != "bar" {
+		t.Fatalf("GetOrComputeChain returned %v, %v", x, err)
+	}
+	if strings.Join(calls, ",") != "file,redis" {
+		t.Errorf("called loaders %v, want file and redis", calls)
+	}
+	if x, found := tc.Get("foo"); !found || x.(string) != "bar" {
+		t.Error("foo was not stored")
+	}
+
+	_, err = tc.GetOrComputeChain("missing", DefaultExpiration, loader("file", nil, false))
+	if !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("got error %v for a key no loader has, want ErrKeyNotFound", err)
+	}
+	if _, found := tc.Get("missing"); found {
+		t.Error("missing was stored even though no loader had it")
+	}
+}
+
+func TestGetOrComputeChainError(t *testing.T) {
+	want := errors.New("unreachable")
+	failing := func() (interface{}, bool, error) { return nil, false, want }
+	origin := func() (interface{}, bool, error) { return "bar", true, nil }
+
+	tc := New(DefaultExpiration, 0)
+	if _, err := tc.GetOrComputeChain("foo", DefaultExpiration, failing, origin); err != want {
+		t.Errorf("GetOrComputeChain returned error %v, not %v", err, want)
+	}
+	if _, found := tc.Get("foo"); found {
+		t.Error("foo was stored even though the chain was aborted")
+	}
+
+	l := &testLogger{}
+	tc = NewWithOptions(WithChainSkipErrors(), WithLogger(l))
+	x, err := tc.GetOrComputeChain("foo", DefaultExpiration, failing, origin)
+	if err != nil || x.(string) != "bar" {
+		t.Fatalf("GetOrComputeChain returned %v, %v", x, err)
+	}
+	if len(l.lines) != 1 || !strings.Contains(l.lines[0], "unreachable") {
+		t.Errorf("logged %q, want the loader's error", l.lines)
+	}
+}
+
+func TestGetOrComputeChainSingleFlight(t *testing.T) {
+	tc := NewShardedWithOptions(WithShards(3))
+	var calls int32
+	release := make(chan struct{})
+	first := func() (interface{}, bool, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return nil, false, nil
+	}
+	second := func() (interface{}, bool, error) {
+		atomic.AddInt32(&calls, 1)
+		return "bar", true, nil
+	}
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if x, err := tc.GetOrComputeChain("foo", DefaultExpiration, first, second); err != nil || x.(string) != "bar" {
+				t.Errorf("GetOrComputeChain returned %v, %v", x, err)
+			}
+		}()
+	}
+	for len(tc.cs[0].InFlight())+len(tc.cs[1].InFlight())+len(tc.cs[2].InFlight()) == 0 {
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("loaders were called %d times, not 2", n)
+	}
+	if n := tc.ItemCount(); n != 1 {
+		t.Errorf("ItemCount is %d, not 1", n)
+	}
+}
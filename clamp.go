@@ -0,0 +1,58 @@
+package cache
+
+import "math"
+
+// IncrementClamped adds n, which may be negative, to an item of type int64,
+// clamps the result into [min, max], and stores and returns it, all while the
+// item is locked, e.g. for a gauge or a semaphore count that must stay within
+// bounds. The sum saturates rather than wrapping around if it overflows. If
+// min is greater than max, the result is max. Returns an error if the item's
+// value is not an int64, or if it was not found.
+func (c *cache) IncrementClamped(k string, n, min, max int64) (int64, error) {
+	c.flushPending(k)
+	c.mu.Lock()
+	v, found := c.items[k]
+	if !found || c.expired(v) {
+		c.mu.Unlock()
+		return 0, keyError("IncrementClamped", k, ErrKeyNotFound, "Item %s not found")
+	}
+	rv, ok := v.Object.(int64)
+	if !ok {
+		c.mu.Unlock()
+		return 0, keyError("IncrementClamped", k, ErrWrongType, "The value for %s is not an int64")
+	}
+	nv := clamp(saturatingAdd(rv, n), min, max)
+	v.Object = nv
+	v.version = c.nextVersion()
+	c.account(k, &v)
+	c.items[k] = v
+	c.mu.Unlock()
+	return nv, nil
+}
+
+// IncrementClamped increments an item in the shard owning k and clamps it into
+// [min, max]. See the cache's IncrementClamped.
+func (sc *shardedCache) IncrementClamped(k string, n, min, max int64) (int64, error) {
+	return sc.bucket(k).IncrementClamped(k, n, min, max)
+}
+
+// Returns x + n, or the nearest int64 if it doesn't fit.
+func saturatingAdd(x, n int64) int64 {
+	switch {
+	case n > 0 && x > math.MaxInt64-n:
+		return math.MaxInt64
+	case n < 0 && x < math.MinInt64-n:
+		return math.MinInt64
+	}
+	return x + n
+}
+
+func clamp(x, min, max int64) int64 {
+	if x < min {
+		x = min
+	}
+	if x > max {
+		x = max
+	}
+	return x
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestIncrementClamped(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("sem", int64(0), DefaultExpiration)
+	for i, want := range []int64{1, 2, 3, 3, 3} {
+		if v, err := tc.IncrementClamped("sem", 1, 0, 3); err != nil || v != want {
+			t.Errorf("increment %d returned %d, %v, want %d", i, v, err, want)
+		}
+	}
+	if v, err := tc.IncrementClamped("sem", -10, 0, 3); err != nil || v != 0 {
+		t.Errorf("decrementing past min returned %d, %v, want 0", v, err)
+	}
+	if x, _ := tc.Get("sem"); x.(int64) != 0 {
+		t.Errorf("stored %v, want 0", x)
+	}
+
+	// Values already out of range are pulled back in.
+	tc.Set("sem", int64(10), DefaultExpiration)
+	if v, _ := tc.IncrementClamped("sem", 0, 0, 3); v != 3 {
+		t.Errorf("got %d for a value above max, want 3", v)
+	}
+}
+
+func TestIncrementClampedOverflow(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("max", int64(math.MaxInt64-1), DefaultExpiration)
+	if v, _ := tc.IncrementClamped("max", 10, 0, math.MaxInt64); v != math.MaxInt64 {
+		t.Errorf("got %d, want MaxInt64", v)
+	}
+	tc.Set("min", int64(math.MinInt64+1), DefaultExpiration)
+	if v, _ := tc.IncrementClamped("min", -10, math.MinInt64, 0); v != math.MinInt64 {
+		t.Errorf("got %d, want MinInt64", v)
+	}
+}
+
+func TestIncrementClampedErrors(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	if _, err := tc.IncrementClamped("missing", 1, 0, 1); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("got error %v for a missing item, want ErrKeyNotFound", err)
+	}
+	tc.Set("int", 1, DefaultExpiration)
+	if _, err := tc.IncrementClamped("int", 1, 0, 1); !errors.Is(err, ErrWrongType) {
+		t.Errorf("got error %v for an int, want ErrWrongType", err)
+	}
+}
+
+func TestShardedIncrementClamped(t *testing.T) {
+	tc := NewShardedWithOptions(WithShards(3))
+	tc.Set("a", int64(5), DefaultExpiration)
+	tc.Set("b", int64(5), DefaultExpiration)
+	if v, err := tc.IncrementClamped("a", 10, 0, 8); err != nil || v != 8 {
+		t.Errorf("got %d, %v at max, want 8", v, err)
+	}
+	if v, err := tc.IncrementClamped("b", -10, 2, 8); err != nil || v != 2 {
+		t.Errorf("got %d, %v at min, want 2", v, err)
+	}
+}
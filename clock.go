@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"time"
+)
+
+// A Clock tells the current time. See WithClock.
+type Clock interface {
+	Now() time.Time
+}
+
+// WithClock makes the cache use clk instead of the system clock to compute
+// expiration times and to decide whether items have expired, e.g. so that
+// tests can advance time instead of sleeping. The janitor still runs on the
+// system clock.
+func WithClock(clk Clock) Option {
+	return func(o *options) {
+		o.clock = clk
+	}
+}
+
+// Returns the current time according to the cache's clock.
+func (c *cache) now() time.Time {
+	if c.clock != nil {
+		return c.clock.Now()
+	}
+	return time.Now()
+}
+
+// Like item.Expired, but using the cache's clock.
+func (c *cache) expired(item Item) bool {
+	if item.Expiration == 0 {
+		return false
+	}
+	return c.now().UnixNano() > item.Expiration
+}
+
+// ReconcileExpirations moves the expiration time of every item that has one by
+// delta, e.g. after the wall clock jumped because the machine was suspended
+// and resumed, or NTP stepped it. Expiration times are absolute wall-clock
+// times, so that they can be saved, loaded and compared across processes: if
+// the clock jumps forward by an hour, every item with an expiration time
+// loses an hour of its time to live, and if it jumps back, every item gains
+// one. Passing the size of the jump as delta restores the items' remaining
+// time to live. An item moved into the past is expired.
+//
+// Measuring time to live on Go's monotonic clock instead would be immune to
+// jumps, but a monotonic reading means nothing outside the process that made
+// it, so items couldn't keep their expiration times across Save and Load, and
+// time spent suspended isn't counted on every platform. The cache can't tell
+// a jump from time passing, so detecting one, e.g. by comparing the wall
+// clock with the monotonic clock, is up to the caller.
+//
+// Writes buffered by WithWriteCoalescing and items spilled to disk are moved
+// too.
+func (c *cache) ReconcileExpirations(delta time.Duration) {
+	if c.coalescer != nil {
+		w := c.coalescer
+		w.mu.Lock()
+		for k, p := range w.pending {
+			if p.e > 0 {
+				p.e = shiftExpiration(p.e, delta)
+				w.pending[k] = p
+			}
+		}
+		w.mu.Unlock()
+	}
+	c.mu.Lock()
+	for k, v := range c.items {
+		if v.Expiration > 0 {
+			v.Expiration = shiftExpiration(v.Expiration, delta)
+			c.items[k] = v
+		}
+	}
+	if c.disk != nil {
+		for k, e := range c.disk.index {
+			if e > 0 {
+				c.disk.index[k] = shiftExpiration(e, delta)
+			}
+		}
+	}
+	c.mu.Unlock()
+}
+
+// ReconcileExpirations moves the expiration time of every item in every shard
+// by delta. See the cache's ReconcileExpirations.
+func (sc *shardedCache) ReconcileExpirations(delta time.Duration) {
+	for _, c := range sc.cs {
+		c.ReconcileExpirations(delta)
+	}
+}
+
+// Returns the expiration time e moved by delta, keeping it from reaching 0,
+// which would mean the item never expires.
+func shiftExpiration(e int64, delta time.Duration) int64 {
+	e += int64(delta)
+	if e < 1 {
+		e = 1
+	}
+	return e
+}
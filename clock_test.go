@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconcileExpirations(t *testing.T) {
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := New(DefaultExpiration, 0, WithClock(clk))
+	tc.Set("foo", 1, time.Minute)
+	tc.Set("forever", 2, NoExpiration)
+
+	// The clock jumps forward by an hour, e.g. on resume.
+	clk.Advance(time.Hour)
+	if _, found := tc.Get("foo"); found {
+		t.Fatal("foo didn't expire after the jump")
+	}
+	tc.ReconcileExpirations(time.Hour)
+	if _, found := tc.Get("foo"); !found {
+		t.Error("foo expired after reconciling")
+	}
+	if _, exp, _ := tc.GetWithExpiration("foo"); exp.Sub(clk.Now()) != time.Minute {
+		t.Errorf("got %v left, want 1m", exp.Sub(clk.Now()))
+	}
+	if e := tc.items["forever"].Expiration; e != 0 {
+		t.Errorf("an item that never expires was given expiration %d", e)
+	}
+
+	tc.ReconcileExpirations(-200 * time.Hour)
+	if e := tc.items["foo"].Expiration; e != 1 {
+		t.Errorf("got expiration %d after moving into the past, want 1", e)
+	}
+	if _, found := tc.Get("foo"); found {
+		t.Error("foo was found after moving its expiration into the past")
+	}
+}
+
+func TestReconcileExpirationsDisk(t *testing.T) {
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := NewWithCapacity(DefaultExpiration, 0, 1, EvictionPolicyLRU, WithClock(clk), WithDiskOverflow(t.TempDir(), nil))
+	tc.Set("foo", 1, time.Minute)
+	tc.Set("bar", 2, NoExpiration) // Spills foo.
+	if _, found := tc.disk.index["foo"]; !found {
+		t.Fatal("foo wasn't spilled")
+	}
+	clk.Advance(time.Hour)
+	tc.ReconcileExpirations(time.Hour)
+	x, exp, found := tc.GetWithExpiration("foo")
+	if !found || x.(int) != 1 {
+		t.Fatalf("got (%v, %v) for the spilled item after reconciling, want (1, true)", x, found)
+	}
+	if left := exp.Sub(clk.Now()); left != time.Minute {
+		t.Errorf("got %v left, want 1m", left)
+	}
+}
+
+func TestShardedReconcileExpirations(t *testing.T) {
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := NewShardedWithOptions(WithShards(3), WithClock(clk))
+	tc.Set("foo", 1, time.Minute)
+	tc.Set("bar", 2, time.Minute)
+	clk.Advance(time.Hour)
+	tc.ReconcileExpirations(time.Hour)
+	for _, k := range []string{"foo", "bar"} {
+		if _, found := tc.Get(k); !found {
+			t.Errorf("%s expired after reconciling", k)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"reflect"
+)
+
+// Cloner is implemented by values that know how to copy themselves. CloneValue
+// uses it in preference to copying values using reflection.
+type Cloner interface {
+	Clone() interface{}
+}
+
+// WithValueCloner makes the cache pass every value it returns, from Get,
+// GetWithExpiration, GetVersioned, Items and the other methods that copy or
+// iterate over its items, through clone, so that callers get independent
+// copies they can modify without affecting other readers. If clone is nil,
+// CloneValue is used. Values are stored as they are set.
+//
+// Copying costs an allocation per map, slice and pointer in a value, on every
+// read, and CloneValue's use of reflection makes it several times slower than
+// a hand-written copy; for large values it dominates the cost of a Get. Values
+// that are never modified after being set don't need to be copied.
+func WithValueCloner(clone func(interface{}) interface{}) Option {
+	return func(o *options) {
+		if clone == nil {
+			clone = CloneValue
+		}
+		o.cloner = clone
+	}
+}
+
+// WithCopyOnGet makes Get and the other methods that return values return a
+// copy made by copyFn, or CloneValue if it is nil. It is the same as
+// WithValueCloner.
+func WithCopyOnGet(copyFn func(interface{}) interface{}) Option {
+	return WithValueCloner(copyFn)
+}
+
+// WithImmutableValues is a stricter form of WithValueCloner for caches whose
+// values must never be shared: besides Get and the other methods that return
+// values, the values passed to OnEvicted callbacks, eviction batch handlers
+// and ExpirationChannel, and returned by DeleteExpiredReturn, are copied using
+// clone, so no caller ever sees the same value as the cache or another caller.
+// clone must copy everything in the values that can be modified through them,
+// including the maps, slices and pointers in struct fields, which CloneValue
+// leaves shared; WithImmutableValues panics if it is nil. CloneValue may be
+// passed only if the values are maps, slices, arrays and pointers to these,
+// or implement Cloner.
+//
+// Every read then allocates a copy of the whole value: for a pointer to a small
+// struct with a slice field, a hand-written clone makes Get about four times
+// slower and costs two allocations (see BenchmarkGetWithImmutableValues), and
+// for large maps or slices the copy dominates the cost of every access. Values are stored as
+// they are set, so callers mustn't modify a value after setting it.
+func WithImmutableValues(clone func(interface{}) interface{}) Option {
+	if clone == nil {
+		panic("go-cache: WithImmutableValues: clone must not be nil")
+	}
+	return func(o *options) {
+		o.cloner = clone
+		o.immutable = true
+	}
+}
+
+// CloneValue returns a deep copy of x if it implements Cloner, or is a map,
+// slice, array or pointer (to one of these), copying their elements the same
+// way. Other values, including structs, are returned as they are.
+func CloneValue(x interface{}) interface{} {
+	if x == nil {
+		return nil
+	}
+	if c, ok := x.(Cloner); ok {
+		return c.Clone()
+	}
+	v := reflect.ValueOf(x)
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Ptr:
+		return cloneReflect(v).Interface()
+	}
+	return x
+}
+
+func cloneReflect(v reflect.Value) reflect.Value {
+	if v.CanInterface() {
+		if c, ok := v.Interface().(Cloner); ok {
+			if x := c.Clone(); x != nil {
+				return reflect.ValueOf(x)
+			}
+		}
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		m := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m.SetMapIndex(iter.Key(), cloneElem(iter.Value(), v.Type().Elem()))
+		}
+		return m
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s.Index(i).Set(cloneElem(v.Index(i), v.Type().Elem()))
+		}
+		return s
+	case reflect.Array:
+		a := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			a.Index(i).Set(cloneElem(v.Index(i), v.Type().Elem()))
+		}
+		return a
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		p := reflect.New(v.Type().Elem())
+		p.Elem().Set(cloneElem(v.Elem(), v.Type().Elem()))
+		return p
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		return cloneReflect(v.Elem())
+	}
+	return v
+}
+
+// Clones an element, converting the result back to the element type t, which
+// may be an interface type.
+func cloneElem(v reflect.Value, t reflect.Type) reflect.Value {
+	c := cloneReflect(v)
+	if !c.IsValid() {
+		return reflect.Zero(t)
+	}
+	if c.Type() != t {
+		if !c.Type().AssignableTo(t) {
+			// A Cloner returned a value of another type.
+			return v
+		}
+		n := reflect.New(t).Elem()
+		n.Set(c)
+		return n
+	}
+	return c
+}
+
+// Returns a copy of x made by the cache's cloner if it was created with
+// WithImmutableValues, or x otherwise. Used for values that are handed out as
+// they are removed, which other cloners don't copy.
+func (c *cache) cloneRemoved(x interface{}) interface{} {
+	if !c.immutable {
+		return x
+	}
+	return c.clone(x)
+}
+
+// Returns a copy of x made by the cache's cloner, or x if it has none.
+func (c *cache) clone(x interface{}) interface{} {
+	if c.cloner == nil {
+		return x
+	}
+	return c.cloner(x)
+}
@@ -0,0 +1,245 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+type clonerValue struct {
+	n      int
+	clones *int
+}
+
+func (v *clonerValue) Clone() interface{} {
+	*v.clones++
+	return &clonerValue{n: v.n, clones: v.clones}
+}
+
+func TestValueClonerIsolatesMutations(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithValueCloner(nil))
+	tc.Set("map", map[string][]int{"a": {1, 2}}, DefaultExpiration)
+	tc.Set("slice", []map[string]int{{"a": 1}}, DefaultExpiration)
+
+	m, _ := tc.Get("map")
+	m.(map[string][]int)["a"][0] = 100
+	m.(map[string][]int)["b"] = nil
+	if m, _ := tc.Get("map"); len(m.(map[string][]int)) != 1 || m.(map[string][]int)["a"][0] != 1 {
+		t.Errorf("mutating a value returned by Get changed the cached value: %v", m)
+	}
+
+	s := tc.Items()["slice"].Object.([]map[string]int)
+	s[0]["a"] = 100
+	if s, _ := tc.Get("slice"); s.([]map[string]int)[0]["a"] != 1 {
+		t.Errorf("mutating a value returned by Items changed the cached value: %v", s)
+	}
+}
+
+func TestValueClonerUsesCloner(t *testing.T) {
+	clones := 0
+	tc := New(DefaultExpiration, 0, WithValueCloner(nil))
+	v := &clonerValue{n: 1, clones: &clones}
+	tc.Set("foo", v, DefaultExpiration)
+	x, _ := tc.Get("foo")
+	if x == interface{}(v) || clones != 1 {
+		t.Error("Get didn't return a copy made by Clone")
+	}
+	x.(*clonerValue).n = 2
+	if v.n != 1 {
+		t.Error("mutating the copy changed the cached value")
+	}
+}
+
+func TestValueClonerCustom(t *testing.T) {
+	calls := 0
+	tc := New(DefaultExpiration, 0, WithValueCloner(func(x interface{}) interface{} {
+		calls++
+		return x
+	}))
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Get("foo")
+	tc.GetWithExpiration("foo")
+	tc.Items()
+	if calls != 3 {
+		t.Errorf("the cloner was called %d times, not 3", calls)
+	}
+}
+
+func TestValueClonerOffByDefault(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	s := []int{1}
+	tc.Set("foo", s, DefaultExpiration)
+	x, _ := tc.Get("foo")
+	x.([]int)[0] = 2
+	if s[0] != 2 {
+		t.Error("Get returned a copy without a cloner")
+	}
+}
+
+func TestCloneValue(t *testing.T) {
+	type pair struct{ A, B int }
+	arr := [2][]int{{1}, {2}}
+	c := CloneValue(arr).([2][]int)
+	c[0][0] = 100
+	if arr[0][0] != 1 {
+		t.Error("CloneValue didn't copy an array's slices")
+	}
+	p := &map[string]interface{}{"a": []int{1}}
+	cp := CloneValue(p).(*map[string]interface{})
+	(*cp)["a"].([]int)[0] = 100
+	if (*p)["a"].([]int)[0] != 1 {
+		t.Error("CloneValue didn't copy a slice in an interface in a map behind a pointer")
+	}
+	if CloneValue(pair{1, 2}) != (pair{1, 2}) || CloneValue(nil) != nil || CloneValue(1) != 1 {
+		t.Error("CloneValue changed a value it shouldn't copy")
+	}
+	var nilMap map[string]int
+	if CloneValue(nilMap).(map[string]int) != nil {
+		t.Error("CloneValue of a nil map isn't nil")
+	}
+}
+
+func TestCopyOnGet(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithCopyOnGet(nil))
+	s := []int{1}
+	tc.Set("foo", s, DefaultExpiration)
+	x, _ := tc.Get("foo")
+	x.([]int)[0] = 2
+	if x, _ := tc.Get("foo"); x.([]int)[0] != 1 {
+		t.Error("mutating a value returned by Get changed the cached value")
+	}
+}
+
+func BenchmarkGetWithValueCloner(b *testing.B) {
+	tc := New(DefaultExpiration, 0, WithValueCloner(nil))
+	tc.Set("foo", map[string][]int{"a": {1, 2, 3}, "b": {4, 5, 6}}, DefaultExpiration)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tc.Get("foo")
+	}
+}
+
+func TestImmutableValues(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithImmutableValues(CloneValue))
+	var evicted map[string]int
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = v.(map[string]int)
+	})
+	tc.Set("foo", map[string]int{"a": 1}, DefaultExpiration)
+
+	x, _ := tc.Get("foo")
+	x.(map[string]int)["a"] = 2
+	tc.GetOrdered([]string{"foo"})[0].Value.(map[string]int)["a"] = 3
+	tc.Items()["foo"].Object.(map[string]int)["a"] = 4
+	if x, _ := tc.Get("foo"); x.(map[string]int)["a"] != 1 {
+		t.Errorf("mutating a returned value changed the cached value: %v", x)
+	}
+
+	tc.Replace("foo", map[string]int{"a": 1}, DefaultExpiration)
+	x, _ = tc.Get("foo")
+	tc.Delete("foo")
+	if evicted == nil || evicted["a"] != 1 {
+		t.Fatalf("OnEvicted got %v", evicted)
+	}
+	evicted["a"] = 5
+	if x.(map[string]int)["a"] != 1 {
+		t.Error("the value passed to OnEvicted is shared with Get")
+	}
+}
+
+func TestImmutableValuesExpired(t *testing.T) {
+	clock := &manualClock{t: time.Unix(0, 0)}
+	m := map[string]int{"a": 1}
+	tc := New(time.Minute, 0, WithImmutableValues(CloneValue), WithClock(clock))
+	tc.Set("foo", m, DefaultExpiration)
+	clock.Advance(2 * time.Minute)
+	kvs := tc.DeleteExpiredReturn()
+	if len(kvs) != 1 {
+		t.Fatalf("DeleteExpiredReturn returned %d items, not 1", len(kvs))
+	}
+	kvs[0].Value.(map[string]int)["a"] = 2
+	if m["a"] != 1 {
+		t.Error("DeleteExpiredReturn returned the cached value")
+	}
+}
+
+type immutableRecord struct {
+	Counts map[string]int
+}
+
+func cloneImmutableRecord(x interface{}) interface{} {
+	r := x.(immutableRecord)
+	counts := make(map[string]int, len(r.Counts))
+	for k, v := range r.Counts {
+		counts[k] = v
+	}
+	return immutableRecord{counts}
+}
+
+func TestImmutableValuesStructWithMap(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithImmutableValues(cloneImmutableRecord))
+	tc.Set("foo", immutableRecord{map[string]int{"a": 1}}, DefaultExpiration)
+	x, _ := tc.Get("foo")
+	x.(immutableRecord).Counts["a"] = 99
+	if x, _ := tc.Get("foo"); x.(immutableRecord).Counts["a"] != 1 {
+		t.Errorf("mutating a returned struct's map changed the cached value: %v", x)
+	}
+}
+
+func TestImmutableValuesNilClone(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("WithImmutableValues(nil) didn't panic")
+		}
+	}()
+	WithImmutableValues(nil)
+}
+
+func TestValueClonerDoesntCopyRemoved(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithValueCloner(nil))
+	m := map[string]int{"a": 1}
+	var evicted map[string]int
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = v.(map[string]int)
+	})
+	tc.Set("foo", m, DefaultExpiration)
+	tc.Delete("foo")
+	evicted["a"] = 2
+	if m["a"] != 2 {
+		t.Error("WithValueCloner copied the value passed to OnEvicted")
+	}
+}
+
+type benchUser struct {
+	ID    int64
+	Name  string
+	Email string
+	Roles []string
+}
+
+func cloneBenchUser(x interface{}) interface{} {
+	u := *x.(*benchUser)
+	u.Roles = append([]string(nil), u.Roles...)
+	return &u
+}
+
+func benchmarkGetUser(b *testing.B, opts ...Option) {
+	tc := New(DefaultExpiration, 0, opts...)
+	tc.Set("foo", &benchUser{1, "Ann", "ann@example.com", []string{"admin", "dev"}}, DefaultExpiration)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tc.Get("foo")
+	}
+}
+
+func BenchmarkGetStruct(b *testing.B) {
+	benchmarkGetUser(b)
+}
+
+func BenchmarkGetWithImmutableValues(b *testing.B) {
+	benchmarkGetUser(b, WithImmutableValues(cloneBenchUser))
+}
+
+func BenchmarkGetWithImmutableValuesCloneValue(b *testing.B) {
+	benchmarkGetUser(b, WithImmutableValues(CloneValue))
+}
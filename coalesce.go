@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// WithWriteCoalescing makes Set buffer the latest value written to each key
+// instead of storing it right away, and a background goroutine store the
+// buffered values every interval. Keys that are written many times per
+// interval, e.g. by telemetry producers, are then only stored once, reducing
+// lock contention and map writes.
+//
+// Get and GetWithExpiration return the buffered value for a key if there is
+// one. Every other write to a key discards its buffered value, so that it
+// can't be stored over the newer one later: Delete, Flush and the methods that
+// set items, e.g. SetAt or SetWithTags, drop it, and the methods that depend
+// on the item, e.g. Add, Replace, Increment or Touch, store it first. Until a
+// value is stored, however, it isn't visible to methods that only read items,
+// e.g. Items or ItemCount, and it isn't subject to the cache's capacity, so
+// those may see a value up to interval old. Close stores the
+// buffered values and stops the goroutine.
+//
+// This option is ignored by NewSharded.
+func WithWriteCoalescing(interval time.Duration) Option {
+	return func(o *options) {
+		o.coalesceInterval = interval
+	}
+}
+
+type pendingWrite struct {
+	x interface{}
+	// The expiration time, as for Item.Expiration.
+	e int64
+}
+
+type coalescer struct {
+	Interval time.Duration
+	mu       sync.Mutex
+	pending  map[string]pendingWrite
+	// Set once the goroutine has stopped, after which writes are no longer
+	// buffered.
+	closed bool
+	stop   chan bool
+	done   chan struct{}
+}
+
+// Buffers a write. Returns false if it must be stored right away instead.
+func (w *coalescer) put(k string, x interface{}, e int64) bool {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return false
+	}
+	w.pending[k] = pendingWrite{x, e}
+	w.mu.Unlock()
+	return true
+}
+
+func (w *coalescer) get(k string) (pendingWrite, bool) {
+	w.mu.Lock()
+	p, found := w.pending[k]
+	w.mu.Unlock()
+	return p, found
+}
+
+func (w *coalescer) remove(k string) {
+	w.mu.Lock()
+	delete(w.pending, k)
+	w.mu.Unlock()
+}
+
+// Discards the buffered writes to keys for which f returns true.
+func (w *coalescer) removeFunc(f func(k string) bool) {
+	w.mu.Lock()
+	for k := range w.pending {
+		if f(k) {
+			delete(w.pending, k)
+		}
+	}
+	w.mu.Unlock()
+}
+
+func (w *coalescer) clear() {
+	w.mu.Lock()
+	w.pending = map[string]pendingWrite{}
+	w.mu.Unlock()
+}
+
+func (w *coalescer) Run(c *cache) {
+	ticker := time.NewTicker(w.Interval)
+	for {
+		select {
+		case <-ticker.C:
+			c.commitPending(false)
+		case <-w.stop:
+			ticker.Stop()
+			c.commitPending(true)
+			close(w.done)
+			return
+		}
+	}
+}
+
+func runCoalescer(c *cache, interval time.Duration) {
+	w := &coalescer{
+		Interval: interval,
+		pending:  map[string]pendingWrite{},
+		stop:     make(chan bool),
+		done:     make(chan struct{}),
+	}
+	c.coalescer = w
+	c.goroutines.helper(func() { w.Run(c) })
+}
+
+// Stores the buffered writes in the cache. If closing is set, writes are no
+// longer buffered afterwards.
+func (c *cache) commitPending(closing bool) {
+	w := c.coalescer
+	if !closing {
+		w.mu.Lock()
+		n := len(w.pending)
+		w.mu.Unlock()
+		if n == 0 {
+			return
+		}
+	}
+	// c.mu is taken before w.mu, as by the writes that discard buffered
+	// ones, and held until the buffered writes are stored, so that a write
+	// made once closed is set, which waits for c.mu, can't be overwritten by
+	// an older buffered one. Neither is held while the callbacks run, as
+	// they may use the cache.
+	c.mu.Lock()
+	w.mu.Lock()
+	w.closed = closing
+	m := w.pending
+	w.pending = map[string]pendingWrite{}
+	w.mu.Unlock()
+	var evictedItems []keyAndValue
+	now := c.now().UnixNano()
+	for k, p := range m {
+		d := NoExpiration
+		if p.e > 0 {
+			if now > p.e {
+				continue
+			}
+			d = time.Duration(p.e - now)
+		}
+		evictedItems = append(evictedItems, c.store(k, p.x, p.e, d)...)
+	}
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+}
+
+// Returns the buffered value for k, if it hasn't expired.
+func (c *cache) getPending(k string) (pendingWrite, bool) {
+	p, found := c.coalescer.get(k)
+	if !found || (p.e > 0 && c.now().UnixNano() > p.e) {
+		return pendingWrite{}, false
+	}
+	return p, true
+}
+
+// Stores the buffered write to k, if there is one, so that a method modifying
+// the item in place sees it. c.mu must not be held.
+func (c *cache) flushPending(k string) {
+	if c.coalescer == nil {
+		return
+	}
+	if _, found := c.coalescer.get(k); found {
+		c.commitPending(false)
+	}
+}
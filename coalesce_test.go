@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWriteCoalescing(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithWriteCoalescing(20*time.Millisecond))
+	defer tc.Close()
+	evicted := 0
+	tc.OnEvicted(func(string, interface{}) { evicted++ })
+	for i := 0; i < 1000; i++ {
+		tc.Set("hot", i, DefaultExpiration)
+	}
+	if x, found := tc.Get("hot"); !found || x.(int) != 999 {
+		t.Errorf("Get returned %v, %v instead of the buffered value", x, found)
+	}
+	if n := tc.ItemCount(); n != 0 {
+		t.Errorf("%d items were stored before the interval elapsed", n)
+	}
+	<-time.After(50 * time.Millisecond)
+	if x, found := tc.Items()["hot"]; !found || x.Object.(int) != 999 {
+		t.Errorf("the buffered value wasn't stored: %v, %v", x, found)
+	}
+	if evicted != 0 {
+		t.Errorf("OnEvicted was called %d times", evicted)
+	}
+}
+
+func TestWriteCoalescingDelete(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithWriteCoalescing(20*time.Millisecond))
+	defer tc.Close()
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Delete("foo")
+	tc.Set("bar", 1, DefaultExpiration)
+	tc.Flush()
+	<-time.After(50 * time.Millisecond)
+	if _, found := tc.Get("foo"); found {
+		t.Error("a deleted buffered value was stored")
+	}
+	if _, found := tc.Get("bar"); found {
+		t.Error("a flushed buffered value was stored")
+	}
+}
+
+func TestWriteCoalescingExpiration(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithWriteCoalescing(time.Hour))
+	defer tc.Close()
+	tc.Set("foo", 1, 50*time.Millisecond)
+	tc.Set("bar", 2, time.Millisecond)
+	_, exp, found := tc.GetWithExpiration("foo")
+	if !found || exp.IsZero() || time.Until(exp) > 50*time.Millisecond {
+		t.Errorf("GetWithExpiration returned %v, %v", exp, found)
+	}
+	<-time.After(5 * time.Millisecond)
+	if _, found := tc.Get("bar"); found {
+		t.Error("an expired buffered value was found")
+	}
+}
+
+func TestWriteCoalescingClose(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithWriteCoalescing(time.Hour))
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Close()
+	if _, found := tc.Items()["foo"]; !found {
+		t.Error("Close didn't store the buffered value")
+	}
+	tc.Set("bar", 2, DefaultExpiration)
+	if _, found := tc.Items()["bar"]; !found {
+		t.Error("a value set after Close was buffered")
+	}
+}
+
+func TestWriteCoalescingReentrantCallback(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithMaxItems(1), WithWriteCoalescing(time.Hour))
+	got := make(chan bool, 2)
+	tc.OnEvicted(func(k string, _ interface{}) {
+		_, found := tc.Get(k)
+		tc.Set("other", 0, DefaultExpiration)
+		got <- found
+	})
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Set("bar", 2, DefaultExpiration)
+	done := make(chan struct{})
+	go func() {
+		tc.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close deadlocked on an OnEvicted callback using the cache")
+	}
+	select {
+	case <-got:
+	default:
+		t.Error("OnEvicted wasn't called")
+	}
+}
+
+func TestWriteCoalescingOtherWrites(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithWriteCoalescing(time.Hour))
+	defer tc.Close()
+	tc.Set("at", "old", DefaultExpiration)
+	tc.SetAt("at", "new", time.Time{})
+	tc.Set("tags", "old", DefaultExpiration)
+	if err := tc.SetWithTags("tags", "new", DefaultExpiration, "t"); err != nil {
+		t.Fatal(err)
+	}
+	tc.Set("meta", "old", DefaultExpiration)
+	tc.SetWithMeta("meta", "new", DefaultExpiration, nil)
+	tc.Set("n", 1, DefaultExpiration)
+	tc.Set("n", 10, DefaultExpiration)
+	if err := tc.Increment("n", 1); err != nil {
+		t.Fatal(err)
+	}
+	tc.Set("r", "old", DefaultExpiration)
+	if err := tc.Replace("r", "new", DefaultExpiration); err != nil {
+		t.Error("Replace didn't see the buffered value:", err)
+	}
+	tc.commitPending(false)
+	for _, k := range []string{"at", "tags", "meta", "r"} {
+		if x, found := tc.Get(k); !found || x != "new" {
+			t.Errorf("%s: got %v, %v, want new: a buffered write was stored over a newer one", k, x, found)
+		}
+	}
+	if x, found := tc.Get("n"); !found || x.(int) != 11 {
+		t.Errorf("n: got %v, %v, want 11", x, found)
+	}
+}
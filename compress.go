@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"io"
+)
+
+// A Codec compresses and decompresses values stored in a cache created with
+// WithValueCompression.
+type Codec interface {
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+// GzipCodec is a Codec that uses gzip. Level is the gzip compression level;
+// zero means gzip.DefaultCompression.
+type GzipCodec struct {
+	Level int
+}
+
+func (g GzipCodec) Compress(src []byte) ([]byte, error) {
+	level := g.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(src); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (g GzipCodec) Decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// The stored form of a compressed []byte or string value. Its fields are
+// exported so that Save can write it as is.
+type compressedValue struct {
+	Data   []byte
+	String bool
+}
+
+func init() {
+	gob.Register(compressedValue{})
+}
+
+// WithValueCompression makes the cache compress values of type []byte or
+// string that are longer than threshold bytes using codec when they are set,
+// and decompress them when they are read, including by Items and the other
+// methods that copy or iterate over the cache's items, and before they are
+// passed to the OnEvicted function. Values are stored uncompressed if
+// compressing them fails or doesn't make them smaller.
+//
+// Save writes values in their compressed form, so a cache saved with
+// compression must be loaded into a cache created with the same codec.
+func WithValueCompression(threshold int, codec Codec) Option {
+	return func(o *options) {
+		o.compressThreshold = threshold
+		o.codec = codec
+	}
+}
+
+// Returns the form of x to store in the cache: compressed if x is a large
+// enough []byte or string and the cache has a codec, or x itself otherwise.
+func (c *cache) compress(x interface{}) interface{} {
+	if c.codec == nil {
+		return x
+	}
+	var (
+		b     []byte
+		isStr bool
+	)
+	switch v := x.(type) {
+	case []byte:
+		b = v
+	case string:
+		if len(v) <= c.compressThreshold {
+			return x
+		}
+		b, isStr = []byte(v), true
+	default:
+		return x
+	}
+	if len(b) <= c.compressThreshold {
+		return x
+	}
+	data, err := c.codec.Compress(b)
+	if err != nil || len(data) >= len(b) {
+		return x
+	}
+	return compressedValue{Data: data, String: isStr}
+}
+
+// Returns the original form of x, which was stored in the cache. Does nothing
+// unless x was compressed.
+func (c *cache) decompress(x interface{}) (interface{}, error) {
+	cv, ok := x.(compressedValue)
+	if !ok || c.codec == nil {
+		return x, nil
+	}
+	b, err := c.codec.Decompress(cv.Data)
+	if err != nil {
+		return nil, err
+	}
+	if cv.String {
+		return string(b), nil
+	}
+	return b, nil
+}
+
+// Returns the value to return for the stored object x of the item with key k,
+// computing it if it was set using SetLazy, decompressing it if it was
+// compressed, and copying it if the cache has a cloner. Reports a miss if
+// computing or decompressing it fails. c.mu must not be held.
+func (c *cache) value(k string, x interface{}) (interface{}, bool) {
+	if lv, ok := x.(*lazyValue); ok {
+		x, found := c.resolveLazy(k, lv)
+		if !found {
+			return nil, false
+		}
+		return c.clone(x), true
+	}
+	x, err := c.decompress(x)
+	if err != nil {
+		c.logf("couldn't decompress the value for key %q: %v", k, err)
+		return nil, false
+	}
+	return c.clone(x), true
+}
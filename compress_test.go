@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func compressible(n int) []byte {
+	return bytes.Repeat([]byte(`{"id":12345,"name":"go-cache","tags":["a","b"]},`), n/48+1)[:n]
+}
+
+func TestValueCompression(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithValueCompression(1024, GzipCodec{}))
+	big := compressible(64 << 10)
+	tc.Set("big", big, DefaultExpiration)
+	tc.Set("str", string(big), DefaultExpiration)
+	tc.Set("small", []byte("small"), DefaultExpiration)
+	tc.Set("int", 1, DefaultExpiration)
+
+	tc.mu.RLock()
+	cv, ok := tc.items["big"].Object.(compressedValue)
+	_, smallCompressed := tc.items["small"].Object.(compressedValue)
+	tc.mu.RUnlock()
+	if !ok {
+		t.Fatal("big value was not compressed")
+	}
+	if len(cv.Data) >= len(big) {
+		t.Errorf("compressed value is %d bytes, not less than %d", len(cv.Data), len(big))
+	}
+	if smallCompressed {
+		t.Error("value below the threshold was compressed")
+	}
+
+	if x, found := tc.Get("big"); !found || !bytes.Equal(x.([]byte), big) {
+		t.Error("Get didn't return the decompressed []byte")
+	}
+	if x, found := tc.Get("str"); !found || x.(string) != string(big) {
+		t.Error("Get didn't return the decompressed string")
+	}
+	if x, _, found := tc.GetWithExpiration("big"); !found || !bytes.Equal(x.([]byte), big) {
+		t.Error("GetWithExpiration didn't return the decompressed []byte")
+	}
+	if x, found := tc.Get("small"); !found || string(x.([]byte)) != "small" {
+		t.Error("Get didn't return the small value")
+	}
+	items := tc.Items()
+	if !bytes.Equal(items["big"].Object.([]byte), big) {
+		t.Error("Items didn't return the decompressed []byte")
+	}
+	if items["int"].Object.(int) != 1 {
+		t.Error("Items didn't return the int")
+	}
+}
+
+func TestValueCompressionOnEvicted(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithValueCompression(16, GzipCodec{}))
+	big := strings.Repeat("a", 1024)
+	var got interface{}
+	tc.OnEvicted(func(k string, v interface{}) {
+		got = v
+	})
+	tc.Set("foo", big, DefaultExpiration)
+	tc.Delete("foo")
+	if s, ok := got.(string); !ok || s != big {
+		t.Errorf("OnEvicted was passed %T, not the decompressed string", got)
+	}
+}
+
+type failingCodec struct{}
+
+func (failingCodec) Compress(src []byte) ([]byte, error) {
+	return []byte{0}, nil
+}
+
+func (failingCodec) Decompress(src []byte) ([]byte, error) {
+	return nil, errors.New("corrupt")
+}
+
+func TestValueCompressionDecompressError(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithValueCompression(0, failingCodec{}))
+	l := &testLogger{}
+	tc.SetLogger(l)
+	tc.Set("foo", []byte("bar"), DefaultExpiration)
+	if _, found := tc.Get("foo"); found {
+		t.Error("Get found a value that couldn't be decompressed")
+	}
+	if len(l.lines) != 1 {
+		t.Error("decompression error was not logged")
+	}
+}
+
+func TestValueCompressionSaveLoad(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithValueCompression(1024, GzipCodec{}))
+	big := compressible(16 << 10)
+	tc.Set("big", big, DefaultExpiration)
+	fp := &bytes.Buffer{}
+	if err := tc.Save(fp); err != nil {
+		t.Fatal("Couldn't save cache to fp:", err)
+	}
+	if fp.Len() >= len(big) {
+		t.Errorf("saved cache is %d bytes, not smaller than the value", fp.Len())
+	}
+	oc := New(DefaultExpiration, 0, WithValueCompression(1024, GzipCodec{}))
+	if err := oc.Load(fp); err != nil {
+		t.Fatal("Couldn't load cache from fp:", err)
+	}
+	oc.mu.RLock()
+	_, ok := oc.items["big"].Object.(compressedValue)
+	oc.mu.RUnlock()
+	if !ok {
+		t.Error("value was not loaded in its compressed form")
+	}
+	if x, found := oc.Get("big"); !found || !bytes.Equal(x.([]byte), big) {
+		t.Error("Get didn't return the decompressed value after Load")
+	}
+}
+
+func benchmarkCompressionSet(b *testing.B, opts ...Option) {
+	tc := New(DefaultExpiration, 0, opts...)
+	v := compressible(1 << 20)
+	b.SetBytes(int64(len(v)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tc.Set("foo", v, DefaultExpiration)
+	}
+	b.StopTimer()
+	tc.mu.RLock()
+	stored := len(v)
+	if cv, ok := tc.items["foo"].Object.(compressedValue); ok {
+		stored = len(cv.Data)
+	}
+	tc.mu.RUnlock()
+	b.ReportMetric(float64(stored), "stored-bytes")
+}
+
+func BenchmarkCompressionSetNone(b *testing.B) {
+	benchmarkCompressionSet(b)
+}
+
+func BenchmarkCompressionSetGzip(b *testing.B) {
+	benchmarkCompressionSet(b, WithValueCompression(1024, GzipCodec{}))
+}
+
+func BenchmarkCompressionSetGzipBestSpeed(b *testing.B) {
+	benchmarkCompressionSet(b, WithValueCompression(1024, GzipCodec{Level: 1}))
+}
+
+func BenchmarkCompressionGetGzip(b *testing.B) {
+	tc := New(DefaultExpiration, 0, WithValueCompression(1024, GzipCodec{}))
+	v := compressible(1 << 20)
+	tc.Set("foo", v, DefaultExpiration)
+	b.SetBytes(int64(len(v)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tc.Get("foo")
+	}
+}
@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// ErrInvalidOption is wrapped by the errors NewShardedE returns for invalid
+// options.
+var ErrInvalidOption = errors.New("Invalid option")
+
+// WithDefaultExpiration sets the expiration duration used for items set with
+// DefaultExpiration. If it is less than one (or NoExpiration), such items
+// never expire. See New.
+func WithDefaultExpiration(d time.Duration) Option {
+	return func(o *options) {
+		o.defaultExpiration = d
+	}
+}
+
+// WithCleanupInterval makes a janitor delete expired items every d. If d is
+// less than one, expired items aren't deleted before DeleteExpired is called.
+// See New.
+func WithCleanupInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.cleanupInterval = d
+	}
+}
+
+// WithMaxItems limits the cache to n items, evicting items chosen by the
+// eviction policy (see WithEvictionPolicy) to make room for new ones. In a
+// sharded cache, each shard holds at most n items. If n is less than one, the
+// cache is unbounded. See NewWithCapacity and NewShardedLRU.
+func WithMaxItems(n int) Option {
+	return func(o *options) {
+		o.maxItems = n
+	}
+}
+
+// WithEvictionPolicy sets the policy used to choose which items to evict from
+// a cache created with WithMaxItems. The default is EvictionPolicyLRU.
+func WithEvictionPolicy(p EvictionPolicy) Option {
+	return func(o *options) {
+		o.evictionPolicy = p
+	}
+}
+
+// WithShards sets the number of shards of a cache created with
+// NewShardedWithOptions, which defaults to GOMAXPROCS. It is ignored by
+// NewWithOptions.
+func WithShards(n int) Option {
+	return func(o *options) {
+		o.shards, o.shardsSet = n, true
+	}
+}
+
+// WithPowerOfTwoShards rounds the number of shards of a sharded cache up to a
+// power of two.
+func WithPowerOfTwoShards() Option {
+	return func(o *options) {
+		o.powerOfTwoShards = true
+	}
+}
+
+// WithShardSeed sets the seed used to map keys to shards in a cache created
+// with NewShardedWithOptions instead of a random one. See NewShardedSeeded.
+func WithShardSeed(seed uint32) Option {
+	return func(o *options) {
+		o.seed, o.seedSet = seed, true
+	}
+}
+
+// WithOnEvicted sets the function called when an item is removed from the
+// cache. See OnEvicted.
+func WithOnEvicted(f func(string, interface{})) Option {
+	return func(o *options) {
+		if f == nil {
+			o.onEvicted = nil
+			return
+		}
+		o.onEvicted = func(k string, v interface{}, _ EvictionReason) {
+			f(k, v)
+		}
+	}
+}
+
+// WithOnEvictedWithReason sets the function called, with the reason, when an
+// item is removed from the cache. See OnEvictedWithReason.
+func WithOnEvictedWithReason(f func(string, interface{}, EvictionReason)) Option {
+	return func(o *options) {
+		o.onEvicted = f
+	}
+}
+
+// WithLogger sets the Logger used to report problems. See SetLogger.
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// NewWithOptions returns a new cache configured entirely by options, e.g.
+//
+//	c := cache.NewWithOptions(
+//		cache.WithDefaultExpiration(5*time.Minute),
+//		cache.WithCleanupInterval(10*time.Minute),
+//		cache.WithMaxItems(10000),
+//		cache.WithOnEvicted(onEvicted),
+//	)
+//
+// Without options, the cache is unbounded, its items never expire by default,
+// and there is no janitor. New and NewWithCapacity are shorthands for it.
+func NewWithOptions(opts ...Option) *Cache {
+	return newFromOptions(make(map[string]Item), newOptions(opts))
+}
+
+func newFromOptions(m map[string]Item, o *options) *Cache {
+	c := newCache(o.defaultExpiration, m)
+	o.apply(c)
+	c.accountAll()
+	if o.reloadPath != "" && o.reloadInterval > 0 {
+		c.reloader = &fileReloader{
+			Path:     o.reloadPath,
+			Interval: o.reloadInterval,
+			Mode:     o.reloadMode,
+			Callback: o.reloadCallback,
+		}
+	}
+	maxItems := o.maxItems
+	if w := newWatermarks(o); w != nil {
+		c.watermarks = w
+		maxItems = w.hard
+	}
+	if maxItems > 0 {
+		c.maxItems = maxItems
+		c.evictor = newEvictor(c, o.evictionPolicy, maxItems, o)
+	}
+	return newCacheWithJanitorFrom(c, o.cleanupInterval)
+}
+
+// NewShardedWithOptions returns a new sharded cache configured entirely by
+// options, like NewWithOptions. The number of shards is set using WithShards,
+// and WithMaxItems limits each shard. NewSharded, NewShardedSeeded and
+// NewShardedLRU are shorthands for it.
+func NewShardedWithOptions(opts ...Option) *ShardedCache {
+	return newShardedFromOptions(newOptions(opts))
+}
+
+// NewShardedE is like NewShardedWithOptions, but returns an error wrapping
+// ErrInvalidOption instead of substituting a default if the number of shards
+// set with WithShards is less than one, the default expiration is negative
+// (other than NoExpiration), or the cleanup interval or maximum number of items
+// is negative.
+func NewShardedE(opts ...Option) (*ShardedCache, error) {
+	o := newOptions(opts)
+	if err := o.validateSharded(); err != nil {
+		return nil, err
+	}
+	return newShardedFromOptions(o), nil
+}
+
+func (o *options) validateSharded() error {
+	if o.shardsSet && o.shards < 1 {
+		return fmt.Errorf("Number of shards must be at least 1, not %d: %w", o.shards, ErrInvalidOption)
+	}
+	if o.defaultExpiration < 0 && o.defaultExpiration != NoExpiration {
+		return fmt.Errorf("Default expiration %v is negative: %w", o.defaultExpiration, ErrInvalidOption)
+	}
+	if o.cleanupInterval < 0 {
+		return fmt.Errorf("Cleanup interval %v is negative: %w", o.cleanupInterval, ErrInvalidOption)
+	}
+	if o.maxItems < 0 {
+		return fmt.Errorf("Maximum number of items %d is negative: %w", o.maxItems, ErrInvalidOption)
+	}
+	return nil
+}
+
+// Panics if shards, passed to the constructor name, is less than one.
+func mustHaveShards(name string, shards int) {
+	if shards < 1 {
+		panic(fmt.Sprintf("go-cache: %s: number of shards must be at least 1, not %d", name, shards))
+	}
+}
+
+func newShardedFromOptions(o *options) *ShardedCache {
+	n := o.shards
+	if n < 1 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	if o.powerOfTwoShards {
+		p := 1
+		for p < n {
+			p <<= 1
+		}
+		n = p
+	}
+	seed := o.seed
+	if !o.seedSet {
+		seed = randomSeed(o.logger)
+	}
+	de := o.defaultExpiration
+	if de == 0 {
+		de = -1
+	}
+	sc := newShardedCache(n, seed, de, o)
+	if o.maxItems > 0 {
+		for _, c := range sc.cs {
+			c.maxItems = o.maxItems
+			c.evictor = newEvictor(c, o.evictionPolicy, o.maxItems, o)
+		}
+	}
+	return newShardedCacheWithJanitor(sc, o.cleanupInterval)
+}
+
+// Returns a copy of opts followed by more, so that the positional arguments of
+// the older constructors take precedence over the options passed with them.
+func withOptions(opts []Option, more ...Option) []Option {
+	return append(append(make([]Option, 0, len(opts)+len(more)), opts...), more...)
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"errors"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	var evicted []string
+	tc := NewWithOptions(
+		WithDefaultExpiration(time.Hour),
+		WithCleanupInterval(time.Minute),
+		WithMaxItems(2),
+		WithEvictionPolicy(EvictionPolicyLRU),
+		WithOnEvicted(func(k string, v interface{}) {
+			evicted = append(evicted, k)
+		}),
+	)
+	defer tc.Close()
+	if tc.janitor == nil {
+		t.Error("no janitor was started")
+	}
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Get("a")
+	tc.Set("c", 3, DefaultExpiration)
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Errorf("evicted %v, not [b]", evicted)
+	}
+	if _, e, _ := tc.GetWithExpiration("a"); time.Until(e) < 59*time.Minute {
+		t.Errorf("a expires at %v, not in an hour", e)
+	}
+}
+
+func TestNewWithOptionsDefaults(t *testing.T) {
+	tc := NewWithOptions()
+	if tc.janitor != nil || tc.evictor != nil || tc.defaultExpiration != NoExpiration {
+		t.Error("a cache created without options isn't unbounded and janitor-less, with items that never expire")
+	}
+}
+
+func TestPositionalArgsOverrideOptions(t *testing.T) {
+	tc := NewWithCapacity(NoExpiration, 0, 3, EvictionPolicyLRU, WithMaxItems(100))
+	for i := 0; i < 10; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	if n := tc.ItemCount(); n != 3 {
+		t.Errorf("ItemCount is %d, not 3", n)
+	}
+}
+
+func TestNewShardedWithOptions(t *testing.T) {
+	evicted := 0
+	tc := NewShardedWithOptions(
+		WithShards(4),
+		WithShardSeed(42),
+		WithMaxItems(2),
+		WithOnEvictedWithReason(func(k string, v interface{}, r EvictionReason) {
+			if r == EvictionReasonCapacity {
+				evicted++
+			}
+		}),
+	)
+	if tc.NumShards() != 4 || tc.Seed() != 42 {
+		t.Errorf("cache has %d shards and seed %d", tc.NumShards(), tc.Seed())
+	}
+	for i := 0; i < 100; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	if n := tc.Len(); n != 8 {
+		t.Errorf("Len is %d, not 8", n)
+	}
+	if evicted != 92 {
+		t.Errorf("%d items were evicted, not 92", evicted)
+	}
+}
+
+func TestNewShardedE(t *testing.T) {
+	tc, err := NewShardedE(WithShards(3), WithShardSeed(1), WithDefaultExpiration(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tc.cs) != 3 || tc.Seed() != 1 {
+		t.Errorf("got %d shards with seed %d", len(tc.cs), tc.Seed())
+	}
+	tc.Set("foo", 1, DefaultExpiration)
+	if tc.bucket("foo").items["foo"].Expiration == 0 {
+		t.Error("the default expiration wasn't used")
+	}
+
+	tc, err = NewShardedE()
+	if err != nil || len(tc.cs) != runtime.GOMAXPROCS(0) {
+		t.Errorf("NewShardedE() returned %v", err)
+	}
+
+	tc, err = NewShardedE(WithShards(5), WithPowerOfTwoShards())
+	if err != nil || len(tc.cs) != 8 {
+		t.Errorf("WithPowerOfTwoShards rounded 5 shards to %d", len(tc.cs))
+	}
+	tc, _ = NewShardedE(WithShards(4), WithPowerOfTwoShards())
+	if len(tc.cs) != 4 {
+		t.Errorf("WithPowerOfTwoShards rounded 4 shards to %d", len(tc.cs))
+	}
+}
+
+func TestNewShardedEInvalid(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithShards(0)},
+		{WithShards(-1)},
+		{WithDefaultExpiration(-time.Second)},
+		{WithCleanupInterval(-time.Second)},
+		{WithMaxItems(-1)},
+	} {
+		tc, err := NewShardedE(opts...)
+		if tc != nil || !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("NewShardedE returned %v, %v", tc, err)
+		}
+	}
+	if _, err := NewShardedE(WithDefaultExpiration(NoExpiration)); err != nil {
+		t.Errorf("NoExpiration was rejected: %v", err)
+	}
+}
+
+func TestNewShardedPanicsWithoutShards(t *testing.T) {
+	for name, f := range map[string]func(){
+		"NewSharded":       func() { NewSharded(DefaultExpiration, 0, 0) },
+		"NewShardedSeeded": func() { NewShardedSeeded(DefaultExpiration, 0, -1, 1) },
+		"NewShardedLRU":    func() { NewShardedLRU(DefaultExpiration, 0, 0, 10) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s didn't panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// The Ctx variants of the cache's methods accept a context for frameworks that
+// require one for every call that may block. Operations that only touch memory
+// never block, so they ignore the context entirely and cost the same as the
+// plain methods; the context only matters where the cache waits, i.e. for a
+// load made by another caller, and is passed on to loaders.
+
+// GetCtx is like Get. ctx is ignored, as Get doesn't block.
+func (c *cache) GetCtx(ctx context.Context, k string) (interface{}, bool) {
+	return c.Get(k)
+}
+
+// SetCtx is like Set. ctx is ignored, as Set doesn't block.
+func (c *cache) SetCtx(ctx context.Context, k string, x interface{}, d time.Duration) {
+	c.Set(k, x, d)
+}
+
+// DeleteCtx is like Delete. ctx is ignored, as Delete doesn't block.
+func (c *cache) DeleteCtx(ctx context.Context, k string) {
+	c.Delete(k)
+}
+
+// GetOrComputeCtx is like GetOrCompute, but passes ctx to loader, and returns
+// ctx.Err() if ctx is done while waiting for a load of the same key made by
+// another call. The call that runs loader waits for it to return, so loader
+// should honor ctx. If loader fails once the ctx of the call that ran it is
+// done, the calls waiting for it don't receive the error: they retry, and one
+// of them runs its own loader.
+func (c *cache) GetOrComputeCtx(ctx context.Context, k string, d time.Duration, loader func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	v, _, err := c.getOrComputeCtx(ctx, k, func(ctx context.Context) (interface{}, time.Duration, error) {
+		v, err := loader(ctx)
+		return v, d, err
+	})
+	return v, err
+}
+
+// GetCtx is like Get. See the cache's GetCtx.
+func (sc *shardedCache) GetCtx(ctx context.Context, k string) (interface{}, bool) {
+	return sc.Get(k)
+}
+
+// SetCtx is like Set. See the cache's SetCtx.
+func (sc *shardedCache) SetCtx(ctx context.Context, k string, x interface{}, d time.Duration) {
+	sc.Set(k, x, d)
+}
+
+// DeleteCtx is like Delete. See the cache's DeleteCtx.
+func (sc *shardedCache) DeleteCtx(ctx context.Context, k string) {
+	sc.Delete(k)
+}
+
+// GetOrComputeCtx is like GetOrCompute, but passes ctx to loader and stops
+// waiting for other calls' loads once it is done. See the cache's
+// GetOrComputeCtx.
+func (sc *shardedCache) GetOrComputeCtx(ctx context.Context, k string, d time.Duration, loader func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	return sc.bucket(k).GetOrComputeCtx(ctx, k, d, loader)
+}
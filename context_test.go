@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCtxVariants(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tc := New(DefaultExpiration, 0)
+	// In-memory operations ignore the context, even if it is done.
+	tc.SetCtx(ctx, "foo", 1, DefaultExpiration)
+	if x, found := tc.GetCtx(ctx, "foo"); !found || x.(int) != 1 {
+		t.Errorf("GetCtx returned %v, %v", x, found)
+	}
+	tc.DeleteCtx(ctx, "foo")
+	if _, found := tc.GetCtx(ctx, "foo"); found {
+		t.Error("foo was found after DeleteCtx")
+	}
+}
+
+type ctxKey struct{}
+
+func TestGetOrComputeCtxPassesContext(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	ctx := context.WithValue(context.Background(), ctxKey{}, "trace")
+	x, err := tc.GetOrComputeCtx(ctx, "foo", DefaultExpiration, func(ctx context.Context) (interface{}, error) {
+		return ctx.Value(ctxKey{}), nil
+	})
+	if err != nil || x != "trace" {
+		t.Errorf("GetOrComputeCtx returned %v, %v", x, err)
+	}
+}
+
+func TestGetOrComputeCtxCanceledWait(t *testing.T) {
+	for _, s := range []interface {
+		GetOrComputeCtx(context.Context, string, time.Duration, func(context.Context) (interface{}, error)) (interface{}, error)
+	}{
+		New(DefaultExpiration, 0),
+		NewSharded(DefaultExpiration, 0, 13),
+	} {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		go s.GetOrComputeCtx(context.Background(), "foo", DefaultExpiration, func(context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			return "bar", nil
+		})
+		<-started
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		begin := time.Now()
+		_, err := s.GetOrComputeCtx(ctx, "foo", DefaultExpiration, func(context.Context) (interface{}, error) {
+			t.Error("the loader was called while another load was in progress")
+			return nil, nil
+		})
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Errorf("GetOrComputeCtx returned %v, not context.DeadlineExceeded", err)
+		}
+		if d := time.Since(begin); d > time.Second {
+			t.Errorf("GetOrComputeCtx took %v to return after its context was done", d)
+		}
+		close(release)
+	}
+}
+
+func TestLoadingCacheGetCtx(t *testing.T) {
+	tc := NewLoadingCacheContext(DefaultExpiration, 0, func(ctx context.Context, k string) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	defer tc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := tc.GetCtx(ctx, "foo"); err != context.DeadlineExceeded {
+		t.Errorf("GetCtx returned %v, not context.DeadlineExceeded", err)
+	}
+	if keys := tc.InFlight(); len(keys) != 0 {
+		t.Errorf("loads %v are still in flight", keys)
+	}
+}
+
+func TestGetOrComputeCtxLeaderCanceled(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := tc.GetOrComputeCtx(ctx, "foo", DefaultExpiration, func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		leaderErr <- err
+	}()
+	<-started
+	waiter := make(chan error, 1)
+	go func() {
+		x, err := tc.GetOrComputeCtx(context.Background(), "foo", DefaultExpiration, func(context.Context) (interface{}, error) {
+			return "bar", nil
+		})
+		if err == nil && x != "bar" {
+			err = fmt.Errorf("got %v, not bar", x)
+		}
+		waiter <- err
+	}()
+	// Let the second call start waiting for the first one's load.
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-leaderErr; err != context.Canceled {
+		t.Errorf("the canceled call returned %v, not context.Canceled", err)
+	}
+	if err := <-waiter; err != nil {
+		t.Errorf("the waiting call returned %v after the other call was canceled", err)
+	}
+	if x, found := tc.Get("foo"); !found || x != "bar" {
+		t.Errorf("foo is %v, %v, not bar", x, found)
+	}
+}
+
+func TestGetOrComputeTombstoned(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithDeleteTombstones(time.Hour), WithStrictTombstones())
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Delete("foo")
+	x, stored, err := tc.getOrCompute("foo", DefaultExpiration, func() (interface{}, error) {
+		return 2, nil
+	})
+	if err != nil || x != 2 {
+		t.Errorf("getOrCompute returned %v, %v", x, err)
+	}
+	if stored {
+		t.Error("getOrCompute reported storing a value over a strict tombstone")
+	}
+	if _, found := tc.Get("foo"); found {
+		t.Error("a value loaded for a tombstoned key was stored")
+	}
+}
@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CounterCache is a cache of int64 counters, for counting at high rates, e.g.
+// metrics or rate limits. Unlike Increment on a Cache, which has to find out
+// the type of the stored value, its operations work on the counters directly
+// with atomic instructions, only taking the cache's write lock to create or
+// remove a counter.
+//
+// A counter is created with the value 0 by the first Add (or CompareAndSwap)
+// after it is missing or has expired, and expires the cache's default
+// expiration after that; adding to it doesn't extend its lifetime, so that a
+// counter counts over a fixed window. Expired counters read as missing.
+type CounterCache struct {
+	*counterCache
+	// The janitor runs on the embedded value; see newCacheWithJanitorFrom.
+}
+
+type counterCache struct {
+	defaultExpiration time.Duration
+	mu                sync.RWMutex
+	counters          map[string]*counter
+	janitor           *Janitor
+}
+
+type counter struct {
+	n int64
+	// Unix nanoseconds, or 0 if the counter never expires. Set when the
+	// counter is created and never changed, so it can be read without
+	// synchronization.
+	expiration int64
+}
+
+func (c *counter) expired(now int64) bool {
+	return c.expiration > 0 && now > c.expiration
+}
+
+// NewCounterCache returns a new CounterCache whose counters expire
+// defaultExpiration after they are created. If defaultExpiration is less than
+// one (or NoExpiration), counters never expire. If cleanupInterval is greater
+// than zero, expired counters are deleted every cleanupInterval, as in New.
+func NewCounterCache(defaultExpiration, cleanupInterval time.Duration) *CounterCache {
+	c := &counterCache{
+		defaultExpiration: defaultExpiration,
+		counters:          map[string]*counter{},
+	}
+	C := &CounterCache{c}
+	if cleanupInterval > 0 {
+		c.janitor = NewJanitor(cleanupInterval, c.DeleteExpired)
+		c.janitor.Start()
+		runtime.SetFinalizer(C, stopCounterJanitor)
+	}
+	return C
+}
+
+func stopCounterJanitor(c *CounterCache) {
+	c.janitor.Stop()
+}
+
+// Returns k's counter if it exists and hasn't expired. The time is only read
+// if the counter expires.
+func (c *counterCache) get(k string) (*counter, bool) {
+	c.mu.RLock()
+	ctr, found := c.counters[k]
+	c.mu.RUnlock()
+	if !found || (ctr.expiration > 0 && ctr.expired(time.Now().UnixNano())) {
+		return nil, false
+	}
+	return ctr, true
+}
+
+// Returns k's counter, replacing it with a new one holding n if it is missing
+// or has expired. Reports whether the counter was created.
+func (c *counterCache) getOrCreate(k string, n int64) (*counter, bool) {
+	now := time.Now().UnixNano()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ctr, found := c.counters[k]; found && !ctr.expired(now) {
+		return ctr, false
+	}
+	ctr := &counter{n: n}
+	if c.defaultExpiration > 0 {
+		ctr.expiration = now + int64(c.defaultExpiration)
+	}
+	c.counters[k] = ctr
+	return ctr, true
+}
+
+// Add adds n, which may be negative, to the counter k and returns its new
+// value. A counter that is missing or has expired is created with the value n.
+func (c *counterCache) Add(k string, n int64) int64 {
+	if ctr, found := c.get(k); found {
+		return atomic.AddInt64(&ctr.n, n)
+	}
+	ctr, created := c.getOrCreate(k, n)
+	if created {
+		return n
+	}
+	return atomic.AddInt64(&ctr.n, n)
+}
+
+// Get returns the value of the counter k, and whether it was found and hadn't
+// expired.
+func (c *counterCache) Get(k string) (int64, bool) {
+	ctr, found := c.get(k)
+	if !found {
+		return 0, false
+	}
+	return atomic.LoadInt64(&ctr.n), true
+}
+
+// GetAndReset sets the counter k to 0 and returns the value it held before,
+// and whether it was found and hadn't expired. Resetting a counter doesn't
+// change when it expires.
+func (c *counterCache) GetAndReset(k string) (int64, bool) {
+	ctr, found := c.get(k)
+	if !found {
+		return 0, false
+	}
+	return atomic.SwapInt64(&ctr.n, 0), true
+}
+
+// CompareAndSwap sets the counter k to new if it holds old, and reports
+// whether it did. A counter that is missing or has expired holds 0, so it is
+// created with the value new if old is 0.
+func (c *counterCache) CompareAndSwap(k string, old, new int64) bool {
+	if ctr, found := c.get(k); found {
+		return atomic.CompareAndSwapInt64(&ctr.n, old, new)
+	}
+	if old != 0 {
+		return false
+	}
+	ctr, created := c.getOrCreate(k, new)
+	if created {
+		return true
+	}
+	return atomic.CompareAndSwapInt64(&ctr.n, old, new)
+}
+
+// Delete deletes the counter k. Does nothing if there is no such counter.
+func (c *counterCache) Delete(k string) {
+	c.mu.Lock()
+	delete(c.counters, k)
+	c.mu.Unlock()
+}
+
+// DeleteExpired deletes all expired counters.
+func (c *counterCache) DeleteExpired() {
+	now := time.Now().UnixNano()
+	c.mu.Lock()
+	for k, ctr := range c.counters {
+		if ctr.expired(now) {
+			delete(c.counters, k)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// ItemCount returns the number of counters in the cache, including those that
+// have expired but haven't been deleted yet.
+func (c *counterCache) ItemCount() int {
+	c.mu.RLock()
+	n := len(c.counters)
+	c.mu.RUnlock()
+	return n
+}
+
+// Close stops the cache's janitor, if it has one. The cache can still be used
+// afterwards, but expired counters are only deleted by DeleteExpired.
+func (c *counterCache) Close() {
+	if c.janitor != nil {
+		c.janitor.Stop()
+	}
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCounterCache(t *testing.T) {
+	tc := NewCounterCache(NoExpiration, 0)
+	if _, found := tc.Get("foo"); found {
+		t.Error("missing counter was found")
+	}
+	if n := tc.Add("foo", 5); n != 5 {
+		t.Errorf("got %d, want 5", n)
+	}
+	if n := tc.Add("foo", -2); n != 3 {
+		t.Errorf("got %d, want 3", n)
+	}
+	if n, found := tc.Get("foo"); !found || n != 3 {
+		t.Errorf("got (%d, %v), want (3, true)", n, found)
+	}
+	if n, found := tc.GetAndReset("foo"); !found || n != 3 {
+		t.Errorf("got (%d, %v), want (3, true)", n, found)
+	}
+	if n, found := tc.Get("foo"); !found || n != 0 {
+		t.Errorf("got (%d, %v) after reset, want (0, true)", n, found)
+	}
+	if _, found := tc.GetAndReset("bar"); found {
+		t.Error("missing counter was reset")
+	}
+	tc.Delete("foo")
+	if _, found := tc.Get("foo"); found {
+		t.Error("deleted counter was found")
+	}
+}
+
+func TestCounterCacheCompareAndSwap(t *testing.T) {
+	tc := NewCounterCache(NoExpiration, 0)
+	if tc.CompareAndSwap("foo", 1, 2) {
+		t.Error("swapped a missing counter from 1")
+	}
+	if !tc.CompareAndSwap("foo", 0, 2) {
+		t.Error("couldn't swap a missing counter from 0")
+	}
+	if tc.CompareAndSwap("foo", 0, 3) {
+		t.Error("swapped a counter holding 2 from 0")
+	}
+	if !tc.CompareAndSwap("foo", 2, 3) {
+		t.Error("couldn't swap a counter holding 2")
+	}
+	if n, _ := tc.Get("foo"); n != 3 {
+		t.Errorf("got %d, want 3", n)
+	}
+}
+
+func TestCounterCacheExpiration(t *testing.T) {
+	tc := NewCounterCache(20*time.Millisecond, 0)
+	tc.Add("foo", 5)
+	tc.Add("foo", 5)
+	<-time.After(30 * time.Millisecond)
+	if _, found := tc.Get("foo"); found {
+		t.Error("expired counter was found")
+	}
+	if n := tc.Add("foo", 1); n != 1 {
+		t.Errorf("got %d after expiry, want 1", n)
+	}
+	tc.Add("bar", 1)
+	<-time.After(30 * time.Millisecond)
+	tc.DeleteExpired()
+	if n := tc.ItemCount(); n != 0 {
+		t.Errorf("got %d counters, want 0", n)
+	}
+}
+
+func TestCounterCacheJanitor(t *testing.T) {
+	tc := NewCounterCache(time.Millisecond, 5*time.Millisecond)
+	defer tc.Close()
+	tc.Add("foo", 1)
+	<-time.After(50 * time.Millisecond)
+	if n := tc.ItemCount(); n != 0 {
+		t.Errorf("got %d counters, want 0", n)
+	}
+}
+
+func TestCounterCacheConcurrentAdd(t *testing.T) {
+	tc := NewCounterCache(NoExpiration, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				tc.Add("foo", 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n, _ := tc.Get("foo"); n != 8000 {
+		t.Errorf("got %d, want 8000", n)
+	}
+}
+
+func BenchmarkCounterCacheAdd(b *testing.B) {
+	tc := NewCounterCache(NoExpiration, 0)
+	tc.Add("foo", 0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tc.Add("foo", 1)
+	}
+}
+
+func BenchmarkCounterCacheAddManyKeys(b *testing.B) {
+	tc := NewCounterCache(NoExpiration, 0)
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = "foo" + strconv.Itoa(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tc.Add(keys[i%len(keys)], 1)
+	}
+}
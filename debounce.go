@@ -0,0 +1,38 @@
+package cache
+
+import "time"
+
+// SetDebounced sets an item like Set, unless it was already set with
+// SetDebounced less than minInterval ago and hasn't expired, in which case x is
+// dropped and the existing item is kept as it is, including its expiration
+// time. Returns whether x was stored.
+//
+// It throttles keys that are written far more often than they are read, e.g.
+// by a chatty producer, trading freshness for fewer writes: for up to
+// minInterval after a write, readers keep seeing the earlier value. Only
+// writes made with SetDebounced are tracked; the first SetDebounced after the
+// item was set in any other way always stores its value.
+func (c *cache) SetDebounced(k string, x interface{}, d, minInterval time.Duration) bool {
+	now := c.now().UnixNano()
+	x = c.compress(x)
+	c.mu.Lock()
+	old, found := c.items[k]
+	found = found && !c.expired(old)
+	if (found && old.debounced > 0 && now-old.debounced < int64(minInterval)) || c.tombstoned(k) {
+		c.mu.Unlock()
+		return false
+	}
+	evictedItems := c.set(k, x, d)
+	item := c.items[k]
+	item.debounced = now
+	c.items[k] = item
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+	return true
+}
+
+// SetDebounced sets an item in the shard owning k unless it was set with
+// SetDebounced less than minInterval ago. See the cache's SetDebounced.
+func (sc *shardedCache) SetDebounced(k string, x interface{}, d, minInterval time.Duration) bool {
+	return sc.bucket(k).SetDebounced(k, x, d, minInterval)
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetDebounced(t *testing.T) {
+	clock := &manualClock{t: time.Unix(100, 0)}
+	tc := NewWithOptions(WithClock(clock))
+	if !tc.SetDebounced("foo", 1, time.Minute, time.Second) {
+		t.Error("the first write was dropped")
+	}
+	clock.Advance(500 * time.Millisecond)
+	if tc.SetDebounced("foo", 2, time.Hour, time.Second) {
+		t.Error("a write within minInterval was stored")
+	}
+	x, e, _ := tc.GetWithExpiration("foo")
+	if x != 1 || !e.Equal(time.Unix(160, 0)) {
+		t.Errorf("got %v expiring at %v after a dropped write", x, e)
+	}
+	clock.Advance(500 * time.Millisecond)
+	if !tc.SetDebounced("foo", 3, time.Minute, time.Second) {
+		t.Error("a write after minInterval was dropped")
+	}
+	if x, _ := tc.Get("foo"); x != 3 {
+		t.Errorf("foo is %v, not 3", x)
+	}
+
+	// Other writes aren't tracked.
+	tc.Set("foo", 4, DefaultExpiration)
+	if !tc.SetDebounced("foo", 5, DefaultExpiration, time.Second) {
+		t.Error("a write after Set was dropped")
+	}
+
+	// Nor are expired items.
+	tc.SetDebounced("bar", 1, time.Millisecond, time.Hour)
+	clock.Advance(time.Second)
+	if !tc.SetDebounced("bar", 2, DefaultExpiration, time.Hour) {
+		t.Error("a write over an expired item was dropped")
+	}
+}
+
+func TestShardedSetDebounced(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 2)
+	tc.SetDebounced("foo", 1, DefaultExpiration, time.Hour)
+	tc.SetDebounced("foo", 2, DefaultExpiration, time.Hour)
+	if x, _ := tc.Get("foo"); x != 1 {
+		t.Errorf("foo is %v, not 1", x)
+	}
+	if n := tc.ItemCount(); n != 1 {
+		t.Errorf("ItemCount is %d, not 1", n)
+	}
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrKeyNotFound is the Kind of the CacheError returned by Decode, Replace and
+// the Increment and Decrement methods when there is no unexpired item with the
+// given key.
+var ErrKeyNotFound = errors.New("Key not found")
+
+// DecodeFallback selects how Decode converts values that can't be assigned to
+// the destination directly. See WithDecodeFallback.
+type DecodeFallback int
+
+const (
+	// DecodeFallbackNone makes Decode return an error wrapping ErrWrongType.
+	DecodeFallbackNone DecodeFallback = iota
+	// DecodeFallbackJSON makes Decode encode the value as JSON, or use it as
+	// it is if it is a []byte, and decode it into the destination.
+	DecodeFallbackJSON
+	// DecodeFallbackGob is like DecodeFallbackJSON, but uses encoding/gob.
+	DecodeFallbackGob
+)
+
+// WithDecodeFallback sets how Decode converts values that can't be assigned to
+// the destination directly, e.g. values stored as serialized bytes, or values
+// of a different struct type with the same fields. The default is
+// DecodeFallbackNone.
+func WithDecodeFallback(f DecodeFallback) Option {
+	return func(o *options) {
+		o.decodeFallback = f
+	}
+}
+
+// Decode copies the value of the item with key k into the variable dst points
+// to, so that the caller gets its own copy of e.g. a struct rather than sharing
+// a pointer with other readers. The value is copied if it can be assigned to
+// *dst, or if it is a non-nil pointer to a value that can. Otherwise it is
+// converted as selected using WithDecodeFallback, or an error wrapping
+// ErrWrongType is returned. Returns an error wrapping ErrKeyNotFound if there is
+// no unexpired item with the key. Both are *CacheErrors.
+//
+// Copies are shallow: maps, slices and pointers within the value are still
+// shared, unless the value is converted or the cache copies values (see
+// WithValueCloner).
+func (c *cache) Decode(k string, dst interface{}) error {
+	x, found := c.Get(k)
+	if !found {
+		return keyError("Decode", k, ErrKeyNotFound, "Item %s not found")
+	}
+	return decodeValue(k, x, dst, c.decodeFallback)
+}
+
+func decodeValue(k string, x, dst interface{}, fallback DecodeFallback) error {
+	d := reflect.ValueOf(dst)
+	if d.Kind() != reflect.Pointer || d.IsNil() {
+		return fmt.Errorf("Decode requires a non-nil pointer, not %T", dst)
+	}
+	d = d.Elem()
+	v := reflect.ValueOf(x)
+	if !v.IsValid() {
+		switch d.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Slice, reflect.Map, reflect.Chan, reflect.Func:
+			d.Set(reflect.Zero(d.Type()))
+			return nil
+		}
+	} else if v.Type().AssignableTo(d.Type()) {
+		d.Set(v)
+		return nil
+	} else if v.Kind() == reflect.Pointer && !v.IsNil() && v.Elem().Type().AssignableTo(d.Type()) {
+		d.Set(v.Elem())
+		return nil
+	}
+	var err error
+	switch fallback {
+	case DecodeFallbackJSON:
+		b, ok := x.([]byte)
+		if !ok {
+			if b, err = json.Marshal(x); err != nil {
+				break
+			}
+		}
+		err = json.Unmarshal(b, dst)
+	case DecodeFallbackGob:
+		var buf bytes.Buffer
+		if b, ok := x.([]byte); ok {
+			buf.Write(b)
+		} else if err = gob.NewEncoder(&buf).Encode(x); err != nil {
+			break
+		}
+		err = gob.NewDecoder(&buf).Decode(dst)
+	default:
+		return keyError("Decode", k, ErrWrongType, "Item %s is of type %T, not %s", x, d.Type())
+	}
+	if err != nil {
+		return keyError("Decode", k, ErrWrongType, "Item %s of type %T couldn't be decoded into %s: %v", x, d.Type(), err)
+	}
+	return nil
+}
+
+// Decode copies the value of the item with key k into the variable dst points
+// to. See the cache's Decode.
+func (sc *shardedCache) Decode(k string, dst interface{}) error {
+	return sc.bucket(k).Decode(k, dst)
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type decodeUser struct {
+	Name string
+	Age  int
+}
+
+type decodeOtherUser struct {
+	Name string
+	Age  int
+}
+
+func TestDecode(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("struct", decodeUser{"a", 1}, DefaultExpiration)
+	p := &decodeUser{"b", 2}
+	tc.Set("pointer", p, DefaultExpiration)
+	tc.Set("slice", []int{1, 2}, DefaultExpiration)
+
+	var u decodeUser
+	if err := tc.Decode("struct", &u); err != nil || u != (decodeUser{"a", 1}) {
+		t.Errorf("Decode of a struct returned %v, %v", u, err)
+	}
+	if err := tc.Decode("pointer", &u); err != nil || u != (decodeUser{"b", 2}) {
+		t.Errorf("Decode of a pointer into a struct returned %v, %v", u, err)
+	}
+	u.Name = "c"
+	if p.Name != "b" {
+		t.Error("the decoded struct shares memory with the cached value")
+	}
+	var up *decodeUser
+	if err := tc.Decode("pointer", &up); err != nil || up != p {
+		t.Errorf("Decode of a pointer into a pointer returned %v, %v", up, err)
+	}
+	var s []int
+	if err := tc.Decode("slice", &s); err != nil || !reflect.DeepEqual(s, []int{1, 2}) {
+		t.Errorf("Decode of a slice returned %v, %v", s, err)
+	}
+	var i interface{}
+	if err := tc.Decode("slice", &i); err != nil || !reflect.DeepEqual(i, []int{1, 2}) {
+		t.Errorf("Decode into an interface returned %v, %v", i, err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("struct", decodeUser{"a", 1}, DefaultExpiration)
+	var o decodeOtherUser
+	if err := tc.Decode("struct", &o); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Decode into a mismatched struct returned %v", err)
+	}
+	var s []string
+	if err := tc.Decode("struct", &s); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Decode into a slice returned %v", err)
+	}
+	if err := tc.Decode("missing", &o); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Decode of a missing item returned %v", err)
+	}
+	if err := tc.Decode("struct", o); err == nil || errors.Is(err, ErrWrongType) {
+		t.Errorf("Decode into a non-pointer returned %v", err)
+	}
+}
+
+func TestDecodeFallback(t *testing.T) {
+	for _, f := range []DecodeFallback{DecodeFallbackJSON, DecodeFallbackGob} {
+		tc := New(DefaultExpiration, 0, WithDecodeFallback(f))
+		tc.Set("struct", decodeUser{"a", 1}, DefaultExpiration)
+		var o decodeOtherUser
+		if err := tc.Decode("struct", &o); err != nil || o != (decodeOtherUser{"a", 1}) {
+			t.Errorf("fallback %d: Decode into a mismatched struct returned %v, %v", f, o, err)
+		}
+		tc.Set("int", 1, DefaultExpiration)
+		if err := tc.Decode("int", &o); !errors.Is(err, ErrWrongType) {
+			t.Errorf("fallback %d: Decode of an int into a struct returned %v", f, err)
+		}
+	}
+
+	tc := New(DefaultExpiration, 0, WithDecodeFallback(DecodeFallbackJSON))
+	tc.Set("json", []byte(`{"Name":"a","Age":1}`), DefaultExpiration)
+	var u decodeUser
+	if err := tc.Decode("json", &u); err != nil || u != (decodeUser{"a", 1}) {
+		t.Errorf("Decode of JSON bytes returned %v, %v", u, err)
+	}
+}
+
+func TestShardedDecode(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	tc.Set("struct", &decodeUser{"a", 1}, DefaultExpiration)
+	var u decodeUser
+	if err := tc.Decode("struct", &u); err != nil || u != (decodeUser{"a", 1}) {
+		t.Errorf("Decode returned %v, %v", u, err)
+	}
+}
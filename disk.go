@@ -0,0 +1,226 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const spillExt = ".spill"
+
+// Holds items evicted from a capacity-limited cache in files under a directory.
+// See WithDiskOverflow. All methods must be called with the cache's write lock
+// held.
+type diskTier struct {
+	dir   string
+	codec Codec
+	// The expiration time of each spilled item.
+	index map[string]int64
+}
+
+// WithDiskOverflow makes a capacity-limited cache (see NewWithCapacity) write
+// the items it evicts to make room for others to files under dir, instead of
+// discarding them, and read them back into memory (possibly evicting others in
+// turn) when they are requested using Get or GetWithExpiration. The files are
+// compressed using codec, unless it is nil. Spilled items don't count towards
+// ItemCount, aren't returned by Items, and lose their tags. Delete and Flush
+// remove them, and DeleteExpired (and so the janitor) removes them once they
+// expire.
+//
+// Items aren't passed to the OnEvicted function when they are spilled, but when
+// they are removed from disk in turn, with the value read back from their file.
+//
+// The disk tier is a cache too: files left over from an earlier process are
+// removed when the cache is created, and an item whose file can't be written,
+// read or decoded is treated as if it had been evicted, and passed to the
+// OnEvicted function with EvictionReasonCapacity (and a nil value if it was
+// written.) Files are read and written with the cache's lock held.
+func WithDiskOverflow(dir string, codec Codec) Option {
+	return func(o *options) {
+		o.diskDir = dir
+		o.diskCodec = codec
+	}
+}
+
+// Creates the directory if needed, and removes any spill files in it.
+func newDiskTier(dir string, codec Codec) (*diskTier, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), spillExt) {
+			os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+	return &diskTier{
+		dir:   dir,
+		codec: codec,
+		index: map[string]int64{},
+	}, nil
+}
+
+func (d *diskTier) path(k string) string {
+	h := fnv.New64a()
+	h.Write([]byte(k))
+	return filepath.Join(d.dir, strconv.FormatUint(h.Sum64(), 16)+spillExt)
+}
+
+// Writes v to disk. Returns false if it couldn't be written.
+func (d *diskTier) spill(k string, v Item) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			// gob.Register panicked.
+			ok = false
+		}
+	}()
+	var buf bytes.Buffer
+	gob.Register(v.Object)
+	if err := gob.NewEncoder(&buf).Encode(snapshotEntry{Key: k, Item: v}); err != nil {
+		return false
+	}
+	b := buf.Bytes()
+	if d.codec != nil {
+		var err error
+		if b, err = d.codec.Compress(b); err != nil {
+			return false
+		}
+	}
+	if err := writeFileAtomic(d.path(k), false, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	}); err != nil {
+		return false
+	}
+	d.index[k] = v.Expiration
+	return true
+}
+
+// Reads the item with key k from disk. Returns false if its file can't be read
+// or decoded. The item's expiration time is taken from the index, which
+// ReconcileExpirations moves without rewriting the file.
+func (d *diskTier) read(k string) (Item, bool) {
+	b, err := os.ReadFile(d.path(k))
+	if err != nil {
+		return Item{}, false
+	}
+	if d.codec != nil {
+		if b, err = d.codec.Decompress(b); err != nil {
+			return Item{}, false
+		}
+	}
+	var e snapshotEntry
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&e); err != nil {
+		return Item{}, false
+	}
+	if e.Key != k {
+		// Another key with the same hash overwrote the file.
+		return Item{}, false
+	}
+	if exp, found := d.index[k]; found {
+		e.Item.Expiration = exp
+	}
+	return e.Item, true
+}
+
+// Removes the item with key k from disk. Returns whether it was there.
+func (d *diskTier) remove(k string) bool {
+	if _, found := d.index[k]; !found {
+		return false
+	}
+	delete(d.index, k)
+	os.Remove(d.path(k))
+	return true
+}
+
+// Removes k from the disk tier, and returns the OnEvicted notification owed for
+// it, if any, and whether it was there. c.mu must be held.
+func (c *cache) dropSpilled(k string, reason EvictionReason) ([]keyAndValue, bool) {
+	if _, found := c.disk.index[k]; !found {
+		return nil, false
+	}
+	var evictedItems []keyAndValue
+	if c.notifying() {
+		item, _ := c.disk.read(k)
+		evictedItems = append(evictedItems, keyAndValue{k, item.Object, reason})
+	}
+	c.disk.remove(k)
+	return evictedItems, true
+}
+
+// Removes the spilled items that have expired by now. c.mu must be held.
+func (c *cache) deleteExpiredSpilled(now int64) []keyAndValue {
+	var evictedItems []keyAndValue
+	for k, exp := range c.disk.index {
+		if exp > 0 && now > exp {
+			kv, _ := c.dropSpilled(k, EvictionReasonExpired)
+			evictedItems = append(evictedItems, kv...)
+		}
+	}
+	return evictedItems
+}
+
+// Reports whether any spilled item has an expiration time. c.mu must be held.
+func (d *diskTier) expiring() bool {
+	for _, exp := range d.index {
+		if exp > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Removes all spilled items. c.mu must be held.
+func (c *cache) flushSpilled() []keyAndValue {
+	var evictedItems []keyAndValue
+	for k := range c.disk.index {
+		kv, _ := c.dropSpilled(k, EvictionReasonDeleted)
+		evictedItems = append(evictedItems, kv...)
+	}
+	return evictedItems
+}
+
+// Gets a missing item from the disk tier and moves it back into memory.
+func (c *cache) getFromDisk(k string) (Item, bool) {
+	c.mu.Lock()
+	if item, found := c.items[k]; found && !c.expired(item) {
+		// Promoted by someone else in the meantime.
+		c.mu.Unlock()
+		return item, true
+	}
+	exp, found := c.disk.index[k]
+	if !found {
+		c.mu.Unlock()
+		return Item{}, false
+	}
+	if exp > 0 && c.now().UnixNano() > exp {
+		evictedItems, _ := c.dropSpilled(k, EvictionReasonExpired)
+		c.mu.Unlock()
+		c.notifyEvicted(evictedItems)
+		return Item{}, false
+	}
+	item, ok := c.disk.read(k)
+	c.disk.remove(k)
+	if !ok {
+		var evictedItems []keyAndValue
+		if c.notifying() {
+			evictedItems = append(evictedItems, keyAndValue{k, nil, EvictionReasonCapacity})
+		}
+		c.mu.Unlock()
+		c.notifyEvicted(evictedItems)
+		return Item{}, false
+	}
+	evictedItems := c.loadItem(k, item)
+	item = c.items[k]
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+	return item, true
+}
@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func spillFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+spillExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestDiskOverflowSpillsAndPromotes(t *testing.T) {
+	dir := t.TempDir()
+	var evicted []string
+	tc := NewWithCapacity(DefaultExpiration, 0, 2, EvictionPolicyLRU, WithDiskOverflow(dir, GzipCodec{}))
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = append(evicted, k)
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", "two", DefaultExpiration)
+	tc.Set("c", []byte("three"), DefaultExpiration)
+	if len(evicted) != 0 {
+		t.Errorf("spilled items were passed to OnEvicted: %v", evicted)
+	}
+	if n := tc.ItemCount(); n != 2 {
+		t.Errorf("ItemCount is %d, not 2", n)
+	}
+	if files := spillFiles(t, dir); len(files) != 1 {
+		t.Fatalf("expected 1 spill file, got %v", files)
+	}
+
+	x, found := tc.Get("a")
+	if !found || x.(int) != 1 {
+		t.Fatalf("a wasn't read back from disk: %v, %v", x, found)
+	}
+	// Promoting a evicted b, the least recently used item.
+	if _, found := tc.Items()["b"]; found {
+		t.Error("b is still in memory after a was promoted")
+	}
+	if x, _, found := tc.GetWithExpiration("b"); !found || x.(string) != "two" {
+		t.Errorf("b wasn't read back from disk: %v, %v", x, found)
+	}
+	if len(evicted) != 0 {
+		t.Errorf("spilled items were passed to OnEvicted: %v", evicted)
+	}
+}
+
+func TestDiskOverflowDelete(t *testing.T) {
+	dir := t.TempDir()
+	tc := NewWithCapacity(DefaultExpiration, 0, 1, EvictionPolicyLRU, WithDiskOverflow(dir, nil))
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Delete("a")
+	if _, found := tc.Get("a"); found {
+		t.Error("a was found after being deleted")
+	}
+	if files := spillFiles(t, dir); len(files) != 0 {
+		t.Errorf("Delete left spill files behind: %v", files)
+	}
+
+	tc.Set("c", 3, DefaultExpiration)
+	tc.Flush()
+	if _, found := tc.Get("b"); found {
+		t.Error("b was found after Flush")
+	}
+	if files := spillFiles(t, dir); len(files) != 0 {
+		t.Errorf("Flush left spill files behind: %v", files)
+	}
+}
+
+func TestDiskOverflowSetReplacesSpilled(t *testing.T) {
+	dir := t.TempDir()
+	tc := NewWithCapacity(DefaultExpiration, 0, 1, EvictionPolicyLRU, WithDiskOverflow(dir, nil))
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("a", 10, DefaultExpiration)
+	// a was set again, and b spilled in its place.
+	if x, _ := tc.Get("a"); x.(int) != 10 {
+		t.Errorf("a is %v, not 10", x)
+	}
+	if files := spillFiles(t, dir); len(files) != 1 {
+		t.Errorf("expected 1 spill file, got %v", files)
+	}
+}
+
+func TestDiskOverflowExpired(t *testing.T) {
+	dir := t.TempDir()
+	tc := NewWithCapacity(DefaultExpiration, 0, 1, EvictionPolicyLRU, WithDiskOverflow(dir, nil))
+	tc.Set("a", 1, 20*time.Millisecond)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, 20*time.Millisecond)
+	<-time.After(30 * time.Millisecond)
+	tc.DeleteExpired()
+	if files := spillFiles(t, dir); len(files) != 1 {
+		t.Errorf("expected only b's spill file to remain, got %v", files)
+	}
+	if _, found := tc.Get("a"); found {
+		t.Error("expired a was read back from disk")
+	}
+	if x, found := tc.Get("b"); !found || x.(int) != 2 {
+		t.Errorf("b wasn't read back from disk: %v, %v", x, found)
+	}
+}
+
+func TestDiskOverflowCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+	tc := NewWithCapacity(DefaultExpiration, 0, 1, EvictionPolicyLRU, WithDiskOverflow(dir, GzipCodec{}))
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	files := spillFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("expected 1 spill file, got %v", files)
+	}
+	if err := os.WriteFile(files[0], []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := tc.Get("a"); found {
+		t.Error("a was read back from a corrupt file")
+	}
+	if x, found := tc.Get("b"); !found || x.(int) != 2 {
+		t.Errorf("b is %v, %v after a corrupt read", x, found)
+	}
+	if files := spillFiles(t, dir); len(files) != 0 {
+		t.Errorf("the corrupt file wasn't removed: %v", files)
+	}
+}
+
+func TestDiskOverflowRemovesStaleFiles(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "stale"+spillExt)
+	other := filepath.Join(dir, "other.txt")
+	for _, f := range []string{stale, other} {
+		if err := os.WriteFile(f, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	NewWithCapacity(DefaultExpiration, 0, 1, EvictionPolicyLRU, WithDiskOverflow(dir, nil))
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("a stale spill file wasn't removed")
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("an unrelated file was removed: %v", err)
+	}
+}
+
+func TestDiskOverflowOnEvicted(t *testing.T) {
+	tc := NewWithCapacity(DefaultExpiration, 0, 1, EvictionPolicyLRU, WithDiskOverflow(t.TempDir(), nil))
+	evicted := map[string]EvictionReason{}
+	values := map[string]interface{}{}
+	tc.OnEvictedWithReason(func(k string, v interface{}, reason EvictionReason) {
+		if _, found := evicted[k]; found {
+			t.Errorf("OnEvicted was called twice for %s", k)
+		}
+		evicted[k] = reason
+		values[k] = v
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, time.Millisecond)
+	tc.Set("c", 3, DefaultExpiration)
+	tc.Set("d", 4, DefaultExpiration)
+	// a, b and c are on disk.
+	tc.Delete("a")
+	<-time.After(5 * time.Millisecond)
+	tc.DeleteExpired()
+	tc.Flush()
+	want := map[string]EvictionReason{
+		"a": EvictionReasonDeleted,
+		"b": EvictionReasonExpired,
+		"c": EvictionReasonDeleted,
+		"d": EvictionReasonDeleted,
+	}
+	if len(evicted) != len(want) {
+		t.Errorf("OnEvicted was called for %v", evicted)
+	}
+	for k, reason := range want {
+		if evicted[k] != reason {
+			t.Errorf("%s was evicted as %v, not %v", k, evicted[k], reason)
+		}
+	}
+	if values["a"] != 1 || values["c"] != 3 {
+		t.Errorf("spilled items were passed with values %v", values)
+	}
+}
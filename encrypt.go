@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrSnapshotDecrypt is returned by LoadEncrypted if a snapshot can't be
+// decrypted because the key is wrong or the snapshot was tampered with or
+// truncated.
+var ErrSnapshotDecrypt = errors.New("Couldn't decrypt snapshot: wrong key or tampered data")
+
+// An encrypted snapshot starts with a header made up of encryptedMagic, the
+// format version and a random nonce prefix, followed by chunks of at most
+// encryptedChunkSize bytes of the Save output, each sealed with AES-GCM and
+// preceded by its length, whose top bit marks the last chunk. A chunk's nonce
+// is the prefix followed by the chunk's index, and its additional data is the
+// header followed by the last chunk marker, so chunks can't be reordered,
+// dropped or moved between snapshots.
+const (
+	encryptedMagic      = "GCES"
+	encryptedVersion    = 1
+	encryptedPrefixSize = 8
+	encryptedHeaderSize = len(encryptedMagic) + 1 + encryptedPrefixSize
+	encryptedLastChunk  = 1 << 31
+)
+
+// A variable so that tests can use small chunks.
+var encryptedChunkSize = 64 << 10
+
+type encryptedWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	n      uint32
+	buf    []byte
+	err    error
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newEncryptedWriter(w io.Writer, key []byte) (*encryptedWriter, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, encryptedHeaderSize)
+	copy(header, encryptedMagic)
+	header[len(encryptedMagic)] = encryptedVersion
+	if _, err := io.ReadFull(rand.Reader, header[len(encryptedMagic)+1:]); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptedWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		buf:    make([]byte, 0, encryptedChunkSize),
+	}, nil
+}
+
+func chunkNonce(header []byte, n uint32) []byte {
+	nonce := make([]byte, encryptedPrefixSize+4)
+	copy(nonce, header[len(encryptedMagic)+1:])
+	binary.BigEndian.PutUint32(nonce[encryptedPrefixSize:], n)
+	return nonce
+}
+
+func chunkAD(header []byte, last bool) []byte {
+	ad := append([]byte{}, header...)
+	if last {
+		return append(ad, 1)
+	}
+	return append(ad, 0)
+}
+
+func (e *encryptedWriter) seal(last bool) error {
+	if e.n == ^uint32(0) {
+		return errors.New("Snapshot is too large to encrypt")
+	}
+	sealed := e.aead.Seal(nil, chunkNonce(e.header, e.n), e.buf, chunkAD(e.header, last))
+	e.n++
+	e.buf = e.buf[:0]
+	size := uint32(len(sealed))
+	if last {
+		size |= encryptedLastChunk
+	}
+	var l [4]byte
+	binary.BigEndian.PutUint32(l[:], size)
+	if _, err := e.w.Write(l[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+func (e *encryptedWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	written := 0
+	for len(p) > 0 {
+		if len(e.buf) == encryptedChunkSize {
+			if e.err = e.seal(false); e.err != nil {
+				return written, e.err
+			}
+		}
+		n := copy(e.buf[len(e.buf):encryptedChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Seals the last chunk, which may be empty.
+func (e *encryptedWriter) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	e.err = e.seal(true)
+	return e.err
+}
+
+// Decrypts a whole encrypted snapshot from r, verifying every chunk.
+func decryptSnapshot(r io.Reader, key []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, encryptedHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrSnapshotDecrypt
+	}
+	if string(header[:len(encryptedMagic)]) != encryptedMagic {
+		return nil, fmt.Errorf("Not an encrypted snapshot")
+	}
+	if v := header[len(encryptedMagic)]; v != encryptedVersion {
+		return nil, fmt.Errorf("Unsupported encrypted snapshot version %d", v)
+	}
+	var (
+		out   bytes.Buffer
+		l     [4]byte
+		chunk []byte
+	)
+	for n := uint32(0); ; n++ {
+		if _, err := io.ReadFull(r, l[:]); err != nil {
+			// Truncated before the last chunk.
+			return nil, ErrSnapshotDecrypt
+		}
+		size := binary.BigEndian.Uint32(l[:])
+		last := size&encryptedLastChunk != 0
+		size &^= encryptedLastChunk
+		if int(size) > encryptedChunkSize+aead.Overhead() {
+			return nil, ErrSnapshotDecrypt
+		}
+		if uint32(cap(chunk)) < size {
+			chunk = make([]byte, size)
+		}
+		chunk = chunk[:size]
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, ErrSnapshotDecrypt
+		}
+		p, err := aead.Open(chunk[:0], chunkNonce(header, n), chunk, chunkAD(header, last))
+		if err != nil {
+			return nil, ErrSnapshotDecrypt
+		}
+		out.Write(p)
+		if last {
+			break
+		}
+	}
+	if n, _ := r.Read(l[:1]); n != 0 {
+		// Data was appended after the last chunk.
+		return nil, ErrSnapshotDecrypt
+	}
+	return out.Bytes(), nil
+}
+
+// SaveEncrypted writes the cache's items to w like Save, encrypted with
+// AES-GCM using key, which must be 16, 24 or 32 bytes long to select AES-128,
+// AES-192 or AES-256. Each snapshot uses a new random nonce.
+func (c *cache) SaveEncrypted(w io.Writer, key []byte) error {
+	ew, err := newEncryptedWriter(w, key)
+	if err != nil {
+		return err
+	}
+	if err := c.Save(ew); err != nil {
+		return err
+	}
+	return ew.Close()
+}
+
+// LoadEncrypted adds the items in a snapshot written by SaveEncrypted to the
+// cache like Load. The whole snapshot is decrypted and verified before any item
+// is added: if key is wrong, or the snapshot was tampered with or truncated,
+// ErrSnapshotDecrypt is returned and the cache is left unchanged.
+func (c *cache) LoadEncrypted(r io.Reader, key []byte) error {
+	b, err := decryptSnapshot(r, key)
+	if err != nil {
+		return err
+	}
+	return c.Load(bytes.NewReader(b))
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestSaveLoadEncrypted(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("a", "aaa", DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	fp := &bytes.Buffer{}
+	if err := tc.SaveEncrypted(fp, testKey); err != nil {
+		t.Fatal("Couldn't save encrypted cache:", err)
+	}
+	if bytes.Contains(fp.Bytes(), []byte("aaa")) {
+		t.Error("encrypted snapshot contains a plaintext value")
+	}
+	oc := New(DefaultExpiration, 0)
+	if err := oc.LoadEncrypted(fp, testKey); err != nil {
+		t.Fatal("Couldn't load encrypted cache:", err)
+	}
+	if x, found := oc.Get("a"); !found || x.(string) != "aaa" {
+		t.Error("a was not loaded")
+	}
+	if x, found := oc.Get("b"); !found || x.(int) != 2 {
+		t.Error("b was not loaded")
+	}
+}
+
+func TestSaveEncryptedUsesNewNonce(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("a", "aaa", DefaultExpiration)
+	fp1, fp2 := &bytes.Buffer{}, &bytes.Buffer{}
+	tc.SaveEncrypted(fp1, testKey)
+	tc.SaveEncrypted(fp2, testKey)
+	if bytes.Equal(fp1.Bytes(), fp2.Bytes()) {
+		t.Error("two snapshots of the same cache are identical")
+	}
+}
+
+func TestSaveLoadEncryptedChunks(t *testing.T) {
+	defer func(n int) { encryptedChunkSize = n }(encryptedChunkSize)
+	encryptedChunkSize = 1024
+	tc := New(DefaultExpiration, 0)
+	for i := 0; i < 1000; i++ {
+		tc.Set("foo"+strconv.Itoa(i), strings.Repeat("x", i), DefaultExpiration)
+	}
+	fp := &bytes.Buffer{}
+	if err := tc.SaveEncrypted(fp, testKey); err != nil {
+		t.Fatal("Couldn't save encrypted cache:", err)
+	}
+	if fp.Len() < 100*encryptedChunkSize {
+		t.Fatalf("snapshot is only %d bytes", fp.Len())
+	}
+	oc := New(DefaultExpiration, 0)
+	if err := oc.LoadEncrypted(fp, testKey); err != nil {
+		t.Fatal("Couldn't load encrypted cache:", err)
+	}
+	if n := oc.ItemCount(); n != 1000 {
+		t.Errorf("%d items were loaded, not 1000", n)
+	}
+	if x, found := oc.Get("foo999"); !found || len(x.(string)) != 999 {
+		t.Error("foo999 was not loaded")
+	}
+}
+
+func TestLoadEncryptedTampered(t *testing.T) {
+	defer func(n int) { encryptedChunkSize = n }(encryptedChunkSize)
+	encryptedChunkSize = 256
+	tc := New(DefaultExpiration, 0)
+	for i := 0; i < 100; i++ {
+		tc.Set("foo"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+	fp := &bytes.Buffer{}
+	if err := tc.SaveEncrypted(fp, testKey); err != nil {
+		t.Fatal("Couldn't save encrypted cache:", err)
+	}
+	snapshot := fp.Bytes()
+	load := func(b []byte, key []byte) error {
+		oc := New(DefaultExpiration, 0)
+		err := oc.LoadEncrypted(bytes.NewReader(b), key)
+		if err != nil && oc.ItemCount() != 0 {
+			t.Error("items were loaded from an invalid snapshot")
+		}
+		return err
+	}
+
+	wrongKey := append([]byte{}, testKey...)
+	wrongKey[0] ^= 1
+	if err := load(snapshot, wrongKey); err != ErrSnapshotDecrypt {
+		t.Errorf("wrong key: got %v, not ErrSnapshotDecrypt", err)
+	}
+	// Flip a bit in the nonce prefix, a length and some ciphertext.
+	for _, i := range []int{len(encryptedMagic) + 1, encryptedHeaderSize + 2, encryptedHeaderSize + 10, len(snapshot) / 2, len(snapshot) - 1} {
+		b := append([]byte{}, snapshot...)
+		b[i] ^= 0x40
+		if err := load(b, testKey); err != ErrSnapshotDecrypt {
+			t.Errorf("bit flip at %d: got %v, not ErrSnapshotDecrypt", i, err)
+		}
+	}
+	for _, n := range []int{encryptedHeaderSize - 1, encryptedHeaderSize, encryptedHeaderSize + 4 + encryptedChunkSize + 16, len(snapshot) - 1} {
+		if err := load(snapshot[:n], testKey); err != ErrSnapshotDecrypt {
+			t.Errorf("truncated to %d bytes: got %v, not ErrSnapshotDecrypt", n, err)
+		}
+	}
+	if err := load(append(append([]byte{}, snapshot...), 0), testKey); err != ErrSnapshotDecrypt {
+		t.Errorf("appended data: got %v, not ErrSnapshotDecrypt", err)
+	}
+	if err := load(snapshot, testKey); err != nil {
+		t.Errorf("original snapshot couldn't be loaded: %v", err)
+	}
+}
+
+func TestLoadEncryptedNotEncrypted(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	fp := &bytes.Buffer{}
+	tc.Save(fp)
+	err := New(DefaultExpiration, 0).LoadEncrypted(fp, testKey)
+	if err == nil || err == ErrSnapshotDecrypt {
+		t.Errorf("loading a plain snapshot returned %v", err)
+	}
+}
+
+func TestSaveEncryptedInvalidKey(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	if err := tc.SaveEncrypted(&bytes.Buffer{}, []byte("short")); err == nil {
+		t.Error("SaveEncrypted accepted a 5 byte key")
+	}
+}
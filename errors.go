@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrItemExists is the Kind of the error Add returns when an unexpired item
+// already exists for the key.
+var ErrItemExists = errors.New("Item already exists")
+
+// CacheError is the error returned when an operation on a key fails, e.g.
+// Increment on a missing item or one whose value isn't a number. It unwraps to
+// its Kind, so it can be matched with errors.Is against the package's sentinel
+// errors, while errors.As extracts the key and operation:
+//
+//	var ce *cache.CacheError
+//	if errors.As(err, &ce) && errors.Is(err, cache.ErrKeyNotFound) {
+//		log.Printf("%s: no such key %s", ce.Op, ce.Key)
+//	}
+type CacheError struct {
+	// Op is the name of the method that failed, e.g. "IncrementInt64".
+	Op string
+	// Key is the key it was called with.
+	Key string
+	// Kind is the sentinel error describing the failure: ErrKeyNotFound,
+	// ErrItemExists, ErrWrongType, ErrTooManyTags or ErrTombstoned.
+	Kind error
+	// The description of the failure, naming the key.
+	msg string
+}
+
+func (e *CacheError) Error() string {
+	return e.Op + ": " + e.msg
+}
+
+func (e *CacheError) Unwrap() error {
+	return e.Kind
+}
+
+// Returns a *CacheError for op on k. format describes the failure, starting
+// with a verb for the key, which is followed by args.
+func keyError(op, k string, kind error, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, append([]interface{}{k}, args...)...)
+	return &CacheError{Op: op, Key: k, Kind: kind, msg: msg}
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The methods of Cache and ShardedCache that return errors for a key.
+type keyErrorer interface {
+	Set(k string, x interface{}, d time.Duration)
+	Add(k string, x interface{}, d time.Duration) error
+	Replace(k string, x interface{}, d time.Duration) error
+	Increment(k string, n int64) error
+	Decrement(k string, n int64) error
+	IncrementFloat(k string, n float64) error
+	Decode(k string, dst interface{}) error
+	SetWithTags(k string, x interface{}, d time.Duration, tags ...string) error
+}
+
+func TestCacheError(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		new  func() keyErrorer
+	}{
+		{"Cache", func() keyErrorer { return New(DefaultExpiration, 0, WithMaxTagsPerItem(1)) }},
+		{"ShardedCache", func() keyErrorer { return NewShardedWithOptions(WithShards(3), WithMaxTagsPerItem(1)) }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := tt.new()
+			tc.Set("str", "bar", DefaultExpiration)
+			var i int
+			for _, op := range []struct {
+				op   string
+				key  string
+				kind error
+				call func() error
+			}{
+				{"Add", "str", ErrItemExists, func() error { return tc.Add("str", 1, DefaultExpiration) }},
+				{"Replace", "missing", ErrKeyNotFound, func() error { return tc.Replace("missing", 1, DefaultExpiration) }},
+				{"Increment", "missing", ErrKeyNotFound, func() error { return tc.Increment("missing", 1) }},
+				{"Increment", "str", ErrWrongType, func() error { return tc.Increment("str", 1) }},
+				{"Decrement", "missing", ErrKeyNotFound, func() error { return tc.Decrement("missing", 1) }},
+				{"Decrement", "str", ErrWrongType, func() error { return tc.Decrement("str", 1) }},
+				{"IncrementFloat", "str", ErrWrongType, func() error { return tc.IncrementFloat("str", 1) }},
+				{"Decode", "missing", ErrKeyNotFound, func() error { return tc.Decode("missing", &i) }},
+				{"Decode", "str", ErrWrongType, func() error { return tc.Decode("str", &i) }},
+				{"GetAs", "str", ErrWrongType, func() error {
+					_, _, err := GetAs[int](tc.(Store), "str")
+					return err
+				}},
+				{"SetWithTags", "tagged", ErrTooManyTags, func() error {
+					return tc.SetWithTags("tagged", 1, DefaultExpiration, "a", "b")
+				}},
+			} {
+				err := op.call()
+				var ce *CacheError
+				if !errors.As(err, &ce) {
+					t.Errorf("%s(%s): got %v, want a *CacheError", op.op, op.key, err)
+					continue
+				}
+				if ce.Op != op.op || ce.Key != op.key {
+					t.Errorf("%s(%s): got Op %q and Key %q", op.op, op.key, ce.Op, ce.Key)
+				}
+				if !errors.Is(err, op.kind) {
+					t.Errorf("%s(%s): %v doesn't wrap %v", op.op, op.key, err, op.kind)
+				}
+				if msg := err.Error(); !strings.HasPrefix(msg, op.op+": ") || !strings.Contains(msg, op.key) {
+					t.Errorf("%s(%s): message %q doesn't name the operation and key", op.op, op.key, msg)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheErrorTypedIncrement(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("str", "bar", DefaultExpiration)
+	_, err := tc.IncrementInt64("missing", 1)
+	var ce *CacheError
+	if !errors.As(err, &ce) || ce.Op != "IncrementInt64" || ce.Key != "missing" || !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("got %#v", err)
+	}
+	_, err = tc.DecrementUint8("str", 1)
+	if !errors.As(err, &ce) || ce.Op != "DecrementUint8" || ce.Key != "str" || !errors.Is(err, ErrWrongType) {
+		t.Errorf("got %#v", err)
+	}
+	if want := "DecrementUint8: The value for str is not an uint8"; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+}
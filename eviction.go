@@ -0,0 +1,931 @@
+package cache
+
+import (
+	"container/list"
+	"math"
+	insecurerand "math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EvictionReason describes why an item was removed from the cache. See
+// OnEvictedWithReason.
+type EvictionReason int
+
+const (
+	// EvictionReasonDeleted means the item was removed explicitly, e.g. using
+	// Delete, Flush or InvalidateTag.
+	EvictionReasonDeleted EvictionReason = iota
+	// EvictionReasonExpired means the item expired and was removed by
+	// DeleteExpired (or the janitor), or removed or overwritten in any other way
+	// after it expired.
+	EvictionReasonExpired
+	// EvictionReasonCapacity means the item was evicted to make room for
+	// another in a capacity-limited cache.
+	EvictionReasonCapacity
+)
+
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictionReasonDeleted:
+		return "deleted"
+	case EvictionReasonExpired:
+		return "expired"
+	case EvictionReasonCapacity:
+		return "capacity"
+	}
+	return "unknown"
+}
+
+// EvictionPolicy selects which item a capacity-limited cache evicts when an
+// item is added while the cache is full. See NewWithCapacity.
+type EvictionPolicy int
+
+const (
+	// EvictionPolicyLRU evicts the least recently used item. Every Get moves
+	// the item to the front of a list, which requires a (short) exclusive lock.
+	EvictionPolicyLRU EvictionPolicy = iota
+	// EvictionPolicyRandom evicts an item chosen at random.
+	EvictionPolicyRandom
+	// EvictionPolicyClock approximates LRU using the CLOCK (second-chance)
+	// algorithm: Get only sets a per-item referenced bit, and a sweeping hand
+	// evicts the first item whose bit is clear, clearing bits as it goes.
+	EvictionPolicyClock
+	// EvictionPolicyARC uses the adaptive replacement cache algorithm, which
+	// balances between recently and frequently used items depending on the
+	// workload. It remembers (only) the keys of as many recently evicted
+	// items as the cache's capacity to detect which of the two would have been
+	// the better choice.
+	EvictionPolicyARC
+	// EvictionPolicySegmentedLRU splits the cache into a probationary and a
+	// protected segment, each ordered by recency. New items enter probation
+	// and are promoted to the protected segment when read. Items are evicted
+	// from probation first, and the least recently used protected items are
+	// demoted back to probation when the protected segment is full, so a scan
+	// of items that are only read once can't evict the protected items. The
+	// protected segment's size can be set using WithProtectedRatio.
+	EvictionPolicySegmentedLRU
+	// EvictionPolicyExpiration evicts the item that expires soonest, treating
+	// items that never expire as expiring last. Ties between items with the
+	// same expiration time are broken by the function set using
+	// WithTieBreaker, which defaults to TieBreakByInsertion. Choosing a victim
+	// takes time proportional to the number of items in the cache.
+	EvictionPolicyExpiration
+)
+
+// An EvictionCandidate describes an item considered for eviction by a tie
+// breaker. See WithTieBreaker.
+type EvictionCandidate struct {
+	Key string
+	// The order in which the item was added to the cache. Items added earlier
+	// have lower numbers.
+	Inserted uint64
+	// The number of times the item was read or overwritten since it was added.
+	Accesses uint64
+}
+
+// TieBreakByInsertion prefers evicting the item that was added first.
+func TieBreakByInsertion(a, b EvictionCandidate) bool {
+	return a.Inserted < b.Inserted
+}
+
+// TieBreakByAccessCount prefers evicting the item that was accessed the fewest
+// times, keeping hot items, and the one that was added first if both were
+// accessed equally often.
+func TieBreakByAccessCount(a, b EvictionCandidate) bool {
+	if a.Accesses != b.Accesses {
+		return a.Accesses < b.Accesses
+	}
+	return a.Inserted < b.Inserted
+}
+
+// Tracks the keys in a capacity-limited cache to pick eviction victims. All
+// methods except Access are called with the cache's write lock held. Access is
+// called on every Get hit with (at least) the cache's read lock held, so it
+// must be safe for concurrent use with itself.
+type evictor interface {
+	// A new key was added to the cache.
+	Add(k string)
+	// An existing key was read or overwritten.
+	Access(k string)
+	// A key was removed from the cache.
+	Remove(k string)
+	// Returns the key that should be evicted next to make room for incoming,
+	// which hasn't been added yet, and stops tracking it. Keys for which skip
+	// returns true, e.g. because they are pinned, must not be chosen.
+	Victim(incoming string, skip func(k string) bool) (string, bool)
+	// All keys were removed from the cache.
+	Reset()
+}
+
+func newEvictor(c *cache, p EvictionPolicy, maxItems int, o *options) evictor {
+	switch p {
+	case EvictionPolicyExpiration:
+		return newExpirationEvictor(c, o.tieBreaker)
+	case EvictionPolicyRandom:
+		return newRandomEvictor()
+	case EvictionPolicyClock:
+		return newClockEvictor()
+	case EvictionPolicyARC:
+		return newARCEvictor(maxItems)
+	case EvictionPolicySegmentedLRU:
+		return newSLRUEvictor(int(float64(maxItems) * o.protectedRatio))
+	default:
+		return newLRUEvictor()
+	}
+}
+
+// Makes room for k if the cache is at capacity and k isn't already in it by
+// evicting items chosen by the eviction policy. c.mu must be held. The OnEvicted
+// callbacks for the returned items must be run once c.mu has been released.
+func (c *cache) makeRoom(k string) []keyAndValue {
+	if _, found := c.items[k]; found {
+		c.evictor.Access(k)
+		return nil
+	}
+	evictedItems, _ := c.evictDownTo(k, c.maxItems-1)
+	c.evictor.Add(k)
+	if c.watermarks != nil && len(c.items) >= c.watermarks.soft {
+		c.watermarks.trigger()
+	}
+	return evictedItems
+}
+
+// Evicts items chosen by the eviction policy until at most n are left, to make
+// room for incoming (which may be empty), and returns the number evicted.
+// Stops early if every item left is pinned. c.mu must be held. The OnEvicted
+// callbacks for the returned items must be run once c.mu has been released.
+func (c *cache) evictDownTo(incoming string, n int) ([]keyAndValue, int) {
+	var evictedItems []keyAndValue
+	var tiers *priorityTiers
+	if len(c.prioritized) > 0 && len(c.items) > n {
+		tiers = c.priorityTiers()
+	}
+	removed := 0
+	for len(c.items) > n {
+		victim, ok := c.victim(incoming, tiers)
+		if !ok {
+			break
+		}
+		removed++
+		item, found := c.items[victim]
+		ov, evicted := c.delete(victim)
+		if found && c.disk != nil && c.disk.spill(victim, item) {
+			continue
+		}
+		if evicted {
+			reason := EvictionReasonCapacity
+			if c.expired(item) {
+				reason = EvictionReasonExpired
+			}
+			evictedItems = append(evictedItems, keyAndValue{victim, ov, reason})
+		}
+	}
+	return evictedItems, removed
+}
+
+// Returns the next key to evict to make room for k. If tiers is nil, no item
+// has a priority other than PriorityNormal, so the eviction policy alone
+// decides.
+func (c *cache) victim(k string, tiers *priorityTiers) (string, bool) {
+	if tiers == nil {
+		return c.evictor.Victim(k, c.unevictable)
+	}
+	return tiers.victim(c, k)
+}
+
+// Reports whether k may not be evicted to make room for other items: it's
+// pinned, or was stored by ComputeOnce.
+func (c *cache) unevictable(k string) bool {
+	return c.isPinned(k) || c.items[k].Once
+}
+
+func (c *cache) isPinned(k string) bool {
+	_, found := c.pinned[k]
+	return found
+}
+
+// The pins on a key. See Pin.
+type pinEntry struct {
+	refs int
+	// Whether the item's expiration was paused, and how long it had left.
+	paused    bool
+	remaining int64
+}
+
+// Pin prevents the item with the given key, now or once it is set, from being
+// evicted to make room for other items in a capacity-limited cache, and from
+// expiring, until Unpin is called. Returns whether an unexpired item with the
+// key is in the cache.
+//
+// The expiration of a pinned item is paused rather than ignored: while pinned,
+// the item never expires (GetWithExpiration reports no expiration time), and
+// when the last pin is removed it gets back the time it had left when it was
+// pinned, or when it was set if that was later. Copies of the item made
+// outside the cache, by Items, RangeTTL, Save, Page and the other methods that
+// export items, carry the expiration time it would get if it were unpinned
+// then, so that it isn't lost, e.g. across Save and Load. An item that has already
+// expired isn't revived. Pinned items can still be deleted, and Flush keeps
+// them.
+//
+// Pins are counted: the item stays pinned until Unpin has been called as many
+// times as Pin, so independent callers can't unpin each other's items.
+//
+// Pinned items count towards the cache's capacity, but aren't evicted: if too
+// many items are pinned, the cache grows beyond its capacity.
+func (c *cache) Pin(k string) bool {
+	c.mu.Lock()
+	if c.pinned == nil {
+		c.pinned = map[string]*pinEntry{}
+	}
+	p := c.pinned[k]
+	if p == nil {
+		p = &pinEntry{}
+		c.pinned[k] = p
+		c.pauseExpiration(k, p)
+	}
+	p.refs++
+	_, found := c.get(k)
+	c.mu.Unlock()
+	return found
+}
+
+// Unpin removes a pin added by Pin. Once all pins on the key are removed, the
+// item can be evicted again, and its expiration resumes. Returns false if the
+// key wasn't pinned.
+func (c *cache) Unpin(k string) bool {
+	c.mu.Lock()
+	p := c.pinned[k]
+	if p == nil {
+		c.mu.Unlock()
+		return false
+	}
+	p.refs--
+	if p.refs == 0 {
+		delete(c.pinned, k)
+		if item, found := c.items[k]; found && p.paused && item.Expiration == 0 {
+			item.Expiration = c.now().UnixNano() + p.remaining
+			c.items[k] = item
+			c.noteExpiration(item.Expiration)
+		}
+	}
+	c.mu.Unlock()
+	return true
+}
+
+// PinnedCount returns the number of pinned keys, including keys that were
+// pinned before their items were set, or whose items have been deleted.
+func (c *cache) PinnedCount() int {
+	c.mu.RLock()
+	n := len(c.pinned)
+	c.mu.RUnlock()
+	return n
+}
+
+// Pauses the expiration of k, which was just pinned or stored while pinned.
+// c.mu must be held.
+func (c *cache) pauseExpiration(k string, p *pinEntry) {
+	p.paused = false
+	item, found := c.items[k]
+	if !found || item.Expiration <= 0 {
+		return
+	}
+	now := c.now().UnixNano()
+	if now > item.Expiration {
+		return
+	}
+	p.paused, p.remaining = true, item.Expiration-now
+	item.Expiration = 0
+	c.items[k] = item
+}
+
+// Returns v, the item stored for k, with the expiration time it would get if
+// its paused expiration (see Pin) resumed at now, so that copies of the item
+// made outside the cache, e.g. by Items or Save, don't lose it. c.mu must be
+// held.
+func (c *cache) withPausedExpiration(k string, v Item, now int64) Item {
+	if len(c.pinned) == 0 || v.Expiration != 0 {
+		return v
+	}
+	if p := c.pinned[k]; p != nil && p.paused {
+		v.Expiration = now + p.remaining
+	}
+	return v
+}
+
+// Pauses the expiration of k if it is pinned. Called whenever an item is
+// stored. c.mu must be held.
+func (c *cache) pinStored(k string) {
+	if len(c.pinned) == 0 {
+		return
+	}
+	if p := c.pinned[k]; p != nil {
+		c.pauseExpiration(k, p)
+	}
+}
+
+// RemainingCapacity returns the number of items that can be added to a
+// capacity-limited cache before items start being evicted to make room, or
+// zero or less if it is full (which it can exceed when items are pinned.)
+// Returns math.MaxInt if the cache is unbounded. Expired items that haven't
+// been cleaned up yet count towards the cache's capacity.
+func (c *cache) RemainingCapacity() int {
+	if c.maxItems <= 0 {
+		return math.MaxInt
+	}
+	c.mu.RLock()
+	n := c.maxItems - len(c.items)
+	c.mu.RUnlock()
+	return n
+}
+
+// Runs the OnEvicted callback for each of the given items, or the OnSet and
+// OnReplaced callbacks for those that were set, and sends their events to the
+// subscriptions created with WatchPattern. Must not be called
+// with c.mu held.
+func (c *cache) notifyEvicted(evictedItems []keyAndValue) {
+	if len(evictedItems) == 0 {
+		return
+	}
+	c.mu.RLock()
+	f, s, w := c.onEvicted, c.stats, c.watchers
+	onSet, onReplaced := c.onSet, c.onReplaced
+	c.mu.RUnlock()
+	if w != nil {
+		w.publish(c, evictedItems)
+	}
+	for _, v := range evictedItems {
+		if v.reason == reasonSet {
+			c.callOnSet(onSet, onReplaced, v.key, v.value.(*setEvent))
+			continue
+		}
+		if f == nil {
+			// Unset since the items were removed.
+			continue
+		}
+		c.callOnEvicted(f, s, v.key, v.value, v.reason)
+	}
+}
+
+// NewWithCapacity returns a new cache like New that holds at most maxItems
+// items. When an item is added to a full cache, an existing item chosen by the
+// given policy is evicted (and passed to the OnEvicted function, if any, with
+// EvictionReasonCapacity) to make room for it. If maxItems is less than one,
+// the cache is unbounded.
+func NewWithCapacity(defaultExpiration, cleanupInterval time.Duration, maxItems int, policy EvictionPolicy, opts ...Option) *Cache {
+	return NewWithOptions(withOptions(opts,
+		WithDefaultExpiration(defaultExpiration),
+		WithCleanupInterval(cleanupInterval),
+		WithMaxItems(maxItems),
+		WithEvictionPolicy(policy))...)
+}
+
+type lruEvictor struct {
+	mu       sync.Mutex
+	ll       *list.List
+	elements map[string]*list.Element
+}
+
+func newLRUEvictor() *lruEvictor {
+	return &lruEvictor{
+		ll:       list.New(),
+		elements: map[string]*list.Element{},
+	}
+}
+
+func (e *lruEvictor) Add(k string) {
+	e.mu.Lock()
+	e.elements[k] = e.ll.PushFront(k)
+	e.mu.Unlock()
+}
+
+func (e *lruEvictor) Access(k string) {
+	e.mu.Lock()
+	if el, found := e.elements[k]; found {
+		e.ll.MoveToFront(el)
+	}
+	e.mu.Unlock()
+}
+
+func (e *lruEvictor) Remove(k string) {
+	e.mu.Lock()
+	if el, found := e.elements[k]; found {
+		e.ll.Remove(el)
+		delete(e.elements, k)
+	}
+	e.mu.Unlock()
+}
+
+func (e *lruEvictor) Victim(incoming string, skip func(k string) bool) (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for el := e.ll.Back(); el != nil; el = el.Prev() {
+		k := el.Value.(string)
+		if skip(k) {
+			continue
+		}
+		e.ll.Remove(el)
+		delete(e.elements, k)
+		return k, true
+	}
+	return "", false
+}
+
+func (e *lruEvictor) Reset() {
+	e.mu.Lock()
+	e.ll.Init()
+	e.elements = map[string]*list.Element{}
+	e.mu.Unlock()
+}
+
+type randomEvictor struct {
+	keys []string
+	pos  map[string]int
+}
+
+func newRandomEvictor() *randomEvictor {
+	return &randomEvictor{
+		pos: map[string]int{},
+	}
+}
+
+func (e *randomEvictor) Add(k string) {
+	e.pos[k] = len(e.keys)
+	e.keys = append(e.keys, k)
+}
+
+func (e *randomEvictor) Access(k string) {}
+
+func (e *randomEvictor) Remove(k string) {
+	i, found := e.pos[k]
+	if !found {
+		return
+	}
+	last := len(e.keys) - 1
+	e.keys[i] = e.keys[last]
+	e.pos[e.keys[i]] = i
+	e.keys = e.keys[:last]
+	delete(e.pos, k)
+}
+
+func (e *randomEvictor) Victim(incoming string, skip func(k string) bool) (string, bool) {
+	if len(e.keys) == 0 {
+		return "", false
+	}
+	// Probe from a random position for the first key that isn't skipped.
+	start := insecurerand.Intn(len(e.keys))
+	for i := range e.keys {
+		k := e.keys[(start+i)%len(e.keys)]
+		if skip(k) {
+			continue
+		}
+		e.Remove(k)
+		return k, true
+	}
+	return "", false
+}
+
+func (e *randomEvictor) Reset() {
+	e.keys = nil
+	e.pos = map[string]int{}
+}
+
+type clockEntry struct {
+	key        string
+	referenced uint32 // atomic
+}
+
+// The ring is a slice of slots that the hand sweeps over. Slots of removed
+// entries are set to nil and reused by later additions.
+type clockEvictor struct {
+	ring    []*clockEntry
+	entries map[string]int
+	free    []int
+	hand    int
+}
+
+func newClockEvictor() *clockEvictor {
+	return &clockEvictor{
+		entries: map[string]int{},
+	}
+}
+
+func (e *clockEvictor) Add(k string) {
+	ce := &clockEntry{key: k}
+	if n := len(e.free); n > 0 {
+		i := e.free[n-1]
+		e.free = e.free[:n-1]
+		e.ring[i] = ce
+		e.entries[k] = i
+		return
+	}
+	e.entries[k] = len(e.ring)
+	e.ring = append(e.ring, ce)
+}
+
+// Access is the only work CLOCK does on the Get path: a single atomic store.
+// The entries map is only modified with the cache's write lock held, so it is
+// safe to read here.
+func (e *clockEvictor) Access(k string) {
+	if i, found := e.entries[k]; found {
+		atomic.StoreUint32(&e.ring[i].referenced, 1)
+	}
+}
+
+func (e *clockEvictor) Remove(k string) {
+	i, found := e.entries[k]
+	if !found {
+		return
+	}
+	e.ring[i] = nil
+	e.free = append(e.free, i)
+	delete(e.entries, k)
+}
+
+func (e *clockEvictor) Victim(incoming string, skip func(k string) bool) (string, bool) {
+	if len(e.entries) == 0 {
+		return "", false
+	}
+	// After one full sweep every referenced bit has been cleared, so this
+	// finds a victim within two unless every key is skipped.
+	for i := 0; i < 2*len(e.ring)+1; i++ {
+		if e.hand >= len(e.ring) {
+			e.hand = 0
+		}
+		ce := e.ring[e.hand]
+		e.hand++
+		if ce == nil {
+			continue
+		}
+		if skip(ce.key) {
+			continue
+		}
+		if atomic.LoadUint32(&ce.referenced) == 1 {
+			atomic.StoreUint32(&ce.referenced, 0)
+			continue
+		}
+		e.Remove(ce.key)
+		return ce.key, true
+	}
+	return "", false
+}
+
+func (e *clockEvictor) Reset() {
+	e.ring = nil
+	e.entries = map[string]int{}
+	e.free = nil
+	e.hand = 0
+}
+
+// Implements ARC as described in "ARC: A Self-Tuning, Low Overhead Replacement
+// Cache" (Megiddo & Modha, 2003.) t1 holds keys seen once recently and t2 keys
+// seen at least twice; b1 and b2 are the ghost lists of keys recently evicted
+// from t1 and t2 respectively. p is the target size of t1.
+type arcEvictor struct {
+	mu             sync.Mutex
+	c              int
+	p              int
+	t1, t2, b1, b2 *list.List
+	elements       map[string]*list.Element
+	// The incoming key p was last adapted for, so that a ghost hit is only
+	// counted once even if Victim is called several times before Add.
+	adapted   string
+	isAdapted bool
+}
+
+func newARCEvictor(c int) *arcEvictor {
+	return &arcEvictor{
+		c:        c,
+		t1:       list.New(),
+		t2:       list.New(),
+		b1:       list.New(),
+		b2:       list.New(),
+		elements: map[string]*list.Element{},
+	}
+}
+
+type arcEntry struct {
+	key string
+	l   *list.List
+}
+
+func (e *arcEvictor) push(l *list.List, k string) {
+	e.elements[k] = l.PushFront(&arcEntry{k, l})
+}
+
+func (e *arcEvictor) remove(el *list.Element) string {
+	entry := arcEntryOf(el)
+	entry.l.Remove(el)
+	delete(e.elements, entry.key)
+	return entry.key
+}
+
+func arcEntryOf(el *list.Element) *arcEntry {
+	return el.Value.(*arcEntry)
+}
+
+// Adjusts the target size of t1 if k is in one of the ghost lists: a hit in b1
+// means t1 should have been larger, a hit in b2 that t2 should have been.
+func (e *arcEvictor) adapt(k string) {
+	if e.isAdapted && e.adapted == k {
+		return
+	}
+	e.adapted, e.isAdapted = k, true
+	el, found := e.elements[k]
+	if !found {
+		return
+	}
+	switch arcEntryOf(el).l {
+	case e.b1:
+		delta := 1
+		if e.b2.Len() > e.b1.Len() {
+			delta = e.b2.Len() / e.b1.Len()
+		}
+		e.p += delta
+		if e.p > e.c {
+			e.p = e.c
+		}
+	case e.b2:
+		delta := 1
+		if e.b1.Len() > e.b2.Len() {
+			delta = e.b1.Len() / e.b2.Len()
+		}
+		e.p -= delta
+		if e.p < 0 {
+			e.p = 0
+		}
+	}
+}
+
+func (e *arcEvictor) Add(k string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.adapt(k)
+	e.isAdapted = false
+	if el, found := e.elements[k]; found {
+		// A ghost hit: k was evicted recently, so it goes straight to t2.
+		e.remove(el)
+		e.push(e.t2, k)
+		return
+	}
+	e.push(e.t1, k)
+	// Bound the ghost lists so that t1+b1 and t1+t2+b1+b2 hold at most c and
+	// 2c keys respectively.
+	if e.t1.Len()+e.b1.Len() > e.c && e.b1.Len() > 0 {
+		e.remove(e.b1.Back())
+	}
+	if e.t1.Len()+e.t2.Len()+e.b1.Len()+e.b2.Len() > 2*e.c && e.b2.Len() > 0 {
+		e.remove(e.b2.Back())
+	}
+}
+
+func (e *arcEvictor) Access(k string) {
+	e.mu.Lock()
+	if el, found := e.elements[k]; found {
+		switch arcEntryOf(el).l {
+		case e.t1:
+			e.remove(el)
+			e.push(e.t2, k)
+		case e.t2:
+			e.t2.MoveToFront(el)
+		}
+	}
+	e.mu.Unlock()
+}
+
+func (e *arcEvictor) Remove(k string) {
+	e.mu.Lock()
+	if el, found := e.elements[k]; found {
+		if l := arcEntryOf(el).l; l == e.t1 || l == e.t2 {
+			e.remove(el)
+		}
+	}
+	e.mu.Unlock()
+}
+
+func (e *arcEvictor) Victim(incoming string, skip func(k string) bool) (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.adapt(incoming)
+	inB2 := false
+	if el, found := e.elements[incoming]; found {
+		inB2 = arcEntryOf(el).l == e.b2
+	}
+	from, to := e.t2, e.b2
+	other, otherTo := e.t1, e.b1
+	if t1 := e.t1.Len(); t1 > 0 && (t1 > e.p || (inB2 && t1 == e.p) || e.t2.Len() == 0) {
+		from, to, other, otherTo = other, otherTo, from, to
+	}
+	// Fall back to the other list if every key in the preferred one is
+	// skipped.
+	if k, ok := e.evictFrom(from, to, skip); ok {
+		return k, true
+	}
+	return e.evictFrom(other, otherTo, skip)
+}
+
+// Moves the least recently used key in from that isn't skipped to the ghost
+// list to, and returns it.
+func (e *arcEvictor) evictFrom(from, to *list.List, skip func(k string) bool) (string, bool) {
+	for el := from.Back(); el != nil; el = el.Prev() {
+		k := arcEntryOf(el).key
+		if skip(k) {
+			continue
+		}
+		e.remove(el)
+		e.push(to, k)
+		return k, true
+	}
+	return "", false
+}
+
+func (e *arcEvictor) Reset() {
+	e.mu.Lock()
+	e.p = 0
+	e.t1.Init()
+	e.t2.Init()
+	e.b1.Init()
+	e.b2.Init()
+	e.elements = map[string]*list.Element{}
+	e.isAdapted = false
+	e.mu.Unlock()
+}
+
+// Segmented LRU: probation and protected are both ordered from most to least
+// recently used. protectedCap bounds the size of the protected segment.
+type slruEvictor struct {
+	mu           sync.Mutex
+	protectedCap int
+	probation    *list.List
+	protected    *list.List
+	elements     map[string]*list.Element
+}
+
+type slruEntry struct {
+	key       string
+	protected bool
+}
+
+func newSLRUEvictor(protectedCap int) *slruEvictor {
+	return &slruEvictor{
+		protectedCap: protectedCap,
+		probation:    list.New(),
+		protected:    list.New(),
+		elements:     map[string]*list.Element{},
+	}
+}
+
+func (e *slruEvictor) Add(k string) {
+	e.mu.Lock()
+	e.elements[k] = e.probation.PushFront(&slruEntry{key: k})
+	e.mu.Unlock()
+}
+
+// Access promotes k to the protected segment, or refreshes its recency there.
+// Both are O(1) list operations.
+func (e *slruEvictor) Access(k string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	el, found := e.elements[k]
+	if !found {
+		return
+	}
+	se := el.Value.(*slruEntry)
+	if se.protected {
+		e.protected.MoveToFront(el)
+		return
+	}
+	if e.protectedCap < 1 {
+		e.probation.MoveToFront(el)
+		return
+	}
+	e.probation.Remove(el)
+	se.protected = true
+	e.elements[k] = e.protected.PushFront(se)
+	if e.protected.Len() > e.protectedCap {
+		// Demote the least recently used protected item.
+		last := e.protected.Back()
+		de := e.protected.Remove(last).(*slruEntry)
+		de.protected = false
+		e.elements[de.key] = e.probation.PushFront(de)
+	}
+}
+
+func (e *slruEvictor) Remove(k string) {
+	e.mu.Lock()
+	if el, found := e.elements[k]; found {
+		e.remove(el)
+	}
+	e.mu.Unlock()
+}
+
+func (e *slruEvictor) remove(el *list.Element) string {
+	se := el.Value.(*slruEntry)
+	if se.protected {
+		e.protected.Remove(el)
+	} else {
+		e.probation.Remove(el)
+	}
+	delete(e.elements, se.key)
+	return se.key
+}
+
+func (e *slruEvictor) Victim(incoming string, skip func(k string) bool) (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, l := range []*list.List{e.probation, e.protected} {
+		for el := l.Back(); el != nil; el = el.Prev() {
+			if skip(el.Value.(*slruEntry).key) {
+				continue
+			}
+			return e.remove(el), true
+		}
+	}
+	return "", false
+}
+
+func (e *slruEvictor) Reset() {
+	e.mu.Lock()
+	e.probation.Init()
+	e.protected.Init()
+	e.elements = map[string]*list.Element{}
+	e.mu.Unlock()
+}
+
+type expirationEntry struct {
+	inserted uint64
+	accesses atomic.Uint64
+}
+
+type expirationEvictor struct {
+	c       *cache
+	less    func(a, b EvictionCandidate) bool
+	seq     uint64
+	entries map[string]*expirationEntry
+}
+
+func newExpirationEvictor(c *cache, less func(a, b EvictionCandidate) bool) *expirationEvictor {
+	if less == nil {
+		less = TieBreakByInsertion
+	}
+	return &expirationEvictor{
+		c:       c,
+		less:    less,
+		entries: map[string]*expirationEntry{},
+	}
+}
+
+func (e *expirationEvictor) Add(k string) {
+	e.seq++
+	e.entries[k] = &expirationEntry{inserted: e.seq}
+}
+
+func (e *expirationEvictor) Access(k string) {
+	// The map is only modified with the cache's write lock held.
+	if ent, ok := e.entries[k]; ok {
+		ent.accesses.Add(1)
+	}
+}
+
+func (e *expirationEvictor) Remove(k string) {
+	delete(e.entries, k)
+}
+
+func (e *expirationEvictor) candidate(k string, ent *expirationEntry) EvictionCandidate {
+	return EvictionCandidate{
+		Key:      k,
+		Inserted: ent.inserted,
+		Accesses: ent.accesses.Load(),
+	}
+}
+
+func (e *expirationEvictor) Victim(incoming string, skip func(k string) bool) (string, bool) {
+	var (
+		victim EvictionCandidate
+		exp    int64
+		found  bool
+	)
+	for k, ent := range e.entries {
+		if skip(k) {
+			continue
+		}
+		x := e.c.items[k].Expiration
+		if x <= 0 {
+			x = math.MaxInt64
+		}
+		cand := e.candidate(k, ent)
+		if !found || x < exp || (x == exp && e.less(cand, victim)) {
+			victim, exp, found = cand, x, true
+		}
+	}
+	if !found {
+		return "", false
+	}
+	delete(e.entries, victim.Key)
+	return victim.Key, true
+}
+
+func (e *expirationEvictor) Reset() {
+	e.entries = map[string]*expirationEntry{}
+}
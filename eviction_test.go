@@ -0,0 +1,607 @@
+package cache
+
+import (
+	"bytes"
+	"math"
+	insecurerand "math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var evictionPolicies = map[string]EvictionPolicy{
+	"LRU":        EvictionPolicyLRU,
+	"Random":     EvictionPolicyRandom,
+	"Clock":      EvictionPolicyClock,
+	"ARC":        EvictionPolicyARC,
+	"SLRU":       EvictionPolicySegmentedLRU,
+	"Expiration": EvictionPolicyExpiration,
+}
+
+func TestCapacity(t *testing.T) {
+	for name, p := range evictionPolicies {
+		tc := NewWithCapacity(DefaultExpiration, 0, 10, p)
+		evicted := 0
+		tc.OnEvicted(func(k string, v interface{}) {
+			evicted++
+		})
+		for i := 0; i < 100; i++ {
+			tc.Set("foo"+strconv.Itoa(i), i, DefaultExpiration)
+			if n := tc.ItemCount(); n > 10 {
+				t.Fatalf("%s: ItemCount is %d, more than the capacity", name, n)
+			}
+		}
+		if evicted != 90 {
+			t.Errorf("%s: %d items were evicted, not 90", name, evicted)
+		}
+		if _, found := tc.Get("foo99"); !found {
+			t.Errorf("%s: the most recently set item was evicted", name)
+		}
+		// Overwriting an existing item doesn't evict anything.
+		tc.Set("foo99", 0, DefaultExpiration)
+		if evicted != 90 {
+			t.Errorf("%s: overwriting an item evicted another", name)
+		}
+		tc.Delete("foo99")
+		if err := tc.Add("bar", 1, DefaultExpiration); err != nil {
+			t.Errorf("%s: couldn't add bar: %v", name, err)
+		}
+		if n := tc.ItemCount(); n != 10 {
+			t.Errorf("%s: ItemCount is %d, not 10", name, n)
+		}
+		tc.Flush()
+		for i := 0; i < 10; i++ {
+			tc.Set("baz"+strconv.Itoa(i), i, DefaultExpiration)
+		}
+		if n := tc.ItemCount(); n != 10 {
+			t.Errorf("%s: ItemCount is %d after Flush, not 10", name, n)
+		}
+	}
+}
+
+func TestRemainingCapacity(t *testing.T) {
+	tc := NewWithCapacity(DefaultExpiration, 0, 3, EvictionPolicyLRU)
+	if n := tc.RemainingCapacity(); n != 3 {
+		t.Errorf("RemainingCapacity is %d, not 3", n)
+	}
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	if n := tc.RemainingCapacity(); n != 1 {
+		t.Errorf("RemainingCapacity is %d, not 1", n)
+	}
+	tc.Set("c", 3, DefaultExpiration)
+	tc.Set("d", 4, DefaultExpiration)
+	if n := tc.RemainingCapacity(); n != 0 {
+		t.Errorf("RemainingCapacity is %d when full, not 0", n)
+	}
+	tc.Delete("d")
+	if n := tc.RemainingCapacity(); n != 1 {
+		t.Errorf("RemainingCapacity is %d after Delete, not 1", n)
+	}
+	if n := New(DefaultExpiration, 0).RemainingCapacity(); n != math.MaxInt {
+		t.Errorf("RemainingCapacity is %d for an unbounded cache", n)
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	tc := NewWithCapacity(DefaultExpiration, 0, 3, EvictionPolicyLRU)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, DefaultExpiration)
+	tc.Get("a")
+	tc.Set("d", 4, DefaultExpiration)
+	if _, found := tc.Get("b"); found {
+		t.Error("b was not evicted even though it was least recently used")
+	}
+	if _, found := tc.Get("a"); !found {
+		t.Error("a was evicted even though it was recently used")
+	}
+}
+
+func TestClockEviction(t *testing.T) {
+	tc := NewWithCapacity(DefaultExpiration, 0, 3, EvictionPolicyClock)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, DefaultExpiration)
+	tc.Get("a")
+	tc.Get("c")
+	tc.Set("d", 4, DefaultExpiration)
+	if _, found := tc.Get("b"); found {
+		t.Error("b was not evicted even though it was the only unreferenced item")
+	}
+	for _, k := range []string{"a", "c", "d"} {
+		if _, found := tc.Get(k); !found {
+			t.Errorf("%s was evicted", k)
+		}
+	}
+}
+
+func TestOnEvictedWithReason(t *testing.T) {
+	tc := NewWithCapacity(DefaultExpiration, 0, 1, EvictionPolicyLRU)
+	reasons := map[string]EvictionReason{}
+	tc.OnEvictedWithReason(func(k string, v interface{}, reason EvictionReason) {
+		reasons[k] = reason
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Delete("b")
+	tc.Set("c", 3, 1*time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	tc.DeleteExpired()
+	want := map[string]EvictionReason{
+		"a": EvictionReasonCapacity,
+		"b": EvictionReasonDeleted,
+		"c": EvictionReasonExpired,
+	}
+	for k, reason := range want {
+		if reasons[k] != reason {
+			t.Errorf("%s was evicted with reason %v, not %v", k, reasons[k], reason)
+		}
+	}
+}
+
+func TestClockGetDoesNotAllocate(t *testing.T) {
+	tc := NewWithCapacity(DefaultExpiration, 0, 10, EvictionPolicyClock)
+	tc.Set("foo", "bar", DefaultExpiration)
+	if n := testing.AllocsPerRun(100, func() { tc.Get("foo") }); n != 0 {
+		t.Errorf("Get allocated %v times", n)
+	}
+}
+
+// Replays a Zipfian trace against each policy, setting keys on a miss, and
+// compares the resulting hit ratios.
+func TestEvictionHitRatio(t *testing.T) {
+	ratios := map[string]float64{}
+	for name, p := range evictionPolicies {
+		rnd := insecurerand.New(insecurerand.NewSource(1))
+		zipf := insecurerand.NewZipf(rnd, 1.1, 1, 10000)
+		tc := NewWithCapacity(DefaultExpiration, 0, 500, p)
+		hits := 0
+		const n = 200000
+		for i := 0; i < n; i++ {
+			k := strconv.FormatUint(zipf.Uint64(), 10)
+			if _, found := tc.Get(k); found {
+				hits++
+			} else {
+				tc.Set(k, nil, DefaultExpiration)
+			}
+		}
+		ratios[name] = float64(hits) / n
+	}
+	t.Logf("hit ratios: %v", ratios)
+	if ratios["Clock"] < ratios["Random"] {
+		t.Errorf("CLOCK hit ratio %.3f is worse than random %.3f", ratios["Clock"], ratios["Random"])
+	}
+	if ratios["Clock"] < ratios["LRU"]-0.02 {
+		t.Errorf("CLOCK hit ratio %.3f is much worse than LRU %.3f", ratios["Clock"], ratios["LRU"])
+	}
+}
+
+// Builds a trace alternating between frequency-dominated phases (a Zipfian hot
+// set polluted by one-off scans) and recency-dominated phases (a sliding
+// working set.)
+func arcTrace() []string {
+	rnd := insecurerand.New(insecurerand.NewSource(1))
+	var trace []string
+	scan := 0
+	for phase := 0; phase < 6; phase++ {
+		if phase%2 == 0 {
+			zipf := insecurerand.NewZipf(rnd, 1.2, 1, 2000)
+			for i := 0; i < 30000; i++ {
+				if i%2 == 0 {
+					trace = append(trace, "hot"+strconv.FormatUint(zipf.Uint64(), 10))
+				} else {
+					trace = append(trace, "scan"+strconv.Itoa(scan))
+					scan++
+				}
+			}
+		} else {
+			base := phase * 100000
+			for i := 0; i < 30000; i++ {
+				k := base + i/10 + rnd.Intn(300)
+				trace = append(trace, "window"+strconv.Itoa(k))
+			}
+		}
+	}
+	return trace
+}
+
+func replayHitRatio(trace []string, get func(string) bool, set func(string)) float64 {
+	hits := 0
+	for _, k := range trace {
+		if get(k) {
+			hits++
+		} else {
+			set(k)
+		}
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+// A minimal LFU for comparison: evicts the least frequently used key, breaking
+// ties by evicting the one that was inserted first.
+func lfuHitRatio(trace []string, capacity int) float64 {
+	type entry struct {
+		freq, inserted int
+	}
+	resident := map[string]*entry{}
+	i := 0
+	return replayHitRatio(trace, func(k string) bool {
+		e, found := resident[k]
+		if found {
+			e.freq++
+		}
+		return found
+	}, func(k string) {
+		i++
+		if len(resident) >= capacity {
+			var victim string
+			var min *entry
+			for vk, v := range resident {
+				if min == nil || v.freq < min.freq || (v.freq == min.freq && v.inserted < min.inserted) {
+					victim, min = vk, v
+				}
+			}
+			delete(resident, victim)
+		}
+		resident[k] = &entry{1, i}
+	})
+}
+
+func TestARCHitRatio(t *testing.T) {
+	const capacity = 500
+	trace := arcTrace()
+	ratios := map[string]float64{
+		"LFU": lfuHitRatio(trace, capacity),
+	}
+	for _, name := range []string{"LRU", "ARC"} {
+		tc := NewWithCapacity(DefaultExpiration, 0, capacity, evictionPolicies[name])
+		ratios[name] = replayHitRatio(trace, func(k string) bool {
+			_, found := tc.Get(k)
+			return found
+		}, func(k string) {
+			tc.Set(k, nil, DefaultExpiration)
+		})
+	}
+	t.Logf("hit ratios: %v", ratios)
+	best := ratios["LRU"]
+	if ratios["LFU"] > best {
+		best = ratios["LFU"]
+	}
+	if ratios["ARC"] < best {
+		t.Errorf("ARC hit ratio %.3f is worse than the better of LRU and LFU %.3f", ratios["ARC"], best)
+	}
+}
+
+func TestARCGhostsAreBounded(t *testing.T) {
+	tc := NewWithCapacity(DefaultExpiration, 0, 100, EvictionPolicyARC)
+	for i := 0; i < 10000; i++ {
+		k := strconv.Itoa(i)
+		tc.Set(k, i, DefaultExpiration)
+		if i%3 == 0 {
+			tc.Get(k)
+		}
+	}
+	e := tc.evictor.(*arcEvictor)
+	if n := e.t1.Len() + e.t2.Len(); n != 100 {
+		t.Errorf("ARC tracks %d resident keys, not 100", n)
+	}
+	if n := len(e.elements); n > 200 {
+		t.Errorf("ARC tracks %d keys, more than twice the capacity", n)
+	}
+}
+
+func BenchmarkCacheGetLRU(b *testing.B) {
+	benchmarkCacheGetPolicy(b, EvictionPolicyLRU)
+}
+
+func BenchmarkCacheGetClock(b *testing.B) {
+	benchmarkCacheGetPolicy(b, EvictionPolicyClock)
+}
+
+func benchmarkCacheGetPolicy(b *testing.B, p EvictionPolicy) {
+	b.StopTimer()
+	tc := NewWithCapacity(NoExpiration, 0, 1000, p)
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = "foo" + strconv.Itoa(i)
+		tc.Set(keys[i], i, DefaultExpiration)
+	}
+	b.StartTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			tc.Get(keys[i%len(keys)])
+			i++
+		}
+	})
+}
+
+func TestPin(t *testing.T) {
+	for name, p := range evictionPolicies {
+		tc := NewWithCapacity(DefaultExpiration, 0, 5, p)
+		tc.Pin("pinned")
+		tc.Set("pinned", 0, DefaultExpiration)
+		for i := 0; i < 100; i++ {
+			tc.Set("foo"+strconv.Itoa(i), i, DefaultExpiration)
+		}
+		if _, found := tc.Get("pinned"); !found {
+			t.Errorf("%s: pinned item was evicted", name)
+		}
+		if n := tc.ItemCount(); n != 5 {
+			t.Errorf("%s: ItemCount is %d, not 5", name, n)
+		}
+		tc.Unpin("pinned")
+		for i := 100; i < 200; i++ {
+			// Read each item too, so that ARC doesn't keep the
+			// previously read pinned item in favor of these.
+			tc.Set("foo"+strconv.Itoa(i), i, DefaultExpiration)
+			tc.Get("foo" + strconv.Itoa(i))
+		}
+		if _, found := tc.Get("pinned"); found {
+			t.Errorf("%s: unpinned item was never evicted", name)
+		}
+	}
+}
+
+func TestPinAllExceedsCapacity(t *testing.T) {
+	for name, p := range evictionPolicies {
+		tc := NewWithCapacity(DefaultExpiration, 0, 2, p)
+		for _, k := range []string{"a", "b", "c"} {
+			tc.Pin(k)
+			tc.Set(k, k, DefaultExpiration)
+		}
+		if n := tc.ItemCount(); n != 3 {
+			t.Errorf("%s: ItemCount is %d, not 3", name, n)
+		}
+	}
+}
+
+func TestPinnedItemsDontExpire(t *testing.T) {
+	clk := &manualClock{t: time.Unix(1000, 0)}
+	tc := New(DefaultExpiration, 0, WithClock(clk))
+	if tc.Pin("foo") {
+		t.Error("Pin of a missing key returned true")
+	}
+	tc.Set("foo", "bar", 10*time.Second)
+	clk.Advance(time.Minute)
+	tc.DeleteExpired()
+	if _, found := tc.Get("foo"); !found {
+		t.Error("pinned item expired")
+	}
+	if _, e, _ := tc.GetWithExpiration("foo"); !e.IsZero() {
+		t.Errorf("pinned item has expiration time %v", e)
+	}
+	// The item gets back the time it had left when it was set.
+	tc.Unpin("foo")
+	clk.Advance(9 * time.Second)
+	if _, found := tc.Get("foo"); !found {
+		t.Error("unpinned item expired early")
+	}
+	clk.Advance(2 * time.Second)
+	if _, found := tc.Get("foo"); found {
+		t.Error("unpinned item didn't expire")
+	}
+	// An item that has expired isn't revived by pinning it.
+	if tc.Pin("foo") {
+		t.Error("Pin of an expired item returned true")
+	}
+	if _, found := tc.Get("foo"); found {
+		t.Error("expired item was revived by Pin")
+	}
+}
+
+func TestPinnedItemSaveLoad(t *testing.T) {
+	clk := &manualClock{t: time.Unix(1000, 0)}
+	tc := New(DefaultExpiration, 0, WithClock(clk))
+	tc.Set("foo", "bar", time.Minute)
+	tc.Pin("foo")
+	clk.Advance(time.Hour)
+	if e := tc.Items()["foo"].Expiration; e != clk.Now().Add(time.Minute).UnixNano() {
+		t.Errorf("Items reported expiration %d for a pinned item, want a minute from now", e)
+	}
+	fp := &bytes.Buffer{}
+	if err := tc.Save(fp); err != nil {
+		t.Fatal(err)
+	}
+	oc := New(DefaultExpiration, 0, WithClock(clk))
+	if err := oc.Load(fp); err != nil {
+		t.Fatal(err)
+	}
+	_, e, found := oc.GetWithExpiration("foo")
+	if !found || e.Sub(clk.Now()) != time.Minute {
+		t.Fatalf("got (%v, %v) for the loaded item, want a minute left", e, found)
+	}
+	clk.Advance(time.Minute + time.Nanosecond)
+	if _, found := oc.Get("foo"); found {
+		t.Error("the loaded copy of a pinned item never expires")
+	}
+	if _, found := tc.Get("foo"); !found {
+		t.Error("the pinned item expired")
+	}
+}
+
+func TestPinRefCount(t *testing.T) {
+	tc := NewWithCapacity(DefaultExpiration, 0, 1, EvictionPolicyLRU)
+	tc.Set("foo", 1, DefaultExpiration)
+	if !tc.Pin("foo") || !tc.Pin("foo") {
+		t.Error("Pin of an existing item returned false")
+	}
+	if n := tc.PinnedCount(); n != 1 {
+		t.Errorf("PinnedCount is %d, not 1", n)
+	}
+	if !tc.Unpin("foo") {
+		t.Error("Unpin of a pinned key returned false")
+	}
+	tc.Set("bar", 2, DefaultExpiration)
+	if _, found := tc.Get("foo"); !found {
+		t.Error("item was evicted while it was still pinned once")
+	}
+	tc.Unpin("foo")
+	if tc.Unpin("foo") {
+		t.Error("Unpin of a key that isn't pinned returned true")
+	}
+	if n := tc.PinnedCount(); n != 0 {
+		t.Errorf("PinnedCount is %d, not 0", n)
+	}
+	tc.Set("baz", 3, DefaultExpiration)
+	if _, found := tc.Get("foo"); found {
+		t.Error("unpinned item wasn't evicted")
+	}
+}
+
+func TestFlushKeepsPinned(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Set("bar", 2, DefaultExpiration)
+	tc.Pin("foo")
+	var evicted []string
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = append(evicted, k)
+	})
+	tc.Flush()
+	if _, found := tc.Get("foo"); !found {
+		t.Error("Flush deleted a pinned item")
+	}
+	if _, found := tc.Get("bar"); found {
+		t.Error("Flush kept an unpinned item")
+	}
+	if len(evicted) != 1 || evicted[0] != "bar" {
+		t.Errorf("Flush notified %v, not [bar]", evicted)
+	}
+}
+
+func TestShardedPin(t *testing.T) {
+	clk := &manualClock{t: time.Unix(1000, 0)}
+	tc := NewSharded(DefaultExpiration, 0, 4, WithClock(clk))
+	for i := 0; i < 10; i++ {
+		tc.Set("foo"+strconv.Itoa(i), i, 10*time.Second)
+	}
+	tc.Pin("foo3")
+	tc.Pin("foo7")
+	if n := tc.PinnedCount(); n != 2 {
+		t.Errorf("PinnedCount is %d, not 2", n)
+	}
+	// Pins move with their items.
+	tc.Reseed(tc.Seed() + 1)
+	clk.Advance(time.Minute)
+	tc.DeleteExpired()
+	if n := tc.Len(); n != 2 {
+		t.Errorf("Len is %d, not 2", n)
+	}
+	if !tc.Unpin("foo3") {
+		t.Error("Unpin of a pinned key returned false after Reseed")
+	}
+	clk.Advance(11 * time.Second)
+	if _, found := tc.Get("foo3"); found {
+		t.Error("unpinned item didn't expire")
+	}
+	if _, found := tc.Get("foo7"); !found {
+		t.Error("pinned item expired")
+	}
+}
+
+// Reads a hot set of items (so that SLRU promotes them), then scans through
+// many more items than fit in the cache, reading each only once.
+func scanHotSetSurvivors(p EvictionPolicy, opts ...Option) int {
+	tc := NewWithCapacity(DefaultExpiration, 0, 100, p, opts...)
+	for i := 0; i < 50; i++ {
+		tc.Set("hot"+strconv.Itoa(i), i, DefaultExpiration)
+		tc.Get("hot" + strconv.Itoa(i))
+	}
+	for i := 0; i < 1000; i++ {
+		k := "scan" + strconv.Itoa(i)
+		if _, found := tc.Get(k); !found {
+			tc.Set(k, i, DefaultExpiration)
+		}
+	}
+	n := 0
+	for i := 0; i < 50; i++ {
+		if _, found := tc.Get("hot" + strconv.Itoa(i)); found {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSegmentedLRUScanResistance(t *testing.T) {
+	if n := scanHotSetSurvivors(EvictionPolicySegmentedLRU); n != 50 {
+		t.Errorf("only %d of 50 hot items survived a scan with SLRU", n)
+	}
+	if n := scanHotSetSurvivors(EvictionPolicyLRU); n != 0 {
+		t.Errorf("%d hot items survived a scan with LRU; the scan is too short", n)
+	}
+	// With a protected segment too small for the hot set, some of it is
+	// demoted and evicted.
+	if n := scanHotSetSurvivors(EvictionPolicySegmentedLRU, WithProtectedRatio(0.2)); n != 20 {
+		t.Errorf("%d hot items survived a scan with a 20-item protected segment, not 20", n)
+	}
+}
+
+func TestSegmentedLRUProtectedIsBounded(t *testing.T) {
+	tc := NewWithCapacity(DefaultExpiration, 0, 10, EvictionPolicySegmentedLRU, WithProtectedRatio(0.5))
+	for i := 0; i < 100; i++ {
+		k := strconv.Itoa(i)
+		tc.Set(k, i, DefaultExpiration)
+		tc.Get(k)
+	}
+	e := tc.evictor.(*slruEvictor)
+	if n := e.protected.Len(); n != 5 {
+		t.Errorf("protected segment holds %d items, not 5", n)
+	}
+	if n := tc.ItemCount(); n != 10 {
+		t.Errorf("ItemCount is %d, not 10", n)
+	}
+}
+
+func TestExpirationEviction(t *testing.T) {
+	tc := NewWithCapacity(DefaultExpiration, 0, 3, EvictionPolicyExpiration)
+	tc.Set("a", 1, NoExpiration)
+	tc.Set("b", 2, 1*time.Minute)
+	tc.Set("c", 3, 1*time.Hour)
+	tc.Set("d", 4, 2*time.Hour)
+	if _, found := tc.Get("b"); found {
+		t.Error("the item expiring soonest was not evicted")
+	}
+	tc.Set("e", 5, 3*time.Hour)
+	if _, found := tc.Get("c"); found {
+		t.Error("c was not evicted")
+	}
+	if _, found := tc.Get("a"); !found {
+		t.Error("the item that never expires was evicted")
+	}
+}
+
+func TestExpirationEvictionTieBreakers(t *testing.T) {
+	set := func(tc *Cache) {
+		// All items share an expiration time.
+		for _, k := range []string{"a", "b", "c"} {
+			tc.Set(k, k, NoExpiration)
+		}
+	}
+	tc := NewWithCapacity(DefaultExpiration, 0, 3, EvictionPolicyExpiration)
+	set(tc)
+	tc.Get("a")
+	tc.Set("d", "d", NoExpiration)
+	if _, found := tc.Get("a"); found {
+		t.Error("insertion order: the first inserted item was not evicted")
+	}
+
+	tc = NewWithCapacity(DefaultExpiration, 0, 3, EvictionPolicyExpiration, WithTieBreaker(TieBreakByAccessCount))
+	set(tc)
+	tc.Get("a")
+	tc.Get("c")
+	tc.Set("d", "d", NoExpiration)
+	if _, found := tc.Get("b"); found {
+		t.Error("access count: the least accessed item was not evicted")
+	}
+
+	tc = NewWithCapacity(DefaultExpiration, 0, 3, EvictionPolicyExpiration, WithTieBreaker(func(a, b EvictionCandidate) bool {
+		return a.Key > b.Key
+	}))
+	set(tc)
+	tc.Set("d", "d", NoExpiration)
+	if _, found := tc.Get("c"); found {
+		t.Error("comparator: the greatest key was not evicted")
+	}
+}
@@ -0,0 +1,204 @@
+package cache_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/patrickmn/go-cache/cachetest"
+)
+
+// The expiration tests run on a cachetest.ManualClock instead of sleeping, so
+// they live outside package cache, which cachetest imports.
+
+func TestCacheTimes(t *testing.T) {
+	clk := cachetest.NewManualClock(time.Unix(1000, 0))
+	for name, tc := range map[string]interface {
+		cachetest.Cache
+		Len() int
+	}{
+		"Cache":        cache.New(50*time.Millisecond, 0, cache.WithClock(clk)),
+		"ShardedCache": cache.NewSharded(50*time.Millisecond, 0, 4, cache.WithClock(clk)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			clk.Set(time.Unix(1000, 0))
+			tc.Set("a", 1, cache.DefaultExpiration)
+			tc.Set("b", 2, cache.NoExpiration)
+			tc.Set("c", 3, 20*time.Millisecond)
+			tc.Set("d", 4, 70*time.Millisecond)
+
+			cachetest.AssertExpiresWithin(t, tc, "c", 20*time.Millisecond)
+			clk.Advance(25 * time.Millisecond)
+			cachetest.AssertMissing(t, tc, "c")
+			if n := tc.Len(); n != 4 {
+				t.Errorf("the cache holds %d items before cleanup, not 4", n)
+			}
+			cachetest.RunCleanup(tc)
+			if n := tc.Len(); n != 3 {
+				t.Errorf("the cache holds %d items after cleanup, not 3", n)
+			}
+
+			clk.Advance(30 * time.Millisecond)
+			cachetest.AssertMissing(t, tc, "a")
+			cachetest.AssertContains(t, tc, "b", 2)
+			cachetest.AssertContains(t, tc, "d", 4)
+			cachetest.RunCleanup(tc)
+			if n := tc.Len(); n != 2 {
+				t.Errorf("the cache holds %d items after cleanup, not 2", n)
+			}
+
+			clk.Advance(20 * time.Millisecond)
+			cachetest.AssertMissing(t, tc, "d")
+			cachetest.RunCleanup(tc)
+			if n := tc.Len(); n != 1 {
+				t.Errorf("the cache holds %d items after cleanup, not 1", n)
+			}
+			cachetest.AssertContains(t, tc, "b", 2)
+		})
+	}
+}
+
+func TestDeleteAndGet(t *testing.T) {
+	clk := cachetest.NewManualClock(time.Unix(1000, 0))
+	tc := cache.New(cache.DefaultExpiration, 0, cache.WithClock(clk))
+	var (
+		notified interface{}
+		reason   cache.EvictionReason
+	)
+	tc.OnEvictedWithReason(func(k string, v interface{}, r cache.EvictionReason) {
+		notified, reason = v, r
+	})
+	tc.Set("foo", "bar", cache.DefaultExpiration)
+	x, found := tc.DeleteAndGet("foo")
+	if !found || x != "bar" {
+		t.Fatalf("got (%v, %v), want (bar, true)", x, found)
+	}
+	if notified != "bar" || reason != cache.EvictionReasonDeleted {
+		t.Errorf("notified (%v, %v), want (bar, %v)", notified, reason, cache.EvictionReasonDeleted)
+	}
+	cachetest.AssertMissing(t, tc, "foo")
+	if x, found := tc.DeleteAndGet("foo"); found || x != nil {
+		t.Errorf("got (%v, %v) for a missing key, want (nil, false)", x, found)
+	}
+
+	tc.Set("exp", "bar", time.Nanosecond)
+	clk.Advance(time.Millisecond)
+	if x, found := tc.DeleteAndGet("exp"); found || x != nil {
+		t.Errorf("got (%v, %v) for an expired key, want (nil, false)", x, found)
+	}
+	if reason != cache.EvictionReasonExpired {
+		t.Errorf("got reason %v for an expired key, want %v", reason, cache.EvictionReasonExpired)
+	}
+}
+
+func TestDeleteExpiredReturn(t *testing.T) {
+	clk := cachetest.NewManualClock(time.Unix(1000, 0))
+	tc := cache.New(cache.DefaultExpiration, 0, cache.WithClock(clk))
+	tc.Set("a", 1, 1*time.Millisecond)
+	tc.Set("b", 2, 1*time.Millisecond)
+	tc.Set("c", 3, cache.NoExpiration)
+	clk.Advance(5 * time.Millisecond)
+	kvs := tc.DeleteExpiredReturn()
+	if len(kvs) != 2 {
+		t.Fatalf("DeleteExpiredReturn returned %d items, not 2", len(kvs))
+	}
+	got := map[string]interface{}{}
+	for _, kv := range kvs {
+		got[kv.Key] = kv.Value
+	}
+	if got["a"] != 1 || got["b"] != 2 {
+		t.Errorf("DeleteExpiredReturn returned %v", kvs)
+	}
+	if tc.ItemCount() != 1 {
+		t.Errorf("ItemCount is %d, not 1", tc.ItemCount())
+	}
+	if kvs := tc.DeleteExpiredReturn(); len(kvs) != 0 {
+		t.Errorf("DeleteExpiredReturn returned %v with nothing expired", kvs)
+	}
+}
+
+func TestShardedDeleteExpiredReturn(t *testing.T) {
+	clk := cachetest.NewManualClock(time.Unix(1000, 0))
+	tc := cache.NewSharded(cache.DefaultExpiration, 0, 13, cache.WithClock(clk))
+	for i := 0; i < 20; i++ {
+		tc.Set(fmt.Sprint("foo", i), i, 1*time.Millisecond)
+	}
+	tc.Set("bar", 0, cache.NoExpiration)
+	clk.Advance(5 * time.Millisecond)
+	if kvs := tc.DeleteExpiredReturn(); len(kvs) != 20 {
+		t.Errorf("DeleteExpiredReturn returned %d items, not 20", len(kvs))
+	}
+	if n := tc.ItemCount(); n != 1 {
+		t.Errorf("ItemCount is %d, not 1", n)
+	}
+}
+
+func TestSetIfNewer(t *testing.T) {
+	clk := cachetest.NewManualClock(time.Unix(1000, 0))
+	tc := cache.New(cache.DefaultExpiration, 0, cache.WithClock(clk))
+	now := clk.Now()
+	if !tc.SetIfNewer("foo", 1, now, cache.DefaultExpiration) {
+		t.Error("SetIfNewer didn't set a missing item")
+	}
+	if tc.SetIfNewer("foo", 2, now.Add(-time.Second), cache.DefaultExpiration) {
+		t.Error("SetIfNewer set an older value")
+	}
+	if tc.SetIfNewer("foo", 2, now, cache.DefaultExpiration) {
+		t.Error("SetIfNewer set a value with the same timestamp")
+	}
+	cachetest.AssertContains(t, tc, "foo", 1)
+	if !tc.SetIfNewer("foo", 3, now.Add(time.Second), cache.DefaultExpiration) {
+		t.Error("SetIfNewer didn't set a newer value")
+	}
+	cachetest.AssertContains(t, tc, "foo", 3)
+	tc.Set("bar", 1, 1*time.Millisecond)
+	clk.Advance(5 * time.Millisecond)
+	if !tc.SetIfNewer("bar", 2, time.Unix(0, 1), cache.DefaultExpiration) {
+		t.Error("SetIfNewer didn't replace an expired item")
+	}
+}
+
+func TestGetOrdered(t *testing.T) {
+	clk := cachetest.NewManualClock(time.Unix(1000, 0))
+	tc := cache.New(cache.DefaultExpiration, 0, cache.WithClock(clk))
+	tc.Set("a", 1, cache.DefaultExpiration)
+	tc.Set("b", 2, cache.DefaultExpiration)
+	tc.Set("expired", 3, time.Millisecond)
+	clk.Advance(5 * time.Millisecond)
+	keys := []string{"b", "missing", "a", "expired", "b"}
+	want := []cache.Result{{2, true}, {nil, false}, {1, true}, {nil, false}, {2, true}}
+	res := tc.GetOrdered(keys)
+	if len(res) != len(want) {
+		t.Fatalf("got %d results for %d keys", len(res), len(keys))
+	}
+	for i, r := range res {
+		if r != want[i] {
+			t.Errorf("result %d (%s) is %v, not %v", i, keys[i], r, want[i])
+		}
+	}
+	if res := tc.GetOrdered(nil); len(res) != 0 {
+		t.Errorf("got %d results for no keys", len(res))
+	}
+}
+
+func TestOnEvictedWhenOverwritingExpired(t *testing.T) {
+	clk := cachetest.NewManualClock(time.Unix(1000, 0))
+	tc := cache.New(cache.DefaultExpiration, 0, cache.WithClock(clk))
+	var reasons []cache.EvictionReason
+	tc.OnEvictedWithReason(func(k string, v interface{}, reason cache.EvictionReason) {
+		reasons = append(reasons, reason)
+	})
+	tc.Set("foo", 1, time.Millisecond)
+	tc.Set("foo", 2, cache.DefaultExpiration)
+	if len(reasons) != 0 {
+		t.Errorf("overwriting an unexpired item called OnEvicted: %v", reasons)
+	}
+	tc.Set("foo", 3, time.Millisecond)
+	clk.Advance(5 * time.Millisecond)
+	tc.Set("foo", 4, cache.DefaultExpiration)
+	tc.Flush()
+	if len(reasons) != 2 || reasons[0] != cache.EvictionReasonExpired || reasons[1] != cache.EvictionReasonDeleted {
+		t.Errorf("OnEvicted was called with %v, not [expired deleted]", reasons)
+	}
+}
@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ExpirationChannel returns a channel on which every expired item removed by
+// DeleteExpired, e.g. by the janitor, is sent, so that expirations can be
+// processed as a stream. The channel has room for buffer items. Sending never
+// blocks the janitor: if the channel is full, the item is dropped and counted
+// in DroppedExpirations, so a consumer that needs every item must keep up, or
+// use a bigger buffer. Items removed in other ways after they expired, e.g. by
+// Flush or by being overwritten, aren't sent.
+//
+// The cache has one such channel: later calls return the same channel, and
+// ignore buffer. Close closes it.
+func (c *cache) ExpirationChannel(buffer int) <-chan KV {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.expirations == nil {
+		c.expirations = &expirationStream{ch: make(chan KV, buffer)}
+	}
+	return c.expirations.ch
+}
+
+// DroppedExpirations returns the number of expired items that weren't sent on
+// the channel returned by ExpirationChannel because it was full.
+func (c *cache) DroppedExpirations() uint64 {
+	c.mu.RLock()
+	s := c.expirations
+	c.mu.RUnlock()
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&s.dropped)
+}
+
+type expirationStream struct {
+	mu      sync.Mutex
+	ch      chan KV
+	closed  bool
+	dropped uint64
+}
+
+// Sends kvs without blocking, counting the ones that don't fit.
+func (s *expirationStream) send(kvs []KV) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	for _, kv := range kvs {
+		select {
+		case s.ch <- kv:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+func (s *expirationStream) close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+	s.mu.Unlock()
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExpirationChannel(t *testing.T) {
+	clk := &manualClock{t: time.Unix(1000, 0)}
+	tc := New(DefaultExpiration, 0, WithClock(clk))
+	ch := tc.ExpirationChannel(10)
+	if tc.ExpirationChannel(1) != ch {
+		t.Error("ExpirationChannel returned a different channel the second time")
+	}
+	tc.Set("foo", "bar", time.Second)
+	tc.Set("baz", "qux", NoExpiration)
+	clk.Advance(2 * time.Second)
+	tc.DeleteExpired()
+	select {
+	case kv := <-ch:
+		if kv.Key != "foo" || kv.Value != "bar" {
+			t.Errorf("received %+v, not foo", kv)
+		}
+	default:
+		t.Fatal("nothing was sent for the expired item")
+	}
+	select {
+	case kv := <-ch:
+		t.Errorf("received %+v, although only foo expired", kv)
+	default:
+	}
+	tc.Close()
+	if _, ok := <-ch; ok {
+		t.Error("channel wasn't closed by Close")
+	}
+	// Expirations after Close are neither sent nor counted.
+	tc.Set("foo", "bar", time.Second)
+	clk.Advance(2 * time.Second)
+	tc.DeleteExpired()
+	if n := tc.DroppedExpirations(); n != 0 {
+		t.Errorf("DroppedExpirations is %d, not 0", n)
+	}
+}
+
+func TestExpirationChannelDropsWhenFull(t *testing.T) {
+	clk := &manualClock{t: time.Unix(1000, 0)}
+	tc := New(DefaultExpiration, 0, WithClock(clk))
+	ch := tc.ExpirationChannel(3)
+	for i := 0; i < 10; i++ {
+		tc.Set(strconv.Itoa(i), i, time.Second)
+	}
+	clk.Advance(2 * time.Second)
+	if n := tc.DeleteExpired(); n != 10 {
+		t.Errorf("DeleteExpired removed %d items, not 10", n)
+	}
+	if n := len(ch); n != 3 {
+		t.Errorf("%d items are buffered, not 3", n)
+	}
+	if n := tc.DroppedExpirations(); n != 7 {
+		t.Errorf("DroppedExpirations is %d, not 7", n)
+	}
+}
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportOptions configures ExportCSV.
+type ExportOptions struct {
+	// The field delimiter, e.g. '\t' for TSV. The default is ','.
+	Delimiter rune
+	// If set, only items whose keys have this prefix are exported.
+	Prefix string
+	// If positive, at most this many rows are exported.
+	MaxRows int
+}
+
+var exportHeader = []string{"key", "type", "size", "created", "expires"}
+
+// ExportCSV writes a header and one row per unexpired item to w, describing
+// the item without its value, so that it is safe to use on caches holding
+// personal data: its key, the type of its value, its size if the cache was
+// created with WithSizeAccounting, when it was created if stats were enabled
+// when it was set (see EnableStats), and when it expires. Times are in RFC 3339
+// format, in UTC; unknown sizes and times, and expiration times of items that
+// don't expire, are empty. Fields are quoted as needed by encoding/csv. Items
+// whose values were set with SetLazy and haven't been computed yet aren't
+// exported.
+//
+// Rows are written as the items are visited, in no particular order, rather
+// than collected first. The cache's read lock is held while they are written,
+// so writing to w should be fast, e.g. to a buffer or a file.
+func (c *cache) ExportCSV(w io.Writer, opts ExportOptions) error {
+	cw, err := newExportWriter(w, opts)
+	if err != nil {
+		return err
+	}
+	c.exportCSV(cw, opts, 0)
+	cw.Flush()
+	return cw.Error()
+}
+
+func newExportWriter(w io.Writer, opts ExportOptions) (*csv.Writer, error) {
+	cw := csv.NewWriter(w)
+	if opts.Delimiter != 0 {
+		cw.Comma = opts.Delimiter
+	}
+	if err := cw.Write(exportHeader); err != nil {
+		return nil, fmt.Errorf("Couldn't write the header: %w", err)
+	}
+	return cw, nil
+}
+
+// Writes a row for each item to cw, stopping once opts.MaxRows rows, including
+// the given number already written, have been written. Returns the total number
+// of rows written, or -1 if the limit was reached or writing failed.
+func (c *cache) exportCSV(cw *csv.Writer, opts ExportOptions, rows int) int {
+	row := make([]string, len(exportHeader))
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.now().UnixNano()
+	for k, v := range c.items {
+		if opts.MaxRows > 0 && rows >= opts.MaxRows {
+			return -1
+		}
+		if v.Expiration > 0 && now > v.Expiration {
+			continue
+		}
+		if !strings.HasPrefix(k, opts.Prefix) || isLazy(v.Object) {
+			continue
+		}
+		row[0] = k
+		row[1] = exportType(v.Object)
+		row[2] = ""
+		if c.sizer != nil {
+			row[2] = strconv.FormatInt(v.size, 10)
+		}
+		row[3] = exportTime(v.Created)
+		row[4] = exportTime(c.withPausedExpiration(k, v, now).Expiration)
+		if cw.Write(row) != nil {
+			return -1
+		}
+		rows++
+	}
+	return rows
+}
+
+// Returns the name of the type of the value stored as x.
+func exportType(x interface{}) string {
+	if cv, ok := x.(compressedValue); ok {
+		if cv.String {
+			return "string"
+		}
+		return "[]uint8"
+	}
+	return fmt.Sprintf("%T", x)
+}
+
+func exportTime(ns int64) string {
+	if ns <= 0 {
+		return ""
+	}
+	return time.Unix(0, ns).UTC().Format(time.RFC3339Nano)
+}
+
+// ExportCSV writes a header and one row per unexpired item in any shard to w,
+// one shard at a time. See the cache's ExportCSV.
+func (sc *shardedCache) ExportCSV(w io.Writer, opts ExportOptions) error {
+	cw, err := newExportWriter(w, opts)
+	if err != nil {
+		return err
+	}
+	rows := 0
+	for _, c := range sc.cs {
+		if rows = c.exportCSV(cw, opts, rows); rows < 0 {
+			break
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
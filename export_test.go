@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns the lines of a CSV export with the rows after the header sorted.
+func sortedExport(b []byte) string {
+	lines := strings.SplitAfter(string(b), "\n")
+	sort.Strings(lines[1:])
+	return strings.Join(lines, "")
+}
+
+func newExportCache() *Cache {
+	clock := &manualClock{t: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	tc := NewWithOptions(
+		WithClock(clock),
+		WithSizeAccounting(func(k string, v interface{}) int64 {
+			return int64(len(k)) + 8
+		}, func(int64) {}),
+	)
+	tc.EnableStats()
+	tc.Set("user:1", map[string]string{"email": "a@example.com"}, time.Hour)
+	tc.Set("user:2", "secret", NoExpiration)
+	clock.Advance(time.Second)
+	tc.Set(`quoted "key", with comma`, []byte("x"), DefaultExpiration)
+	tc.Set("tab\tkey", 42, 90*time.Minute)
+	tc.Set("expired", 1, time.Second)
+	clock.Advance(2 * time.Second)
+	return tc
+}
+
+func testExportGolden(t *testing.T, golden string, opts ExportOptions) {
+	var buf bytes.Buffer
+	if err := newExportCache().ExportCSV(&buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join("testdata", golden))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sortedExport(buf.Bytes()); got != string(want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	testExportGolden(t, "export.csv.golden", ExportOptions{})
+}
+
+func TestExportTSV(t *testing.T) {
+	testExportGolden(t, "export.tsv.golden", ExportOptions{Delimiter: '\t'})
+}
+
+func TestExportCSVPrefix(t *testing.T) {
+	testExportGolden(t, "export_prefix.csv.golden", ExportOptions{Prefix: "user:"})
+}
+
+func TestExportCSVMaxRows(t *testing.T) {
+	for _, tc := range []exportable{
+		newExportCache(),
+		NewSharded(DefaultExpiration, 0, 4),
+	} {
+		for _, k := range []string{"a", "b", "c", "d", "e", "f"} {
+			tc.Set(k, 1, DefaultExpiration)
+		}
+		var buf bytes.Buffer
+		if err := tc.ExportCSV(&buf, ExportOptions{MaxRows: 3}); err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(buf.String(), "\n"); n != 4 {
+			t.Errorf("exported %d lines, not a header and 3 rows:\n%s", n, buf.String())
+		}
+	}
+}
+
+type exportable interface {
+	Set(k string, x interface{}, d time.Duration)
+	ExportCSV(w io.Writer, opts ExportOptions) error
+}
+
+func TestShardedExportCSV(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 4)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", "x", DefaultExpiration)
+	var buf bytes.Buffer
+	if err := tc.ExportCSV(&buf, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	want := "key,type,size,created,expires\na,int,,,\nb,string,,,\n"
+	if got := sortedExport(buf.Bytes()); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestExportCSVInvalidDelimiter(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	if err := tc.ExportCSV(io.Discard, ExportOptions{Delimiter: '"'}); err == nil {
+		t.Error("exported with a quote as the delimiter")
+	}
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// WithMaxGoroutines limits the number of goroutines the cache starts on demand
+// to do work in the background, like the workers of Warm and WarmAsync and
+// SnapshotAsync, to n. Once n of them are running, further work is queued and
+// run by the first of them to finish, in the order it was queued, rather than
+// in a goroutine of its own. If n is 0 or less, the default, there is no limit.
+//
+// The long-running helpers the cache's options call for, like the janitor or
+// the goroutine delivering eviction batches, are always started, and don't
+// count toward the limit, but are included in ActiveGoroutines. For a sharded
+// cache, the limit applies to the cache as a whole.
+func WithMaxGoroutines(n int) Option {
+	return func(o *options) {
+		o.maxGoroutines = n
+	}
+}
+
+// Keeps track of the goroutines a cache runs, queuing on-demand work beyond
+// the limit. A nil *goroutines starts goroutines without tracking them.
+type goroutines struct {
+	max    int
+	active int32
+
+	mu      sync.Mutex
+	workers int
+	queue   []func()
+}
+
+// ActiveGoroutines returns the number of goroutines the cache is running in
+// the background, including both its long-running helpers and the workers
+// started on demand. Work queued because of WithMaxGoroutines isn't counted.
+func (c *cache) ActiveGoroutines() int {
+	return c.goroutines.count()
+}
+
+// ActiveGoroutines returns the number of goroutines the cache and its shards
+// are running in the background. See the cache's ActiveGoroutines.
+func (sc *shardedCache) ActiveGoroutines() int {
+	// The shards share one tracker.
+	return sc.cs[0].goroutines.count()
+}
+
+func (g *goroutines) count() int {
+	if g == nil {
+		return 0
+	}
+	return int(atomic.LoadInt32(&g.active))
+}
+
+// Runs the long-running helper f in a goroutine of its own.
+func (g *goroutines) helper(f func()) {
+	if g == nil {
+		go f()
+		return
+	}
+	atomic.AddInt32(&g.active, 1)
+	go func() {
+		defer atomic.AddInt32(&g.active, -1)
+		f()
+	}()
+}
+
+// Runs f in a new goroutine, or, if the limit has been reached, queues it to
+// be run by the first worker to finish.
+func (g *goroutines) work(f func()) {
+	if g == nil {
+		go f()
+		return
+	}
+	g.mu.Lock()
+	if g.max > 0 && g.workers >= g.max {
+		g.queue = append(g.queue, f)
+		g.mu.Unlock()
+		return
+	}
+	g.workers++
+	g.mu.Unlock()
+	atomic.AddInt32(&g.active, 1)
+	go g.runWorker(f)
+}
+
+// Runs f, then the queued work until there is none left.
+func (g *goroutines) runWorker(f func()) {
+	for f != nil {
+		f()
+		g.mu.Lock()
+		f = nil
+		if len(g.queue) > 0 {
+			f = g.queue[0]
+			g.queue[0] = nil
+			g.queue = g.queue[1:]
+		} else {
+			g.workers--
+			atomic.AddInt32(&g.active, -1)
+		}
+		g.mu.Unlock()
+	}
+}
@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Waits up to a second for the cache's ActiveGoroutines to become want, as
+// goroutines are counted out only after they return.
+func waitGoroutines(t *testing.T, active func() int, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for active() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d active goroutines, want %d", active(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestActiveGoroutines(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	if n := tc.ActiveGoroutines(); n != 0 {
+		t.Errorf("got %d active goroutines without background features, want 0", n)
+	}
+
+	tc = New(DefaultExpiration, time.Hour, WithWriteCoalescing(time.Hour))
+	waitGoroutines(t, tc.ActiveGoroutines, 2)
+	tc.Close()
+	waitGoroutines(t, tc.ActiveGoroutines, 0)
+}
+
+func TestShardedActiveGoroutines(t *testing.T) {
+	tc := NewShardedWithOptions(WithShards(4), WithCleanupInterval(time.Hour))
+	defer tc.janitor.Stop()
+	waitGoroutines(t, tc.ActiveGoroutines, 1)
+}
+
+func TestMaxGoroutines(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithMaxGoroutines(2))
+	var (
+		running, peak int32
+		release       = make(chan struct{})
+	)
+	keys := make([]string, 20)
+	for i := range keys {
+		keys[i] = "foo" + strconv.Itoa(i)
+	}
+	errs := tc.WarmAsync(keys, func(k string) (interface{}, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+		return k, nil
+	}, DefaultExpiration, 8)
+	// A second batch of work has to queue behind the first.
+	errs2 := tc.WarmAsync([]string{"bar"}, func(k string) (interface{}, error) {
+		return k, nil
+	}, DefaultExpiration, 1)
+	waitGoroutines(t, tc.ActiveGoroutines, 2)
+	close(release)
+	for range errs {
+	}
+	for range errs2 {
+	}
+	if p := atomic.LoadInt32(&peak); p > 2 {
+		t.Errorf("%d loaders ran at once, want at most 2", p)
+	}
+	if n := tc.ItemCount(); n != 21 {
+		t.Errorf("got %d items, want 21", n)
+	}
+	waitGoroutines(t, tc.ActiveGoroutines, 0)
+}
+
+func TestGoroutinesQueue(t *testing.T) {
+	g := &goroutines{max: 1}
+	var (
+		mu    sync.Mutex
+		order []int
+		wg    sync.WaitGroup
+	)
+	block := make(chan struct{})
+	wg.Add(4)
+	g.work(func() {
+		<-block
+		wg.Done()
+	})
+	for i := 1; i < 4; i++ {
+		i := i
+		g.work(func() {
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			wg.Done()
+		})
+	}
+	if n := g.count(); n != 1 {
+		t.Errorf("got %d active goroutines, want 1", n)
+	}
+	close(block)
+	wg.Wait()
+	if len(order) != 3 || order[0] != 1 || order[1] != 2 || order[2] != 3 {
+		t.Errorf("queued work ran in order %v, want [1 2 3]", order)
+	}
+}
@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Handler returns an http.Handler that serves a JSON view of the cache for
+// debugging and administration:
+//
+//	GET    /              the cache's name, item count and Stats
+//	GET    /keys          the keys of the items in the cache (see KeysSorted)
+//	GET    /item?key=k    the value of k and its remaining time to live
+//	DELETE /item?key=k    deletes k
+//
+// Values are encoded with encoding/json, or, if they can't be, formatted as
+// strings with fmt's %v. The handler only reads the cache through its public,
+// locked methods. It does no authentication, so it should be mounted behind
+// the application's own, e.g. using http.StripPrefix:
+//
+//	mux.Handle("/debug/cache/", requireAdmin(http.StripPrefix("/debug/cache", c.Handler())))
+func (c *cache) Handler() http.Handler {
+	return &cacheHandler{c, func() int { return c.ItemCount() }}
+}
+
+// Handler returns an http.Handler that serves a JSON view of the cache. See the
+// cache's Handler.
+func (sc *shardedCache) Handler() http.Handler {
+	return &cacheHandler{sc, func() int { return int(sc.ItemCount()) }}
+}
+
+// The methods of cache and shardedCache used by cacheHandler.
+type handlerStore interface {
+	Name() string
+	Stats() Stats
+	KeysSorted() []string
+	Inspect(keys []string) map[string]Inspection
+	DeleteAndGet(k string) (interface{}, bool)
+}
+
+type cacheHandler struct {
+	c         handlerStore
+	itemCount func() int
+}
+
+type handlerSummary struct {
+	Name  string `json:"name,omitempty"`
+	Items int    `json:"items"`
+	Stats Stats  `json:"stats"`
+}
+
+type handlerItem struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+	// Omitted if the item never expires.
+	TTLSeconds *float64 `json:"ttl_seconds,omitempty"`
+}
+
+func (h *cacheHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/", "":
+		if !allowMethods(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, http.StatusOK, handlerSummary{
+			Name:  h.c.Name(),
+			Items: h.itemCount(),
+			Stats: h.c.Stats(),
+		})
+	case "/keys":
+		if !allowMethods(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string][]string{"keys": h.c.KeysSorted()})
+	case "/item":
+		if !allowMethods(w, r, http.MethodGet, http.MethodDelete) {
+			return
+		}
+		k, ok := r.URL.Query()["key"]
+		if !ok || len(k) != 1 {
+			writeError(w, http.StatusBadRequest, "Exactly one key parameter is required")
+			return
+		}
+		if r.Method == http.MethodDelete {
+			h.deleteItem(w, k[0])
+		} else {
+			h.getItem(w, k[0])
+		}
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (h *cacheHandler) getItem(w http.ResponseWriter, k string) {
+	in := h.c.Inspect([]string{k})[k]
+	if !in.Found {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Item %s not found", k))
+		return
+	}
+	v, err := json.Marshal(in.Value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprintf("%v", in.Value))
+	}
+	item := handlerItem{Key: k, Value: v}
+	if in.TTL != NoExpiration {
+		ttl := in.TTL.Seconds()
+		item.TTLSeconds = &ttl
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+func (h *cacheHandler) deleteItem(w http.ResponseWriter, k string) {
+	if _, found := h.c.DeleteAndGet(k); !found {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Item %s not found", k))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Reports whether r uses one of methods, replying with 405 Method Not Allowed
+// if it doesn't.
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method %s not allowed", r.Method))
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func serve(t *testing.T, h http.Handler, method, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	tc := NewWithOptions(WithName("users"))
+	tc.Set("b", map[string]int{"x": 1}, time.Hour)
+	tc.Set("a", "foo", DefaultExpiration)
+	tc.Set("ch", make(chan int), DefaultExpiration)
+	h := tc.Handler()
+
+	w := serve(t, h, http.MethodGet, "/")
+	var summary struct {
+		Name  string
+		Items int
+	}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &summary) != nil {
+		t.Fatalf("GET /: got %d %s", w.Code, w.Body)
+	}
+	if summary.Name != "users" || summary.Items != 3 {
+		t.Errorf("GET /: got %+v", summary)
+	}
+
+	w = serve(t, h, http.MethodGet, "/keys")
+	var keys struct{ Keys []string }
+	json.Unmarshal(w.Body.Bytes(), &keys)
+	if want := []string{"a", "b", "ch"}; !reflect.DeepEqual(keys.Keys, want) {
+		t.Errorf("GET /keys: got %v, want %v", keys.Keys, want)
+	}
+
+	w = serve(t, h, http.MethodGet, "/item?key=b")
+	var item struct {
+		Key        string
+		Value      map[string]int
+		TTLSeconds *float64 `json:"ttl_seconds"`
+	}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &item) != nil {
+		t.Fatalf("GET /item?key=b: got %d %s", w.Code, w.Body)
+	}
+	if item.Key != "b" || item.Value["x"] != 1 || item.TTLSeconds == nil || *item.TTLSeconds <= 0 {
+		t.Errorf("GET /item?key=b: got %s", w.Body)
+	}
+	w = serve(t, h, http.MethodGet, "/item?key=a")
+	if body := w.Body.String(); body != "{\"key\":\"a\",\"value\":\"foo\"}\n" {
+		t.Errorf("GET /item?key=a: got %s", body)
+	}
+	if w = serve(t, h, http.MethodGet, "/item?key=ch"); w.Code != http.StatusOK {
+		t.Errorf("GET /item?key=ch: got %d, want a value that can't be encoded to be formatted", w.Code)
+	}
+
+	if w = serve(t, h, http.MethodDelete, "/item?key=a"); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE /item?key=a: got %d", w.Code)
+	}
+	if _, found := tc.Get("a"); found {
+		t.Error("a wasn't deleted")
+	}
+	for _, tt := range []struct {
+		method, target string
+		code           int
+	}{
+		{http.MethodDelete, "/item?key=a", http.StatusNotFound},
+		{http.MethodGet, "/item?key=a", http.StatusNotFound},
+		{http.MethodGet, "/item", http.StatusBadRequest},
+		{http.MethodPost, "/item?key=b", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/keys", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/bogus", http.StatusNotFound},
+	} {
+		if w := serve(t, h, tt.method, tt.target); w.Code != tt.code {
+			t.Errorf("%s %s: got %d, want %d", tt.method, tt.target, w.Code, tt.code)
+		}
+	}
+}
+
+func TestShardedHandler(t *testing.T) {
+	tc := NewShardedWithOptions(WithShards(3))
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Set("bar", 2, DefaultExpiration)
+	h := http.StripPrefix("/debug", tc.Handler())
+	if w := serve(t, h, http.MethodGet, "/debug/keys"); w.Body.String() != "{\"keys\":[\"bar\",\"foo\"]}\n" {
+		t.Errorf("GET /keys: got %s", w.Body)
+	}
+	if w := serve(t, h, http.MethodDelete, "/debug/item?key=foo"); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE /item?key=foo: got %d", w.Code)
+	}
+	if n := tc.ItemCount(); n != 1 {
+		t.Errorf("got item count %d, want 1", n)
+	}
+}
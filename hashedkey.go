@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// A HashedKey is a key of a sharded cache together with the shard it maps to,
+// made by MakeKey, so that operations on hot keys don't have to hash them each
+// time. It remembers the seed and number of shards it was made for: after the
+// cache is reseeded (see Reseed), or when used with a cache with a different
+// layout, the shard is found by hashing the key again, as for a plain string.
+type HashedKey struct {
+	s    string
+	seed uint32
+	m    uint32
+	i    uint32
+}
+
+// String returns the key.
+func (k HashedKey) String() string {
+	return k.s
+}
+
+// MakeKey hashes the key k for use with GetKey, SetKey, DeleteKey and
+// IncrementKey.
+func (sc *shardedCache) MakeKey(k string) HashedKey {
+	seed := atomic.LoadUint32(&sc.seed)
+	return HashedKey{s: k, seed: seed, m: sc.m, i: djb33(seed, k) % sc.m}
+}
+
+// Returns the shard owning k, only hashing it if the cache's layout has
+// changed since it was made.
+func (sc *shardedCache) keyBucket(k HashedKey) *cache {
+	if k.seed == atomic.LoadUint32(&sc.seed) && k.m == sc.m {
+		return sc.cs[k.i]
+	}
+	return sc.bucket(k.s)
+}
+
+// GetKey is like Get, for a key made by MakeKey.
+func (sc *shardedCache) GetKey(k HashedKey) (interface{}, bool) {
+	return sc.keyBucket(k).Get(k.s)
+}
+
+// SetKey is like Set, for a key made by MakeKey.
+func (sc *shardedCache) SetKey(k HashedKey, x interface{}, d time.Duration) {
+	sc.keyBucket(k).Set(k.s, x, d)
+}
+
+// DeleteKey is like Delete, for a key made by MakeKey.
+func (sc *shardedCache) DeleteKey(k HashedKey) {
+	sc.keyBucket(k).Delete(k.s)
+}
+
+// IncrementKey is like Increment, for a key made by MakeKey.
+func (sc *shardedCache) IncrementKey(k HashedKey, n int64) error {
+	return sc.keyBucket(k).Increment(k.s, n)
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashedKey(t *testing.T) {
+	tc := NewShardedSeeded(DefaultExpiration, 0, 13, 1)
+	k := tc.MakeKey("foo")
+	if s := k.String(); s != "foo" {
+		t.Errorf("got %q, want foo", s)
+	}
+	tc.SetKey(k, 1, DefaultExpiration)
+	if x, found := tc.Get("foo"); !found || x != 1 {
+		t.Errorf("Get after SetKey: got (%v, %v), want (1, true)", x, found)
+	}
+	if err := tc.IncrementKey(k, 2); err != nil {
+		t.Fatal(err)
+	}
+	if x, found := tc.GetKey(k); !found || x != 3 {
+		t.Errorf("GetKey: got (%v, %v), want (3, true)", x, found)
+	}
+	tc.DeleteKey(k)
+	if _, found := tc.Get("foo"); found {
+		t.Error("foo was found after DeleteKey")
+	}
+	if n := tc.ItemCount(); n != 0 {
+		t.Errorf("got item count %d, want 0", n)
+	}
+}
+
+func TestHashedKeyAfterReseed(t *testing.T) {
+	tc := NewShardedSeeded(DefaultExpiration, 0, 13, 1)
+	k := tc.MakeKey("foo")
+	tc.SetKey(k, 1, DefaultExpiration)
+	// Find a seed that moves the key to another shard.
+	seed := uint32(2)
+	for djb33(seed, "foo")%13 == k.i {
+		seed++
+	}
+	tc.Reseed(seed)
+	if x, found := tc.GetKey(k); !found || x != 1 {
+		t.Errorf("GetKey after Reseed: got (%v, %v), want (1, true)", x, found)
+	}
+	tc.SetKey(k, 2, DefaultExpiration)
+	if x, _ := tc.Get("foo"); x != 2 {
+		t.Errorf("Get after SetKey with a stale key: got %v, want 2", x)
+	}
+
+	other := NewShardedSeeded(DefaultExpiration, 0, 7, 1)
+	other.SetKey(k, 3, DefaultExpiration)
+	if x, _ := other.Get("foo"); x != 3 {
+		t.Errorf("Get after SetKey with another cache's key: got %v, want 3", x)
+	}
+}
+
+var hotKey = strings.Repeat("tenant:1234:user:56789:profile:", 8)
+
+func BenchmarkShardedGetLongKey(b *testing.B) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	tc.Set(hotKey, 1, DefaultExpiration)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tc.Get(hotKey)
+	}
+}
+
+func BenchmarkShardedGetHashedKey(b *testing.B) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	k := tc.MakeKey(hotKey)
+	tc.SetKey(k, 1, DefaultExpiration)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tc.GetKey(k)
+	}
+}
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// The number of buckets the window of a rollingCounter is divided into.
+const rollingBuckets = 10
+
+// Counts hits and misses over a rolling window of time, divided into
+// rollingBuckets buckets. Buckets that fall out of the window are reset when
+// they are reused, so old counts age out.
+type rollingCounter struct {
+	mu      sync.Mutex
+	width   int64 // nanoseconds per bucket
+	buckets [rollingBuckets]struct {
+		epoch        int64 // which bucket-width period the counts are for
+		hits, misses uint64
+	}
+}
+
+func newRollingCounter(window time.Duration) *rollingCounter {
+	width := int64(window) / rollingBuckets
+	if width < 1 {
+		width = 1
+	}
+	return &rollingCounter{width: width}
+}
+
+func (r *rollingCounter) record(hit bool, now int64) {
+	epoch := now / r.width
+	r.mu.Lock()
+	b := &r.buckets[epoch%rollingBuckets]
+	if b.epoch != epoch {
+		b.epoch, b.hits, b.misses = epoch, 0, 0
+	}
+	if hit {
+		b.hits++
+	} else {
+		b.misses++
+	}
+	r.mu.Unlock()
+}
+
+// Returns the hits and misses counted in the window ending at now.
+func (r *rollingCounter) sum(now int64) (hits, misses uint64) {
+	epoch := now / r.width
+	r.mu.Lock()
+	for _, b := range r.buckets {
+		if b.epoch > epoch-rollingBuckets && b.epoch <= epoch {
+			hits += b.hits
+			misses += b.misses
+		}
+	}
+	r.mu.Unlock()
+	return hits, misses
+}
+
+// WithRecentHitRate makes the cache count hits and misses of Get and
+// GetWithExpiration over the last window, so that RecentHitRate can report
+// the hit rate over it rather than over the cache's whole lifetime. The window
+// is divided into ten buckets, which age out one at a time. This adds a little
+// overhead to every lookup, so the counts aren't kept by default.
+func WithRecentHitRate(window time.Duration) Option {
+	return func(o *options) {
+		o.hitRateWindow = window
+	}
+}
+
+// Records the outcome of a lookup, if WithRecentHitRate was given.
+func (c *cache) recordLookup(found bool) {
+	if c.hitRate != nil {
+		c.hitRate.record(found, c.now().UnixNano())
+	}
+}
+
+// RecentHitRate returns the fraction of lookups that were hits over the window
+// set with WithRecentHitRate. It returns 0 if there were no lookups in the
+// window, or if WithRecentHitRate wasn't given.
+func (c *cache) RecentHitRate() float64 {
+	if c.hitRate == nil {
+		return 0
+	}
+	return hitRate(c.hitRate.sum(c.now().UnixNano()))
+}
+
+// RecentHitRate returns the fraction of lookups that were hits over the window
+// set with WithRecentHitRate, across all shards. See the cache's
+// RecentHitRate.
+func (sc *shardedCache) RecentHitRate() float64 {
+	var hits, misses uint64
+	for _, c := range sc.cs {
+		if c.hitRate == nil {
+			continue
+		}
+		h, m := c.hitRate.sum(c.now().UnixNano())
+		hits += h
+		misses += m
+	}
+	return hitRate(hits, misses)
+}
+
+func hitRate(hits, misses uint64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type manualClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (m *manualClock) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.t
+}
+
+func (m *manualClock) Advance(d time.Duration) {
+	m.mu.Lock()
+	m.t = m.t.Add(d)
+	m.mu.Unlock()
+}
+
+func TestRecentHitRate(t *testing.T) {
+	clk := &manualClock{t: time.Unix(1000, 0)}
+	tc := New(NoExpiration, 0, WithClock(clk), WithRecentHitRate(time.Minute))
+	if r := tc.RecentHitRate(); r != 0 {
+		t.Errorf("RecentHitRate with no lookups is %v, not 0", r)
+	}
+	tc.Set("foo", 1, DefaultExpiration)
+	for i := 0; i < 9; i++ {
+		tc.Get("foo")
+	}
+	tc.Get("bar")
+	if r := tc.RecentHitRate(); r != 0.9 {
+		t.Errorf("RecentHitRate is %v, not 0.9", r)
+	}
+
+	// Half a window later, a run of misses drags the rate down.
+	clk.Advance(30 * time.Second)
+	for i := 0; i < 10; i++ {
+		tc.GetWithExpiration("bar")
+	}
+	if r := tc.RecentHitRate(); r != 0.45 {
+		t.Errorf("RecentHitRate is %v, not 0.45", r)
+	}
+
+	// Once the hits age out, only the misses are left.
+	clk.Advance(45 * time.Second)
+	if r := tc.RecentHitRate(); r != 0 {
+		t.Errorf("RecentHitRate after the hits aged out is %v, not 0", r)
+	}
+	tc.Get("foo")
+	if r := tc.RecentHitRate(); r != 1.0/11 {
+		t.Errorf("RecentHitRate is %v, not 1/11", r)
+	}
+}
+
+func TestRecentHitRateDisabled(t *testing.T) {
+	tc := New(NoExpiration, 0)
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Get("foo")
+	if r := tc.RecentHitRate(); r != 0 {
+		t.Errorf("RecentHitRate without WithRecentHitRate is %v, not 0", r)
+	}
+}
+
+func TestShardedRecentHitRate(t *testing.T) {
+	tc := NewSharded(NoExpiration, 0, 4, WithRecentHitRate(time.Minute))
+	for i := 0; i < 3; i++ {
+		tc.Set(string(rune('a'+i)), i, DefaultExpiration)
+		tc.Get(string(rune('a' + i)))
+	}
+	tc.Get("missing")
+	if r := tc.RecentHitRate(); r != 0.75 {
+		t.Errorf("RecentHitRate is %v, not 0.75", r)
+	}
+}
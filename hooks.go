@@ -0,0 +1,114 @@
+package cache
+
+// Not a removal: marks an item that was set, for the OnSet and OnReplaced
+// callbacks and watchers. Its value is a *setEvent. notifyEvicted doesn't pass
+// these to the OnEvicted callback.
+const reasonSet EvictionReason = -1
+
+type setEvent struct {
+	// The stored objects of the new item and, if replaced is true, of the
+	// unexpired item it replaced.
+	x, old   interface{}
+	replaced bool
+}
+
+// Sets an (optional) function that is called with the key, the old value and
+// the new value when an unexpired item is overwritten by Set, Replace or any
+// of the other methods that set items (but not by Increment, Decrement or
+// Load), so that resources held by the old value can be released. Overwriting
+// an expired item calls the OnEvicted function instead. f is called after the
+// cache has been unlocked. Set to nil to disable. A panic in f is recovered
+// and reported to the cache's Logger.
+func (c *cache) OnReplaced(f func(k string, oldValue, newValue interface{})) {
+	c.mu.Lock()
+	c.onReplaced = f
+	c.mu.Unlock()
+}
+
+// Sets an (optional) function that is called with the key and value whenever
+// an item is set by Set, Add, Replace or any of the other methods that set
+// items, e.g. to feed an audit log. f is called after the cache has been
+// unlocked, and before the OnReplaced function. Set to nil to disable. A
+// panic in f is recovered and reported to the cache's Logger.
+func (c *cache) OnSet(f func(k string, v interface{})) {
+	c.mu.Lock()
+	c.onSet = f
+	c.mu.Unlock()
+}
+
+// Returns the item stored for k and whether it is unexpired, if the cache has
+// an OnReplaced function that needs it. c.mu must be held.
+func (c *cache) liveItem(k string) (Item, bool) {
+	if c.onReplaced == nil {
+		return Item{}, false
+	}
+	item, found := c.items[k]
+	return item, found && !c.expired(item)
+}
+
+// Returns evictedItems with an event for setting k to the stored object x
+// appended, if anyone is listening. old is the item k replaced, if live is
+// true. c.mu must be held.
+func (c *cache) noteSet(evictedItems []keyAndValue, k string, old Item, live bool, x interface{}) []keyAndValue {
+	if c.watchers == nil && c.onSet == nil && c.onReplaced == nil {
+		return evictedItems
+	}
+	return append(evictedItems, keyAndValue{k, &setEvent{x, old.Object, live}, reasonSet})
+}
+
+// Calls the OnSet and OnReplaced functions, if they are set, for the item with
+// key k that was set as described by e. Each is called even if the other
+// panics, so that a panicking OnSet can't keep OnReplaced from releasing the
+// old value. Must not be called with c.mu held.
+func (c *cache) callOnSet(onSet func(string, interface{}), onReplaced func(string, interface{}, interface{}), k string, e *setEvent) {
+	if onSet != nil {
+		c.callRecovering("OnSet", k, func() {
+			onSet(k, c.setValue(e.x))
+		})
+	}
+	if onReplaced != nil && e.replaced {
+		c.callRecovering("OnReplaced", k, func() {
+			onReplaced(k, c.setValue(e.old), c.setValue(e.x))
+		})
+	}
+}
+
+// Calls f, recovering from a panic in it and reporting it to the cache's
+// Logger as a panic in the callback name for key k.
+func (c *cache) callRecovering(name, k string, f func()) {
+	defer func() {
+		if x := recover(); x != nil {
+			c.logf("recovered from panic in %s callback for key %q: %v", name, k, x)
+		}
+	}()
+	f()
+}
+
+// Returns the value to pass to the OnSet and OnReplaced functions for the
+// stored object x.
+func (c *cache) setValue(x interface{}) interface{} {
+	if isLazy(x) {
+		// The value hasn't been computed.
+		return nil
+	}
+	if v, err := c.decompress(x); err == nil {
+		return c.cloneRemoved(v)
+	}
+	return x
+}
+
+// Sets the function called when an unexpired item is overwritten in any shard.
+// See the cache's OnReplaced.
+func (sc *shardedCache) OnReplaced(f func(k string, oldValue, newValue interface{})) {
+	for _, c := range sc.cs {
+		c.OnReplaced(f)
+	}
+}
+
+// Sets the function called when an item is set in any shard. See the cache's
+// OnSet.
+func (sc *shardedCache) OnSet(f func(k string, v interface{})) {
+	for _, c := range sc.cs {
+		c.OnSet(f)
+	}
+}
@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+type replacedEvent struct {
+	k        string
+	old, new interface{}
+}
+
+type hookable interface {
+	Set(k string, x interface{}, d time.Duration)
+	Add(k string, x interface{}, d time.Duration) error
+	Replace(k string, x interface{}, d time.Duration) error
+	Delete(k string)
+	OnReplaced(f func(k string, oldValue, newValue interface{}))
+	OnSet(f func(k string, v interface{}))
+}
+
+func testOnReplaced(t *testing.T, tc hookable) {
+	var (
+		replaced []replacedEvent
+		sets     []string
+	)
+	tc.OnReplaced(func(k string, old, new interface{}) {
+		replaced = append(replaced, replacedEvent{k, old, new})
+	})
+	tc.OnSet(func(k string, v interface{}) {
+		sets = append(sets, k)
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Add("b", 1, DefaultExpiration)
+	if len(replaced) != 0 {
+		t.Errorf("OnReplaced was called for new items: %v", replaced)
+	}
+	tc.Set("a", 2, DefaultExpiration)
+	tc.Replace("b", 3, DefaultExpiration)
+	tc.Add("b", 4, DefaultExpiration)
+	tc.Delete("a")
+	tc.Set("a", 5, DefaultExpiration)
+	want := []replacedEvent{{"a", 1, 2}, {"b", 1, 3}}
+	if len(replaced) != len(want) || replaced[0] != want[0] || replaced[1] != want[1] {
+		t.Errorf("OnReplaced got %v, want %v", replaced, want)
+	}
+	if len(sets) != 5 {
+		t.Errorf("OnSet got %v", sets)
+	}
+}
+
+func TestOnReplaced(t *testing.T) {
+	testOnReplaced(t, New(DefaultExpiration, 0))
+}
+
+func TestShardedOnReplaced(t *testing.T) {
+	testOnReplaced(t, NewSharded(DefaultExpiration, 0, 3))
+}
+
+func TestOnReplacedExpired(t *testing.T) {
+	clock := &manualClock{t: time.Unix(0, 0)}
+	tc := NewWithOptions(WithClock(clock))
+	var replaced, evicted int
+	tc.OnReplaced(func(string, interface{}, interface{}) {
+		replaced++
+	})
+	tc.OnEvicted(func(string, interface{}) {
+		evicted++
+	})
+	tc.Set("a", 1, time.Second)
+	clock.Advance(2 * time.Second)
+	tc.Set("a", 2, DefaultExpiration)
+	if replaced != 0 || evicted != 1 {
+		t.Errorf("overwriting an expired item called OnReplaced %d times and OnEvicted %d times", replaced, evicted)
+	}
+}
+
+func TestOnReplacedOutsideLock(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.OnReplaced(func(k string, old, new interface{}) {
+		tc.Get(k)
+		tc.Set("other", old, DefaultExpiration)
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	done := make(chan bool)
+	go func() {
+		tc.Set("a", 2, DefaultExpiration)
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnReplaced was called with the cache locked")
+	}
+	if x, _ := tc.Get("other"); x != 1 {
+		t.Errorf("other is %v, not 1", x)
+	}
+}
+
+func TestOnSetPanic(t *testing.T) {
+	l := &testLogger{}
+	tc := New(DefaultExpiration, 0, WithLogger(l))
+	tc.OnSet(func(string, interface{}) {
+		panic("boom")
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	if x, _ := tc.Get("a"); x != 1 {
+		t.Error("a panic in OnSet lost the item")
+	}
+	if len(l.lines) != 1 {
+		t.Errorf("logged %v", l.lines)
+	}
+}
+
+func TestOnSetPanicStillCallsOnReplaced(t *testing.T) {
+	l := &testLogger{}
+	tc := New(DefaultExpiration, 0, WithLogger(l))
+	tc.Set("a", 1, DefaultExpiration)
+	tc.OnSet(func(string, interface{}) {
+		panic("boom")
+	})
+	var released interface{}
+	tc.OnReplaced(func(_ string, old, _ interface{}) {
+		released = old
+	})
+	tc.Set("a", 2, DefaultExpiration)
+	if released != 1 {
+		t.Errorf("OnReplaced got old value %v after OnSet panicked, want 1", released)
+	}
+	if len(l.lines) != 1 {
+		t.Errorf("logged %v", l.lines)
+	}
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"time"
+)
+
+// An Inspection is the outcome of looking up one key with Inspect.
+type Inspection struct {
+	Value interface{}
+	Found bool
+	// The time remaining until the item expires, or NoExpiration if it never
+	// does. Zero if the item wasn't found.
+	TTL time.Duration
+}
+
+// Inspect gets the items with the given keys from the cache, together with
+// their remaining time to live, while holding the cache's read lock once. The
+// returned map has an Inspection for every key, including those that weren't
+// found.
+func (c *cache) Inspect(keys []string) map[string]Inspection {
+	m := make(map[string]Inspection, len(keys))
+	c.inspect(keys, m)
+	return m
+}
+
+// Adds an Inspection for each of keys to m.
+func (c *cache) inspect(keys []string, m map[string]Inspection) {
+	var (
+		objs = make([]interface{}, len(keys))
+		exps = make([]int64, len(keys))
+		hits = make([]bool, len(keys))
+	)
+	now := c.now().UnixNano()
+	c.mu.RLock()
+	for i, k := range keys {
+		item, found := c.items[k]
+		if !found || (item.Expiration > 0 && now > item.Expiration) {
+			continue
+		}
+		if c.evictor != nil {
+			c.evictor.Access(k)
+		}
+		objs[i], exps[i], hits[i] = item.Object, item.Expiration, true
+	}
+	c.mu.RUnlock()
+	for i, k := range keys {
+		if !hits[i] && c.disk != nil {
+			if item, found := c.getFromDisk(k); found {
+				objs[i], exps[i], hits[i] = item.Object, item.Expiration, true
+			}
+		}
+		if !hits[i] {
+			m[k] = Inspection{}
+			continue
+		}
+		var in Inspection
+		in.Value, in.Found = c.value(k, objs[i])
+		if in.Found {
+			in.TTL = NoExpiration
+			if exps[i] > 0 {
+				in.TTL = time.Duration(exps[i] - now)
+			}
+		}
+		m[k] = in
+	}
+}
+
+// Inspect gets the items with the given keys from the cache, together with
+// their remaining time to live, holding each shard's read lock once. See the
+// cache's Inspect.
+func (sc *shardedCache) Inspect(keys []string) map[string]Inspection {
+	var (
+		byShard = map[*cache][]string{}
+		order   []*cache
+	)
+	for _, k := range keys {
+		c := sc.bucket(k)
+		if _, found := byShard[c]; !found {
+			order = append(order, c)
+		}
+		byShard[c] = append(byShard[c], k)
+	}
+	m := make(map[string]Inspection, len(keys))
+	for _, c := range order {
+		c.inspect(byShard[c], m)
+	}
+	return m
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+type inspectable interface {
+	Set(k string, x interface{}, d time.Duration)
+	Inspect(keys []string) map[string]Inspection
+}
+
+func testInspect(t *testing.T, tc inspectable, clock *manualClock) {
+	tc.Set("a", 1, time.Minute)
+	tc.Set("b", 2, NoExpiration)
+	tc.Set("c", 3, time.Second)
+	clock.Advance(2 * time.Second)
+
+	m := tc.Inspect([]string{"a", "b", "c", "d"})
+	if len(m) != 4 {
+		t.Fatalf("Inspect returned %d results, not 4", len(m))
+	}
+	if in := m["a"]; !in.Found || in.Value != 1 || in.TTL != 58*time.Second {
+		t.Errorf("a: %+v", in)
+	}
+	if in := m["b"]; !in.Found || in.Value != 2 || in.TTL != NoExpiration {
+		t.Errorf("b: %+v", in)
+	}
+	for _, k := range []string{"c", "d"} {
+		if in := m[k]; in != (Inspection{}) {
+			t.Errorf("%s: %+v", k, in)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	clock := &manualClock{t: time.Unix(0, 0)}
+	testInspect(t, NewWithOptions(WithClock(clock)), clock)
+}
+
+func TestShardedInspect(t *testing.T) {
+	clock := &manualClock{t: time.Unix(0, 0)}
+	testInspect(t, NewShardedWithOptions(WithShards(3), WithClock(clock)), clock)
+}
+
+func BenchmarkInspect(b *testing.B) {
+	tc := New(DefaultExpiration, 0)
+	keys := make([]string, 20)
+	for i := range keys {
+		keys[i] = string(rune('a' + i))
+		tc.Set(keys[i], i, time.Hour)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tc.Inspect(keys)
+	}
+}
@@ -0,0 +1,165 @@
+package cache
+
+import (
+	insecurerand "math/rand"
+	"sync"
+	"time"
+)
+
+// A Janitor calls a sweep function periodically from its own goroutine until it
+// is stopped. It is what deletes expired items from caches created with a
+// cleanup interval, and can be used for other structures that need periodic
+// cleanup with a clean shutdown.
+//
+// A Janitor's methods may be called concurrently.
+type Janitor struct {
+	interval time.Duration
+	jitter   time.Duration
+	eager    bool
+	sweep    func()
+	// Counts the janitor's goroutine, if it belongs to a cache.
+	goroutines *goroutines
+	// Runs the janitor's sweeps instead of its own goroutine, if set.
+	reaper *Reaper
+
+	mu      sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+	trigger chan struct{}
+}
+
+// A JanitorOption configures a Janitor. See NewJanitor.
+type JanitorOption func(*Janitor)
+
+// WithJanitorJitter adds a random duration in [0, max) to each wait between
+// sweeps, so that janitors started at the same time don't sweep in lockstep.
+func WithJanitorJitter(max time.Duration) JanitorOption {
+	return func(j *Janitor) {
+		j.jitter = max
+	}
+}
+
+// WithJanitorSweepOnStart makes the janitor sweep once as soon as it is
+// started, rather than waiting for the first interval to pass.
+func WithJanitorSweepOnStart() JanitorOption {
+	return func(j *Janitor) {
+		j.eager = true
+	}
+}
+
+// NewJanitor returns a Janitor that calls sweep every interval once started.
+// interval must be greater than zero. Sweeps never overlap: the next wait
+// starts when a sweep returns.
+func NewJanitor(interval time.Duration, sweep func(), opts ...JanitorOption) *Janitor {
+	j := &Janitor{
+		interval: interval,
+		sweep:    sweep,
+		trigger:  make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
+}
+
+// Start starts the janitor's goroutine. It has no effect if the janitor is
+// already running. A stopped janitor can be started again.
+func (j *Janitor) Start() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.stop != nil {
+		return
+	}
+	// Drop any trigger made while the janitor wasn't running.
+	select {
+	case <-j.trigger:
+	default:
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	j.stop, j.done = stop, done
+	if j.reaper != nil {
+		close(done)
+		j.reaper.add(j)
+		return
+	}
+	j.goroutines.helper(func() { j.run(stop, done) })
+}
+
+// Stop stops the janitor's goroutine, waiting for a sweep in progress to
+// finish. No sweeps are started once Stop returns. It has no effect if the
+// janitor isn't running. Stop must not be called from the sweep function.
+func (j *Janitor) Stop() {
+	j.mu.Lock()
+	stop, done := j.stop, j.done
+	j.stop, j.done = nil, nil
+	j.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	if j.reaper != nil {
+		j.reaper.remove(j)
+	}
+	close(stop)
+	<-done
+}
+
+// TriggerNow makes the janitor sweep as soon as possible instead of waiting
+// for the rest of the interval, without waiting for the sweep. If a sweep is in
+// progress, another one is made once it returns. Triggers made before the
+// janitor gets to sweep are merged into one. It has no effect if the janitor
+// isn't running.
+func (j *Janitor) TriggerNow() {
+	if j.reaper != nil {
+		j.reaper.trigger(j)
+		return
+	}
+	select {
+	case j.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Returns the time to wait until the next sweep.
+func (j *Janitor) wait() time.Duration {
+	d := j.interval
+	if j.jitter > 0 {
+		d += time.Duration(insecurerand.Int63n(int64(j.jitter)))
+	}
+	return d
+}
+
+func (j *Janitor) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	if j.eager {
+		select {
+		case <-stop:
+			return
+		default:
+			j.sweep()
+		}
+	}
+	timer := time.NewTimer(j.wait())
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-j.trigger:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-stop:
+			return
+		}
+		// Don't sweep if both were ready and the stop lost the race.
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		j.sweep()
+		timer.Reset(j.wait())
+	}
+}
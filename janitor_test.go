@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJanitorSweeps(t *testing.T) {
+	var n int32
+	j := NewJanitor(5*time.Millisecond, func() { atomic.AddInt32(&n, 1) }, WithJanitorJitter(time.Millisecond))
+	j.Start()
+	j.Start()
+	<-time.After(50 * time.Millisecond)
+	j.Stop()
+	swept := atomic.LoadInt32(&n)
+	if swept < 2 {
+		t.Errorf("the janitor swept %d times in 50ms with a 5ms interval", swept)
+	}
+	<-time.After(20 * time.Millisecond)
+	if m := atomic.LoadInt32(&n); m != swept {
+		t.Errorf("the janitor swept %d times after being stopped", m-swept)
+	}
+}
+
+func TestJanitorSweepOnStart(t *testing.T) {
+	swept := make(chan struct{}, 1)
+	j := NewJanitor(time.Hour, func() { swept <- struct{}{} }, WithJanitorSweepOnStart())
+	j.Start()
+	defer j.Stop()
+	select {
+	case <-swept:
+	case <-time.After(time.Second):
+		t.Error("the janitor didn't sweep when started")
+	}
+}
+
+func TestJanitorStopIsPrompt(t *testing.T) {
+	j := NewJanitor(time.Hour, func() {})
+	j.Start()
+	stopped := make(chan struct{})
+	go func() {
+		j.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop waited for the interval to pass")
+	}
+	// Stopping again, or a janitor that was never started, has no effect.
+	j.Stop()
+	NewJanitor(time.Hour, func() {}).Stop()
+}
+
+func TestJanitorStopWaitsForSweep(t *testing.T) {
+	started := make(chan struct{})
+	var finished int32
+	j := NewJanitor(time.Hour, func() {
+		close(started)
+		<-time.After(20 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+	})
+	j.Start()
+	j.TriggerNow()
+	<-started
+	j.Stop()
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Error("Stop returned before the sweep in progress finished")
+	}
+}
+
+func TestJanitorTriggerNow(t *testing.T) {
+	swept := make(chan struct{}, 10)
+	release := make(chan struct{})
+	j := NewJanitor(time.Hour, func() {
+		swept <- struct{}{}
+		<-release
+	})
+	j.TriggerNow()
+	j.Start()
+	defer j.Stop()
+	select {
+	case <-swept:
+		t.Fatal("a trigger made before Start caused a sweep")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	j.TriggerNow()
+	<-swept
+	// Triggers made during a sweep are merged into one more sweep.
+	j.TriggerNow()
+	j.TriggerNow()
+	j.TriggerNow()
+	release <- struct{}{}
+	select {
+	case <-swept:
+	case <-time.After(time.Second):
+		t.Fatal("TriggerNow during a sweep didn't cause another sweep")
+	}
+	release <- struct{}{}
+	select {
+	case <-swept:
+		t.Error("triggers made during a sweep weren't merged")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestJanitorRestart(t *testing.T) {
+	swept := make(chan struct{}, 1)
+	j := NewJanitor(time.Hour, func() { swept <- struct{}{} })
+	j.Start()
+	j.Stop()
+	j.Start()
+	defer j.Stop()
+	j.TriggerNow()
+	select {
+	case <-swept:
+	case <-time.After(time.Second):
+		t.Error("a restarted janitor didn't sweep")
+	}
+}
+
+func TestJanitorNoGoroutineLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		j := NewJanitor(time.Millisecond, func() {})
+		j.Start()
+		j.TriggerNow()
+		j.Stop()
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("%d goroutines were left running", after-before)
+	}
+}
@@ -0,0 +1,57 @@
+package cache
+
+import "time"
+
+// WithKeepTTLFallback makes SetKeepTTL store the value with the default
+// expiration when the key is missing or has expired, instead of storing
+// nothing.
+func WithKeepTTLFallback() Option {
+	return func(o *options) {
+		o.keepTTLFallback = true
+	}
+}
+
+// SetKeepTTL replaces the value of an unexpired item, keeping its expiration
+// time, like Redis's SET with KEEPTTL: refreshing a value doesn't extend its
+// lifetime. Returns whether the key held an unexpired item. If it didn't,
+// nothing is stored, unless the cache was created with WithKeepTTLFallback,
+// in which case the value is stored with the default expiration.
+//
+// An item is unexpired up to and including its expiration time, as for Get.
+func (c *cache) SetKeepTTL(k string, x interface{}) bool {
+	c.flushPending(k)
+	x = c.compress(x)
+	c.mu.Lock()
+	old, found := c.items[k]
+	found = found && !c.expired(old)
+	if (!found && !c.keepTTLFallback) || c.tombstoned(k) {
+		c.mu.Unlock()
+		return false
+	}
+	d := DefaultExpiration
+	if found {
+		d = NoExpiration
+		if old.Expiration > 0 {
+			d = time.Duration(old.Expiration - c.now().UnixNano())
+		}
+	}
+	evictedItems := c.set(k, x, d)
+	if found {
+		// Set the exact expiration time again: it may have moved, as the
+		// clock was read twice, and at the expiration time itself d is 0,
+		// which set takes for DefaultExpiration.
+		item := c.items[k]
+		item.Expiration = old.Expiration
+		c.items[k] = item
+		c.noteExpiration(old.Expiration)
+	}
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+	return found
+}
+
+// SetKeepTTL replaces the value of an unexpired item in the shard owning k,
+// keeping its expiration time. See the cache's SetKeepTTL.
+func (sc *shardedCache) SetKeepTTL(k string, x interface{}) bool {
+	return sc.bucket(k).SetKeepTTL(k, x)
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetKeepTTL(t *testing.T) {
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := New(time.Minute, 0, WithClock(clk))
+	if tc.SetKeepTTL("foo", "bar") {
+		t.Error("SetKeepTTL kept the expiration of a missing key")
+	}
+	if _, found := tc.Get("foo"); found {
+		t.Error("SetKeepTTL stored a missing key")
+	}
+
+	tc.Set("foo", "bar", time.Second)
+	exp := tc.items["foo"].Expiration
+	clk.Advance(500 * time.Millisecond)
+	if !tc.SetKeepTTL("foo", "baz") {
+		t.Error("SetKeepTTL didn't keep the expiration of a live key")
+	}
+	if v, _ := tc.Get("foo"); v != "baz" {
+		t.Errorf("got %v, want baz", v)
+	}
+	if e := tc.items["foo"].Expiration; e != exp {
+		t.Errorf("got expiration %d, want %d", e, exp)
+	}
+
+	// The item is still live at its expiration time.
+	clk.Advance(500 * time.Millisecond)
+	if !tc.SetKeepTTL("foo", "qux") {
+		t.Error("SetKeepTTL didn't keep the expiration at the expiration time")
+	}
+	if e := tc.items["foo"].Expiration; e != exp {
+		t.Errorf("got expiration %d at the boundary, want %d", e, exp)
+	}
+	clk.Advance(time.Nanosecond)
+	if tc.SetKeepTTL("foo", "quux") {
+		t.Error("SetKeepTTL kept the expiration of an expired key")
+	}
+	if v, found := tc.items["foo"]; !found || v.Object != "qux" {
+		t.Errorf("SetKeepTTL changed an expired item: %v", v.Object)
+	}
+
+	tc.Set("forever", 1, NoExpiration)
+	tc.SetKeepTTL("forever", 2)
+	if e := tc.items["forever"].Expiration; e != 0 {
+		t.Errorf("got expiration %d for an item that never expires", e)
+	}
+}
+
+func TestSetKeepTTLNoDefaultExpiration(t *testing.T) {
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := New(NoExpiration, 0, WithClock(clk))
+	tc.Set("foo", "bar", time.Second)
+	clk.Advance(time.Second)
+	tc.mayExpire.Store(false)
+	tc.SetKeepTTL("foo", "baz")
+	if !tc.mayExpire.Load() {
+		t.Error("cache holding an item that expires isn't marked as expiring")
+	}
+	clk.Advance(time.Nanosecond)
+	if n := tc.DeleteExpired(); n != 1 {
+		t.Errorf("deleted %d items, want 1", n)
+	}
+}
+
+func TestSetKeepTTLFallback(t *testing.T) {
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := New(time.Minute, 0, WithClock(clk), WithKeepTTLFallback())
+	if tc.SetKeepTTL("foo", "bar") {
+		t.Error("SetKeepTTL kept the expiration of a missing key")
+	}
+	if v, found := tc.Get("foo"); !found || v != "bar" {
+		t.Errorf("got (%v, %v), want (bar, true)", v, found)
+	}
+	if e, want := tc.items["foo"].Expiration, clk.Now().Add(time.Minute).UnixNano(); e != want {
+		t.Errorf("got expiration %d, want the default %d", e, want)
+	}
+}
+
+func TestShardedSetKeepTTL(t *testing.T) {
+	tc := NewShardedWithOptions(WithShards(3), WithKeepTTLFallback())
+	if tc.SetKeepTTL("foo", 1) {
+		t.Error("SetKeepTTL kept the expiration of a missing key")
+	}
+	tc.Set("bar", 1, time.Hour)
+	exp := tc.bucket("bar").items["bar"].Expiration
+	if !tc.SetKeepTTL("bar", 2) {
+		t.Error("SetKeepTTL didn't keep the expiration of a live key")
+	}
+	if e := tc.bucket("bar").items["bar"].Expiration; e != exp {
+		t.Errorf("got expiration %d, want %d", e, exp)
+	}
+	if n := tc.ItemCount(); n != 2 {
+		t.Errorf("got item count %d, want 2", n)
+	}
+}
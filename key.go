@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// KeySeparator separates the parts of keys made by Key and KeyBuilder.
+const KeySeparator = ':'
+
+// Key makes a key from the given parts, e.g. Key("user", 42, "profile") is
+// "user:42:profile". Use it instead of formatting keys at each call site, so
+// that the same parts always make the same key.
+//
+// Strings, []byte, bools, integers, floats, time.Time and time.Duration are
+// formatted without using fmt; other values are formatted using fmt.Sprint.
+// Any separators and backslashes within a part are escaped with a backslash,
+// so different lists of parts never make the same key: Key("a:b") is "a\:b",
+// not "a:b" like Key("a", "b"). Parts that format the same way, like 1 and
+// "1", do make the same key.
+func Key(parts ...interface{}) string {
+	// Most parts are short, so this usually avoids growing the buffer.
+	b := KeyBuilder{buf: make([]byte, 0, 16*len(parts))}
+	for _, p := range parts {
+		b.Add(p)
+	}
+	return b.String()
+}
+
+// A KeyBuilder makes a key from parts added one at a time, like Key. The zero
+// value is ready to use. Reset allows the builder's buffer to be reused.
+type KeyBuilder struct {
+	buf []byte
+	n   int
+}
+
+// Add adds a part to the key. See Key for how parts are formatted.
+func (b *KeyBuilder) Add(part interface{}) *KeyBuilder {
+	if b.n > 0 {
+		b.buf = append(b.buf, KeySeparator)
+	}
+	b.n++
+	switch v := part.(type) {
+	case string:
+		b.appendEscaped(v)
+	case []byte:
+		b.appendEscaped(string(v))
+	case bool:
+		b.buf = strconv.AppendBool(b.buf, v)
+	case int:
+		b.buf = strconv.AppendInt(b.buf, int64(v), 10)
+	case int8:
+		b.buf = strconv.AppendInt(b.buf, int64(v), 10)
+	case int16:
+		b.buf = strconv.AppendInt(b.buf, int64(v), 10)
+	case int32:
+		b.buf = strconv.AppendInt(b.buf, int64(v), 10)
+	case int64:
+		b.buf = strconv.AppendInt(b.buf, v, 10)
+	case uint:
+		b.buf = strconv.AppendUint(b.buf, uint64(v), 10)
+	case uint8:
+		b.buf = strconv.AppendUint(b.buf, uint64(v), 10)
+	case uint16:
+		b.buf = strconv.AppendUint(b.buf, uint64(v), 10)
+	case uint32:
+		b.buf = strconv.AppendUint(b.buf, uint64(v), 10)
+	case uint64:
+		b.buf = strconv.AppendUint(b.buf, v, 10)
+	case uintptr:
+		b.buf = strconv.AppendUint(b.buf, uint64(v), 10)
+	case float32:
+		b.buf = strconv.AppendFloat(b.buf, float64(v), 'g', -1, 32)
+	case float64:
+		b.buf = strconv.AppendFloat(b.buf, v, 'g', -1, 64)
+	case time.Duration:
+		b.buf = strconv.AppendInt(b.buf, int64(v), 10)
+	case time.Time:
+		b.appendEscaped(v.UTC().Format(time.RFC3339Nano))
+	default:
+		b.appendEscaped(fmt.Sprint(v))
+	}
+	return b
+}
+
+func (b *KeyBuilder) appendEscaped(s string) {
+	for i := 0; i < len(s); i++ {
+		if s[i] == KeySeparator || s[i] == '\\' {
+			b.buf = append(b.buf, '\\')
+		}
+		b.buf = append(b.buf, s[i])
+	}
+}
+
+// String returns the key made from the parts added so far.
+func (b *KeyBuilder) String() string {
+	return string(b.buf)
+}
+
+// Reset removes all parts from the builder, keeping its buffer.
+func (b *KeyBuilder) Reset() {
+	b.buf = b.buf[:0]
+	b.n = 0
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestKey(t *testing.T) {
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 6, time.FixedZone("", 3600))
+	cases := []struct {
+		parts []interface{}
+		want  string
+	}{
+		{nil, ""},
+		{[]interface{}{"user", 42, "profile"}, "user:42:profile"},
+		{[]interface{}{int8(-1), uint64(18446744073709551615), true}, "-1:18446744073709551615:true"},
+		{[]interface{}{1.5, float32(0.1), []byte("b")}, "1.5:0.1:b"},
+		{[]interface{}{"a:b", `c\`}, `a\:b:c\\`},
+		{[]interface{}{"", ""}, ":"},
+		{[]interface{}{time.Second, ts}, "1000000000:2020-01-02T02\\:04\\:05.000000006Z"},
+		{[]interface{}{errors.New("x:y")}, `x\:y`},
+	}
+	for _, c := range cases {
+		if k := Key(c.parts...); k != c.want {
+			t.Errorf("Key(%v) is %q, not %q", c.parts, k, c.want)
+		}
+	}
+}
+
+func TestKeyIsUnambiguous(t *testing.T) {
+	keys := map[string][]interface{}{}
+	for _, parts := range [][]interface{}{
+		{"a", "b"},
+		{"a:b"},
+		{`a\`, "b"},
+		{`a\:b`},
+		{"a", "", "b"},
+		{"a::b"},
+	} {
+		k := Key(parts...)
+		if other, found := keys[k]; found {
+			t.Errorf("%v and %v make the same key %q", parts, other, k)
+		}
+		keys[k] = parts
+	}
+}
+
+func TestKeyBuilder(t *testing.T) {
+	var b KeyBuilder
+	b.Add("user").Add(42)
+	if k := b.String(); k != "user:42" {
+		t.Errorf("key is %q", k)
+	}
+	b.Reset()
+	b.Add("order")
+	if k := b.String(); k != "order" {
+		t.Errorf("key is %q after Reset", k)
+	}
+}
+
+func BenchmarkKey(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Key("user", i, "profile")
+	}
+}
+
+func BenchmarkKeyBuilder(b *testing.B) {
+	var kb KeyBuilder
+	for i := 0; i < b.N; i++ {
+		kb.Reset()
+		kb.Add("user").Add(i).Add("profile")
+		_ = kb.String()
+	}
+}
+
+func BenchmarkKeySprintf(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_ = fmt.Sprintf("%s:%d:%s", "user", i, "profile")
+	}
+}
@@ -0,0 +1,367 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// KeyEventType is the kind of change a KeyEvent describes.
+type KeyEventType int
+
+const (
+	// KeyEventSet means the item was set, e.g. using Set, Add or Replace.
+	KeyEventSet KeyEventType = iota
+	// KeyEventDelete means the item was removed explicitly, e.g. using Delete
+	// or Flush.
+	KeyEventDelete
+	// KeyEventExpire means the item was removed after it expired.
+	KeyEventExpire
+	// KeyEventEvict means the item was evicted to make room for another in a
+	// capacity-limited cache.
+	KeyEventEvict
+)
+
+func (t KeyEventType) String() string {
+	switch t {
+	case KeyEventSet:
+		return "set"
+	case KeyEventDelete:
+		return "delete"
+	case KeyEventExpire:
+		return "expire"
+	case KeyEventEvict:
+		return "evict"
+	}
+	return "unknown"
+}
+
+// A KeyEvent describes a change to the item with a key. See WatchPattern.
+type KeyEvent struct {
+	Key  string
+	Type KeyEventType
+}
+
+// WatchPattern returns a channel on which a KeyEvent is sent whenever an item
+// whose key matches pattern is set, deleted, expires or is evicted, and a
+// function that stops the subscription and closes the channel. Items stored by
+// Load and the other snapshot methods, or modified by Increment and Decrement,
+// don't produce events.
+//
+// pattern is a glob: '*' matches any sequence of characters, '?' matches any
+// one character, '[abc]' and '[a-z]' match one of the characters in the class,
+// '[!abc]' or '[^abc]' one that isn't, and '\' matches the next character
+// literally. A '[' without a closing ']' matches itself. The pattern is
+// compiled once, and matched against keys after the cache has been unlocked.
+//
+// Every subscription whose pattern matches a key receives its events. The
+// channel has room for buffer events; sending never blocks a writer, so if the
+// channel is full, the event is dropped and counted in DroppedKeyEvents. Events
+// for changes made concurrently may arrive in a different order from the one
+// in which the changes were made. Close closes every subscription's channel.
+func (c *cache) WatchPattern(pattern string, buffer int) (<-chan KeyEvent, func()) {
+	s := newPatternSub(pattern, buffer)
+	c.subscribe(s)
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() {
+			c.unsubscribe(s)
+			s.close()
+		})
+	}
+}
+
+// DroppedKeyEvents returns the number of events that weren't sent to a
+// subscription created with WatchPattern because its channel was full.
+func (c *cache) DroppedKeyEvents() uint64 {
+	return atomic.LoadUint64(&c.droppedKeyEvents)
+}
+
+func (c *cache) subscribe(s *patternSub) {
+	c.mu.Lock()
+	if c.watchers == nil {
+		c.watchers = &keyWatchers{}
+	}
+	w := c.watchers
+	w.mu.Lock()
+	w.subs = append(w.subs, s)
+	w.mu.Unlock()
+	c.mu.Unlock()
+}
+
+func (c *cache) unsubscribe(s *patternSub) {
+	c.mu.Lock()
+	if w := c.watchers; w != nil {
+		w.mu.Lock()
+		for i, v := range w.subs {
+			if v == s {
+				w.subs = append(w.subs[:i:i], w.subs[i+1:]...)
+				break
+			}
+		}
+		if len(w.subs) == 0 {
+			c.watchers = nil
+		}
+		w.mu.Unlock()
+	}
+	c.mu.Unlock()
+}
+
+// Reports whether removed items must be collected for notifyEvicted. c.mu
+// must be held.
+func (c *cache) notifying() bool {
+	return c.onEvicted != nil || c.watchers != nil
+}
+
+// The subscriptions created with WatchPattern.
+type keyWatchers struct {
+	mu   sync.RWMutex
+	subs []*patternSub
+}
+
+// Sends an event for each of the given items to every subscription whose
+// pattern matches its key. c.mu must not be held.
+func (w *keyWatchers) publish(c *cache, items []keyAndValue) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	for _, s := range w.subs {
+		for _, v := range items {
+			if !s.pattern.match(v.key) {
+				continue
+			}
+			if !s.send(KeyEvent{v.key, keyEventType(v.reason)}) {
+				atomic.AddUint64(&c.droppedKeyEvents, 1)
+			}
+		}
+	}
+}
+
+func (w *keyWatchers) close() {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	for _, s := range w.subs {
+		s.close()
+	}
+}
+
+func keyEventType(reason EvictionReason) KeyEventType {
+	switch reason {
+	case reasonSet:
+		return KeyEventSet
+	case EvictionReasonExpired:
+		return KeyEventExpire
+	case EvictionReasonCapacity:
+		return KeyEventEvict
+	}
+	return KeyEventDelete
+}
+
+type patternSub struct {
+	pattern globPattern
+	mu      sync.Mutex
+	ch      chan KeyEvent
+	closed  bool
+}
+
+func newPatternSub(pattern string, buffer int) *patternSub {
+	return &patternSub{
+		pattern: compileGlob(pattern),
+		ch:      make(chan KeyEvent, buffer),
+	}
+}
+
+// Sends ev without blocking. Returns false if it was dropped.
+func (s *patternSub) send(ev KeyEvent) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return true
+	}
+	select {
+	case s.ch <- ev:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *patternSub) close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+	s.mu.Unlock()
+}
+
+const (
+	globLiteral = iota
+	globAny
+	globStar
+	globClass
+)
+
+type globToken struct {
+	kind   int
+	r      rune
+	ranges []runeRange
+	negate bool
+}
+
+type runeRange struct {
+	lo, hi rune
+}
+
+func (t *globToken) matches(r rune) bool {
+	switch t.kind {
+	case globLiteral:
+		return r == t.r
+	case globAny:
+		return true
+	case globClass:
+		for _, rr := range t.ranges {
+			if r >= rr.lo && r <= rr.hi {
+				return !t.negate
+			}
+		}
+		return t.negate
+	}
+	return false
+}
+
+// A compiled glob pattern. See WatchPattern.
+type globPattern []globToken
+
+func compileGlob(pattern string) globPattern {
+	var p globPattern
+	for i := 0; i < len(pattern); {
+		r, n := utf8.DecodeRuneInString(pattern[i:])
+		i += n
+		switch r {
+		case '*':
+			if len(p) == 0 || p[len(p)-1].kind != globStar {
+				p = append(p, globToken{kind: globStar})
+			}
+		case '?':
+			p = append(p, globToken{kind: globAny})
+		case '\\':
+			if i < len(pattern) {
+				r, n = utf8.DecodeRuneInString(pattern[i:])
+				i += n
+			}
+			p = append(p, globToken{kind: globLiteral, r: r})
+		case '[':
+			if t, m, ok := compileClass(pattern[i:]); ok {
+				p = append(p, t)
+				i += m
+			} else {
+				p = append(p, globToken{kind: globLiteral, r: r})
+			}
+		default:
+			p = append(p, globToken{kind: globLiteral, r: r})
+		}
+	}
+	return p
+}
+
+// Compiles the character class at the start of s, which follows a '['.
+// Returns the class and the length of s it took up, including the closing
+// ']', or false if there is none.
+func compileClass(s string) (globToken, int, bool) {
+	t := globToken{kind: globClass}
+	i := 0
+	if i < len(s) && (s[i] == '!' || s[i] == '^') {
+		t.negate = true
+		i++
+	}
+	first := true
+	for i < len(s) {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if r == ']' && !first {
+			return t, i + n, true
+		}
+		first = false
+		i += n
+		if r == '\\' && i < len(s) {
+			r, n = utf8.DecodeRuneInString(s[i:])
+			i += n
+		}
+		hi := r
+		if i+1 < len(s) && s[i] == '-' && s[i+1] != ']' {
+			i++
+			hi, n = utf8.DecodeRuneInString(s[i:])
+			i += n
+			if hi == '\\' && i < len(s) {
+				hi, n = utf8.DecodeRuneInString(s[i:])
+				i += n
+			}
+		}
+		t.ranges = append(t.ranges, runeRange{r, hi})
+	}
+	return t, 0, false
+}
+
+// Reports whether s matches the whole pattern. A '*' is retried at each
+// position of s only when what follows it fails to match, so matching takes
+// time proportional to len(s) times the number of tokens at worst.
+func (p globPattern) match(s string) bool {
+	var (
+		pi, si         int
+		starPi, starSi = -1, 0
+	)
+	for pi < len(p) || si < len(s) {
+		if pi < len(p) {
+			t := &p[pi]
+			if t.kind == globStar {
+				starPi, starSi = pi, si
+				pi++
+				continue
+			}
+			if si < len(s) {
+				r, n := utf8.DecodeRuneInString(s[si:])
+				if t.matches(r) {
+					pi++
+					si += n
+					continue
+				}
+			}
+		}
+		if starPi >= 0 && starSi < len(s) {
+			_, n := utf8.DecodeRuneInString(s[starSi:])
+			starSi += n
+			pi, si = starPi+1, starSi
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// WatchPattern returns a channel on which a KeyEvent is sent whenever an item
+// in any shard whose key matches pattern changes. See the cache's
+// WatchPattern.
+func (sc *shardedCache) WatchPattern(pattern string, buffer int) (<-chan KeyEvent, func()) {
+	s := newPatternSub(pattern, buffer)
+	for _, c := range sc.cs {
+		c.subscribe(s)
+	}
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() {
+			for _, c := range sc.cs {
+				c.unsubscribe(s)
+			}
+			s.close()
+		})
+	}
+}
+
+// DroppedKeyEvents returns the number of events that weren't sent to a
+// subscription created with WatchPattern because its channel was full.
+func (sc *shardedCache) DroppedKeyEvents() uint64 {
+	var n uint64
+	for _, c := range sc.cs {
+		n += c.DroppedKeyEvents()
+	}
+	return n
+}
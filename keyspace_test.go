@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGlobMatch(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"session:*", "session:abc", true},
+		{"session:*", "session:", true},
+		{"session:*", "sessions:abc", false},
+		{"user:*:profile", "user:42:profile", true},
+		{"user:*:profile", "user:42:settings", false},
+		{"user:*:profile", "user:a:b:profile", true},
+		{"*", "", true},
+		{"", "", true},
+		{"", "a", false},
+		{"a**b", "ab", true},
+		{"*a*b*", "xxaxxbxx", true},
+		{"*a*b*", "xxbxxaxx", false},
+		{"?", "é", true},
+		{"??", "é", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[!e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{"[]]", "]", true},
+		{"[a-]", "-", true},
+		{"[\\]]", "]", true},
+		{"h[allo", "h[allo", true},
+		{"h[allo", "hallo", false},
+		{"a\\*", "a*", true},
+		{"a\\*", "ab", false},
+		{"a\\", "a\\", true},
+		{"/a/*/c", "/a/b/x/c", true},
+	} {
+		if got := compileGlob(tt.pattern).match(tt.key); got != tt.want {
+			t.Errorf("%q matching %q: got %v, want %v", tt.pattern, tt.key, got, tt.want)
+		}
+	}
+}
+
+// Returns the events waiting in ch.
+func drainKeyEvents(ch <-chan KeyEvent) []KeyEvent {
+	var evs []KeyEvent
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return evs
+			}
+			evs = append(evs, ev)
+		default:
+			return evs
+		}
+	}
+}
+
+func TestWatchPattern(t *testing.T) {
+	clock := &manualClock{t: time.Unix(0, 0)}
+	tc := NewWithOptions(WithClock(clock), WithMaxItems(3))
+	sessions, stopSessions := tc.WatchPattern("session:*", 16)
+	all, stopAll := tc.WatchPattern("*", 16)
+	defer stopAll()
+
+	tc.Set("session:1", 1, time.Minute)
+	tc.Set("user:1", 1, DefaultExpiration)
+	tc.Delete("session:1")
+	tc.Set("session:2", 2, time.Minute)
+	clock.Advance(2 * time.Minute)
+	tc.DeleteExpired()
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 1, DefaultExpiration)
+	tc.Set("c", 1, DefaultExpiration)
+
+	want := []KeyEvent{
+		{"session:1", KeyEventSet},
+		{"session:1", KeyEventDelete},
+		{"session:2", KeyEventSet},
+		{"session:2", KeyEventExpire},
+	}
+	got := drainKeyEvents(sessions)
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+	evs := drainKeyEvents(all)
+	if len(evs) != 9 {
+		t.Errorf("the overlapping subscription got %v", evs)
+	}
+	if last := evs[len(evs)-2]; last != (KeyEvent{"user:1", KeyEventEvict}) {
+		t.Errorf("got %v, not an eviction of user:1", last)
+	}
+
+	stopSessions()
+	stopSessions()
+	if _, ok := <-sessions; ok {
+		t.Error("the channel is still open after unsubscribing")
+	}
+	if n := len(tc.watchers.subs); n != 1 {
+		t.Errorf("%d subscriptions left, not 1", n)
+	}
+	stopAll()
+	if tc.watchers != nil {
+		t.Error("the watchers weren't removed after the last unsubscribe")
+	}
+}
+
+func TestWatchPatternDoesntCallOnEvicted(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	calls := 0
+	tc.OnEvicted(func(string, interface{}) {
+		calls++
+	})
+	_, stop := tc.WatchPattern("*", 1)
+	defer stop()
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Delete("foo")
+	if calls != 1 {
+		t.Errorf("OnEvicted was called %d times, not once", calls)
+	}
+}
+
+func TestWatchPatternDropsWhenFull(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	ch, stop := tc.WatchPattern("*", 1)
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 10; i++ {
+			tc.Set("foo", i, DefaultExpiration)
+		}
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a full subscription blocked Set")
+	}
+	if evs := drainKeyEvents(ch); len(evs) != 1 {
+		t.Errorf("got %d events, not 1", len(evs))
+	}
+	if n := tc.DroppedKeyEvents(); n != 9 {
+		t.Errorf("DroppedKeyEvents is %d, not 9", n)
+	}
+	stop()
+	tc.Set("foo", 1, DefaultExpiration)
+}
+
+func TestWatchPatternClosedByClose(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	ch, stop := tc.WatchPattern("*", 1)
+	tc.Close()
+	if _, ok := <-ch; ok {
+		t.Error("Close didn't close the channel")
+	}
+	stop()
+}
+
+func TestShardedWatchPattern(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 4)
+	ch, stop := tc.WatchPattern("k?", 16)
+	for _, k := range []string{"k1", "k2", "k3", "k10", "x1"} {
+		tc.Set(k, 1, DefaultExpiration)
+	}
+	if evs := drainKeyEvents(ch); len(evs) != 3 {
+		t.Errorf("got %v", evs)
+	}
+	stop()
+	for _, c := range tc.cs {
+		if c.watchers != nil {
+			t.Error("a shard still has watchers after unsubscribing")
+		}
+	}
+	if _, ok := <-ch; ok {
+		t.Error("the channel is still open after unsubscribing")
+	}
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A value set using SetLazy that hasn't been replaced by its computed value
+// yet.
+type lazyValue struct {
+	compute func() (interface{}, error)
+	mu      sync.Mutex
+	// The current or, once it has succeeded, last computation.
+	f *flight
+}
+
+func isLazy(x interface{}) bool {
+	_, ok := x.(*lazyValue)
+	return ok
+}
+
+// SetLazy adds an item to the cache, replacing any existing item, whose value
+// is only computed, by calling compute, the first time it is read using Get (or
+// GetWithExpiration.) The computed value then replaces the item's value in
+// place, keeping its expiration time. If several goroutines read the item
+// while it is being computed, compute is only called once.
+//
+// If compute returns an error, the read reports a miss and the item is left in
+// place to be computed again by the next read, or removed if the cache was
+// created with WithLazyRemoveOnError. If it was created with WithLazyErrorTTL,
+// the item is instead set to expire soon, so that reads keep retrying for a
+// short while before it is cleaned up.
+//
+// Items that haven't been computed yet count towards ItemCount, but are skipped
+// by Items and the other methods that iterate over or copy the cache's items,
+// and by Save, rather than being computed.
+func (c *cache) SetLazy(k string, compute func() (interface{}, error), d time.Duration) {
+	c.Set(k, &lazyValue{compute: compute}, d)
+}
+
+// Computes the value of lv, the lazy value stored for k, or waits for the
+// computation in progress, and stores it in place of lv.
+func (c *cache) resolveLazy(k string, lv *lazyValue) (interface{}, bool) {
+	lv.mu.Lock()
+	f := lv.f
+	if f != nil {
+		lv.mu.Unlock()
+		<-f.done
+	} else {
+		f = newFlight()
+		lv.f = f
+		lv.mu.Unlock()
+		func() {
+			defer func() {
+				if x := recover(); x != nil {
+					f.err = fmt.Errorf("Lazy value for %s panicked: %v", k, x)
+					c.finishLazy(k, lv, f)
+					panic(x)
+				}
+			}()
+			f.val, f.err = lv.compute()
+		}()
+		c.finishLazy(k, lv, f)
+	}
+	if f.err != nil {
+		return nil, false
+	}
+	return f.val, true
+}
+
+func (c *cache) finishLazy(k string, lv *lazyValue, f *flight) {
+	var evictedItems []keyAndValue
+	c.mu.Lock()
+	if item, found := c.items[k]; found && item.Object == interface{}(lv) {
+		if f.err == nil {
+			item.Object = c.compress(f.val)
+			c.account(k, &item)
+			c.items[k] = item
+		} else if c.removeLazyOnError {
+			if ov, evicted := c.delete(k); evicted {
+				evictedItems = append(evictedItems, keyAndValue{k, ov, EvictionReasonDeleted})
+			}
+		} else if c.lazyErrorTTL > 0 {
+			e := c.now().Add(c.lazyErrorTTL).UnixNano()
+			if item.Expiration <= 0 || e < item.Expiration {
+				item.Expiration = e
+				c.items[k] = item
+				c.noteExpiration(e)
+			}
+		}
+	}
+	c.mu.Unlock()
+	if f.err != nil {
+		// Let the next read retry.
+		lv.mu.Lock()
+		lv.f = nil
+		lv.mu.Unlock()
+	}
+	close(f.done)
+	c.notifyEvicted(evictedItems)
+}
+
+// SetLazy adds an item whose value is computed on first read to the shard
+// owning k. See the cache's SetLazy.
+func (sc *shardedCache) SetLazy(k string, compute func() (interface{}, error), d time.Duration) {
+	sc.bucket(k).SetLazy(k, compute, d)
+}
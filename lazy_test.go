@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSetLazy(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	calls := 0
+	tc.SetLazy("foo", func() (interface{}, error) {
+		calls++
+		return "bar", nil
+	}, 1*time.Hour)
+	if calls != 0 {
+		t.Error("compute was called by SetLazy")
+	}
+	for i := 0; i < 3; i++ {
+		x, found := tc.Get("foo")
+		if !found || x.(string) != "bar" {
+			t.Fatalf("Get returned %v, %v", x, found)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("compute was called %d times, not 1", calls)
+	}
+	tc.mu.RLock()
+	item := tc.items["foo"]
+	tc.mu.RUnlock()
+	if item.Object != "bar" {
+		t.Error("computed value did not replace the lazy value")
+	}
+	x, exp, found := tc.GetWithExpiration("foo")
+	if !found || x.(string) != "bar" || exp.IsZero() {
+		t.Errorf("GetWithExpiration returned %v, %v, %v", x, exp, found)
+	}
+}
+
+func TestSetLazyGetWithExpiration(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.SetLazy("foo", func() (interface{}, error) {
+		return "bar", nil
+	}, NoExpiration)
+	x, exp, found := tc.GetWithExpiration("foo")
+	if !found || x.(string) != "bar" || !exp.IsZero() {
+		t.Errorf("GetWithExpiration returned %v, %v, %v", x, exp, found)
+	}
+}
+
+func TestSetLazySingleFlight(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	var calls int32
+	release := make(chan struct{})
+	tc.SetLazy("foo", func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "bar", nil
+	}, DefaultExpiration)
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if x, found := tc.Get("foo"); !found || x.(string) != "bar" {
+				t.Errorf("Get returned %v, %v", x, found)
+			}
+		}()
+	}
+	<-time.After(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("compute was called %d times, not 1", n)
+	}
+}
+
+func TestSetLazyError(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	calls := 0
+	tc.SetLazy("foo", func() (interface{}, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("failed")
+		}
+		return "bar", nil
+	}, DefaultExpiration)
+	if _, found := tc.Get("foo"); found {
+		t.Error("Get found foo even though compute failed")
+	}
+	if tc.ItemCount() != 1 {
+		t.Error("foo was removed after compute failed")
+	}
+	if x, found := tc.Get("foo"); !found || x.(string) != "bar" {
+		t.Errorf("Get returned %v, %v after retrying", x, found)
+	}
+	if calls != 2 {
+		t.Errorf("compute was called %d times, not 2", calls)
+	}
+}
+
+func TestSetLazyRemoveOnError(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithLazyRemoveOnError())
+	tc.SetLazy("foo", func() (interface{}, error) {
+		return nil, errors.New("failed")
+	}, DefaultExpiration)
+	if _, found := tc.Get("foo"); found {
+		t.Error("Get found foo even though compute failed")
+	}
+	if tc.ItemCount() != 0 {
+		t.Error("foo was not removed after compute failed")
+	}
+}
+
+func TestSetLazyReplaced(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.SetLazy("foo", func() (interface{}, error) {
+		tc.Set("foo", "baz", DefaultExpiration)
+		return "bar", nil
+	}, DefaultExpiration)
+	if x, found := tc.Get("foo"); !found || x.(string) != "bar" {
+		t.Errorf("Get returned %v, %v", x, found)
+	}
+	if x, _ := tc.Get("foo"); x.(string) != "baz" {
+		t.Errorf("computed value overwrote the value set meanwhile: %v", x)
+	}
+}
+
+func TestSetLazySkippedByItems(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.SetLazy("b", func() (interface{}, error) {
+		return 2, nil
+	}, DefaultExpiration)
+	items := tc.Items()
+	if _, found := items["b"]; found || len(items) != 1 {
+		t.Errorf("Items included an uncomputed lazy value: %v", items)
+	}
+	tc.Get("b")
+	if len(tc.Items()) != 2 {
+		t.Error("Items did not include a computed lazy value")
+	}
+}
+
+func TestSetLazySkippedBySave(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.SetLazy("b", func() (interface{}, error) {
+		return 2, nil
+	}, DefaultExpiration)
+	fp := &bytes.Buffer{}
+	if err := tc.Save(fp); err != nil {
+		t.Fatal("Couldn't save cache to fp:", err)
+	}
+	oc := New(DefaultExpiration, 0)
+	if err := oc.Load(fp); err != nil {
+		t.Fatal("Couldn't load cache from fp:", err)
+	}
+	if _, found := oc.Get("a"); !found {
+		t.Error("a was not saved")
+	}
+	if _, found := oc.Get("b"); found {
+		t.Error("uncomputed lazy value b was saved")
+	}
+}
+
+func TestShardedSetLazy(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 4)
+	tc.SetLazy("foo", func() (interface{}, error) {
+		return "bar", nil
+	}, DefaultExpiration)
+	if x, found := tc.Get("foo"); !found || x.(string) != "bar" {
+		t.Errorf("Get returned %v, %v", x, found)
+	}
+	if tc.ItemCount() != 1 {
+		t.Errorf("ItemCount is %d, not 1", tc.ItemCount())
+	}
+}
+
+func TestSetLazyErrorTTL(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithLazyErrorTTL(10*time.Millisecond))
+	tc.SetLazy("foo", func() (interface{}, error) {
+		return nil, errors.New("failed")
+	}, 1*time.Hour)
+	if _, found := tc.Get("foo"); found {
+		t.Error("Get found foo even though compute failed")
+	}
+	tc.mu.RLock()
+	exp := time.Unix(0, tc.items["foo"].Expiration)
+	tc.mu.RUnlock()
+	if time.Until(exp) > 10*time.Millisecond {
+		t.Errorf("foo expires in %v after compute failed", time.Until(exp))
+	}
+	<-time.After(20 * time.Millisecond)
+	if n := tc.DeleteExpired(); n != 1 {
+		t.Errorf("DeleteExpired removed %d items, not 1", n)
+	}
+}
@@ -0,0 +1,230 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// An in-flight or completed call to a loader passed to GetOrCompute.
+type flight struct {
+	// Closed once val and err are set.
+	done chan struct{}
+	val  interface{}
+	err  error
+	// Set if the loader failed after the context of the call that ran it
+	// was done, so that the calls waiting for it load the value themselves.
+	canceled bool
+}
+
+func newFlight() *flight {
+	return &flight{done: make(chan struct{})}
+}
+
+// GetOrCompute gets an item from the cache, or, if it isn't found, calls
+// loader to compute it and stores the result for the duration d (see Set.) If
+// several goroutines call GetOrCompute for the same missing key at the same
+// time, loader is only called once and all of them receive its result. If
+// loader returns an error, nothing is stored and the error is returned to
+// every waiting caller.
+func (c *cache) GetOrCompute(k string, d time.Duration, loader func() (interface{}, error)) (interface{}, error) {
+	v, _, err := c.getOrCompute(k, d, loader)
+	return v, err
+}
+
+// GetOrComputeTTL is like GetOrCompute, but loader returns the duration to
+// store the computed value for (see Set) along with it, e.g. one derived from
+// an HTTP response's Cache-Control header.
+func (c *cache) GetOrComputeTTL(k string, loader func() (interface{}, time.Duration, error)) (interface{}, error) {
+	v, _, err := c.getOrComputeTTL(k, loader)
+	return v, err
+}
+
+// Like GetOrCompute, but also reports whether this call stored a new item.
+func (c *cache) getOrCompute(k string, d time.Duration, loader func() (interface{}, error)) (interface{}, bool, error) {
+	return c.getOrComputeTTL(k, func() (interface{}, time.Duration, error) {
+		v, err := loader()
+		return v, d, err
+	})
+}
+
+// Like GetOrComputeTTL, but also reports whether this call stored a new item.
+func (c *cache) getOrComputeTTL(k string, loader func() (interface{}, time.Duration, error)) (interface{}, bool, error) {
+	return c.getOrComputeCtx(context.Background(), k, func(context.Context) (interface{}, time.Duration, error) {
+		return loader()
+	})
+}
+
+// Like getOrComputeTTL, but passes ctx to loader, and stops waiting for a load
+// made by another goroutine, returning ctx.Err(), once ctx is done.
+func (c *cache) getOrComputeCtx(ctx context.Context, k string, loader func(context.Context) (interface{}, time.Duration, error)) (interface{}, bool, error) {
+	if v, found := c.Get(k); found {
+		return v, false, nil
+	}
+	c.flightMu.Lock()
+	for {
+		f, found := c.flights[k]
+		if !found {
+			break
+		}
+		c.flightMu.Unlock()
+		select {
+		case <-f.done:
+			if !f.canceled || ctx.Err() != nil {
+				return f.val, false, f.err
+			}
+			// Only the call that ran the loader gave up.
+			c.flightMu.Lock()
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+	// The item may have been stored by a flight that finished since the
+	// check above.
+	if v, found := c.lookup(k); found {
+		c.flightMu.Unlock()
+		return v, false, nil
+	}
+	f := newFlight()
+	if c.flights == nil {
+		c.flights = map[string]*flight{}
+	}
+	c.flights[k] = f
+	c.flightMu.Unlock()
+
+	var (
+		stored bool
+		d      time.Duration
+	)
+	func() {
+		defer func() {
+			if x := recover(); x != nil {
+				f.err = fmt.Errorf("Loader for %s panicked: %v", k, x)
+				c.finishFlight(k, f)
+				panic(x)
+			}
+		}()
+		f.val, d, f.err = loader(ctx)
+	}()
+	if f.err == nil {
+		var evictedItems []keyAndValue
+		c.mu.Lock()
+		// A strict tombstone keeps the value from being stored, but it is
+		// still returned.
+		if !c.tombstoned(k) {
+			evictedItems = c.set(k, f.val, d)
+			stored = true
+		}
+		c.mu.Unlock()
+		c.notifyEvicted(evictedItems)
+	} else {
+		f.canceled = ctx.Err() != nil
+	}
+	c.finishFlight(k, f)
+	return f.val, stored, f.err
+}
+
+func (c *cache) finishFlight(k string, f *flight) {
+	c.flightMu.Lock()
+	delete(c.flights, k)
+	c.flightMu.Unlock()
+	close(f.done)
+}
+
+// InFlight returns the keys that are being loaded by GetOrCompute (or the
+// other methods that use it, like LoadingCache's Get) at the time of the call,
+// in sorted order.
+func (c *cache) InFlight() []string {
+	c.flightMu.Lock()
+	keys := make([]string, 0, len(c.flights))
+	for k := range c.flights {
+		keys = append(keys, k)
+	}
+	c.flightMu.Unlock()
+	sort.Strings(keys)
+	return keys
+}
+
+// GetOrCompute gets an item from the shard owning k, or computes and stores it
+// using loader. Concurrent loads of the same key are deduplicated within the
+// owning shard, so loads of keys in different shards never contend with each
+// other. See the cache's GetOrCompute.
+func (sc *shardedCache) GetOrCompute(k string, d time.Duration, loader func() (interface{}, error)) (interface{}, error) {
+	return sc.bucket(k).GetOrCompute(k, d, loader)
+}
+
+// GetOrComputeTTL gets an item from the shard owning k, or computes and stores
+// it for the duration returned by loader. See the cache's GetOrComputeTTL.
+func (sc *shardedCache) GetOrComputeTTL(k string, loader func() (interface{}, time.Duration, error)) (interface{}, error) {
+	return sc.bucket(k).GetOrComputeTTL(k, loader)
+}
+
+// WarmAsync loads the items with the given keys in the background by calling
+// loader for each key that isn't already in the cache, running at most
+// concurrency loaders at a time, and stores the loaded values for the duration
+// d (see Set.) Loads go through GetOrCompute, so a key that is requested by
+// another goroutine while it is being warmed is only loaded once.
+//
+// Errors returned by loader are sent on the returned channel, which is closed
+// once all keys have been loaded. The channel is buffered to hold an error for
+// every key, so it doesn't need to be read.
+func (c *cache) WarmAsync(keys []string, loader func(k string) (interface{}, error), d time.Duration, concurrency int) <-chan error {
+	return warmAsync(c.goroutines, keys, concurrency, func(k string) error {
+		_, _, err := c.getOrCompute(k, d, func() (interface{}, error) {
+			return loader(k)
+		})
+		return err
+	})
+}
+
+// Calls load for each key using at most concurrency workers started with g,
+// sending its errors on the returned channel. The workers take the keys in
+// turn rather than being fed them, so that they don't depend on each other if
+// g queues some of them.
+func warmAsync(g *goroutines, keys []string, concurrency int, load func(k string) error) <-chan error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > len(keys) {
+		concurrency = len(keys)
+	}
+	errs := make(chan error, len(keys))
+	if len(keys) == 0 {
+		close(errs)
+		return errs
+	}
+	var (
+		next    int32 = -1
+		workers       = int32(concurrency)
+	)
+	for i := 0; i < concurrency; i++ {
+		g.work(func() {
+			for {
+				i := int(atomic.AddInt32(&next, 1))
+				if i >= len(keys) {
+					break
+				}
+				if err := load(keys[i]); err != nil {
+					errs <- fmt.Errorf("Couldn't warm %s: %w", keys[i], err)
+				}
+			}
+			if atomic.AddInt32(&workers, -1) == 0 {
+				close(errs)
+			}
+		})
+	}
+	return errs
+}
+
+// WarmAsync loads the items with the given keys into the shards owning them in
+// the background. See the cache's WarmAsync.
+func (sc *shardedCache) WarmAsync(keys []string, loader func(k string) (interface{}, error), d time.Duration, concurrency int) <-chan error {
+	return warmAsync(sc.cs[0].goroutines, keys, concurrency, func(k string) error {
+		_, err := sc.bucket(k).GetOrCompute(k, d, func() (interface{}, error) {
+			return loader(k)
+		})
+		return err
+	})
+}
@@ -0,0 +1,261 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrCompute(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	calls := 0
+	loader := func() (interface{}, error) {
+		calls++
+		return "bar", nil
+	}
+	x, err := tc.GetOrCompute("foo", DefaultExpiration, loader)
+	if err != nil || x.(string) != "bar" {
+		t.Fatalf("GetOrCompute returned %v, %v", x, err)
+	}
+	x, err = tc.GetOrCompute("foo", DefaultExpiration, loader)
+	if err != nil || x.(string) != "bar" {
+		t.Fatalf("GetOrCompute returned %v, %v", x, err)
+	}
+	if calls != 1 {
+		t.Errorf("loader was called %d times, not 1", calls)
+	}
+	if x, found := tc.Get("foo"); !found || x.(string) != "bar" {
+		t.Error("foo was not stored")
+	}
+}
+
+func TestGetOrComputeError(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	want := errors.New("failed")
+	_, err := tc.GetOrCompute("foo", DefaultExpiration, func() (interface{}, error) {
+		return nil, want
+	})
+	if err != want {
+		t.Errorf("GetOrCompute returned error %v, not %v", err, want)
+	}
+	if _, found := tc.Get("foo"); found {
+		t.Error("foo was stored even though the loader failed")
+	}
+}
+
+func TestGetOrComputeSingleFlight(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	var calls int32
+	release := make(chan struct{})
+	loader := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "bar", nil
+	}
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			x, err := tc.GetOrCompute("foo", DefaultExpiration, loader)
+			if err != nil || x.(string) != "bar" {
+				t.Errorf("GetOrCompute returned %v, %v", x, err)
+			}
+		}()
+	}
+	<-time.After(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("loader was called %d times, not 1", n)
+	}
+}
+
+func TestShardedGetOrCompute(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	for _, v := range shardedKeys {
+		k := v
+		x, err := tc.GetOrCompute(k, DefaultExpiration, func() (interface{}, error) {
+			return k, nil
+		})
+		if err != nil || x.(string) != k {
+			t.Errorf("GetOrCompute returned %v, %v", x, err)
+		}
+	}
+	if n := tc.ItemCount(); n != uint32(len(shardedKeys)) {
+		t.Errorf("ItemCount is not %d: %d", len(shardedKeys), n)
+	}
+	for _, v := range shardedKeys {
+		if _, found := tc.Get(v); !found {
+			t.Errorf("%q was not stored", v)
+		}
+	}
+}
+
+func BenchmarkShardedGetOrComputeConcurrent(b *testing.B) {
+	b.StopTimer()
+	tc := NewSharded(DefaultExpiration, 0, 32)
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "foo" + strconv.Itoa(i)
+	}
+	loader := func() (interface{}, error) {
+		return "bar", nil
+	}
+	b.StartTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			k := keys[i%len(keys)]
+			tc.GetOrCompute(k, DefaultExpiration, loader)
+			if i%4 == 0 {
+				tc.Delete(k)
+			}
+			i++
+		}
+	})
+}
+
+func TestGetOrComputeTTL(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	calls := 0
+	loader := func() (interface{}, time.Duration, error) {
+		calls++
+		return "bar", time.Hour, nil
+	}
+	for i := 0; i < 2; i++ {
+		if x, err := tc.GetOrComputeTTL("foo", loader); err != nil || x.(string) != "bar" {
+			t.Errorf("GetOrComputeTTL returned %v, %v", x, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("loader was called %d times, not 1", calls)
+	}
+	_, exp, _ := tc.GetWithExpiration("foo")
+	if d := time.Until(exp); d <= 59*time.Minute || d > time.Hour {
+		t.Errorf("foo expires in %v, not an hour", d)
+	}
+
+	fail := errors.New("failed")
+	_, err := tc.GetOrComputeTTL("baz", func() (interface{}, time.Duration, error) {
+		return nil, time.Hour, fail
+	})
+	if err != fail {
+		t.Errorf("GetOrComputeTTL returned %v, not the loader's error", err)
+	}
+	if _, found := tc.Get("baz"); found {
+		t.Error("a failed load was stored")
+	}
+}
+
+func TestShardedGetOrComputeTTL(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	x, err := tc.GetOrComputeTTL("foo", func() (interface{}, time.Duration, error) {
+		return "bar", time.Millisecond, nil
+	})
+	if err != nil || x.(string) != "bar" {
+		t.Errorf("GetOrComputeTTL returned %v, %v", x, err)
+	}
+	if n := tc.ItemCount(); n != 1 {
+		t.Errorf("ItemCount is %d, not 1", n)
+	}
+	<-time.After(5 * time.Millisecond)
+	if _, found := tc.Get("foo"); found {
+		t.Error("foo didn't expire after the loader's TTL")
+	}
+}
+
+func TestWarmAsync(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("k0", "cached", DefaultExpiration)
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = "k" + strconv.Itoa(i)
+	}
+	var running, maxRunning, calls int32
+	loader := func(k string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		<-time.After(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		if k == "k13" {
+			return nil, errors.New("failed")
+		}
+		return k, nil
+	}
+	var errs []error
+	for err := range tc.WarmAsync(keys, loader, DefaultExpiration, 4) {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "k13") {
+		t.Errorf("WarmAsync sent errors %v", errs)
+	}
+	if n := atomic.LoadInt32(&maxRunning); n > 4 {
+		t.Errorf("%d loaders ran at once, more than 4", n)
+	}
+	if n := atomic.LoadInt32(&calls); n != 99 {
+		t.Errorf("loader was called %d times, not 99", n)
+	}
+	if x, _ := tc.Get("k0"); x.(string) != "cached" {
+		t.Error("an existing item was reloaded")
+	}
+	if x, found := tc.Get("k99"); !found || x.(string) != "k99" {
+		t.Error("k99 was not warmed")
+	}
+	if tc.ItemCount() != 99 {
+		t.Errorf("ItemCount is %d, not 99", tc.ItemCount())
+	}
+}
+
+func TestWarmAsyncSingleFlight(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	var calls int32
+	release := make(chan struct{})
+	loader := func(k string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "bar", nil
+	}
+	done := tc.WarmAsync([]string{"foo"}, loader, DefaultExpiration, 1)
+	<-time.After(10 * time.Millisecond)
+	got := make(chan interface{})
+	go func() {
+		x, _ := tc.GetOrCompute("foo", DefaultExpiration, func() (interface{}, error) {
+			return loader("foo")
+		})
+		got <- x
+	}()
+	<-time.After(10 * time.Millisecond)
+	close(release)
+	for range done {
+	}
+	if x := <-got; x.(string) != "bar" {
+		t.Errorf("GetOrCompute returned %v", x)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("loader was called %d times, not 1", n)
+	}
+}
+
+func TestShardedWarmAsync(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 4)
+	keys := []string{"a", "b", "c", "d", "e"}
+	for err := range tc.WarmAsync(keys, func(k string) (interface{}, error) {
+		return k, nil
+	}, DefaultExpiration, 2) {
+		t.Error(err)
+	}
+	if n := tc.ItemCount(); n != 5 {
+		t.Errorf("ItemCount is %d, not 5", n)
+	}
+}
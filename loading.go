@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by a LoadingCache's Get once the cache has been closed.
+var ErrClosed = errors.New("Cache is closed")
+
+// LoadingCache is a Cache that populates itself: reading a key that is missing
+// or has expired calls the cache's loader to load it, and stores and returns
+// the result, so that callers never see a miss for a key that can be loaded.
+type LoadingCache struct {
+	*Cache
+	loader func(ctx context.Context, k string) (interface{}, error)
+	// Canceled by Close.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	errorTTL time.Duration
+	errMu    sync.Mutex
+	errs     map[string]loadError
+}
+
+// A loader error cached for a key until expiration. See WithLoaderErrorTTL.
+type loadError struct {
+	err        error
+	expiration int64
+}
+
+// NewLoadingCache returns a new LoadingCache, like New, that loads missing and
+// expired items using loader.
+func NewLoadingCache(defaultExpiration, cleanupInterval time.Duration, loader func(k string) (interface{}, error), opts ...Option) *LoadingCache {
+	return NewLoadingCacheContext(defaultExpiration, cleanupInterval, func(_ context.Context, k string) (interface{}, error) {
+		return loader(k)
+	}, opts...)
+}
+
+// NewLoadingCacheContext is like NewLoadingCache, but loader is passed a
+// context that is canceled when the cache is closed, so that loads in progress
+// can be abandoned on shutdown. See Close.
+func NewLoadingCacheContext(defaultExpiration, cleanupInterval time.Duration, loader func(ctx context.Context, k string) (interface{}, error), opts ...Option) *LoadingCache {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &LoadingCache{
+		Cache:    New(defaultExpiration, cleanupInterval, opts...),
+		loader:   loader,
+		ctx:      ctx,
+		cancel:   cancel,
+		errorTTL: newOptions(opts).loaderErrorTTL,
+	}
+}
+
+// WithLoaderErrorTTL makes a LoadingCache remember an error returned by its
+// loader for d, returning it for reads of the same key instead of calling the
+// loader again, so that a failing backend isn't hit on every read.
+func WithLoaderErrorTTL(d time.Duration) Option {
+	return func(o *options) {
+		o.loaderErrorTTL = d
+	}
+}
+
+// Get gets an item from the cache, or, if it is missing or has expired, loads
+// it synchronously, stores it with the cache's default expiration, and returns
+// it. Concurrent reads of a key that is being loaded wait for that load
+// instead of calling the loader again (see GetOrCompute.) Returns the loader's
+// error if it fails, or the error remembered from an earlier failure (see
+// WithLoaderErrorTTL.) Returns ErrClosed if the item has to be loaded but the
+// cache has been closed, including while waiting for a load.
+func (lc *LoadingCache) Get(k string) (interface{}, error) {
+	return lc.GetCtx(context.Background(), k)
+}
+
+// GetCtx is like Get, but returns ctx.Err() if ctx is done before the item is
+// loaded. If this call loads the item, the context passed to the loader is
+// canceled when either ctx is done or the cache is closed, and carries ctx's
+// values.
+func (lc *LoadingCache) GetCtx(ctx context.Context, k string) (interface{}, error) {
+	if x, found := lc.Cache.Get(k); found {
+		return x, nil
+	}
+	if err := lc.cachedError(k); err != nil {
+		return nil, err
+	}
+	if lc.ctx.Err() != nil {
+		return nil, ErrClosed
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(lc.ctx, cancel)
+	defer stop()
+	x, _, err := lc.cache.getOrComputeCtx(ctx, k, func(ctx context.Context) (interface{}, time.Duration, error) {
+		x, err := lc.loader(ctx, k)
+		if err != nil && ctx.Err() != nil {
+			// Don't remember errors caused by the cache being closed or
+			// the caller giving up.
+			return nil, 0, ctx.Err()
+		}
+		lc.setError(k, err)
+		return x, DefaultExpiration, err
+	})
+	if err != nil && lc.ctx.Err() != nil {
+		return nil, ErrClosed
+	}
+	return x, err
+}
+
+// Close cancels the context passed to loaders in progress (see
+// NewLoadingCacheContext), makes reads waiting for them, and any later reads
+// that would have to load an item, return ErrClosed, and stops the cache's
+// background goroutines (see the cache's Close.) Close doesn't wait for loaders
+// to return; a read that called a loader returns ErrClosed once it does. Items
+// already in the cache can still be read.
+func (lc *LoadingCache) Close() {
+	lc.cancel()
+	lc.Cache.Close()
+}
+
+func (lc *LoadingCache) cachedError(k string) error {
+	lc.errMu.Lock()
+	defer lc.errMu.Unlock()
+	le, found := lc.errs[k]
+	if !found {
+		return nil
+	}
+	if lc.now().UnixNano() > le.expiration {
+		delete(lc.errs, k)
+		return nil
+	}
+	return le.err
+}
+
+// Remembers err for k, or forgets any remembered error if err is nil.
+func (lc *LoadingCache) setError(k string, err error) {
+	if lc.errorTTL <= 0 {
+		return
+	}
+	lc.errMu.Lock()
+	if err == nil {
+		delete(lc.errs, k)
+	} else {
+		if lc.errs == nil {
+			lc.errs = map[string]loadError{}
+		}
+		lc.errs[k] = loadError{err, lc.now().Add(lc.errorTTL).UnixNano()}
+	}
+	lc.errMu.Unlock()
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadingCache(t *testing.T) {
+	var calls int32
+	tc := NewLoadingCache(10*time.Millisecond, 0, func(k string) (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	})
+	x, err := tc.Get("foo")
+	if err != nil || x.(int32) != 1 {
+		t.Fatalf("Get returned %v, %v", x, err)
+	}
+	if x, _ := tc.Get("foo"); x.(int32) != 1 {
+		t.Error("Get reloaded an unexpired item")
+	}
+	<-time.After(20 * time.Millisecond)
+	// The expired item is reloaded instead of reported as a miss.
+	x, err = tc.Get("foo")
+	if err != nil || x.(int32) != 2 {
+		t.Errorf("Get of an expired item returned %v, %v", x, err)
+	}
+}
+
+func TestLoadingCacheSingleFlight(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	tc := NewLoadingCache(DefaultExpiration, 0, func(k string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "bar", nil
+	})
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if x, err := tc.Get("foo"); err != nil || x.(string) != "bar" {
+				t.Errorf("Get returned %v, %v", x, err)
+			}
+		}()
+	}
+	<-time.After(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("loader was called %d times, not 1", n)
+	}
+}
+
+func TestLoadingCacheErrorTTL(t *testing.T) {
+	var calls int32
+	fail := errors.New("failed")
+	tc := NewLoadingCache(DefaultExpiration, 0, func(k string) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, fail
+		}
+		return "bar", nil
+	}, WithLoaderErrorTTL(10*time.Millisecond))
+	for i := 0; i < 3; i++ {
+		if _, err := tc.Get("foo"); err != fail {
+			t.Errorf("Get returned error %v, not %v", err, fail)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("loader was called %d times while its error was cached, not 1", n)
+	}
+	<-time.After(20 * time.Millisecond)
+	if x, err := tc.Get("foo"); err != nil || x.(string) != "bar" {
+		t.Errorf("Get returned %v, %v after the error expired", x, err)
+	}
+}
+
+func TestLoadingCacheInFlight(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	tc := NewLoadingCache(DefaultExpiration, 0, func(k string) (interface{}, error) {
+		started <- struct{}{}
+		<-release
+		return k, nil
+	})
+	var wg sync.WaitGroup
+	for _, k := range []string{"b", "a"} {
+		wg.Add(1)
+		go func(k string) {
+			defer wg.Done()
+			tc.Get(k)
+		}(k)
+	}
+	<-started
+	<-started
+	if keys := tc.InFlight(); !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Errorf("InFlight returned %v, not [a b]", keys)
+	}
+	close(release)
+	wg.Wait()
+	if keys := tc.InFlight(); len(keys) != 0 {
+		t.Errorf("InFlight returned %v after the loads finished", keys)
+	}
+}
+
+func TestLoadingCacheClose(t *testing.T) {
+	started := make(chan struct{})
+	tc := NewLoadingCacheContext(DefaultExpiration, 0, func(ctx context.Context, k string) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	errs := make(chan error, 2)
+	go func() {
+		_, err := tc.Get("foo")
+		errs <- err
+	}()
+	<-started
+	go func() {
+		_, err := tc.Get("foo")
+		errs <- err
+	}()
+	<-time.After(10 * time.Millisecond)
+	tc.Close()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			if err != ErrClosed {
+				t.Errorf("Get returned %v, not ErrClosed", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Get didn't return after Close")
+		}
+	}
+	if _, err := tc.Get("bar"); err != ErrClosed {
+		t.Errorf("Get after Close returned %v, not ErrClosed", err)
+	}
+}
+
+func TestLoadingCacheCloseDoesntWaitForLoader(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	tc := NewLoadingCache(DefaultExpiration, 0, func(k string) (interface{}, error) {
+		close(started)
+		<-release
+		return "bar", nil
+	})
+	go tc.Get("foo")
+	<-started
+	waiter := make(chan error)
+	go func() {
+		_, err := tc.Get("foo")
+		waiter <- err
+	}()
+	<-time.After(10 * time.Millisecond)
+	tc.Close()
+	select {
+	case err := <-waiter:
+		if err != ErrClosed {
+			t.Errorf("the waiting Get returned %v, not ErrClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a Get waiting for a loader that ignores its context didn't return after Close")
+	}
+}
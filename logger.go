@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Logger is used by the cache to report problems that can't be returned as
+// errors, e.g. a panic in a user-supplied callback. *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+var (
+	defaultLoggerMu sync.RWMutex
+	defaultLogger   Logger = log.New(os.Stderr, "", 0)
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Printf(format string, v ...interface{}) {}
+
+// SetDefaultLogger sets the Logger used by caches that haven't been given one
+// of their own, including for warnings emitted while a cache is being created.
+// The default writes to os.Stderr. Set to nil to discard all output.
+func SetDefaultLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	defaultLoggerMu.Lock()
+	defaultLogger = l
+	defaultLoggerMu.Unlock()
+}
+
+// Returns l, or the package's default Logger if l is nil.
+func loggerOrDefault(l Logger) Logger {
+	if l != nil {
+		return l
+	}
+	defaultLoggerMu.RLock()
+	l = defaultLogger
+	defaultLoggerMu.RUnlock()
+	return l
+}
+
+// Sets the Logger used to report recovered panics in user-supplied callbacks.
+// Set to nil to use the default set with SetDefaultLogger.
+func (c *cache) SetLogger(l Logger) {
+	c.mu.Lock()
+	c.logger = l
+	c.mu.Unlock()
+}
+
+func (c *cache) logf(format string, v ...interface{}) {
+	c.mu.RLock()
+	l := c.logger
+	c.mu.RUnlock()
+	loggerOrDefault(l).Printf("%s"+format, append([]interface{}{c.logPrefix()}, v...)...)
+}
+
+// Returns the prefix of the cache's log lines: "go-cache: ", or, if it was
+// given a name with WithName, "go-cache[name]: ".
+func (c *cache) logPrefix() string {
+	if c.name == "" {
+		return "go-cache: "
+	}
+	return "go-cache[" + c.name + "]: "
+}
+
+// Calls the OnEvicted function f, recovering from (and logging) any panic so
+// that a buggy callback can't take down the janitor or the calling goroutine.
+// If s isn't nil, the call may be timed. Must not be called with c.mu held.
+func (c *cache) callOnEvicted(f func(string, interface{}, EvictionReason), s *stats, k string, v interface{}, reason EvictionReason) {
+	defer func() {
+		if x := recover(); x != nil {
+			c.logf("recovered from panic in OnEvicted callback for key %q: %v", k, x)
+		}
+	}()
+	v = c.removedValue(v)
+	if s != nil && s.sampleCallback() {
+		start := time.Now()
+		f(k, v, reason)
+		s.observeCallback(time.Since(start))
+		return
+	}
+	f(k, v, reason)
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+	l.mu.Unlock()
+}
+
+func TestOnEvictedPanicDuringDeleteExpired(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	l := &testLogger{}
+	tc.SetLogger(l)
+	calls := 0
+	tc.OnEvicted(func(k string, v interface{}) {
+		calls++
+		panic("boom")
+	})
+	tc.Set("foo", 1, 1*time.Millisecond)
+	tc.Set("bar", 2, 1*time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	if n := tc.DeleteExpired(); n != 2 {
+		t.Errorf("DeleteExpired removed %d items, not 2", n)
+	}
+	if calls != 2 {
+		t.Errorf("OnEvicted was called %d times, not 2", calls)
+	}
+	if len(l.lines) != 2 {
+		t.Fatalf("expected 2 logged panics, got %d", len(l.lines))
+	}
+	if !strings.Contains(l.lines[0], "boom") {
+		t.Error("logged line does not contain the panic value:", l.lines[0])
+	}
+
+	// The cache must still be usable, i.e. the mutex isn't left locked.
+	tc.Set("baz", 3, DefaultExpiration)
+	if x, found := tc.Get("baz"); !found || x.(int) != 3 {
+		t.Error("baz was not found after a panicking callback")
+	}
+	tc.Delete("baz")
+	if len(l.lines) != 3 {
+		t.Errorf("expected 3 logged panics, got %d", len(l.lines))
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("no entropy")
+}
+
+func TestSetDefaultLogger(t *testing.T) {
+	l := &testLogger{}
+	SetDefaultLogger(l)
+	defer SetDefaultLogger(log.New(os.Stderr, "", 0))
+
+	r := seedReader
+	seedReader = errReader{}
+	NewSharded(DefaultExpiration, 0, 1)
+	seedReader = r
+	if len(l.lines) != 1 || !strings.Contains(l.lines[0], "CSPRNG") {
+		t.Errorf("CSPRNG warning was not written to the default logger: %v", l.lines)
+	}
+
+	tc := New(DefaultExpiration, 0)
+	tc.OnEvicted(func(k string, v interface{}) {
+		panic("boom")
+	})
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Delete("foo")
+	if len(l.lines) != 2 {
+		t.Errorf("recovered panic was not written to the default logger: %v", l.lines)
+	}
+}
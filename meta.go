@@ -0,0 +1,115 @@
+package cache
+
+import "time"
+
+// SetWithMeta adds an item to the cache like Set, and attaches a copy of meta
+// to it, e.g. the service a value came from or a trace ID from when it was
+// loaded. The metadata is returned by GetMeta, and in the Meta field of the
+// items passed to DeleteFunc and returned by Items, and is saved and loaded
+// along with the item.
+//
+// Metadata belongs to the item it was set with: Set, Add, Replace and the
+// other methods that store a new item replace the metadata too, leaving the new
+// item without any. Use SetWithMeta again to keep it.
+func (c *cache) SetWithMeta(k string, x interface{}, d time.Duration, meta map[string]string) {
+	c.mu.Lock()
+	if c.tombstoned(k) {
+		c.mu.Unlock()
+		return
+	}
+	evictedItems := c.set(k, x, d)
+	item := c.items[k]
+	item.Meta = copyMeta(meta)
+	c.items[k] = item
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+}
+
+// GetMeta returns a copy of the metadata attached to an item using
+// SetWithMeta, and a bool indicating whether the key was found. The map is nil
+// if the item has no metadata.
+func (c *cache) GetMeta(k string) (map[string]string, bool) {
+	c.mu.RLock()
+	item, found := c.items[k]
+	if !found || c.expired(item) {
+		c.mu.RUnlock()
+		return nil, false
+	}
+	meta := copyMeta(item.Meta)
+	c.mu.RUnlock()
+	return meta, true
+}
+
+// DeleteFunc deletes every unexpired item for which f returns true, and returns
+// the number of items deleted. f is passed a copy of each item, including its
+// metadata (see SetWithMeta), so it can select items by their metadata as well
+// as their values. Items set using SetLazy whose values haven't been computed
+// are skipped.
+//
+// f is called while the cache's write lock is held, so it must not use the
+// cache.
+func (c *cache) DeleteFunc(f func(k string, v Item) bool) int {
+	var evictedItems []keyAndValue
+	now := c.now().UnixNano()
+	c.mu.Lock()
+	n := 0
+	for k, v := range c.items {
+		if v.Expiration > 0 && now > v.Expiration {
+			continue
+		}
+		if isLazy(v.Object) {
+			continue
+		}
+		x, err := c.decompress(v.Object)
+		if err != nil {
+			continue
+		}
+		v.Object = x
+		v.Meta = copyMeta(v.Meta)
+		if !f(k, v) {
+			continue
+		}
+		n++
+		ov, evicted := c.delete(k)
+		if evicted {
+			evictedItems = append(evictedItems, keyAndValue{k, ov, EvictionReasonDeleted})
+		}
+	}
+	c.refreshBloom()
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+	return n
+}
+
+func copyMeta(meta map[string]string) map[string]string {
+	if meta == nil {
+		return nil
+	}
+	m := make(map[string]string, len(meta))
+	for k, v := range meta {
+		m[k] = v
+	}
+	return m
+}
+
+// SetWithMeta adds an item with metadata to the shard owning k. See the
+// cache's SetWithMeta.
+func (sc *shardedCache) SetWithMeta(k string, x interface{}, d time.Duration, meta map[string]string) {
+	sc.bucket(k).SetWithMeta(k, x, d, meta)
+}
+
+// GetMeta returns a copy of the metadata attached to an item. See the cache's
+// GetMeta.
+func (sc *shardedCache) GetMeta(k string) (map[string]string, bool) {
+	return sc.bucket(k).GetMeta(k)
+}
+
+// DeleteFunc deletes every unexpired item in every shard for which f returns
+// true. See the cache's DeleteFunc.
+func (sc *shardedCache) DeleteFunc(f func(k string, v Item) bool) int {
+	n := 0
+	for _, c := range sc.cs {
+		n += c.DeleteFunc(f)
+	}
+	return n
+}
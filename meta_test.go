@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+func TestSetWithMeta(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	meta := map[string]string{"origin": "users"}
+	tc.SetWithMeta("foo", 1, DefaultExpiration, meta)
+	meta["origin"] = "changed"
+
+	m, found := tc.GetMeta("foo")
+	if !found || m["origin"] != "users" {
+		t.Fatalf("GetMeta returned %v, %v", m, found)
+	}
+	m["origin"] = "changed"
+	if m, _ := tc.GetMeta("foo"); m["origin"] != "users" {
+		t.Error("changing the map returned by GetMeta changed the item's metadata")
+	}
+	items := tc.Items()
+	items["foo"].Meta["origin"] = "changed"
+	if m, _ := tc.GetMeta("foo"); m["origin"] != "users" {
+		t.Error("changing the map returned by Items changed the item's metadata")
+	}
+	if x, _ := tc.Get("foo"); x.(int) != 1 {
+		t.Errorf("foo is %v, not 1", x)
+	}
+
+	if _, found := tc.GetMeta("missing"); found {
+		t.Error("GetMeta found a missing item")
+	}
+	tc.Set("bar", 1, DefaultExpiration)
+	if m, found := tc.GetMeta("bar"); !found || m != nil {
+		t.Errorf("GetMeta returned %v, %v for an item without metadata", m, found)
+	}
+}
+
+func TestMetaReplacedWithItem(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.SetWithMeta("foo", 1, DefaultExpiration, map[string]string{"a": "b"})
+	tc.Replace("foo", 2, DefaultExpiration)
+	if m, found := tc.GetMeta("foo"); !found || m != nil {
+		t.Errorf("Replace kept the metadata: %v", m)
+	}
+}
+
+func TestMetaIsSaved(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.SetWithMeta("foo", 1, DefaultExpiration, map[string]string{"trace": "abc"})
+	var buf bytes.Buffer
+	if err := tc.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	oc := New(DefaultExpiration, 0)
+	if err := oc.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := oc.GetMeta("foo"); m["trace"] != "abc" {
+		t.Errorf("the loaded item's metadata is %v", m)
+	}
+}
+
+func TestDeleteFunc(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	var evicted []string
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = append(evicted, k)
+	})
+	tc.SetWithMeta("a", 1, DefaultExpiration, map[string]string{"origin": "users"})
+	tc.SetWithMeta("b", 2, DefaultExpiration, map[string]string{"origin": "orders"})
+	tc.Set("c", 3, DefaultExpiration)
+	n := tc.DeleteFunc(func(k string, v Item) bool {
+		return v.Meta["origin"] == "users" || v.Object.(int) == 3
+	})
+	if n != 2 {
+		t.Errorf("DeleteFunc deleted %d items, not 2", n)
+	}
+	if _, found := tc.Get("b"); !found {
+		t.Error("b was deleted")
+	}
+	if len(evicted) != 2 {
+		t.Errorf("OnEvicted was called for %v", evicted)
+	}
+}
+
+func TestShardedDeleteFunc(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	for i := 0; i < 100; i++ {
+		tc.SetWithMeta(strconv.Itoa(i), i, DefaultExpiration, map[string]string{"even": strconv.FormatBool(i%2 == 0)})
+	}
+	if n := tc.DeleteFunc(func(k string, v Item) bool { return v.Meta["even"] == "true" }); n != 50 {
+		t.Errorf("DeleteFunc deleted %d items, not 50", n)
+	}
+	if n := tc.ItemCount(); n != 50 {
+		t.Errorf("ItemCount is %d, not 50", n)
+	}
+	if m, found := tc.GetMeta("1"); !found || m["even"] != "false" {
+		t.Errorf("GetMeta returned %v, %v", m, found)
+	}
+}
@@ -0,0 +1,23 @@
+package cache
+
+// WithName gives the cache a name, e.g. the kind of data it holds, to tell it
+// apart from the others in the same process. The name is included in the
+// cache's log lines, as in "go-cache[sessions]: ...", and in its Stats. For a
+// sharded cache, it names the cache as a whole, not its shards.
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// Name returns the name the cache was given with WithName, or "" if it has
+// none.
+func (c *cache) Name() string {
+	return c.name
+}
+
+// Name returns the name the cache was given with WithName, or "" if it has
+// none.
+func (sc *shardedCache) Name() string {
+	return sc.name
+}
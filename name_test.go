@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithName(t *testing.T) {
+	l := &testLogger{}
+	tc := NewWithOptions(WithName("sessions%d"), WithLogger(l))
+	if n := tc.Name(); n != "sessions%d" {
+		t.Errorf("got name %q, want sessions%%d", n)
+	}
+	if n := tc.Stats().Name; n != "sessions%d" {
+		t.Errorf("got Stats name %q, want sessions%%d", n)
+	}
+	tc.OnEvicted(func(k string, v interface{}) {
+		panic("boom")
+	})
+	tc.Set("foo", "bar", DefaultExpiration)
+	tc.Delete("foo")
+	if len(l.lines) != 1 {
+		t.Fatalf("got %d log lines, want 1", len(l.lines))
+	}
+	if want := "go-cache[sessions%d]: recovered from panic"; !strings.HasPrefix(l.lines[0], want) {
+		t.Errorf("got log line %q, want it to start with %q", l.lines[0], want)
+	}
+}
+
+func TestUnnamedLogPrefix(t *testing.T) {
+	l := &testLogger{}
+	tc := NewWithOptions(WithLogger(l))
+	if n := tc.Name(); n != "" {
+		t.Errorf("got name %q, want none", n)
+	}
+	tc.logf("foo %d", 1)
+	if len(l.lines) != 1 || l.lines[0] != "go-cache: foo 1" {
+		t.Errorf("got log lines %q, want [go-cache: foo 1]", l.lines)
+	}
+}
+
+func TestShardedWithName(t *testing.T) {
+	tc := NewShardedWithOptions(WithShards(3), WithName("users"))
+	if n := tc.Name(); n != "users" {
+		t.Errorf("got name %q, want users", n)
+	}
+	tc.EnableStats()
+	if n := tc.Stats().Name; n != "users" {
+		t.Errorf("got Stats name %q, want users", n)
+	}
+}
@@ -0,0 +1,35 @@
+package cache
+
+import "time"
+
+// ComputeOnce is like GetOrCompute, but the item it stores is marked as
+// computed once (see Item.Once): it isn't evicted to make room for other
+// items, and the mark is saved with it, so a cache that loads a snapshot
+// containing the item won't call loader again until the item expires or is
+// deleted. Setting the key again with Set and friends clears the mark.
+//
+// The cache doesn't save itself, so for the value to survive a restart, call
+// SaveFile (or Save) after ComputeOnce has stored it; a value computed after
+// the last save is computed again after a restart. LoadFile keeps the items
+// already in the cache, so call it before the first ComputeOnce: if
+// ComputeOnce runs first, its freshly computed value wins over the one in the
+// snapshot. Items in the snapshot that have expired are not loaded, so their
+// loaders run again.
+func (c *cache) ComputeOnce(k string, d time.Duration, loader func() (interface{}, error)) (interface{}, error) {
+	v, stored, err := c.getOrCompute(k, d, loader)
+	if stored {
+		c.mu.Lock()
+		if item, found := c.items[k]; found {
+			item.Once = true
+			c.items[k] = item
+		}
+		c.mu.Unlock()
+	}
+	return v, err
+}
+
+// ComputeOnce gets an item from the shard owning k, or computes and stores it
+// using loader, marking it as computed once. See the cache's ComputeOnce.
+func (sc *shardedCache) ComputeOnce(k string, d time.Duration, loader func() (interface{}, error)) (interface{}, error) {
+	return sc.bucket(k).ComputeOnce(k, d, loader)
+}
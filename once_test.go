@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestComputeOnce(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	calls := 0
+	loader := func() (interface{}, error) {
+		calls++
+		return "bar", nil
+	}
+	for i := 0; i < 3; i++ {
+		v, err := tc.ComputeOnce("foo", NoExpiration, loader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != "bar" {
+			t.Fatalf("got %v, want bar", v)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("loader called %d times, want 1", calls)
+	}
+	if !tc.items["foo"].Once {
+		t.Error("item stored by ComputeOnce isn't marked Once")
+	}
+
+	tc.Set("foo", "baz", NoExpiration)
+	if tc.items["foo"].Once {
+		t.Error("Set didn't clear the Once mark")
+	}
+}
+
+func TestComputeOnceError(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	want := errors.New("boom")
+	_, err := tc.ComputeOnce("foo", NoExpiration, func() (interface{}, error) {
+		return nil, want
+	})
+	if err != want {
+		t.Fatalf("got error %v, want %v", err, want)
+	}
+	if _, found := tc.Get("foo"); found {
+		t.Error("failed load stored an item")
+	}
+}
+
+func TestComputeOnceAcrossRestart(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.snapshot")
+	tc := New(DefaultExpiration, 0)
+	if _, err := tc.ComputeOnce("foo", time.Hour, func() (interface{}, error) {
+		return "bar", nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.SaveFile(fname); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := New(DefaultExpiration, 0)
+	if err := restarted.LoadFile(fname); err != nil {
+		t.Fatal(err)
+	}
+	v, err := restarted.ComputeOnce("foo", time.Hour, func() (interface{}, error) {
+		t.Error("loader called after loading the snapshot")
+		return "baz", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "bar" {
+		t.Errorf("got %v, want bar", v)
+	}
+	if !restarted.items["foo"].Once {
+		t.Error("Once mark wasn't restored by LoadFile")
+	}
+}
+
+func TestComputeOnceAfterExpiry(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	calls := 0
+	loader := func() (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+	tc.ComputeOnce("foo", time.Millisecond, loader)
+	time.Sleep(5 * time.Millisecond)
+	v, err := tc.ComputeOnce("foo", time.Millisecond, loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 2 || calls != 2 {
+		t.Errorf("got %v after %d calls, want 2 after 2", v, calls)
+	}
+}
+
+func TestComputeOnceNotEvicted(t *testing.T) {
+	tc := NewWithCapacity(DefaultExpiration, 0, 2, EvictionPolicyLRU)
+	tc.ComputeOnce("a", NoExpiration, func() (interface{}, error) {
+		return 1, nil
+	})
+	tc.Set("b", 2, NoExpiration)
+	tc.Set("c", 3, NoExpiration)
+	if _, found := tc.Get("a"); !found {
+		t.Error("item stored by ComputeOnce was evicted")
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("b wasn't evicted")
+	}
+}
+
+func TestShardedComputeOnce(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 4)
+	calls := 0
+	for i := 0; i < 3; i++ {
+		tc.ComputeOnce("foo", NoExpiration, func() (interface{}, error) {
+			calls++
+			return "bar", nil
+		})
+	}
+	if calls != 1 {
+		t.Errorf("loader called %d times, want 1", calls)
+	}
+	if !tc.bucket("foo").items["foo"].Once {
+		t.Error("item stored by ComputeOnce isn't marked Once")
+	}
+	if n := tc.ItemCount(); n != 1 {
+		t.Errorf("got item count %d, want 1", n)
+	}
+}
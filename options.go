@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"time"
+)
+
+// Option configures optional behavior of a cache when it is created.
+type Option func(*options)
+
+type options struct {
+	protectedRatio     float64
+	removeLazyOnError  bool
+	lazyErrorTTL       time.Duration
+	compressThreshold  int
+	codec              Codec
+	tieBreaker         func(a, b EvictionCandidate) bool
+	syncDir            bool
+	eagerCleanup       bool
+	reloadPath         string
+	reloadInterval     time.Duration
+	reloadMode         ReloadMode
+	reloadCallback     func(ReloadResult)
+	loaderErrorTTL     time.Duration
+	clock              Clock
+	cloner             func(interface{}) interface{}
+	immutable          bool
+	copyBytes          bool
+	sizer              func(string, interface{}) int64
+	reportSize         func(int64)
+	maxTagsPerItem     int
+	maxTags            int
+	diskDir            string
+	diskCodec          Codec
+	sortByExpiration   bool
+	sweepChunk         int
+	name               string
+	keepTTLFallback    bool
+	maxGoroutines      int
+	tombstoneRetention time.Duration
+	strictTombstones   bool
+	chainSkipErrors    bool
+	reaper             *Reaper
+	goroutines         *goroutines
+	coalesceInterval   time.Duration
+	scanTimeout        time.Duration
+	decodeFallback     DecodeFallback
+	hitRateWindow      time.Duration
+	valueCodec         ValueCodec
+	watermarkSoft      int
+	watermarkHard      int
+	watermarkTarget    int
+	defaultExpiration  time.Duration
+	cleanupInterval    time.Duration
+	maxItems           int
+	evictionPolicy     EvictionPolicy
+	shards             int
+	shardsSet          bool
+	powerOfTwoShards   bool
+	seed               uint32
+	seedSet            bool
+	onEvicted          func(string, interface{}, EvictionReason)
+	logger             Logger
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		protectedRatio: 0.8,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Applies the options that are stored directly on the cache.
+func (o *options) apply(c *cache) {
+	if o.logger != nil {
+		c.logger = o.logger
+	}
+	c.name = o.name
+	c.onEvicted = o.onEvicted
+	c.removeLazyOnError = o.removeLazyOnError
+	c.lazyErrorTTL = o.lazyErrorTTL
+	c.compressThreshold = o.compressThreshold
+	c.codec = o.codec
+	c.syncDir = o.syncDir
+	c.eagerCleanup = o.eagerCleanup
+	c.clock = o.clock
+	c.cloner = o.cloner
+	c.immutable = o.immutable
+	c.copyBytes = o.copyBytes
+	c.sizer, c.reportSize = o.sizer, o.reportSize
+	c.maxTagsPerItem = o.maxTagsPerItem
+	c.maxTags = o.maxTags
+	c.sortByExpiration = o.sortByExpiration
+	c.sweepChunk = o.sweepChunk
+	c.keepTTLFallback = o.keepTTLFallback
+	// The shards of a sharded cache are all created from the same options,
+	// so they share a tracker.
+	if o.goroutines == nil {
+		o.goroutines = &goroutines{max: o.maxGoroutines}
+	}
+	c.goroutines = o.goroutines
+	if o.tombstoneRetention > 0 {
+		c.tombstones = map[string]int64{}
+		c.tombstoneRetention = o.tombstoneRetention
+		c.strictTombstones = o.strictTombstones
+	}
+	c.chainSkipErrors = o.chainSkipErrors
+	c.reaper = o.reaper
+	c.coalesceInterval = o.coalesceInterval
+	c.scans.timeout = o.scanTimeout
+	c.decodeFallback = o.decodeFallback
+	c.valueCodec = o.valueCodec
+	if o.hitRateWindow > 0 {
+		c.hitRate = newRollingCounter(o.hitRateWindow)
+	}
+	if o.diskDir != "" {
+		d, err := newDiskTier(o.diskDir, o.diskCodec)
+		if err != nil {
+			c.logf("couldn't use %s for disk overflow: %v", o.diskDir, err)
+		}
+		c.disk = d
+	}
+}
+
+// WithProtectedRatio sets the fraction of a capacity-limited cache's capacity
+// that the protected segment of EvictionPolicySegmentedLRU may take up. It is
+// clamped to [0, 1], and defaults to 0.8.
+func WithProtectedRatio(r float64) Option {
+	return func(o *options) {
+		if r < 0 {
+			r = 0
+		} else if r > 1 {
+			r = 1
+		}
+		o.protectedRatio = r
+	}
+}
+
+// WithLazyErrorTTL makes the cache shorten the lifetime of an item set using
+// SetLazy to d, if it would otherwise expire later, when computing its value
+// fails. Reads until then still retry the computation.
+func WithLazyErrorTTL(d time.Duration) Option {
+	return func(o *options) {
+		o.lazyErrorTTL = d
+	}
+}
+
+// WithLazyRemoveOnError makes the cache remove an item set using SetLazy if
+// computing its value fails, instead of leaving it to be computed again by the
+// next read.
+func WithLazyRemoveOnError() Option {
+	return func(o *options) {
+		o.removeLazyOnError = true
+	}
+}
+
+// WithTieBreaker sets the function used by EvictionPolicyExpiration to choose
+// between items that expire at the same time. less reports whether a should be
+// evicted before b. It defaults to TieBreakByInsertion.
+func WithTieBreaker(less func(a, b EvictionCandidate) bool) Option {
+	return func(o *options) {
+		o.tieBreaker = less
+	}
+}
+
+// WithDirSync makes SaveFile also sync the directory containing the file once
+// it has been renamed into place, so that the rename itself survives a crash.
+// Errors syncing the directory are ignored, since not all platforms and file
+// systems support it.
+func WithDirSync() Option {
+	return func(o *options) {
+		o.syncDir = true
+	}
+}
+
+// WithEagerCleanup makes the janitor delete expired items once as soon as it
+// starts, instead of waiting a full cleanup interval for its first sweep, so
+// that already expired items passed to NewFrom are purged promptly. It has no
+// effect if the cache has no janitor.
+func WithEagerCleanup(eager bool) Option {
+	return func(o *options) {
+		o.eagerCleanup = eager
+	}
+}
+
+// WithMaxTagsPerItem limits the number of distinct tags an item can be given
+// using SetWithTags to n. There is no limit if n is less than one.
+func WithMaxTagsPerItem(n int) Option {
+	return func(o *options) {
+		o.maxTagsPerItem = n
+	}
+}
+
+// WithMaxTags limits the number of distinct tags in use in the cache at once
+// to n. SetWithTags rejects items whose tags would exceed the limit, rather
+// than dropping existing tags. There is no limit if n is less than one. In a
+// sharded cache, the limit applies to the tags in use across all shards.
+func WithMaxTags(n int) Option {
+	return func(o *options) {
+		o.maxTags = n
+	}
+}
@@ -0,0 +1,78 @@
+package cache
+
+import "time"
+
+// A KVWithExpiration is a key, the value of the item it is associated with,
+// and the item's expiration time, which is the zero Time if it never expires.
+type KVWithExpiration struct {
+	Key        string
+	Value      interface{}
+	Expiration time.Time
+}
+
+// Page returns up to limit unexpired items, in lexicographic order of their
+// keys, starting at offset in that order, along with the total number of
+// unexpired items, e.g. for browsing a large cache one page at a time. The keys
+// are copied while the cache is read-locked and then sorted, so every call
+// costs O(n log n) in the number of items n, however small the page; only the
+// values on the page are copied. Items set using SetLazy whose values were
+// never computed are left out.
+func (c *cache) Page(offset, limit int) (items []KVWithExpiration, total int) {
+	all := c.appendLive(nil)
+	sortItems(all, false)
+	return pageOf(all, offset, limit, func(k string) *cache { return c }), len(all)
+}
+
+// Page returns up to limit unexpired items from all shards, sorted as one
+// list. See the cache's Page. The shards are copied one at a time, so pages
+// are not a consistent snapshot across shards.
+func (sc *shardedCache) Page(offset, limit int) (items []KVWithExpiration, total int) {
+	var all []sortedItem
+	for _, c := range sc.cs {
+		all = c.appendLive(all)
+	}
+	sortItems(all, false)
+	return pageOf(all, offset, limit, sc.bucket), len(all)
+}
+
+// Appends the key and stored item of each unexpired item in the cache to
+// items, without copying or decompressing the values.
+func (c *cache) appendLive(items []sortedItem) []sortedItem {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.now().UnixNano()
+	for k, v := range c.items {
+		if (v.Expiration > 0 && now > v.Expiration) || isLazy(v.Object) {
+			continue
+		}
+		items = append(items, sortedItem{k, c.withPausedExpiration(k, v, now)})
+	}
+	return items
+}
+
+// Returns the items in sorted between offset and offset+limit, resolving their
+// values using the caches returned by owner.
+func pageOf(sorted []sortedItem, offset, limit int, owner func(k string) *cache) []KVWithExpiration {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(sorted) || limit <= 0 {
+		return nil
+	}
+	if limit > len(sorted)-offset {
+		limit = len(sorted) - offset
+	}
+	page := make([]KVWithExpiration, 0, limit)
+	for _, it := range sorted[offset : offset+limit] {
+		x, found := owner(it.k).value(it.k, it.v.Object)
+		if !found {
+			continue
+		}
+		kv := KVWithExpiration{Key: it.k, Value: x}
+		if it.v.Expiration > 0 {
+			kv.Expiration = time.Unix(0, it.v.Expiration)
+		}
+		page = append(page, kv)
+	}
+	return page
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func pageKeys(items []KVWithExpiration) []string {
+	keys := make([]string, len(items))
+	for i, kv := range items {
+		keys[i] = kv.Key
+	}
+	return keys
+}
+
+func TestPage(t *testing.T) {
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := New(DefaultExpiration, 0, WithClock(clk))
+	for i := 0; i < 5; i++ {
+		tc.Set("k"+strconv.Itoa(i), i, NoExpiration)
+	}
+	tc.Set("expiring", "x", time.Minute)
+	tc.Set("expired", "y", time.Second)
+	clk.Advance(2 * time.Second)
+
+	items, total := tc.Page(0, 2)
+	if total != 6 {
+		t.Errorf("total is %d, not 6", total)
+	}
+	if want := []string{"expiring", "k0"}; !reflect.DeepEqual(pageKeys(items), want) {
+		t.Errorf("first page is %v, want %v", pageKeys(items), want)
+	}
+	if want := time.Unix(100, 0).Add(time.Minute); !items[0].Expiration.Equal(want) {
+		t.Errorf("expiring expires at %v, want %v", items[0].Expiration, want)
+	}
+	if !items[1].Expiration.IsZero() || items[1].Value.(int) != 0 {
+		t.Errorf("k0 is %+v", items[1])
+	}
+
+	items, _ = tc.Page(4, 10)
+	if want := []string{"k3", "k4"}; !reflect.DeepEqual(pageKeys(items), want) {
+		t.Errorf("last page is %v, want %v", pageKeys(items), want)
+	}
+	for _, p := range [][2]int{{6, 10}, {100, 1}, {0, 0}} {
+		if items, total := tc.Page(p[0], p[1]); len(items) != 0 || total != 6 {
+			t.Errorf("Page(%d, %d) returned %v, %d", p[0], p[1], pageKeys(items), total)
+		}
+	}
+}
+
+func TestShardedPage(t *testing.T) {
+	tc := NewShardedWithOptions(WithShards(4))
+	var want []string
+	for i := 0; i < 10; i++ {
+		k := "k" + strconv.Itoa(i)
+		tc.Set(k, i, DefaultExpiration)
+		want = append(want, k)
+	}
+	var got []string
+	for offset := 0; ; offset += 3 {
+		items, total := tc.Page(offset, 3)
+		if total != 10 {
+			t.Fatalf("total is %d, not 10", total)
+		}
+		if len(items) == 0 {
+			break
+		}
+		got = append(got, pageKeys(items)...)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("paged through %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package cache
+
+import "time"
+
+// Priority tells a capacity-limited cache how costly an item is to lose. When
+// the cache is full, items are evicted strictly in order of priority: no item
+// is evicted while an item with a lower priority can be, and among items with
+// the same priority the eviction policy decides. Priorities don't affect
+// expiration. See SetWithPriority.
+type Priority int
+
+const (
+	// PriorityLow is for items that are cheap to recompute.
+	PriorityLow Priority = iota - 1
+	// PriorityNormal is the priority of items set without one.
+	PriorityNormal
+	// PriorityHigh is for items that are costly to recompute.
+	PriorityHigh
+	// PriorityCritical is for items that should only be evicted if nothing
+	// else can be, e.g. signing keys.
+	PriorityCritical
+)
+
+const numPriorities = int(PriorityCritical-PriorityLow) + 1
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	case PriorityCritical:
+		return "critical"
+	}
+	return "unknown"
+}
+
+// SetWithPriority adds an item to the cache like Set, with the given priority.
+// In a capacity-limited cache, items with a lower priority are always evicted
+// first. The priority belongs to the item it was set with, like the metadata of
+// SetWithMeta: Set and the other methods that store a new item give it
+// PriorityNormal.
+//
+// While any items have a priority other than PriorityNormal, choosing victims
+// may take time proportional to the number of items in the cache.
+func (c *cache) SetWithPriority(k string, x interface{}, d time.Duration, prio Priority) {
+	c.mu.Lock()
+	if c.tombstoned(k) {
+		c.mu.Unlock()
+		return
+	}
+	evictedItems := c.set(k, x, d)
+	item := c.items[k]
+	item.Priority = prio
+	c.items[k] = item
+	c.trackPriority(k, prio)
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+}
+
+// Remembers that k may have a priority other than PriorityNormal, so that
+// makeRoom takes it into account. c.mu must be held.
+func (c *cache) trackPriority(k string, prio Priority) {
+	if c.evictor == nil || prio == PriorityNormal {
+		return
+	}
+	if c.prioritized == nil {
+		c.prioritized = map[string]struct{}{}
+	}
+	c.prioritized[k] = struct{}{}
+}
+
+// The number of items with each priority, indexed from PriorityLow, while
+// making room for a new item.
+type priorityTiers [numPriorities]int
+
+// Counts the items with each priority. Keys in c.prioritized that were
+// removed, or overwritten without a priority, are forgotten. c.mu must be held.
+func (c *cache) priorityTiers() *priorityTiers {
+	var t priorityTiers
+	others := 0
+	for k := range c.prioritized {
+		item, found := c.items[k]
+		if !found || item.Priority == PriorityNormal {
+			delete(c.prioritized, k)
+			continue
+		}
+		t[item.Priority-PriorityLow]++
+		others++
+	}
+	t[PriorityNormal-PriorityLow] = len(c.items) - others
+	return &t
+}
+
+// Returns the next key to evict: the one the eviction policy picks among the
+// evictable items with the lowest priority.
+func (t *priorityTiers) victim(c *cache, k string) (string, bool) {
+	for i, n := range t {
+		if n == 0 {
+			continue
+		}
+		prio := Priority(i) + PriorityLow
+		victim, ok := c.evictor.Victim(k, func(k string) bool {
+			return c.unevictable(k) || c.items[k].Priority > prio
+		})
+		if ok {
+			t[c.items[victim].Priority-PriorityLow]--
+			return victim, true
+		}
+	}
+	return "", false
+}
+
+// SetWithPriority adds an item to the shard owning it, with the given
+// priority. Items are evicted in order of priority within each shard. See the
+// cache's SetWithPriority.
+func (sc *shardedCache) SetWithPriority(k string, x interface{}, d time.Duration, prio Priority) {
+	sc.bucket(k).SetWithPriority(k, x, d, prio)
+}
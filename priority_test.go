@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestPriorityEvictionOrder(t *testing.T) {
+	prios := []Priority{PriorityHigh, PriorityLow, PriorityCritical, PriorityNormal}
+	for name, p := range evictionPolicies {
+		tc := NewWithCapacity(DefaultExpiration, 0, 12, p)
+		var evicted []Priority
+		tc.OnEvicted(func(k string, v interface{}) {
+			evicted = append(evicted, v.(Priority))
+		})
+		// Interleave the priorities so that no policy evicts them in order by
+		// chance.
+		for i := 0; i < 12; i++ {
+			prio := prios[i%len(prios)]
+			tc.SetWithPriority("old"+strconv.Itoa(i), prio, DefaultExpiration, prio)
+		}
+		for i := 0; i < 9; i++ {
+			tc.SetWithPriority("new"+strconv.Itoa(i), PriorityCritical, DefaultExpiration, PriorityCritical)
+		}
+		want := []Priority{
+			PriorityLow, PriorityLow, PriorityLow,
+			PriorityNormal, PriorityNormal, PriorityNormal,
+			PriorityHigh, PriorityHigh, PriorityHigh,
+		}
+		if len(evicted) != len(want) {
+			t.Fatalf("%s: evicted %v, not %v", name, evicted, want)
+		}
+		for i := range want {
+			if evicted[i] != want[i] {
+				t.Fatalf("%s: evicted %v, not %v", name, evicted, want)
+			}
+		}
+		for i := 2; i < 12; i += len(prios) {
+			if _, found := tc.Get("old" + strconv.Itoa(i)); !found {
+				t.Errorf("%s: critical item old%d was evicted", name, i)
+			}
+		}
+		// Once only critical items are left, they are evicted by policy.
+		tc.Set("last", PriorityNormal, DefaultExpiration)
+		if len(evicted) != 10 || evicted[9] != PriorityCritical {
+			t.Errorf("%s: evicted %v after filling up with critical items", name, evicted)
+		}
+	}
+}
+
+func TestPriorityResetBySet(t *testing.T) {
+	tc := NewWithCapacity(DefaultExpiration, 0, 2, EvictionPolicyLRU)
+	tc.SetWithPriority("foo", 1, DefaultExpiration, PriorityCritical)
+	tc.Set("bar", 2, DefaultExpiration)
+	// Overwriting foo without a priority makes it normal again, and the least
+	// recently used item.
+	tc.Set("foo", 3, DefaultExpiration)
+	tc.Get("bar")
+	tc.Set("baz", 4, DefaultExpiration)
+	if _, found := tc.Get("foo"); found {
+		t.Error("foo was kept after being overwritten without a priority")
+	}
+	if _, found := tc.Get("bar"); !found {
+		t.Error("bar was evicted instead of foo")
+	}
+}
+
+func TestPriorityRespectsPins(t *testing.T) {
+	tc := NewWithCapacity(DefaultExpiration, 0, 2, EvictionPolicyLRU)
+	tc.SetWithPriority("low", 1, DefaultExpiration, PriorityLow)
+	tc.SetWithPriority("high", 2, DefaultExpiration, PriorityHigh)
+	tc.Pin("low")
+	tc.Set("new", 3, DefaultExpiration)
+	if _, found := tc.Get("low"); !found {
+		t.Error("pinned low-priority item was evicted")
+	}
+	if _, found := tc.Get("high"); found {
+		t.Error("high-priority item wasn't evicted although the only lower one is pinned")
+	}
+}
+
+func TestShardedPriority(t *testing.T) {
+	tc := NewShardedLRU(DefaultExpiration, 0, 2, 3)
+	var keys []string
+	for i := 0; len(keys) < 10; i++ {
+		if k := "foo" + strconv.Itoa(i); tc.ShardFor(k) == 0 {
+			keys = append(keys, k)
+		}
+	}
+	tc.SetWithPriority(keys[0], 0, DefaultExpiration, PriorityCritical)
+	for i, k := range keys[1:] {
+		tc.SetWithPriority(k, i+1, DefaultExpiration, PriorityLow)
+	}
+	if _, found := tc.Get(keys[0]); !found {
+		t.Error("critical item was evicted from its shard before low-priority ones")
+	}
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"time"
+)
+
+// ReadOnlyCache is a view of a Cache or ShardedCache that can only read it,
+// for handing to code that should consume the cache but never change it. It
+// shares the cache's items, so it sees every change made through the cache.
+// See ReadOnly.
+type ReadOnlyCache interface {
+	// Get gets an item from the cache. See the cache's Get.
+	Get(k string) (interface{}, bool)
+	// GetWithExpiration gets an item and its expiration time from the
+	// cache. See the cache's GetWithExpiration.
+	GetWithExpiration(k string) (interface{}, time.Time, bool)
+	// Has reports whether there is an unexpired item with the key k,
+	// without computing its value if it was set with SetLazy, and without
+	// counting as a hit or miss.
+	Has(k string) bool
+	// Keys returns the keys of the unexpired items, in the order of
+	// KeysSorted.
+	Keys() []string
+	// ItemCount returns the number of items in the cache, including those
+	// that have expired but haven't been deleted yet.
+	ItemCount() int
+	// Range calls f for each unexpired item, stopping if f returns false.
+	// The items are copied first, so f may read the cache. See RangeTTL.
+	Range(f func(k string, x interface{}) bool)
+}
+
+// ReadOnly returns a read-only view of the cache. It isn't a *Cache, so it
+// can't be converted back to one with a type assertion.
+func (c *cache) ReadOnly() ReadOnlyCache {
+	return readOnlyCache{c}
+}
+
+// ReadOnly returns a read-only view of the cache. See the cache's ReadOnly.
+func (sc *shardedCache) ReadOnly() ReadOnlyCache {
+	return readOnlyShardedCache{sc}
+}
+
+// Reports whether k has an unexpired item, wherever it is stored.
+func (c *cache) has(k string) bool {
+	if c.coalescer != nil {
+		if _, found := c.getPending(k); found {
+			return true
+		}
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if item, found := c.items[k]; found {
+		return !c.expired(item)
+	}
+	if c.disk != nil {
+		if e, found := c.disk.index[k]; found {
+			return e == 0 || c.now().UnixNano() <= e
+		}
+	}
+	return false
+}
+
+// Calls f for each unexpired item in items, resolving its value as Get does,
+// and reports whether f returned true for all of them.
+func (c *cache) rangeValues(items map[string]Item, f func(k string, x interface{}) bool) bool {
+	return c.rangeTTL(items, func(k string, x interface{}, _ time.Duration) bool {
+		x, found := c.value(k, x)
+		return !found || f(k, x)
+	})
+}
+
+type readOnlyCache struct {
+	c *cache
+}
+
+func (r readOnlyCache) Get(k string) (interface{}, bool) {
+	return r.c.Get(k)
+}
+
+func (r readOnlyCache) GetWithExpiration(k string) (interface{}, time.Time, bool) {
+	return r.c.GetWithExpiration(k)
+}
+
+func (r readOnlyCache) Has(k string) bool {
+	return r.c.has(k)
+}
+
+func (r readOnlyCache) Keys() []string {
+	return r.c.KeysSorted()
+}
+
+func (r readOnlyCache) ItemCount() int {
+	return r.c.ItemCount()
+}
+
+func (r readOnlyCache) Range(f func(k string, x interface{}) bool) {
+	r.c.rangeValues(r.c.Items(), f)
+}
+
+type readOnlyShardedCache struct {
+	sc *shardedCache
+}
+
+func (r readOnlyShardedCache) Get(k string) (interface{}, bool) {
+	return r.sc.Get(k)
+}
+
+func (r readOnlyShardedCache) GetWithExpiration(k string) (interface{}, time.Time, bool) {
+	return r.sc.bucket(k).GetWithExpiration(k)
+}
+
+func (r readOnlyShardedCache) Has(k string) bool {
+	return r.sc.bucket(k).has(k)
+}
+
+func (r readOnlyShardedCache) Keys() []string {
+	return r.sc.KeysSorted()
+}
+
+func (r readOnlyShardedCache) ItemCount() int {
+	return int(r.sc.ItemCount())
+}
+
+func (r readOnlyShardedCache) Range(f func(k string, x interface{}) bool) {
+	for _, c := range r.sc.cs {
+		if !c.rangeValues(c.Items(), f) {
+			return
+		}
+	}
+}
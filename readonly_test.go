@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func testReadOnly(t *testing.T, s Store, ro ReadOnlyCache) {
+	s.Set("b", 2, DefaultExpiration)
+	s.Set("a", 1, time.Hour)
+	s.Set("gone", 3, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	if x, found := ro.Get("a"); !found || x != 1 {
+		t.Errorf("Get: got (%v, %v), want (1, true)", x, found)
+	}
+	if _, exp, found := ro.GetWithExpiration("a"); !found || exp.IsZero() {
+		t.Errorf("GetWithExpiration: got (%v, %v), want an expiration time", exp, found)
+	}
+	if !ro.Has("b") || ro.Has("gone") || ro.Has("missing") {
+		t.Error("Has reported the wrong keys")
+	}
+	if keys := ro.Keys(); !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Errorf("Keys: got %v, want [a b]", keys)
+	}
+	if n := ro.ItemCount(); n != 3 {
+		t.Errorf("ItemCount: got %d, want 3", n)
+	}
+	var keys []string
+	ro.Range(func(k string, x interface{}) bool {
+		keys = append(keys, k)
+		return true
+	})
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Errorf("Range: visited %v, want [a b]", keys)
+	}
+
+	// The view shares the cache's items.
+	s.Set("c", 3, DefaultExpiration)
+	if !ro.Has("c") {
+		t.Error("the view doesn't see an item set after it was made")
+	}
+	if _, ok := ro.(Store); ok {
+		t.Error("the view can write to the cache")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	testReadOnly(t, tc, tc.ReadOnly())
+}
+
+func TestShardedReadOnly(t *testing.T) {
+	tc := NewShardedWithOptions(WithShards(3))
+	testReadOnly(t, tc, tc.ReadOnly())
+}
+
+func TestReadOnlyHasLazy(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	computed := false
+	tc.SetLazy("foo", func() (interface{}, error) {
+		computed = true
+		return 1, nil
+	}, DefaultExpiration)
+	if !tc.ReadOnly().Has("foo") {
+		t.Error("Has missed a lazy item")
+	}
+	if computed {
+		t.Error("Has computed a lazy value")
+	}
+}
@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A Reaper runs the sweeps of many janitors from a single goroutine, one at a
+// time, and pauses after each sweep so that, together, they take up at most a
+// given share of one CPU. Without one, each cache's janitor sweeps from its
+// own goroutine, so a process with many caches can spend a lot of CPU on
+// cleanup at once. A Reaper is typically kept in a package-level variable and
+// passed to every cache with WithReaper.
+//
+// Each janitor is still swept about every interval, unless the budget doesn't
+// allow it, in which case sweeps are delayed, in the order they are due. The
+// Reaper's goroutine runs while any janitor is registered with it.
+//
+// A Reaper's methods may be called concurrently.
+type Reaper struct {
+	budget float64
+
+	// Held while a sweep is running.
+	sweepMu sync.Mutex
+
+	mu       sync.Mutex
+	janitors map[*Janitor]time.Time // The time of each janitor's next sweep.
+	stop     chan struct{}
+	done     chan struct{}
+	wake     chan struct{}
+}
+
+// NewReaper returns a Reaper that keeps the time spent sweeping to at most
+// budget, a fraction of the time between sweeps, e.g. 0.05 for 5% of one CPU.
+// It panics if budget isn't greater than 0. A budget of 1 or more doesn't
+// pause between sweeps; it only runs them one at a time.
+func NewReaper(budget float64) *Reaper {
+	if !(budget > 0) {
+		panic(fmt.Sprintf("go-cache: NewReaper: budget must be greater than 0, not %v", budget))
+	}
+	return &Reaper{
+		budget:   budget,
+		janitors: map[*Janitor]time.Time{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// WithReaper makes the cache's janitor (see WithCleanupInterval) run its
+// sweeps through r instead of from its own goroutine. Close deregisters the
+// cache from r.
+func WithReaper(r *Reaper) Option {
+	return func(o *options) {
+		o.reaper = r
+	}
+}
+
+// WithJanitorReaper makes the janitor run its sweeps through r instead of
+// from its own goroutine. Start registers it with r, and Stop deregisters it.
+func WithJanitorReaper(r *Reaper) JanitorOption {
+	return func(j *Janitor) {
+		j.reaper = r
+	}
+}
+
+// Janitors returns the number of janitors registered with the reaper.
+func (r *Reaper) Janitors() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.janitors)
+}
+
+// Registers j, starting the reaper's goroutine if j is the first janitor.
+func (r *Reaper) add(j *Janitor) {
+	next := time.Now()
+	if !j.eager {
+		next = next.Add(j.wait())
+	}
+	r.mu.Lock()
+	r.janitors[j] = next
+	if r.stop == nil {
+		stop, done := make(chan struct{}), make(chan struct{})
+		r.stop, r.done = stop, done
+		go r.run(stop, done)
+	}
+	r.mu.Unlock()
+	r.poke()
+}
+
+// Deregisters j, waiting for a sweep of it in progress to finish, and stops
+// the reaper's goroutine if j was the last janitor.
+func (r *Reaper) remove(j *Janitor) {
+	r.mu.Lock()
+	delete(r.janitors, j)
+	var stop, done chan struct{}
+	if len(r.janitors) == 0 {
+		stop, done = r.stop, r.done
+		r.stop, r.done = nil, nil
+	}
+	r.mu.Unlock()
+	r.sweepMu.Lock()
+	r.sweepMu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// Makes j due for a sweep now, if it is registered.
+func (r *Reaper) trigger(j *Janitor) {
+	r.mu.Lock()
+	_, found := r.janitors[j]
+	if found {
+		r.janitors[j] = time.Now()
+	}
+	r.mu.Unlock()
+	if found {
+		r.poke()
+	}
+}
+
+// Wakes the reaper's goroutine to look for the next due janitor again.
+func (r *Reaper) poke() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Returns the janitor that is due next, and how long until it is due, or nil
+// if there is none.
+func (r *Reaper) next() (*Janitor, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var (
+		first *Janitor
+		at    time.Time
+	)
+	for j, t := range r.janitors {
+		if first == nil || t.Before(at) {
+			first, at = j, t
+		}
+	}
+	if first == nil {
+		return nil, 0
+	}
+	return first, time.Until(at)
+}
+
+// Sweeps j, if it is still registered, and returns how long the sweep took.
+func (r *Reaper) sweep(j *Janitor) time.Duration {
+	r.sweepMu.Lock()
+	defer r.sweepMu.Unlock()
+	r.mu.Lock()
+	_, found := r.janitors[j]
+	r.mu.Unlock()
+	if !found {
+		return 0
+	}
+	begin := time.Now()
+	j.sweep()
+	took := time.Since(begin)
+	r.mu.Lock()
+	if _, found := r.janitors[j]; found {
+		r.janitors[j] = time.Now().Add(j.wait())
+	}
+	r.mu.Unlock()
+	return took
+}
+
+// Sleeps for d, and reports whether stop was closed meanwhile. It returns
+// early, reporting false, if wake is given and receives.
+func sleep(d time.Duration, stop <-chan struct{}, wake <-chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-wake:
+	case <-stop:
+		return true
+	}
+	return false
+}
+
+func (r *Reaper) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	for {
+		j, wait := r.next()
+		if j == nil {
+			wait = time.Hour
+		}
+		if j == nil || wait > 0 {
+			if sleep(wait, stop, r.wake) {
+				return
+			}
+			continue
+		}
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		took := r.sweep(j)
+		if r.budget < 1 && took > 0 {
+			pause := time.Duration(float64(took) * (1 - r.budget) / r.budget)
+			if sleep(pause, stop, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReaperSweepsCaches(t *testing.T) {
+	r := NewReaper(1)
+	tc := NewWithOptions(WithCleanupInterval(5*time.Millisecond), WithReaper(r))
+	sc := NewShardedWithOptions(WithShards(3), WithCleanupInterval(5*time.Millisecond), WithReaper(r))
+	if n := r.Janitors(); n != 2 {
+		t.Fatalf("%d janitors are registered, not 2", n)
+	}
+	tc.Set("foo", 1, time.Millisecond)
+	sc.Set("foo", 1, time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for tc.ItemCount() != 0 || sc.ItemCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the reaper didn't delete the expired items")
+		}
+		<-time.After(time.Millisecond)
+	}
+
+	tc.Close()
+	if n := r.Janitors(); n != 1 {
+		t.Errorf("%d janitors are registered after closing a cache, not 1", n)
+	}
+	sc.janitor.Stop()
+	if n := r.Janitors(); n != 0 {
+		t.Errorf("%d janitors are registered after stopping both, not 0", n)
+	}
+	r.mu.Lock()
+	running := r.stop != nil
+	r.mu.Unlock()
+	if running {
+		t.Error("the reaper's goroutine is running without janitors")
+	}
+}
+
+func TestReaperSerializesAndLimitsSweeps(t *testing.T) {
+	r := NewReaper(0.5)
+	var (
+		n       int32
+		running int32
+	)
+	sweep := func() {
+		if atomic.AddInt32(&running, 1) != 1 {
+			t.Error("two sweeps ran at the same time")
+		}
+		atomic.AddInt32(&n, 1)
+		<-time.After(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	}
+	a := NewJanitor(time.Millisecond, sweep, WithJanitorReaper(r))
+	b := NewJanitor(time.Millisecond, sweep, WithJanitorReaper(r))
+	a.Start()
+	b.Start()
+	<-time.After(100 * time.Millisecond)
+	a.Stop()
+	b.Stop()
+	// Each 10ms sweep is followed by a pause of at least 10ms.
+	if swept := atomic.LoadInt32(&n); swept > 6 {
+		t.Errorf("%d sweeps ran in 100ms with a budget of half the time", swept)
+	} else if swept == 0 {
+		t.Error("no sweeps ran")
+	}
+}
+
+func TestReaperStopAndTrigger(t *testing.T) {
+	r := NewReaper(1)
+	started := make(chan struct{}, 1)
+	var finished int32
+	j := NewJanitor(time.Hour, func() {
+		started <- struct{}{}
+		<-time.After(20 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+	}, WithJanitorReaper(r))
+	j.Start()
+	j.TriggerNow()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("the reaper didn't sweep when triggered")
+	}
+	j.Stop()
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Error("Stop returned before the sweep in progress finished")
+	}
+	// Triggering a stopped janitor has no effect.
+	j.TriggerNow()
+	<-time.After(10 * time.Millisecond)
+	select {
+	case <-started:
+		t.Error("the reaper swept a stopped janitor")
+	default:
+	}
+}
+
+func TestNewReaperInvalidBudget(t *testing.T) {
+	for _, budget := range []float64{0, -0.5, math.NaN()} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewReaper(%v) didn't panic", budget)
+				}
+			}()
+			NewReaper(budget)
+		}()
+	}
+}
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"os"
+	"time"
+)
+
+// ReloadMode selects how a cache created with WithFileReload loads its file
+// when it changes.
+type ReloadMode int
+
+const (
+	// ReloadReplaceAll replaces the cache's contents with the file's: items
+	// that aren't in the file are deleted, and all other items are
+	// overwritten.
+	ReloadReplaceAll ReloadMode = iota
+	// ReloadMergeAdd adds the items in the file only where no unexpired item
+	// with the same key exists, like LoadAdd.
+	ReloadMergeAdd
+)
+
+// ReloadResult describes a reload of a cache's file. See WithReloadCallback.
+type ReloadResult struct {
+	Path string
+	Mode ReloadMode
+	// The number of items that were stored.
+	Added int
+	// The number of items that were skipped because an unexpired item with
+	// the same key exists (only with ReloadMergeAdd) or because they have
+	// expired.
+	SkippedExisting, SkippedExpired int
+	// Set if the file couldn't be read or is corrupt, in which case the
+	// cache was left unchanged.
+	Err error
+}
+
+// WithFileReload makes the cache poll the snapshot file at path (as written by
+// Save or SaveFile) every pollInterval, and load it using mode whenever its
+// modification time or size changes. The file's state when the cache is
+// created is taken as the starting point, so an existing file isn't loaded
+// until it changes. The file is read and verified in full before the cache is
+// updated, under a single lock, so a partially written or corrupt file leaves
+// the cache unchanged. Close stops the polling.
+//
+// This option is ignored by NewSharded.
+func WithFileReload(path string, pollInterval time.Duration, mode ReloadMode) Option {
+	return func(o *options) {
+		o.reloadPath = path
+		o.reloadInterval = pollInterval
+		o.reloadMode = mode
+	}
+}
+
+// WithReloadCallback sets a function that is called with the result of every
+// reload made because of WithFileReload. Like WithFileReload, it is ignored by
+// NewSharded.
+func WithReloadCallback(f func(ReloadResult)) Option {
+	return func(o *options) {
+		o.reloadCallback = f
+	}
+}
+
+type fileReloader struct {
+	Path     string
+	Interval time.Duration
+	Mode     ReloadMode
+	Callback func(ReloadResult)
+	stop     chan bool
+	modTime  time.Time
+	size     int64
+}
+
+func (r *fileReloader) Run(c *cache) {
+	ticker := time.NewTicker(r.Interval)
+	for {
+		select {
+		case <-ticker.C:
+			r.check(c)
+		case <-r.stop:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// Records the file's state, and reports whether it changed since the last
+// call.
+func (r *fileReloader) changed() bool {
+	var (
+		modTime time.Time
+		size    int64 = -1
+	)
+	if fi, err := os.Stat(r.Path); err == nil {
+		modTime, size = fi.ModTime(), fi.Size()
+	}
+	if modTime.Equal(r.modTime) && size == r.size {
+		return false
+	}
+	r.modTime, r.size = modTime, size
+	return true
+}
+
+func (r *fileReloader) check(c *cache) {
+	if !r.changed() || r.size < 0 {
+		return
+	}
+	res := ReloadResult{Path: r.Path, Mode: r.Mode}
+	var items map[string]Item
+	fp, err := os.Open(r.Path)
+	if err == nil {
+		items, err = c.readSnapshot(fp)
+		fp.Close()
+	}
+	switch {
+	case err != nil:
+		res.Err = err
+	case r.Mode == ReloadMergeAdd:
+		res.Added, res.SkippedExisting, res.SkippedExpired = c.loadItems(items, true)
+	default:
+		res.Added, res.SkippedExpired = c.replaceItems(items)
+	}
+	if r.Callback != nil {
+		r.Callback(res)
+	}
+}
+
+func runFileReloader(c *cache, r *fileReloader) {
+	r.stop = make(chan bool)
+	r.changed()
+	c.goroutines.helper(func() { r.Run(c) })
+}
+
+// Replaces the cache's items with items, skipping any that have expired.
+// Returns the number of items stored and skipped.
+func (c *cache) replaceItems(items map[string]Item) (added, expired int) {
+	var evictedItems []keyAndValue
+	now := c.now().UnixNano()
+	c.mu.Lock()
+	for k := range c.items {
+		if _, found := items[k]; !found {
+			ov, evicted := c.delete(k)
+			if evicted {
+				evictedItems = append(evictedItems, keyAndValue{k, ov, EvictionReasonDeleted})
+			}
+		}
+	}
+	for k, v := range items {
+		if v.Expiration > 0 && now > v.Expiration {
+			expired++
+			continue
+		}
+		added++
+		evictedItems = append(evictedItems, c.loadItem(k, v)...)
+	}
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+	return
+}
@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func saveTestFile(t *testing.T, fname string, kvs map[string]interface{}) {
+	tc := New(DefaultExpiration, 0)
+	for k, v := range kvs {
+		tc.Set(k, v, DefaultExpiration)
+	}
+	if err := tc.SaveFile(fname); err != nil {
+		t.Fatal("Couldn't save cache to file:", err)
+	}
+}
+
+func waitReload(t *testing.T, results chan ReloadResult) ReloadResult {
+	select {
+	case res := <-results:
+		return res
+	case <-time.After(1 * time.Second):
+		t.Fatal("the file was not reloaded")
+	}
+	return ReloadResult{}
+}
+
+func TestFileReloadReplaceAll(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.snapshot")
+	saveTestFile(t, fname, map[string]interface{}{"a": 1})
+	results := make(chan ReloadResult, 10)
+	tc := New(DefaultExpiration, 0,
+		WithFileReload(fname, 1*time.Millisecond, ReloadReplaceAll),
+		WithReloadCallback(func(res ReloadResult) { results <- res }))
+	defer tc.Close()
+	tc.Set("live", 1, DefaultExpiration)
+	tc.Set("b", "old", DefaultExpiration)
+
+	// Keep the size and modification time from colliding with the first file.
+	<-time.After(10 * time.Millisecond)
+	saveTestFile(t, fname, map[string]interface{}{"b": "new", "c": 3})
+	res := waitReload(t, results)
+	if res.Err != nil || res.Added != 2 {
+		t.Errorf("reload returned %+v", res)
+	}
+	if _, found := tc.Get("live"); found {
+		t.Error("an item missing from the file was kept")
+	}
+	if x, _ := tc.Get("b"); x != "new" {
+		t.Errorf("b is %v, not new", x)
+	}
+	if tc.ItemCount() != 2 {
+		t.Errorf("ItemCount is %d, not 2", tc.ItemCount())
+	}
+
+	if err := os.WriteFile(fname, []byte("GCSNAP\x01garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	res = waitReload(t, results)
+	if res.Err == nil {
+		t.Error("a corrupt file was reloaded without an error")
+	}
+	if x, _ := tc.Get("b"); x != "new" || tc.ItemCount() != 2 {
+		t.Error("a corrupt file changed the cache's contents")
+	}
+}
+
+func TestFileReloadMergeAdd(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.snapshot")
+	results := make(chan ReloadResult, 10)
+	tc := New(DefaultExpiration, 0,
+		WithFileReload(fname, 1*time.Millisecond, ReloadMergeAdd),
+		WithReloadCallback(func(res ReloadResult) { results <- res }))
+	defer tc.Close()
+	tc.Set("a", "live", DefaultExpiration)
+	saveTestFile(t, fname, map[string]interface{}{"a": "file", "b": "file"})
+	res := waitReload(t, results)
+	if res.Err != nil || res.Added != 1 || res.SkippedExisting != 1 {
+		t.Errorf("reload returned %+v", res)
+	}
+	if x, _ := tc.Get("a"); x != "live" {
+		t.Errorf("a is %v: a live item was overwritten", x)
+	}
+	if x, _ := tc.Get("b"); x != "file" {
+		t.Errorf("b is %v, not file", x)
+	}
+}
+
+func TestCloseStopsFileReload(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.snapshot")
+	results := make(chan ReloadResult, 10)
+	tc := New(DefaultExpiration, 1*time.Millisecond,
+		WithFileReload(fname, 1*time.Millisecond, ReloadMergeAdd),
+		WithReloadCallback(func(res ReloadResult) { results <- res }))
+	tc.Close()
+	tc.Close()
+	saveTestFile(t, fname, map[string]interface{}{"a": 1})
+	select {
+	case <-results:
+		t.Error("the file was reloaded after Close")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if tc.ItemCount() != 0 {
+		t.Error("items were loaded after Close")
+	}
+}
+
+func TestShardedIgnoresFileReload(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.snapshot")
+	tc := NewShardedWithOptions(WithShards(2), WithFileReload(fname, time.Millisecond, ReloadReplaceAll))
+	for i, c := range tc.cs {
+		if c.reloader != nil {
+			t.Errorf("shard %d has a file reloader", i)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Setter is implemented by Cache and ShardedCache, and is all SetFromResponse
+// needs.
+type Setter interface {
+	Set(k string, x interface{}, d time.Duration)
+}
+
+var (
+	_ Setter = (*Cache)(nil)
+	_ Setter = (*ShardedCache)(nil)
+)
+
+// SetFromResponse stores the body of resp in c as a []byte with the given key,
+// for as long as the response's headers say it is fresh, like a shared HTTP
+// cache would. The freshness lifetime is taken from the s-maxage directive of
+// the Cache-Control header, or else its max-age directive, or else the
+// difference between the Expires and Date headers, and the Age header is
+// subtracted from it. If maxTTL is positive, the item is kept for at most
+// maxTTL.
+//
+// Nothing is stored, and resp.Body isn't read, if the status isn't 200 OK, if
+// Cache-Control contains no-store, no-cache or private, if the response has no
+// explicit freshness lifetime, or if it is already stale. Otherwise the body is
+// read and closed, and resp.Body is replaced with a reader of the same bytes,
+// so the caller can still use it. If reading the body fails, nothing is
+// stored, resp.Body is replaced with a reader of the bytes read before the
+// failure, and the error is returned.
+//
+// Returns whether the body was stored, and for how long.
+func SetFromResponse(c Setter, key string, resp *http.Response, maxTTL time.Duration) (stored bool, ttl time.Duration, err error) {
+	ttl = responseTTL(resp, time.Now())
+	if ttl <= 0 {
+		return false, 0, nil
+	}
+	if maxTTL > 0 && ttl > maxTTL {
+		ttl = maxTTL
+	}
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return false, 0, err
+	}
+	c.Set(key, b, ttl)
+	return true, ttl, nil
+}
+
+// Returns how much longer resp stays fresh at now, or zero if it isn't
+// cacheable.
+func responseTTL(resp *http.Response, now time.Time) time.Duration {
+	if resp.StatusCode != http.StatusOK {
+		return 0
+	}
+	cc := parseCacheControl(resp.Header.Values("Cache-Control"))
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, found := cc[d]; found {
+			return 0
+		}
+	}
+	var lifetime time.Duration
+	if v, found := cc["s-maxage"]; found {
+		lifetime = parseDeltaSeconds(v)
+	} else if v, found := cc["max-age"]; found {
+		lifetime = parseDeltaSeconds(v)
+	} else if v := resp.Header.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			// An invalid date, e.g. "0", means already expired.
+			return 0
+		}
+		date := now
+		if d, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+			date = d
+		}
+		lifetime = expires.Sub(date)
+	} else {
+		return 0
+	}
+	if age := parseDeltaSeconds(resp.Header.Get("Age")); age > 0 {
+		lifetime -= age
+	}
+	if lifetime < 0 {
+		return 0
+	}
+	return lifetime
+}
+
+// Parses the Cache-Control header lines into a map of lower-case directive
+// names to their (unquoted) arguments. The first occurrence of a directive
+// wins.
+func parseCacheControl(lines []string) map[string]string {
+	cc := map[string]string{}
+	for _, line := range lines {
+		for _, part := range strings.Split(line, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if _, found := cc[name]; !found {
+				cc[name] = strings.Trim(strings.TrimSpace(arg), `"`)
+			}
+		}
+	}
+	return cc
+}
+
+// Parses a number of seconds, as in max-age or Age. Returns zero if s isn't a
+// non-negative integer.
+func parseDeltaSeconds(s string) time.Duration {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	if n > int64(1<<63-1)/int64(time.Second) {
+		n = int64(1<<63-1) / int64(time.Second)
+	}
+	return time.Duration(n) * time.Second
+}
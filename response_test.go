@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newResponse(status int, body string, header ...string) *http.Response {
+	h := http.Header{}
+	for i := 0; i < len(header); i += 2 {
+		h.Add(header[i], header[i+1])
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     h,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestResponseTTL(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	date := now.Format(http.TimeFormat)
+	for _, tt := range []struct {
+		name   string
+		status int
+		header []string
+		want   time.Duration
+	}{
+		{"max-age", 200, []string{"Cache-Control", "max-age=60"}, time.Minute},
+		{"s-maxage over max-age", 200, []string{"Cache-Control", "max-age=60, s-maxage=120"}, 2 * time.Minute},
+		{"max-age over Expires", 200, []string{"Cache-Control", "max-age=60", "Expires", now.Add(time.Hour).Format(http.TimeFormat)}, time.Minute},
+		{"Expires minus Date", 200, []string{"Date", now.Add(-time.Minute).Format(http.TimeFormat), "Expires", now.Add(time.Hour).Format(http.TimeFormat)}, 61 * time.Minute},
+		{"Expires without Date", 200, []string{"Expires", now.Add(time.Hour).Format(http.TimeFormat)}, time.Hour},
+		{"invalid Expires", 200, []string{"Date", date, "Expires", "0"}, 0},
+		{"past Expires", 200, []string{"Date", date, "Expires", now.Add(-time.Hour).Format(http.TimeFormat)}, 0},
+		{"Age", 200, []string{"Cache-Control", "max-age=60", "Age", "15"}, 45 * time.Second},
+		{"Age past max-age", 200, []string{"Cache-Control", "max-age=60", "Age", "90"}, 0},
+		{"invalid Age", 200, []string{"Cache-Control", "max-age=60", "Age", "soon"}, time.Minute},
+		{"quoted and upper case", 200, []string{"Cache-Control", `Public, MAX-AGE="30"`}, 30 * time.Second},
+		{"several headers", 200, []string{"Cache-Control", "public", "Cache-Control", "max-age=30"}, 30 * time.Second},
+		{"first max-age wins", 200, []string{"Cache-Control", "max-age=30, max-age=60"}, 30 * time.Second},
+		{"invalid max-age", 200, []string{"Cache-Control", "max-age=abc", "Expires", now.Add(time.Hour).Format(http.TimeFormat)}, 0},
+		{"no-store", 200, []string{"Cache-Control", "max-age=60, no-store"}, 0},
+		{"no-cache", 200, []string{"Cache-Control", "no-cache, max-age=60"}, 0},
+		{"private", 200, []string{"Cache-Control", "private, max-age=60"}, 0},
+		{"no freshness", 200, []string{"Date", date}, 0},
+		{"not OK", 404, []string{"Cache-Control", "max-age=60"}, 0},
+	} {
+		if got := responseTTL(newResponse(tt.status, "", tt.header...), now); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetFromResponse(t *testing.T) {
+	for _, tc := range []interface {
+		Setter
+		GetBytes(k string) ([]byte, bool)
+	}{
+		New(DefaultExpiration, 0),
+		NewSharded(DefaultExpiration, 0, 2),
+	} {
+		resp := newResponse(200, "hello", "Cache-Control", "max-age=3600")
+		stored, ttl, err := SetFromResponse(tc, "page", resp, time.Minute)
+		if !stored || ttl != time.Minute || err != nil {
+			t.Errorf("SetFromResponse returned %v, %v, %v", stored, ttl, err)
+		}
+		if b, _ := tc.GetBytes("page"); string(b) != "hello" {
+			t.Errorf("stored %q", b)
+		}
+		if b, _ := io.ReadAll(resp.Body); string(b) != "hello" {
+			t.Errorf("resp.Body reads %q after SetFromResponse", b)
+		}
+	}
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestSetFromResponseNoStore(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	resp := newResponse(200, "secret", "Cache-Control", "no-store, max-age=60")
+	body := &closeRecorder{Reader: resp.Body}
+	resp.Body = body
+	stored, _, err := SetFromResponse(tc, "page", resp, 0)
+	if stored || err != nil {
+		t.Errorf("SetFromResponse returned %v, %v", stored, err)
+	}
+	if _, found := tc.Get("page"); found {
+		t.Error("a no-store response was stored")
+	}
+	if resp.Body != io.ReadCloser(body) || body.closed {
+		t.Error("the body of an uncacheable response was consumed")
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestSetFromResponseReadError(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	resp := newResponse(200, "", "Cache-Control", "max-age=60")
+	resp.Body = io.NopCloser(io.MultiReader(strings.NewReader("partial"), failingReader{}))
+	stored, _, err := SetFromResponse(tc, "page", resp, 0)
+	if stored || err == nil {
+		t.Errorf("SetFromResponse returned %v, %v", stored, err)
+	}
+	if _, found := tc.Get("page"); found {
+		t.Error("a partial body was stored")
+	}
+	if b, _ := io.ReadAll(resp.Body); string(b) != "partial" {
+		t.Errorf("resp.Body reads %q", b)
+	}
+}
@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidCursor is returned by Scan if the cursor wasn't returned by an
+// earlier call to Scan with the same prefix, or its scan was abandoned for
+// longer than the scan timeout (see WithScanTimeout).
+var ErrInvalidCursor = errors.New("Invalid or expired scan cursor")
+
+// The scan timeout used unless WithScanTimeout is given.
+const defaultScanTimeout = time.Minute
+
+// WithScanTimeout sets how long a scan may go without a call to Scan before its
+// cursor expires and the key snapshot it holds is released. It defaults to one
+// minute.
+func WithScanTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.scanTimeout = d
+	}
+}
+
+// The state of the scans in progress on a cache. Each scan holds a snapshot of
+// the keys in the shard it is visiting, so that each page takes time
+// proportional to its size rather than to the size of the cache.
+type scanner struct {
+	mu      sync.Mutex
+	nextID  uint64
+	scans   map[uint64]*scanState
+	timeout time.Duration
+}
+
+type scanState struct {
+	prefix string
+	shard  int
+	keys   []string // the sorted snapshot of shard's keys with the prefix
+	used   time.Time
+}
+
+// Returns the next page of at most count keys with the given prefix that
+// exist, starting at cursor. shards is the number of shards, keys returns a
+// sorted snapshot of the keys in a shard with a prefix, and exists reports
+// which of a page of keys still exist.
+//
+// A cursor holds the shard and the last key visited in it, so that the scan
+// resumes after that key even if the shard's snapshot has been made again
+// since, and holds other keys.
+func (s *scanner) scan(cursor string, count int, prefix string, shards int, keys func(shard int, prefix string) []string, exists func(shard int, ks []string) []string) ([]string, string, error) {
+	if count < 1 {
+		count = 10
+	}
+	timeout := s.timeout
+	if timeout <= 0 {
+		timeout = defaultScanTimeout
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, st := range s.scans {
+		if now.Sub(st.used) > timeout {
+			delete(s.scans, id)
+		}
+	}
+
+	var (
+		id     uint64
+		shard  int
+		offset int
+		st     *scanState
+	)
+	if cursor == "" {
+		s.nextID++
+		id = s.nextID
+		st = &scanState{prefix: prefix, keys: keys(0, prefix)}
+		if s.scans == nil {
+			s.scans = map[uint64]*scanState{}
+		}
+		s.scans[id] = st
+	} else {
+		var (
+			last string
+			err  error
+		)
+		if id, shard, last, err = parseCursor(cursor); err != nil {
+			return nil, "", err
+		}
+		st = s.scans[id]
+		if st == nil || st.prefix != prefix || shard < 0 || shard >= shards {
+			return nil, "", ErrInvalidCursor
+		}
+		if shard != st.shard {
+			// The cursor is from an earlier page than the last one
+			// returned, and has to be repeated.
+			st.shard, st.keys = shard, keys(shard, prefix)
+		}
+		offset = sort.Search(len(st.keys), func(i int) bool {
+			return st.keys[i] > last
+		})
+	}
+	st.used = now
+
+	var page []string
+	for len(page) < count {
+		if offset >= len(st.keys) {
+			st.shard++
+			if st.shard >= shards {
+				delete(s.scans, id)
+				return page, "", nil
+			}
+			st.keys, offset = keys(st.shard, prefix), 0
+			continue
+		}
+		end := offset + count - len(page)
+		if end > len(st.keys) {
+			end = len(st.keys)
+		}
+		page = append(page, exists(st.shard, st.keys[offset:end])...)
+		offset = end
+	}
+	// A page ends right after keys have been visited, so offset > 0.
+	return page, fmt.Sprintf("%x.%x.%x", id, st.shard, st.keys[offset-1]), nil
+}
+
+// Parses a cursor returned by scan into the scan's ID, the shard, and the last
+// key visited in it.
+func parseCursor(cursor string) (id uint64, shard int, last string, err error) {
+	parts := strings.SplitN(cursor, ".", 3)
+	if len(parts) != 3 {
+		return 0, 0, "", ErrInvalidCursor
+	}
+	id, err = strconv.ParseUint(parts[0], 16, 64)
+	if err != nil {
+		return 0, 0, "", ErrInvalidCursor
+	}
+	n, err := strconv.ParseUint(parts[1], 16, 31)
+	if err != nil {
+		return 0, 0, "", ErrInvalidCursor
+	}
+	b, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return 0, 0, "", ErrInvalidCursor
+	}
+	return id, int(n), string(b), nil
+}
+
+// Returns the keys in the cache with the given prefix, including expired keys,
+// in sorted order.
+func (c *cache) keysWithPrefix(prefix string) []string {
+	c.mu.RLock()
+	ks := make([]string, 0, len(c.items))
+	for k := range c.items {
+		if strings.HasPrefix(k, prefix) {
+			ks = append(ks, k)
+		}
+	}
+	c.mu.RUnlock()
+	sort.Strings(ks)
+	return ks
+}
+
+// Returns the keys in ks that are in the cache and haven't expired.
+func (c *cache) existing(ks []string) []string {
+	var res []string
+	now := c.now().UnixNano()
+	c.mu.RLock()
+	for _, k := range ks {
+		if v, found := c.items[k]; found && (v.Expiration <= 0 || now <= v.Expiration) {
+			res = append(res, k)
+		}
+	}
+	c.mu.RUnlock()
+	return res
+}
+
+// Scan returns a page of at most count (10 if count is less than one) keys
+// with the given prefix, and the cursor from which to continue, like Redis's
+// SCAN: pass an empty cursor to start a scan, and the returned cursor to get
+// the next page, until it is empty. Every key that is in the cache for the
+// whole scan is returned exactly once, and no lock is held between calls, so
+// the cache can be modified while it is scanned; keys that are set or deleted
+// during the scan may or may not be returned. A page may hold fewer than count
+// keys before the end of the scan, and may be empty.
+//
+// The first call makes a sorted snapshot of the keys with the prefix, which the
+// remaining pages are read from, so each call takes time proportional to
+// count, besides the first, which sorts the keys. The snapshot is released at
+// the end of the scan, or if no call is made for longer than the scan timeout
+// (see WithScanTimeout), after which the cursor is rejected with
+// ErrInvalidCursor.
+func (c *cache) Scan(cursor string, count int, prefix string) (keys []string, nextCursor string, err error) {
+	return c.scans.scan(cursor, count, prefix, 1, func(_ int, prefix string) []string {
+		return c.keysWithPrefix(prefix)
+	}, func(_ int, ks []string) []string {
+		return c.existing(ks)
+	})
+}
+
+// Scan returns a page of the keys in the sharded cache with the given prefix,
+// visiting one shard at a time so that only one shard's keys are held in a
+// snapshot. See the cache's Scan. Keys may be missed if the cache is reseeded
+// during the scan.
+func (sc *shardedCache) Scan(cursor string, count int, prefix string) (keys []string, nextCursor string, err error) {
+	return sc.scans.scan(cursor, count, prefix, len(sc.cs), func(i int, prefix string) []string {
+		return sc.cs[i].keysWithPrefix(prefix)
+	}, func(i int, ks []string) []string {
+		return sc.cs[i].existing(ks)
+	})
+}
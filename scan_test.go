@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type scannable interface {
+	Set(k string, x interface{}, d time.Duration)
+	Delete(k string)
+	Scan(cursor string, count int, prefix string) ([]string, string, error)
+}
+
+func scanAll(t *testing.T, s scannable, count int, prefix string) map[string]int {
+	seen := map[string]int{}
+	cursor := ""
+	for {
+		keys, next, err := s.Scan(cursor, count, prefix)
+		if err != nil {
+			t.Fatalf("Scan returned %v", err)
+		}
+		if len(keys) > count {
+			t.Fatalf("Scan returned %d keys, more than %d", len(keys), count)
+		}
+		for _, k := range keys {
+			seen[k]++
+		}
+		if next == "" {
+			return seen
+		}
+		cursor = next
+	}
+}
+
+func TestScanConcurrentMutations(t *testing.T) {
+	for name, tc := range map[string]scannable{
+		"cache":   New(DefaultExpiration, 0),
+		"sharded": NewSharded(DefaultExpiration, 0, 8),
+	} {
+		for i := 0; i < 5000; i++ {
+			tc.Set("stable"+strconv.Itoa(i), i, DefaultExpiration)
+		}
+		stop := make(chan struct{})
+		wg := new(sync.WaitGroup)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				k := "churn" + strconv.Itoa(i%1000)
+				tc.Set(k, i, DefaultExpiration)
+				tc.Delete("churn" + strconv.Itoa((i+500)%1000))
+			}
+		}()
+		seen := scanAll(t, tc, 37, "")
+		close(stop)
+		wg.Wait()
+		for i := 0; i < 5000; i++ {
+			k := "stable" + strconv.Itoa(i)
+			if n := seen[k]; n != 1 {
+				t.Fatalf("%s: %s was returned %d times", name, k, n)
+			}
+		}
+	}
+}
+
+// Repeating a page from a shard the scan has left makes a new snapshot of the
+// shard, which mustn't shift the keys that were there all along.
+func TestScanRepeatEarlierShard(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 2)
+	for i := 0; i < 100; i++ {
+		tc.Set(fmt.Sprintf("k%03d", i), i, DefaultExpiration)
+	}
+	first, cursor, err := tc.Scan("", 10, "")
+	if err != nil || cursor == "" {
+		t.Fatalf("Scan returned %q, %v", cursor, err)
+	}
+	_, shard, _, _ := parseCursor(cursor)
+	for next := cursor; ; {
+		_, next, err = tc.Scan(next, 10, "")
+		if err != nil || next == "" {
+			t.Fatalf("Scan returned %q, %v before leaving the first shard", next, err)
+		}
+		if _, s, _, _ := parseCursor(next); s != shard {
+			break
+		}
+	}
+	for i := 0; i < 20; i++ {
+		tc.Set("a"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+	seen := map[string]int{}
+	for _, k := range first {
+		seen[k]++
+	}
+	for cursor != "" {
+		var keys []string
+		if keys, cursor, err = tc.Scan(cursor, 10, ""); err != nil {
+			t.Fatalf("Scan returned %v", err)
+		}
+		for _, k := range keys {
+			seen[k]++
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if k := fmt.Sprintf("k%03d", i); seen[k] != 1 {
+			t.Errorf("%s was returned %d times", k, seen[k])
+		}
+	}
+}
+
+func TestScanPrefix(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 4)
+	for i := 0; i < 100; i++ {
+		tc.Set("user:"+strconv.Itoa(i), i, DefaultExpiration)
+		tc.Set("order:"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+	tc.Delete("user:7")
+	seen := scanAll(t, tc, 10, "user:")
+	if len(seen) != 99 {
+		t.Errorf("scan returned %d keys, not 99", len(seen))
+	}
+	if _, found := seen["user:7"]; found {
+		t.Error("deleted key was returned")
+	}
+	for k := range seen {
+		if k[:5] != "user:" {
+			t.Errorf("%s doesn't have the prefix", k)
+		}
+	}
+}
+
+func TestScanInvalidCursor(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithScanTimeout(time.Millisecond))
+	for i := 0; i < 10; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	if _, _, err := tc.Scan("bogus", 5, ""); err != ErrInvalidCursor {
+		t.Errorf("Scan with a bogus cursor returned %v", err)
+	}
+	_, next, err := tc.Scan("", 5, "")
+	if err != nil || next == "" {
+		t.Fatalf("Scan returned %q, %v", next, err)
+	}
+	if _, _, err := tc.Scan(next, 5, "other"); err != ErrInvalidCursor {
+		t.Errorf("Scan with a different prefix returned %v", err)
+	}
+
+	<-time.After(5 * time.Millisecond)
+	tc.Scan("", 5, "")
+	if _, _, err := tc.Scan(next, 5, ""); err != ErrInvalidCursor {
+		t.Errorf("Scan with an abandoned cursor returned %v", err)
+	}
+}
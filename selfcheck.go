@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"fmt"
+)
+
+// Implemented by evictors that can verify that they track exactly the keys in
+// the cache. Called with the cache's lock held.
+type checkedEvictor interface {
+	check(items map[string]Item) error
+}
+
+func (e *lruEvictor) check(items map[string]Item) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ll.Len() != len(e.elements) {
+		return fmt.Errorf("The LRU list has %d elements, but its index has %d", e.ll.Len(), len(e.elements))
+	}
+	for el := e.ll.Front(); el != nil; el = el.Next() {
+		k := el.Value.(string)
+		if e.elements[k] != el {
+			return fmt.Errorf("The LRU list's index doesn't point to the element for %s", k)
+		}
+		if _, found := items[k]; !found {
+			return fmt.Errorf("The LRU list holds %s, which isn't in the cache", k)
+		}
+	}
+	if len(e.elements) != len(items) {
+		return fmt.Errorf("The LRU list tracks %d keys, but the cache holds %d items", len(e.elements), len(items))
+	}
+	return nil
+}
+
+// SelfCheck verifies the cache's internal invariants, and returns an error
+// describing the first inconsistency it finds, or nil: that no item has a
+// negative expiration time, that the tag index used by SetWithTags and
+// InvalidateTag matches the items, that the LRU list of a cache using
+// EvictionPolicyLRU tracks exactly the cache's keys, and that the total size
+// of the items recorded for WithSizeAccounting matches the sizes recorded on
+// them. It locks the cache, and takes time proportional to the number of
+// items and tags, so it is meant for tests and occasional assertions.
+func (c *cache) SelfCheck() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var total int64
+	for k, v := range c.items {
+		if v.Expiration < 0 {
+			return fmt.Errorf("Item %s has a malformed expiration time %d", k, v.Expiration)
+		}
+		total += v.size
+	}
+	if err := c.checkTags(); err != nil {
+		return err
+	}
+	if e, ok := c.evictor.(checkedEvictor); ok {
+		if err := e.check(c.items); err != nil {
+			return err
+		}
+	}
+	if c.sizer != nil && total != c.accounted {
+		return fmt.Errorf("The accounted size is %d, but the items' sizes add up to %d", c.accounted, total)
+	}
+	return nil
+}
+
+// Verifies that c.tags and c.keyTags are inverses of each other, and only
+// refer to items in the cache. c.mu must be held.
+func (c *cache) checkTags() error {
+	n := 0
+	for k, tags := range c.keyTags {
+		if _, found := c.items[k]; !found {
+			return fmt.Errorf("Item %s has tags, but isn't in the cache", k)
+		}
+		for _, tag := range tags {
+			if _, found := c.tags[tag][k]; !found {
+				return fmt.Errorf("Item %s has tag %s, but the tag's index doesn't hold it", k, tag)
+			}
+		}
+		n += len(tags)
+	}
+	for tag, keys := range c.tags {
+		if len(keys) == 0 {
+			return fmt.Errorf("Tag %s has no items, but is still indexed", tag)
+		}
+		n -= len(keys)
+	}
+	if n != 0 {
+		return fmt.Errorf("The tag index holds %d more keys than the items' tags", -n)
+	}
+	return nil
+}
+
+// SelfCheck verifies the internal invariants of every shard, and that the
+// running count returned by ItemCount matches the number of items in the
+// shards. It returns an error describing the first inconsistency it finds, or
+// nil. See the cache's SelfCheck.
+func (sc *shardedCache) SelfCheck() error {
+	for i, c := range sc.cs {
+		if err := c.SelfCheck(); err != nil {
+			return fmt.Errorf("Shard %d: %w", i, err)
+		}
+	}
+	if count, n := sc.ItemCount(), sc.Len(); int(count) != n {
+		return fmt.Errorf("ItemCount is %d, but the shards hold %d items (drift %+d)", count, n, int(count)-n)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newSelfCheckCache() *Cache {
+	tc := NewWithOptions(
+		WithMaxItems(50),
+		WithSizeAccounting(stringSizer, func(int64) {}),
+	)
+	for i := 0; i < 200; i++ {
+		k := strconv.Itoa(i % 80)
+		switch i % 4 {
+		case 0:
+			tc.SetWithTags(k, k, time.Hour, "even", "t"+strconv.Itoa(i%3))
+		case 1:
+			tc.Set(k, "value"+k, DefaultExpiration)
+		case 2:
+			tc.Get(strconv.Itoa(i % 50))
+		case 3:
+			tc.Delete(strconv.Itoa(i % 7))
+		}
+	}
+	tc.InvalidateTag("t1")
+	return tc
+}
+
+func TestSelfCheck(t *testing.T) {
+	tc := newSelfCheckCache()
+	if err := tc.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+	tc.Flush()
+	if err := tc.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSelfCheckFindsInconsistencies(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		corrupt func(c *cache)
+		want    string
+	}{
+		{"expiration", func(c *cache) {
+			c.items["bad"] = Item{Expiration: -5}
+			c.evictor.Add("bad")
+		}, "malformed expiration"},
+		{"tagged missing item", func(c *cache) {
+			c.keyTags["ghost"] = []string{"even"}
+		}, "isn't in the cache"},
+		{"tag index", func(c *cache) {
+			for tag := range c.tags {
+				for k := range c.tags[tag] {
+					delete(c.tags[tag], k)
+					return
+				}
+			}
+		}, "tag"},
+		{"LRU list", func(c *cache) {
+			c.evictor.Remove(c.evictor.(*lruEvictor).ll.Front().Value.(string))
+		}, "LRU list"},
+		{"size", func(c *cache) {
+			c.accounted++
+		}, "accounted size"},
+	} {
+		tc := newSelfCheckCache()
+		tc.mu.Lock()
+		tt.corrupt(tc.cache)
+		tc.mu.Unlock()
+		if err := tc.SelfCheck(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: SelfCheck returned %v", tt.name, err)
+		}
+	}
+}
+
+func TestShardedSelfCheck(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 4)
+	for i := 0; i < 20; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	if err := tc.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Overwriting items, and flushing, keeps the count in step.
+	tc.Set("0", 0, DefaultExpiration)
+	tc.SetDefault("1", 1)
+	tc.SetWithCost("2", 2, DefaultExpiration, time.Second)
+	if err := tc.SetWithTags("3", 3, DefaultExpiration, "odd"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.Add("4", 4, DefaultExpiration); err == nil {
+		t.Error("Add of an existing key succeeded")
+	}
+	if err := tc.Add("new", 0, DefaultExpiration); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.Replace("5", 5, DefaultExpiration); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+	if n := tc.ItemCount(); n != 21 {
+		t.Errorf("ItemCount is %d, want 21", n)
+	}
+	tc.Flush()
+	if err := tc.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+	if n := tc.ItemCount(); n != 0 {
+		t.Errorf("ItemCount is %d after Flush, want 0", n)
+	}
+
+	tc.Set("0", 0, DefaultExpiration)
+	atomic.AddUint32(&tc.count, 1)
+	if err := tc.SelfCheck(); err == nil || !strings.Contains(err.Error(), "drift +1") {
+		t.Errorf("SelfCheck returned %v", err)
+	}
+
+	tc = NewShardedLRU(DefaultExpiration, 0, 2, 5)
+	for i := 0; i < 20; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	if err := tc.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+	c := tc.bucket("1")
+	c.mu.Lock()
+	c.items["ghost"] = Item{}
+	c.mu.Unlock()
+	if err := tc.SelfCheck(); err == nil || !strings.HasPrefix(err.Error(), "Shard ") {
+		t.Errorf("SelfCheck returned %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package cache
+
+import "time"
+
+// SetAt adds an item to the cache, replacing any existing item, that expires
+// at the time expireAt rather than after a duration. If expireAt is the zero
+// Time, the item never expires. If expireAt has already passed, the item is
+// stored expired: it is never returned, and is removed by the next
+// DeleteExpired.
+func (c *cache) SetAt(k string, x interface{}, expireAt time.Time) {
+	c.SetManyAt(map[string]interface{}{k: x}, expireAt)
+}
+
+// SetManyAt adds all of items to the cache, replacing any existing items, with
+// the same expiration time expireAt, under a single lock. See SetAt.
+func (c *cache) SetManyAt(items map[string]interface{}, expireAt time.Time) {
+	compressed := make(map[string]interface{}, len(items))
+	for k, x := range items {
+		compressed[k] = c.compress(x)
+	}
+	var evictedItems []keyAndValue
+	c.mu.Lock()
+	e, d := int64(0), NoExpiration
+	if !expireAt.IsZero() {
+		e = expireAt.UnixNano()
+		d = time.Duration(e - c.now().UnixNano())
+	}
+	for k, x := range compressed {
+		if c.tombstoned(k) {
+			continue
+		}
+		evictedItems = append(evictedItems, c.setExpiring(k, x, e, d)...)
+	}
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+}
+
+// SetAt adds an item that expires at expireAt to the shard owning k. See the
+// cache's SetAt.
+func (sc *shardedCache) SetAt(k string, x interface{}, expireAt time.Time) {
+	sc.SetManyAt(map[string]interface{}{k: x}, expireAt)
+}
+
+// SetManyAt adds all of items to the cache with the same expiration time
+// expireAt, locking each shard once. See the cache's SetManyAt.
+func (sc *shardedCache) SetManyAt(items map[string]interface{}, expireAt time.Time) {
+	byShard := make(map[*cache]map[string]interface{})
+	for k, x := range items {
+		c := sc.bucket(k)
+		m := byShard[c]
+		if m == nil {
+			m = map[string]interface{}{}
+			byShard[c] = m
+		}
+		m[k] = x
+	}
+	for c, m := range byShard {
+		c.SetManyAt(m, expireAt)
+	}
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSetManyAt(t *testing.T) {
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := New(time.Minute, 0, WithClock(clk))
+	at := time.Unix(200, 0)
+	tc.SetManyAt(map[string]interface{}{"a": 1, "b": 2, "c": 3}, at)
+	for _, k := range []string{"a", "b", "c"} {
+		if e := tc.items[k].Expiration; e != at.UnixNano() {
+			t.Errorf("%s: got expiration %d, want %d", k, e, at.UnixNano())
+		}
+	}
+	clk.Advance(100 * time.Second)
+	if v, found := tc.Get("b"); !found || v != 2 {
+		t.Errorf("got (%v, %v) at the expiration time, want (2, true)", v, found)
+	}
+	clk.Advance(time.Nanosecond)
+	if _, found := tc.Get("b"); found {
+		t.Error("b was found after its expiration time")
+	}
+}
+
+func TestSetAt(t *testing.T) {
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := New(time.Minute, 0, WithClock(clk))
+	tc.SetAt("forever", 1, time.Time{})
+	if e := tc.items["forever"].Expiration; e != 0 {
+		t.Errorf("got expiration %d for the zero time, want 0", e)
+	}
+	tc.SetAt("past", 1, time.Unix(50, 0))
+	if _, found := tc.Get("past"); found {
+		t.Error("item set to expire in the past was found")
+	}
+	if n := tc.DeleteExpired(); n != 1 {
+		t.Errorf("deleted %d items, want 1", n)
+	}
+}
+
+func TestSetManyAtWriteCoalescing(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithWriteCoalescing(time.Hour))
+	defer tc.Close()
+	tc.Set("a", "old", DefaultExpiration)
+	tc.Set("b", "old", DefaultExpiration)
+	tc.SetManyAt(map[string]interface{}{"a": "new", "b": "new"}, time.Time{})
+	tc.commitPending(false)
+	for _, k := range []string{"a", "b"} {
+		if v, found := tc.Get(k); !found || v != "new" {
+			t.Errorf("%s: got (%v, %v), want (new, true): the buffered Set was stored over SetManyAt", k, v, found)
+		}
+	}
+}
+
+func TestShardedSetManyAt(t *testing.T) {
+	tc := NewShardedWithOptions(WithShards(4))
+	tc.Set("k0", "old", DefaultExpiration)
+	items := map[string]interface{}{}
+	for i := 0; i < 10; i++ {
+		items["k"+strconv.Itoa(i)] = i
+	}
+	at := time.Now().Add(time.Hour)
+	tc.SetManyAt(items, at)
+	if n := tc.ItemCount(); n != 10 {
+		t.Errorf("got item count %d, want 10", n)
+	}
+	for k, want := range items {
+		if v, found := tc.Get(k); !found || v != want {
+			t.Errorf("%s: got (%v, %v), want (%v, true)", k, v, found, want)
+		}
+		if e := tc.bucket(k).items[k].Expiration; e != at.UnixNano() {
+			t.Errorf("%s: got expiration %d, want %d", k, e, at.UnixNano())
+		}
+	}
+	tc.SetAt("k1", "new", at)
+	if n := tc.ItemCount(); n != 10 {
+		t.Errorf("got item count %d after overwriting, want 10", n)
+	}
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"sort"
+	"time"
+)
+
+// SetManyReport adds all of items to the cache, replacing any existing items,
+// for the duration d (see Set), under a single lock, and returns the keys that
+// had no unexpired item, and those whose item was replaced, in sorted order.
+// As both are decided while the lock is held, they are accurate even if other
+// goroutines set or delete the same keys, unlike checking the keys with Has
+// beforehand.
+func (c *cache) SetManyReport(items map[string]interface{}, d time.Duration) (created, updated []string) {
+	if c.coalescer != nil {
+		// Store the buffered writes, so that their keys are reported as
+		// updated.
+		c.commitPending(false)
+	}
+	compressed := make(map[string]interface{}, len(items))
+	for k, x := range items {
+		compressed[k] = c.compress(x)
+	}
+	var evictedItems []keyAndValue
+	c.mu.Lock()
+	for k, x := range compressed {
+		if c.tombstoned(k) {
+			continue
+		}
+		if item, found := c.items[k]; found && !c.expired(item) {
+			updated = append(updated, k)
+		} else {
+			created = append(created, k)
+		}
+		evictedItems = append(evictedItems, c.set(k, x, d)...)
+	}
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+	sort.Strings(created)
+	sort.Strings(updated)
+	return created, updated
+}
+
+// SetManyReport adds all of items to the cache, locking each shard once, and
+// returns the keys that were created and those that were updated across all
+// shards. See the cache's SetManyReport.
+func (sc *shardedCache) SetManyReport(items map[string]interface{}, d time.Duration) (created, updated []string) {
+	byShard := make(map[*cache]map[string]interface{})
+	for k, x := range items {
+		c := sc.bucket(k)
+		m := byShard[c]
+		if m == nil {
+			m = map[string]interface{}{}
+			byShard[c] = m
+		}
+		m[k] = x
+	}
+	for c, m := range byShard {
+		cr, up := c.SetManyReport(m, d)
+		created = append(created, cr...)
+		updated = append(updated, up...)
+	}
+	sort.Strings(created)
+	sort.Strings(updated)
+	return created, updated
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSetManyReport(t *testing.T) {
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := New(DefaultExpiration, 0, WithClock(clk))
+	tc.Set("a", 1, NoExpiration)
+	tc.Set("expired", 2, time.Second)
+	clk.Advance(2 * time.Second)
+
+	created, updated := tc.SetManyReport(map[string]interface{}{
+		"a":       10,
+		"b":       20,
+		"expired": 30,
+	}, DefaultExpiration)
+	if want := []string{"b", "expired"}; !reflect.DeepEqual(created, want) {
+		t.Errorf("created %v, want %v", created, want)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(updated, want) {
+		t.Errorf("updated %v, want %v", updated, want)
+	}
+	for k, want := range map[string]int{"a": 10, "b": 20, "expired": 30} {
+		if x, found := tc.Get(k); !found || x.(int) != want {
+			t.Errorf("%s is %v, %v, want %d", k, x, found, want)
+		}
+	}
+}
+
+func TestShardedSetManyReport(t *testing.T) {
+	tc := NewShardedWithOptions(WithShards(4))
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("c", 3, DefaultExpiration)
+	created, updated := tc.SetManyReport(map[string]interface{}{
+		"a": 10, "b": 20, "c": 30, "d": 40, "e": 50,
+	}, DefaultExpiration)
+	if want := []string{"b", "d", "e"}; !reflect.DeepEqual(created, want) {
+		t.Errorf("created %v, want %v", created, want)
+	}
+	if want := []string{"a", "c"}; !reflect.DeepEqual(updated, want) {
+		t.Errorf("updated %v, want %v", updated, want)
+	}
+	if n := tc.ItemCount(); n != 5 {
+		t.Errorf("ItemCount is %d, not 5", n)
+	}
+}
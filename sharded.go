@@ -2,10 +2,11 @@ package cache
 
 import (
 	"crypto/rand"
+	"fmt"
+	"io"
 	"math"
 	"math/big"
 	insecurerand "math/rand"
-	"os"
 	"runtime"
 	"sync/atomic"
 	"time"
@@ -24,12 +25,13 @@ type ShardedCache struct {
 }
 
 type shardedCache struct {
-	seed      uint32
-	m         uint32
-	count     uint32
-	onEvicted func(string, interface{})
-	cs        []*cache
-	janitor   *shardedJanitor
+	seed    uint32
+	m       uint32
+	count   uint32
+	cs      []*cache
+	janitor *Janitor
+	scans   scanner
+	name    string
 }
 
 // djb2 with better shuffling. 5x faster than FNV with the hash.Hash overhead.
@@ -65,17 +67,147 @@ func djb33(seed uint32, k string) uint32 {
 }
 
 func (sc *shardedCache) bucket(k string) *cache {
-	return sc.cs[djb33(sc.seed, k)%sc.m]
+	return sc.cs[djb33(atomic.LoadUint32(&sc.seed), k)%sc.m]
 }
+
+// NumShards returns the number of shards (buckets) in the cache.
+func (sc *shardedCache) NumShards() int {
+	return int(sc.m)
+}
+
+// ShardFor returns the index of the shard that the given key maps to.
+func (sc *shardedCache) ShardFor(k string) int {
+	return int(djb33(atomic.LoadUint32(&sc.seed), k) % sc.m)
+}
+
+// Seed returns the seed used to map keys to shards. A cache created using
+// NewShardedSeeded with the same seed and number of shards maps every key to
+// the same shard, e.g. to reproduce an uneven distribution.
+func (sc *shardedCache) Seed() uint32 {
+	return atomic.LoadUint32(&sc.seed)
+}
+
+// Reseed changes the seed used to map keys to shards, and moves every item to
+// the shard its key now maps to. All shards are locked while the items are
+// moved, so this is expensive for a large cache. Items lose their tags.
+//
+// Seed may be called concurrently with Reseed, but other operations may not:
+// an item set while the cache is being reseeded may be stored in the wrong
+// shard and become unreachable.
+func (sc *shardedCache) Reseed(seed uint32) {
+	for _, c := range sc.cs {
+		c.mu.Lock()
+	}
+	old := make([]map[string]Item, len(sc.cs))
+	var (
+		spilled []map[string]int64
+		pinned  []map[string]*pinEntry
+	)
+	for i, c := range sc.cs {
+		old[i] = c.items
+		c.unaccountAll(c.items)
+		c.uncount(len(c.items))
+		c.items = map[string]Item{}
+		if c.pinned != nil {
+			pinned = append(pinned, c.pinned)
+			c.pinned = nil
+		}
+		c.tags = nil
+		c.keyTags = nil
+		if c.evictor != nil {
+			c.evictor.Reset()
+		}
+		if c.disk != nil {
+			spilled = append(spilled, c.disk.index)
+			c.disk.index = map[string]int64{}
+		}
+	}
+	atomic.StoreUint32(&sc.seed, seed)
+	// Pins move before the items, so that pinned items aren't evicted to
+	// make room in their new shards. Paused expirations are resumed for the
+	// move, and paused again when the items are stored.
+	now := sc.cs[0].now().UnixNano()
+	for _, m := range pinned {
+		for k, p := range m {
+			c := sc.bucket(k)
+			if c.pinned == nil {
+				c.pinned = map[string]*pinEntry{}
+			}
+			c.pinned[k] = p
+		}
+	}
+	evictedItems := make([][]keyAndValue, len(sc.cs))
+	for _, m := range old {
+		for k, v := range m {
+			i := sc.ShardFor(k)
+			v = sc.cs[i].withPausedExpiration(k, v, now)
+			evictedItems[i] = append(evictedItems[i], sc.cs[i].loadItem(k, v)...)
+		}
+	}
+	// Spilled items' files are named after their keys, so only the index
+	// needs to move.
+	for _, m := range spilled {
+		for k, e := range m {
+			sc.bucket(k).disk.index[k] = e
+		}
+	}
+	for _, c := range sc.cs {
+		if c.bloom.Load() != nil {
+			c.rebuildBloom()
+		}
+		c.mu.Unlock()
+	}
+	for i, c := range sc.cs {
+		c.notifyEvicted(evictedItems[i])
+	}
+}
+
+// ShardItems copies all unexpired items in shard i into a new map and returns
+// it. Only the requested shard is copied. Returns nil if i is out of range.
+func (sc *shardedCache) ShardItems(i int) map[string]Item {
+	if i < 0 || i >= len(sc.cs) {
+		return nil
+	}
+	return sc.cs[i].Items()
+}
+
+// CloneShard copies all unexpired items in shard i into a new map while holding
+// only that shard's read lock, for offline analysis. Unlike ShardItems, the
+// values are always copied: using the cloner set with WithValueCloner or
+// WithImmutableValues, or CloneValue if there is none, so the result can be
+// inspected without racing with later writes to them. As CloneValue returns
+// structs as they are, pointers, maps and slices in their fields stay shared
+// unless the values implement Cloner. Returns an error if i is out of range.
+func (sc *shardedCache) CloneShard(i int) (map[string]Item, error) {
+	if i < 0 || i >= len(sc.cs) {
+		return nil, fmt.Errorf("Shard %d is out of range [0, %d)", i, len(sc.cs))
+	}
+	c := sc.cs[i]
+	m := map[string]Item{}
+	c.itemsFunc(func(k string, v Item) bool {
+		if c.cloner == nil {
+			// itemsFunc has only copied the value if there is a cloner.
+			v.Object = CloneValue(v.Object)
+		}
+		m[k] = v
+		return true
+	})
+	return m, nil
+}
+
 func (sc *shardedCache) SetDefault(k string, x interface{}) {
 	c := sc.bucket(k)
 	c.Set(k, x, c.defaultExpiration)
-	atomic.AddUint32(&sc.count, 1)
 }
 func (sc *shardedCache) Set(k string, x interface{}, d time.Duration) {
 	c := sc.bucket(k)
 	c.Set(k, x, d)
-	atomic.AddUint32(&sc.count, 1)
+}
+
+// SetIfNewer sets an item in the shard owning k only if it is newer than the
+// existing item. See the cache's SetIfNewer.
+func (sc *shardedCache) SetIfNewer(k string, x interface{}, ts time.Time, d time.Duration) bool {
+	return sc.bucket(k).SetIfNewer(k, x, ts, d)
 }
 
 func (sc *shardedCache) SetRenew(k string, x interface{}, d time.Duration) {
@@ -84,29 +216,56 @@ func (sc *shardedCache) SetRenew(k string, x interface{}, d time.Duration) {
 }
 
 func (sc *shardedCache) Add(k string, x interface{}, d time.Duration) error {
-	c := sc.bucket(k)
-	if sc.onEvicted != nil {
-		c.OnEvicted(sc.onEvicted)
-	}
-	return c.Add(k, x, d)
+	return sc.bucket(k).Add(k, x, d)
 }
 
 func (sc *shardedCache) Replace(k string, x interface{}, d time.Duration) error {
-	c := sc.bucket(k)
-	if sc.onEvicted != nil {
-		c.OnEvicted(sc.onEvicted)
-	}
-	return c.Replace(k, x, d)
+	return sc.bucket(k).Replace(k, x, d)
 }
 
 func (sc *shardedCache) Get(k string) (interface{}, bool) {
 	return sc.bucket(k).Get(k)
 }
 
+// GetOrdered gets the items with the given keys from the cache, in the same
+// order as keys. See the cache's GetOrdered. Each shard is read-locked once,
+// but the results are not a consistent snapshot across shards.
+func (sc *shardedCache) GetOrdered(keys []string) []Result {
+	var (
+		byShard = map[*cache][]int{}
+		order   []*cache
+	)
+	for i, k := range keys {
+		c := sc.bucket(k)
+		if _, found := byShard[c]; !found {
+			order = append(order, c)
+		}
+		byShard[c] = append(byShard[c], i)
+	}
+	res := make([]Result, len(keys))
+	for _, c := range order {
+		idx := byShard[c]
+		ks := make([]string, len(idx))
+		for j, i := range idx {
+			ks[j] = keys[i]
+		}
+		for j, r := range c.GetOrdered(ks) {
+			res[idx[j]] = r
+		}
+	}
+	return res
+}
+
 func (sc *shardedCache) Increment(k string, n int64) error {
 	return sc.bucket(k).Increment(k, n)
 }
 
+// IncrementReturn increments an item in the shard owning k and returns its new
+// value. See the cache's IncrementReturn.
+func (sc *shardedCache) IncrementReturn(k string, n int64) (int64, error) {
+	return sc.bucket(k).IncrementReturn(k, n)
+}
+
 func (sc *shardedCache) IncrementFloat(k string, n float64) error {
 	return sc.bucket(k).IncrementFloat(k, n)
 }
@@ -117,21 +276,58 @@ func (sc *shardedCache) Decrement(k string, n int64) error {
 
 func (sc *shardedCache) Delete(k string) {
 	sc.bucket(k).Delete(k)
-	atomic.AddUint32(&sc.count, ^uint32(0))
+}
 
+// DeleteAndGet deletes an item from the shard owning k and returns the value it
+// held. See the cache's DeleteAndGet.
+func (sc *shardedCache) DeleteAndGet(k string) (interface{}, bool) {
+	return sc.bucket(k).DeleteAndGet(k)
 }
 
 func (sc *shardedCache) DeleteExpired() {
+	sc.deleteExpired(true)
+}
+
+// Deletes expired items from every shard, or, if all is false, only from the
+// shards that have held an item with an expiration time since they were last
+// swept, skipping those that hold only items that never expire. The janitor
+// uses the latter.
+func (sc *shardedCache) deleteExpired(all bool) {
 	for _, v := range sc.cs {
-		count := v.DeleteExpired()
-		if count > 0 {
-			atomic.AddUint32(&sc.count, ^uint32(count-1))
+		if !all && !v.mayExpire.Load() {
+			continue
 		}
+		v.DeleteExpired()
 	}
 }
 
+// DeleteExpiredReturn deletes all expired items from every shard and returns
+// their keys and values. See the cache's DeleteExpiredReturn.
+func (sc *shardedCache) DeleteExpiredReturn() []KV {
+	var kvs []KV
+	for _, v := range sc.cs {
+		r := v.DeleteExpiredReturn()
+		if len(r) > 0 {
+			kvs = append(kvs, r...)
+		}
+	}
+	return kvs
+}
+
+// Sets an (optional) function that is called with the key and value when an
+// item is evicted from any shard. See the cache's OnEvicted.
 func (sc *shardedCache) OnEvicted(f func(string, interface{})) {
-	sc.onEvicted = f
+	for _, c := range sc.cs {
+		c.OnEvicted(f)
+	}
+}
+
+// Sets the Logger used by all shards to report recovered panics in
+// user-supplied callbacks. Set to nil to restore the default.
+func (sc *shardedCache) SetLogger(l Logger) {
+	for _, v := range sc.cs {
+		v.SetLogger(l)
+	}
 }
 
 // Returns the items in the cache. This may include items that have expired,
@@ -147,80 +343,174 @@ func (sc *shardedCache) Items() []map[string]Item {
 	return res
 }
 
+// ItemsFunc calls f for each unexpired item in the cache, visiting one shard at
+// a time. Unlike Items, no maps are copied: each shard is read-locked only while
+// its entries are being visited. Iteration stops early if f returns false.
+//
+// f is called while a shard's read lock is held, so it must not modify the
+// cache. The visited items are not a consistent snapshot across shards.
+func (sc *shardedCache) ItemsFunc(f func(k string, v Item) bool) {
+	for _, c := range sc.cs {
+		if !c.itemsFunc(f) {
+			return
+		}
+	}
+}
+
+// ItemsInto copies all unexpired items in the cache into dst, which is emptied
+// first, so that the same map can be reused across calls to amortize
+// allocations.
+func (sc *shardedCache) ItemsInto(dst map[string]Item) {
+	for k := range dst {
+		delete(dst, k)
+	}
+	sc.ItemsFunc(func(k string, v Item) bool {
+		dst[k] = v
+		return true
+	})
+}
+
 func (sc *shardedCache) ItemCount() uint32 {
 	return atomic.LoadUint32(&sc.count)
 }
 
+// Len returns the number of items in all shards as an int. It is computed from
+// the shards themselves rather than the running count, so it can't drift. This
+// may include items that have expired, but have not yet been cleaned up.
+func (sc *shardedCache) Len() int {
+	n := 0
+	for _, v := range sc.cs {
+		n += v.Len()
+	}
+	return n
+}
+
 func (sc *shardedCache) Flush() {
 	for _, v := range sc.cs {
 		v.Flush()
-		atomic.AddUint32(&sc.count, ^uint32(0))
 	}
 }
 
-type shardedJanitor struct {
-	Interval time.Duration
-	stop     chan bool
+// Pin pins the item with the given key in the shard owning it. See the cache's
+// Pin.
+func (sc *shardedCache) Pin(k string) bool {
+	return sc.bucket(k).Pin(k)
 }
 
-func (j *shardedJanitor) Run(sc *shardedCache) {
-	j.stop = make(chan bool)
-	tick := time.Tick(j.Interval)
-	for {
-		select {
-		case <-tick:
-			sc.DeleteExpired()
+// Unpin removes a pin added by Pin. See the cache's Unpin.
+func (sc *shardedCache) Unpin(k string) bool {
+	return sc.bucket(k).Unpin(k)
+}
 
-		case <-j.stop:
-			return
-		}
+// PinnedCount returns the number of pinned keys in all shards.
+func (sc *shardedCache) PinnedCount() int {
+	n := 0
+	for _, c := range sc.cs {
+		n += c.PinnedCount()
 	}
+	return n
 }
 
 func stopShardedJanitor(sc *ShardedCache) {
-	sc.janitor.stop <- true
+	sc.janitor.Stop()
 }
 
 func runShardedJanitor(sc *shardedCache, ci time.Duration) {
-	j := &shardedJanitor{
-		Interval: ci,
+	var opts []JanitorOption
+	if r := sc.cs[0].reaper; r != nil {
+		opts = append(opts, WithJanitorReaper(r))
 	}
-	sc.janitor = j
-	go j.Run(sc)
+	sc.janitor = NewJanitor(ci, func() {
+		sc.deleteExpired(false)
+	}, opts...)
+	sc.janitor.goroutines = sc.cs[0].goroutines
+	sc.janitor.Start()
 }
 
-func newShardedCache(n int, de time.Duration) *shardedCache {
+// The source of the seeds chosen by randomSeed. Replaced in tests.
+var seedReader io.Reader = rand.Reader
+
+func randomSeed(l Logger) uint32 {
 	max := big.NewInt(0).SetUint64(uint64(math.MaxUint32))
-	rnd, err := rand.Int(rand.Reader, max)
-	var seed uint32
+	rnd, err := rand.Int(seedReader, max)
 	if err != nil {
-		os.Stderr.Write([]byte("WARNING: go-cache's newShardedCache failed to read from the system CSPRNG (/dev/urandom or equivalent.) Your system's security may be compromised. Continuing with an insecure seed.\n"))
-		seed = insecurerand.Uint32()
-	} else {
-		seed = uint32(rnd.Uint64())
+		loggerOrDefault(l).Printf("WARNING: go-cache's newShardedCache failed to read from the system CSPRNG (/dev/urandom or equivalent.) Your system's security may be compromised. Continuing with an insecure seed.")
+		return insecurerand.Uint32()
 	}
+	return uint32(rnd.Uint64())
+}
+
+func newShardedCache(n int, seed uint32, de time.Duration, o *options) *shardedCache {
 	sc := &shardedCache{
 		seed: seed,
 		m:    uint32(n),
 		cs:   make([]*cache, n),
+		name: o.name,
 	}
+	sc.scans.timeout = o.scanTimeout
 	for i := 0; i < n; i++ {
 		c := &cache{
 			defaultExpiration: de,
 			items:             map[string]Item{},
+			shardCount:        &sc.count,
 		}
+		o.apply(c)
 		sc.cs[i] = c
 	}
 	return sc
 }
 
-// NewSharded sc
-func NewSharded(defaultExpiration, cleanupInterval time.Duration, shards int) *ShardedCache {
-	if defaultExpiration == 0 {
-		defaultExpiration = -1
-	}
-	sc := newShardedCache(shards, defaultExpiration)
-	atomic.StoreUint32(&sc.count, 0)
+// NewShardedLRU returns a new sharded cache like NewSharded in which each shard
+// holds at most maxItemsPerShard items, evicting its least recently used item
+// (and passing it to the OnEvicted function, if any, with
+// EvictionReasonCapacity) to make room for another. If maxItemsPerShard is less
+// than one, the shards are unbounded. It panics if shards is less than one.
+//
+// Each shard keeps its own LRU list, so eviction never locks more than one
+// shard, but it is only approximately LRU across the whole cache: the item
+// evicted is the least recently used in the shard the new key maps to, which
+// may have been used more recently than items in other shards. Likewise, the
+// cache can hold up to shards*maxItemsPerShard items, but a shard can fill up
+// and evict while others have room.
+func NewShardedLRU(defaultExpiration, cleanupInterval time.Duration, shards, maxItemsPerShard int, opts ...Option) *ShardedCache {
+	mustHaveShards("NewShardedLRU", shards)
+	return NewShardedWithOptions(withOptions(opts,
+		WithDefaultExpiration(defaultExpiration),
+		WithCleanupInterval(cleanupInterval),
+		WithShards(shards),
+		WithMaxItems(maxItemsPerShard),
+		WithEvictionPolicy(EvictionPolicyLRU))...)
+}
+
+// NewSharded returns a new cache split into the given number of shards, each
+// with its own lock, with the given default expiration and cleanup interval
+// (see New). It panics if shards is less than one; NewShardedE returns an error
+// instead.
+func NewSharded(defaultExpiration, cleanupInterval time.Duration, shards int, opts ...Option) *ShardedCache {
+	mustHaveShards("NewSharded", shards)
+	return NewShardedWithOptions(withOptions(opts,
+		WithDefaultExpiration(defaultExpiration),
+		WithCleanupInterval(cleanupInterval),
+		WithShards(shards))...)
+}
+
+// NewShardedSeeded is like NewSharded, but uses the given seed to map keys to
+// shards instead of a random one, so that the distribution of keys can be
+// reproduced. See Seed.
+//
+// A random seed makes it hard for an attacker who controls the keys to make
+// them all map to the same shard, so a seed that may be known to one shouldn't
+// be used with untrusted keys.
+func NewShardedSeeded(defaultExpiration, cleanupInterval time.Duration, shards int, seed uint32, opts ...Option) *ShardedCache {
+	mustHaveShards("NewShardedSeeded", shards)
+	return NewShardedWithOptions(withOptions(opts,
+		WithDefaultExpiration(defaultExpiration),
+		WithCleanupInterval(cleanupInterval),
+		WithShards(shards),
+		WithShardSeed(seed))...)
+}
+
+func newShardedCacheWithJanitor(sc *shardedCache, cleanupInterval time.Duration) *ShardedCache {
 	SC := &ShardedCache{sc}
 	if cleanupInterval > 0 {
 		runShardedJanitor(sc, cleanupInterval)
@@ -83,3 +83,456 @@ func benchmarkShardedCacheGetManyConcurrent(b *testing.B, exp time.Duration) {
 	b.StartTimer()
 	wg.Wait()
 }
+
+func TestShardedCacheLen(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	for _, v := range shardedKeys {
+		tc.Set(v, "value", DefaultExpiration)
+	}
+	if n := tc.Len(); n != len(shardedKeys) {
+		t.Errorf("Len is not %d: %d", len(shardedKeys), n)
+	}
+	tc.Delete("missing")
+	if n := tc.Len(); n != len(shardedKeys) {
+		t.Errorf("Len changed after deleting a missing key: %d", n)
+	}
+}
+
+func TestShardFor(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	if n := tc.NumShards(); n != 13 {
+		t.Fatalf("NumShards is not 13: %d", n)
+	}
+	for _, v := range shardedKeys {
+		tc.Set(v, "value", DefaultExpiration)
+	}
+	for _, v := range shardedKeys {
+		i := tc.ShardFor(v)
+		if i < 0 || i >= tc.NumShards() {
+			t.Fatalf("ShardFor(%q) returned out of range shard %d", v, i)
+		}
+		if _, found := tc.ShardItems(i)[v]; !found {
+			t.Errorf("%q was not found in shard %d", v, i)
+		}
+	}
+	if m := tc.ShardItems(-1); m != nil {
+		t.Error("ShardItems(-1) returned a non-nil map")
+	}
+	if m := tc.ShardItems(tc.NumShards()); m != nil {
+		t.Error("ShardItems(NumShards()) returned a non-nil map")
+	}
+}
+
+func TestShardedItemsFunc(t *testing.T) {
+	clk := &manualClock{t: time.Unix(1000, 0)}
+	tc := NewSharded(DefaultExpiration, 0, 13, WithClock(clk))
+	for _, v := range shardedKeys {
+		tc.Set(v, "value", DefaultExpiration)
+	}
+	tc.Set("expired", "value", 1*time.Millisecond)
+	clk.Advance(5 * time.Millisecond)
+
+	seen := map[string]bool{}
+	tc.ItemsFunc(func(k string, v Item) bool {
+		if seen[k] {
+			t.Errorf("%q visited twice", k)
+		}
+		seen[k] = true
+		return true
+	})
+	if len(seen) != len(shardedKeys) {
+		t.Errorf("visited %d items, not %d", len(seen), len(shardedKeys))
+	}
+	if seen["expired"] {
+		t.Error("ItemsFunc visited an expired item")
+	}
+
+	n := 0
+	tc.ItemsFunc(func(k string, v Item) bool {
+		n++
+		return n < 3
+	})
+	if n != 3 {
+		t.Errorf("ItemsFunc did not stop early; visited %d items", n)
+	}
+}
+
+func TestShardedItemsInto(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	for _, v := range shardedKeys {
+		tc.Set(v, "value", DefaultExpiration)
+	}
+	dst := map[string]Item{"stale": {Object: 1}}
+	tc.ItemsInto(dst)
+	if len(dst) != len(shardedKeys) {
+		t.Errorf("dst has %d items, not %d", len(dst), len(shardedKeys))
+	}
+	if _, found := dst["stale"]; found {
+		t.Error("ItemsInto did not empty dst first")
+	}
+	for _, v := range shardedKeys {
+		if dst[v].Object != "value" {
+			t.Errorf("%q is missing from dst", v)
+		}
+	}
+}
+
+func BenchmarkShardedExportItems(b *testing.B) {
+	tc := benchmarkShardedExportCache()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n := 0
+		for _, m := range tc.Items() {
+			n += len(m)
+		}
+	}
+}
+
+func BenchmarkShardedExportItemsFunc(b *testing.B) {
+	tc := benchmarkShardedExportCache()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n := 0
+		tc.ItemsFunc(func(k string, v Item) bool {
+			n++
+			return true
+		})
+	}
+}
+
+func BenchmarkShardedExportItemsInto(b *testing.B) {
+	tc := benchmarkShardedExportCache()
+	dst := make(map[string]Item, 100000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tc.ItemsInto(dst)
+	}
+}
+
+func benchmarkShardedExportCache() *ShardedCache {
+	tc := NewSharded(NoExpiration, 0, 128)
+	for i := 0; i < 100000; i++ {
+		tc.Set("foo"+strconv.Itoa(i), "bar", DefaultExpiration)
+	}
+	return tc
+}
+
+func TestShardedDeleteMissing(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	tc.Set("foo", "bar", DefaultExpiration)
+	tc.Delete("missing")
+	tc.Delete("missing")
+	if n := tc.ItemCount(); n != 1 {
+		t.Errorf("ItemCount is %d after deleting missing keys, not 1", n)
+	}
+	tc.Delete("foo")
+	tc.Delete("foo")
+	if n := tc.ItemCount(); n != 0 {
+		t.Errorf("ItemCount is %d after deleting foo twice, not 0", n)
+	}
+}
+
+func TestShardedDeleteAndGet(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	tc.Set("foo", "bar", DefaultExpiration)
+	x, found := tc.DeleteAndGet("foo")
+	if !found || x != "bar" {
+		t.Fatalf("got (%v, %v), want (bar, true)", x, found)
+	}
+	if _, found := tc.DeleteAndGet("foo"); found {
+		t.Error("foo was found twice")
+	}
+	if n := tc.ItemCount(); n != 0 {
+		t.Errorf("got item count %d, want 0", n)
+	}
+}
+
+func TestShardedCloneShard(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 4)
+	b := []byte("bar")
+	tc.Set("foo", b, DefaultExpiration)
+	tc.Set("baz", 1, DefaultExpiration)
+	m, err := tc.CloneShard(tc.ShardFor("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[0] = 'c'
+	if v := m["foo"].Object.([]byte); string(v) != "bar" {
+		t.Errorf("cloned value is %q: it shares memory with the cache", v)
+	}
+	nested := map[string][]int{"a": {1}}
+	tc.Set("nested", nested, DefaultExpiration)
+	m, _ = tc.CloneShard(tc.ShardFor("nested"))
+	nested["a"][0] = 2
+	if v := m["nested"].Object.(map[string][]int); v["a"][0] != 1 {
+		t.Errorf("cloned value is %v: it shares memory with the cache", v)
+	}
+	total := 0
+	for i := 0; i < tc.NumShards(); i++ {
+		m, _ := tc.CloneShard(i)
+		total += len(m)
+	}
+	if total != 3 {
+		t.Errorf("shards hold %d items in total, not 3", total)
+	}
+	for _, i := range []int{-1, tc.NumShards()} {
+		if _, err := tc.CloneShard(i); err == nil {
+			t.Errorf("CloneShard(%d) didn't return an error", i)
+		}
+	}
+}
+
+func TestShardedCloneShardUsesCloner(t *testing.T) {
+	tc := NewShardedWithOptions(WithShards(2), WithValueCloner(func(x interface{}) interface{} {
+		return "copy"
+	}))
+	tc.Set("foo", "bar", DefaultExpiration)
+	m, err := tc.CloneShard(tc.ShardFor("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := m["foo"].Object; v != "copy" {
+		t.Errorf("cloned value is %v, not the cloner's copy", v)
+	}
+}
+
+func TestShardedSetIfNewer(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	now := time.Now()
+	tc.SetIfNewer("foo", 1, now, DefaultExpiration)
+	tc.SetIfNewer("foo", 2, now.Add(-time.Second), DefaultExpiration)
+	tc.SetIfNewer("foo", 3, now.Add(time.Second), DefaultExpiration)
+	if x, _ := tc.Get("foo"); x.(int) != 3 {
+		t.Errorf("foo is %v, not 3", x)
+	}
+	if n := tc.ItemCount(); n != 1 {
+		t.Errorf("ItemCount is %d, not 1", n)
+	}
+}
+
+func TestShardedGetOrdered(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	var keys []string
+	for i := 0; i < 100; i++ {
+		k := strconv.Itoa(i)
+		keys = append(keys, k)
+		if i%3 != 0 {
+			tc.Set(k, i, DefaultExpiration)
+		}
+	}
+	for i, r := range tc.GetOrdered(keys) {
+		if i%3 == 0 {
+			if r.Found {
+				t.Errorf("%d was found: %v", i, r.Value)
+			}
+		} else if !r.Found || r.Value.(int) != i {
+			t.Errorf("result %d is %v", i, r)
+		}
+	}
+}
+
+func TestShardedSeed(t *testing.T) {
+	a := NewShardedSeeded(DefaultExpiration, 0, 13, 12345)
+	b := NewShardedSeeded(DefaultExpiration, 0, 13, a.Seed())
+	if s := a.Seed(); s != 12345 {
+		t.Errorf("Seed returned %d, not 12345", s)
+	}
+	for i := 0; i < 100; i++ {
+		k := strconv.Itoa(i)
+		if a.ShardFor(k) != b.ShardFor(k) {
+			t.Errorf("%s maps to shard %d and %d with the same seed", k, a.ShardFor(k), b.ShardFor(k))
+		}
+	}
+}
+
+func TestShardedReseed(t *testing.T) {
+	tc := NewShardedSeeded(DefaultExpiration, 0, 13, 1)
+	for i := 0; i < 100; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			tc.Seed()
+		}
+	}()
+	tc.Reseed(2)
+	<-done
+	if s := tc.Seed(); s != 2 {
+		t.Errorf("Seed returned %d after reseeding with 2", s)
+	}
+	for i := 0; i < 100; i++ {
+		k := strconv.Itoa(i)
+		if x, found := tc.Get(k); !found || x.(int) != i {
+			t.Errorf("%s is %v, %v after reseeding", k, x, found)
+		}
+		if _, found := tc.ShardItems(tc.ShardFor(k))[k]; !found {
+			t.Errorf("%s isn't in the shard it maps to", k)
+		}
+	}
+	if n := tc.Len(); n != 100 {
+		t.Errorf("Len is %d, not 100", n)
+	}
+}
+
+func TestShardedLRU(t *testing.T) {
+	tc := NewShardedLRU(DefaultExpiration, 0, 4, 3)
+	var evicted []string
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = append(evicted, k)
+	})
+	// Find four keys that map to the same shard.
+	var keys []string
+	for i := 0; len(keys) < 4; i++ {
+		k := strconv.Itoa(i)
+		if tc.ShardFor(k) == tc.ShardFor("0") {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range keys[:3] {
+		tc.Set(k, k, DefaultExpiration)
+	}
+	tc.Get(keys[0])
+	tc.Set(keys[3], keys[3], DefaultExpiration)
+	if len(evicted) != 1 || evicted[0] != keys[1] {
+		t.Errorf("evicted %v, not [%s]", evicted, keys[1])
+	}
+	if n := len(tc.ShardItems(tc.ShardFor("0"))); n != 3 {
+		t.Errorf("the shard holds %d items, not 3", n)
+	}
+	for i := 0; i < 100; i++ {
+		tc.Set("other"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+	if n := tc.Len(); n > 12 {
+		t.Errorf("the cache holds %d items, more than 4 shards of 3", n)
+	}
+	if n, l := tc.ItemCount(), tc.Len(); int(n) != l {
+		t.Errorf("ItemCount is %d after evictions, but the cache holds %d items", n, l)
+	}
+}
+
+func TestShardedOnEvicted(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	var evicted []string
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = append(evicted, k)
+	})
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Delete("foo")
+	if len(evicted) != 1 {
+		t.Errorf("OnEvicted was called for %v, not [foo]", evicted)
+	}
+}
+
+func TestShardedJanitorSkipsShardsWithoutExpirations(t *testing.T) {
+	clock := &manualClock{t: time.Unix(0, 0)}
+	tc := NewShardedWithOptions(WithShards(4), WithClock(clock))
+	for i := 0; i < 100; i++ {
+		tc.Set(strconv.Itoa(i), i, NoExpiration)
+	}
+	for i, c := range tc.cs {
+		if c.mayExpire.Load() {
+			t.Errorf("shard %d is flagged without expiring items", i)
+		}
+	}
+	tc.Set("foo", 1, time.Minute)
+	foo := tc.bucket("foo")
+	if !foo.mayExpire.Load() {
+		t.Fatal("shard isn't flagged after setting an expiring item")
+	}
+	clock.Advance(2 * time.Minute)
+	tc.deleteExpired(false)
+	if _, found := foo.items["foo"]; found {
+		t.Error("the flagged shard wasn't swept")
+	}
+	if foo.mayExpire.Load() {
+		t.Error("shard is still flagged after sweeping its only expiring item")
+	}
+	if n := tc.ItemCount(); n != 100 {
+		t.Errorf("ItemCount is %d, not 100", n)
+	}
+
+	// A skipped shard must not have anything to reap.
+	foo.mu.Lock()
+	foo.items["bar"] = Item{Object: 1, Expiration: 1}
+	foo.mu.Unlock()
+	tc.deleteExpired(false)
+	if _, found := foo.items["bar"]; !found {
+		t.Error("an unflagged shard was swept")
+	}
+	tc.DeleteExpired()
+	if _, found := foo.items["bar"]; found {
+		t.Error("DeleteExpired skipped an unflagged shard")
+	}
+}
+
+func TestShardedJanitorFlagAfterUnpin(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 2)
+	tc.Set("foo", 1, time.Hour)
+	tc.Pin("foo")
+	tc.deleteExpired(false)
+	if tc.bucket("foo").mayExpire.Load() {
+		t.Error("shard is flagged while its only expiring item is pinned")
+	}
+	tc.Unpin("foo")
+	if !tc.bucket("foo").mayExpire.Load() {
+		t.Error("shard isn't flagged after unpinning an expiring item")
+	}
+}
+
+func benchmarkShardedJanitorMostlyStatic(b *testing.B, all bool) {
+	tc := NewSharded(DefaultExpiration, 0, 64)
+	for i := 0; i < 100000; i++ {
+		tc.Set(strconv.Itoa(i), i, NoExpiration)
+	}
+	// Only a few shards hold expiring items.
+	for i := 0; i < 4; i++ {
+		tc.Set("session"+strconv.Itoa(i), i, time.Hour)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tc.deleteExpired(all)
+	}
+}
+
+func BenchmarkShardedDeleteExpiredMostlyStatic(b *testing.B) {
+	benchmarkShardedJanitorMostlyStatic(b, true)
+}
+
+func BenchmarkShardedJanitorMostlyStatic(b *testing.B) {
+	benchmarkShardedJanitorMostlyStatic(b, false)
+}
+
+func TestShardedIncrementReturn(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 4)
+	tc.Set("counter", 0, DefaultExpiration)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seen = map[int64]bool{}
+	)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				n, err := tc.IncrementReturn("counter", 1)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				seen[n] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != 800 || !seen[1] || !seen[800] {
+		t.Errorf("IncrementReturn returned %d distinct values", len(seen))
+	}
+}
@@ -0,0 +1,91 @@
+package cache
+
+// WithSizeAccounting makes the cache report how many bytes its items take up
+// to an external tracker, e.g. one enforcing a memory budget shared with other
+// caches. The cache measures each value it stores using sizer, and calls
+// report with the change in its total size: the item's size when one is added,
+// the difference between the new and old sizes when one is replaced or
+// modified, and minus its size when one is deleted, expires, is evicted or is
+// flushed, so that the sum of the reported deltas is always the total size of
+// the cache's items.
+//
+// Each item's size is recorded when it is stored, so a value that is modified
+// after being set isn't measured again when it is removed. Compressed values
+// are measured as the compressed []byte, and values set with SetLazy as they
+// are computed. Items spilled to disk don't count.
+//
+// sizer and report are called with the cache (or, in a sharded cache, the
+// shard) locked, so they must be fast and mustn't use the cache. In a sharded
+// cache, report is called by every shard, possibly concurrently.
+func WithSizeAccounting(sizer func(k string, v interface{}) int64, report func(delta int64)) Option {
+	return func(o *options) {
+		if sizer == nil || report == nil {
+			o.sizer, o.reportSize = nil, nil
+			return
+		}
+		o.sizer, o.reportSize = sizer, report
+	}
+}
+
+// Measures item, which is about to be stored for k, and reports the change
+// from the size of the item it replaces, if any. c.mu must be held.
+func (c *cache) account(k string, item *Item) {
+	if c.sizer == nil {
+		return
+	}
+	var old int64
+	if v, found := c.items[k]; found {
+		old = v.size
+	}
+	item.size = c.sizeOf(k, item.Object)
+	if d := item.size - old; d != 0 {
+		c.accounted += d
+		c.reportSize(d)
+	}
+}
+
+// Returns the size of the stored object x of the item with key k.
+func (c *cache) sizeOf(k string, x interface{}) int64 {
+	switch v := x.(type) {
+	case *lazyValue:
+		return 0
+	case compressedValue:
+		return c.sizer(k, v.Data)
+	}
+	return c.sizer(k, x)
+}
+
+// Reports the removal of an item of the given size. c.mu must be held.
+func (c *cache) unaccount(size int64) {
+	if c.sizer != nil && size != 0 {
+		c.accounted -= size
+		c.reportSize(-size)
+	}
+}
+
+// Reports the removal of all of the items in m. c.mu must be held.
+func (c *cache) unaccountAll(m map[string]Item) {
+	if c.sizer == nil {
+		return
+	}
+	var total int64
+	for _, v := range m {
+		total += v.size
+	}
+	c.unaccount(total)
+}
+
+// Measures the items a cache was created with. c.mu must be held.
+func (c *cache) accountAll() {
+	if c.sizer == nil {
+		return
+	}
+	for k, v := range c.items {
+		v.size = c.sizeOf(k, v.Object)
+		c.items[k] = v
+		if v.size != 0 {
+			c.accounted += v.size
+			c.reportSize(v.size)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func stringSizer(k string, v interface{}) int64 {
+	switch x := v.(type) {
+	case string:
+		return int64(len(k) + len(x))
+	case []byte:
+		return int64(len(k) + len(x))
+	case map[string]int:
+		return int64(len(k) + 16*len(x))
+	}
+	return int64(len(k) + 8)
+}
+
+// Returns the total size of the items in tc's shards, as recorded on them.
+func accountedSize(cs ...*cache) int64 {
+	var n int64
+	for _, c := range cs {
+		c.mu.RLock()
+		for _, v := range c.items {
+			n += v.size
+		}
+		c.mu.RUnlock()
+	}
+	return n
+}
+
+func TestSizeAccounting(t *testing.T) {
+	var deltas []int64
+	clock := &manualClock{t: time.Unix(0, 0)}
+	tc := NewWithOptions(WithClock(clock), WithSizeAccounting(stringSizer, func(d int64) {
+		deltas = append(deltas, d)
+	}))
+	expect := func(want ...int64) {
+		t.Helper()
+		if len(deltas) != len(want) {
+			t.Fatalf("reported %v, not %v", deltas, want)
+		}
+		for i := range want {
+			if deltas[i] != want[i] {
+				t.Fatalf("reported %v, not %v", deltas, want)
+			}
+		}
+		deltas = nil
+	}
+
+	tc.Set("a", "xx", DefaultExpiration)
+	expect(3)
+	tc.Set("a", "xxxxx", DefaultExpiration)
+	expect(3)
+	tc.Delete("a")
+	expect(-6)
+
+	tc.Set("b", 1, time.Minute)
+	tc.Increment("b", 1)
+	expect(9)
+	clock.Advance(2 * time.Minute)
+	tc.DeleteExpired()
+	expect(-9)
+
+	m := map[string]int{"x": 1}
+	tc.Set("m", m, DefaultExpiration)
+	expect(17)
+	m["y"] = 2
+	tc.Delete("m")
+	expect(-17)
+
+	tc.Set("c", "x", DefaultExpiration)
+	tc.Set("d", "y", DefaultExpiration)
+	deltas = nil
+	tc.Flush()
+	var sum int64
+	for _, d := range deltas {
+		sum += d
+	}
+	if sum != -4 {
+		t.Errorf("Flush reported %v", deltas)
+	}
+}
+
+func TestSizeAccountingLazy(t *testing.T) {
+	var total int64
+	tc := NewWithOptions(WithSizeAccounting(stringSizer, func(d int64) {
+		total += d
+	}))
+	tc.SetLazy("foo", func() (interface{}, error) {
+		return "bar", nil
+	}, DefaultExpiration)
+	if total != 0 {
+		t.Errorf("an uncomputed value has size %d", total)
+	}
+	tc.Get("foo")
+	if total != 6 {
+		t.Errorf("total is %d after computing the value, not 6", total)
+	}
+}
+
+func testSizeAccountingStress(t *testing.T, total *int64, cs []*cache, set func(k string, x interface{}, d time.Duration), del func(k string), flush func()) {
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				k := strconv.Itoa((g*31 + i) % 200)
+				switch i % 7 {
+				case 0, 1, 2:
+					set(k, k+"value"+strconv.Itoa(i), DefaultExpiration)
+				case 3:
+					set(k, k, time.Microsecond)
+				case 4:
+					del(k)
+				case 5:
+					for _, c := range cs {
+						c.DeleteExpired()
+					}
+				case 6:
+					if i%500 == 6 {
+						flush()
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if got, want := atomic.LoadInt64(total), accountedSize(cs...); got != want {
+		t.Errorf("the reported deltas add up to %d, but the items' sizes add up to %d", got, want)
+	}
+	var measured int64
+	for _, c := range cs {
+		c.mu.RLock()
+		for k, v := range c.items {
+			measured += c.sizeOf(k, v.Object)
+		}
+		c.mu.RUnlock()
+	}
+	if got := atomic.LoadInt64(total); got != measured {
+		t.Errorf("the reported deltas add up to %d, but the items measure %d", got, measured)
+	}
+}
+
+func TestSizeAccountingStress(t *testing.T) {
+	var total int64
+	report := func(d int64) {
+		atomic.AddInt64(&total, d)
+	}
+	tc := NewWithOptions(WithMaxItems(100), WithSizeAccounting(stringSizer, report))
+	testSizeAccountingStress(t, &total, []*cache{tc.cache}, tc.Set, tc.Delete, tc.Flush)
+}
+
+func TestShardedSizeAccountingStress(t *testing.T) {
+	var total int64
+	report := func(d int64) {
+		atomic.AddInt64(&total, d)
+	}
+	tc := NewShardedWithOptions(WithShards(4), WithMaxItems(30), WithSizeAccounting(stringSizer, report))
+	testSizeAccountingStress(t, &total, tc.cs, tc.Set, tc.Delete, tc.Flush)
+	tc.Reseed(tc.Seed() + 1)
+	if got, want := atomic.LoadInt64(&total), accountedSize(tc.cs...); got != want {
+		t.Errorf("after Reseed, the reported deltas add up to %d, but the items' sizes add up to %d", got, want)
+	}
+}
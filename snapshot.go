@@ -0,0 +1,354 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	insecurerand "math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ErrCorruptSnapshot is returned by Load and LoadBestEffort if a snapshot
+// written by Save is truncated or fails checksum verification.
+var ErrCorruptSnapshot = errors.New("Snapshot is corrupt or truncated")
+
+// A snapshot starts with snapshotMagic and the format version, followed by one
+// record per item and a trailer. Each record is its length, a chunk of a single
+// Gob stream holding one snapshotEntry, and the CRC-32C of the chunk. The
+// trailer is a zero length, the number of records, and the CRC-32C of
+// everything before it.
+//
+// Snapshots without the magic bytes were written by older versions, which
+// encoded the whole item map at once, and are still loaded as such.
+const (
+	snapshotMagic   = "GCSNAP"
+	snapshotVersion = 1
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type snapshotEntry struct {
+	Key  string
+	Item Item
+}
+
+// Writes items to w in the snapshot format. Panics if an item's type can't be
+// encoded by Gob.
+func writeSnapshot(w io.Writer, items map[string]Item) error {
+	sw := newSnapshotWriter(w)
+	for k, v := range items {
+		if err := sw.write(k, v); err != nil {
+			return err
+		}
+	}
+	return sw.close()
+}
+
+// Writes a snapshot one item at a time.
+type snapshotWriter struct {
+	w   io.Writer
+	h   hash.Hash32
+	bw  *bufio.Writer
+	buf bytes.Buffer
+	enc *gob.Encoder
+	n   uint64
+}
+
+func newSnapshotWriter(w io.Writer) *snapshotWriter {
+	sw := &snapshotWriter{
+		w: w,
+		h: crc32.New(castagnoli),
+	}
+	sw.bw = bufio.NewWriter(io.MultiWriter(w, sw.h))
+	sw.enc = gob.NewEncoder(&sw.buf)
+	sw.bw.WriteString(snapshotMagic)
+	sw.bw.WriteByte(snapshotVersion)
+	return sw
+}
+
+func (sw *snapshotWriter) write(k string, v Item) error {
+	var hdr [4]byte
+	sw.buf.Reset()
+	if err := sw.enc.Encode(snapshotEntry{Key: k, Item: v}); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(hdr[:], uint32(sw.buf.Len()))
+	sw.bw.Write(hdr[:])
+	sw.bw.Write(sw.buf.Bytes())
+	binary.BigEndian.PutUint32(hdr[:], crc32.Checksum(sw.buf.Bytes(), castagnoli))
+	_, err := sw.bw.Write(hdr[:])
+	sw.n++
+	return err
+}
+
+// Writes the trailer.
+func (sw *snapshotWriter) close() error {
+	var hdr [4]byte
+	sw.bw.Write(hdr[:])
+	if err := sw.bw.Flush(); err != nil {
+		return err
+	}
+	var trailer [12]byte
+	binary.BigEndian.PutUint64(trailer[:8], sw.n)
+	binary.BigEndian.PutUint32(trailer[8:], sw.h.Sum32())
+	_, err := sw.w.Write(trailer[:])
+	return err
+}
+
+// Reads a snapshot written by writeSnapshot, or by older versions of Save,
+// from r. If the snapshot is corrupt, the items read before the corruption
+// point are returned with ErrCorruptSnapshot.
+func readSnapshot(r io.Reader) (map[string]Item, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(len(snapshotMagic)); err != nil || string(magic) != snapshotMagic {
+		items := map[string]Item{}
+		err := gob.NewDecoder(br).Decode(&items)
+		return items, err
+	}
+	h := crc32.New(castagnoli)
+	tr := io.TeeReader(br, h)
+	header := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(tr, header); err != nil {
+		return nil, ErrCorruptSnapshot
+	}
+	if v := header[len(snapshotMagic)]; v != snapshotVersion {
+		return nil, errors.New("Unsupported snapshot version")
+	}
+	var (
+		items  = map[string]Item{}
+		n      uint64
+		hdr    [4]byte
+		chunk  bytes.Buffer
+		stream bytes.Buffer
+	)
+	// bytes.Buffer is an io.ByteReader, so the decoder doesn't read ahead.
+	dec := gob.NewDecoder(&stream)
+	for {
+		if _, err := io.ReadFull(tr, hdr[:]); err != nil {
+			return items, ErrCorruptSnapshot
+		}
+		size := binary.BigEndian.Uint32(hdr[:])
+		if size == 0 {
+			break
+		}
+		chunk.Reset()
+		// Copying rather than allocating size bytes up front guards against
+		// corrupt lengths.
+		if _, err := io.CopyN(&chunk, tr, int64(size)); err != nil {
+			return items, ErrCorruptSnapshot
+		}
+		if _, err := io.ReadFull(tr, hdr[:]); err != nil {
+			return items, ErrCorruptSnapshot
+		}
+		if binary.BigEndian.Uint32(hdr[:]) != crc32.Checksum(chunk.Bytes(), castagnoli) {
+			return items, ErrCorruptSnapshot
+		}
+		stream.Write(chunk.Bytes())
+		var e snapshotEntry
+		if err := dec.Decode(&e); err != nil {
+			return items, err
+		}
+		items[e.Key] = e.Item
+		n++
+	}
+	sum := h.Sum32()
+	var trailer [12]byte
+	if _, err := io.ReadFull(br, trailer[:]); err != nil {
+		return items, ErrCorruptSnapshot
+	}
+	if binary.BigEndian.Uint64(trailer[:8]) != n || binary.BigEndian.Uint32(trailer[8:]) != sum {
+		return items, ErrCorruptSnapshot
+	}
+	return items, nil
+}
+
+// LoadBestEffort adds the items in a snapshot written by Save to the cache like
+// Load, except that if the snapshot is corrupt, the items that were fully
+// decoded before the corruption point are still added. Returns the number of
+// items read from the snapshot, including any that weren't added because they
+// already exist in the cache, and ErrCorruptSnapshot if the snapshot is corrupt.
+func (c *cache) LoadBestEffort(r io.Reader) (int, error) {
+	items, err := c.readSnapshot(r)
+	c.loadItems(items, false)
+	return len(items), err
+}
+
+// Writes a file by calling write with a temporary file in the same directory,
+// then syncing it and renaming it over fname. If fname exists, its permissions
+// are kept. If syncDir is set, the directory is synced after the rename.
+func writeFileAtomic(fname string, syncDir bool, write func(io.Writer) error) error {
+	perm := os.FileMode(0666)
+	fi, err := os.Stat(fname)
+	exists := err == nil
+	if exists {
+		perm = fi.Mode().Perm()
+	}
+	fp, err := createTemp(fname, perm)
+	if err != nil {
+		return err
+	}
+	tmp := fp.Name()
+	if err = writeAndSync(fp, exists, perm, write); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, fname); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if syncDir {
+		if d, err := os.Open(filepath.Dir(fname)); err == nil {
+			d.Sync()
+			d.Close()
+		}
+	}
+	return nil
+}
+
+func writeAndSync(fp *os.File, chmod bool, perm os.FileMode, write func(io.Writer) error) error {
+	err := write(fp)
+	if err == nil && chmod {
+		// Unlike the permissions passed to OpenFile, these aren't subject
+		// to the umask.
+		err = fp.Chmod(perm)
+	}
+	if err == nil {
+		err = fp.Sync()
+	}
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Creates a new file next to fname with a random suffix.
+func createTemp(fname string, perm os.FileMode) (*os.File, error) {
+	for i := 0; ; i++ {
+		name := fname + "." + strconv.FormatUint(uint64(insecurerand.Uint32()), 36) + ".tmp"
+		fp, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if os.IsExist(err) && i < 100 {
+			continue
+		}
+		return fp, err
+	}
+}
+
+// LoadAdd adds the items in a snapshot written by Save to the cache, like
+// Load, only where no unexpired item with the same key exists, so that items
+// set since the cache started serving are never overwritten. Unlike Load, it
+// also skips items that have expired in the snapshot. Returns the number of
+// items added, and skipped because they exist in the cache or have expired.
+// Nothing is added if the snapshot is corrupt.
+func (c *cache) LoadAdd(r io.Reader) (added, skippedExisting, skippedExpired int, err error) {
+	items, err := c.readSnapshot(r)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	added, skippedExisting, skippedExpired = c.loadItems(items, true)
+	return
+}
+
+// LoadAddFile adds the items in the snapshot file fname to the cache. See
+// LoadAdd.
+func (c *cache) LoadAddFile(fname string) (added, skippedExisting, skippedExpired int, err error) {
+	fp, err := os.Open(fname)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer fp.Close()
+	return c.LoadAdd(fp)
+}
+
+// LoadAdd adds the items in a snapshot written by Save to the shards owning
+// them where no unexpired item with the same key exists. See the cache's
+// LoadAdd.
+func (sc *shardedCache) LoadAdd(r io.Reader) (added, skippedExisting, skippedExpired int, err error) {
+	items, err := sc.cs[0].readSnapshot(r)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	shards := make([]map[string]Item, len(sc.cs))
+	for k, v := range items {
+		i := sc.ShardFor(k)
+		if shards[i] == nil {
+			shards[i] = map[string]Item{}
+		}
+		shards[i][k] = v
+	}
+	for i, m := range shards {
+		if m == nil {
+			continue
+		}
+		a, e, x := sc.cs[i].loadItems(m, true)
+		added += a
+		skippedExisting += e
+		skippedExpired += x
+	}
+	return
+}
+
+// LoadAddFile adds the items in the snapshot file fname to the sharded cache.
+// See LoadAdd.
+func (sc *shardedCache) LoadAddFile(fname string) (added, skippedExisting, skippedExpired int, err error) {
+	fp, err := os.Open(fname)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer fp.Close()
+	return sc.LoadAdd(fp)
+}
+
+// SnapshotAsync writes the items in the sharded cache to w, in the same format
+// as Save, in the background, and sends the result on the returned channel,
+// which is then closed. Shards are visited one at a time: each shard's items
+// are copied while its read lock is held, and encoded after it is released, so
+// writers are only ever blocked for as long as it takes to copy one shard.
+//
+// The snapshot is consistent within each shard, but not across shards: items
+// set in a shard that has already been copied aren't included, even if the
+// snapshot finishes after they were set.
+func (sc *shardedCache) SnapshotAsync(w io.Writer) <-chan error {
+	errc := make(chan error, 1)
+	sc.cs[0].goroutines.work(func() {
+		errc <- sc.snapshot(w)
+		close(errc)
+	})
+	return errc
+}
+
+func (sc *shardedCache) snapshot(w io.Writer) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("Error registering item types with Gob library")
+		}
+	}()
+	sw := newSnapshotWriter(w)
+	for _, c := range sc.cs {
+		c.mu.RLock()
+		items := make(map[string]Item, len(c.items))
+		now := c.now().UnixNano()
+		for k, v := range c.items {
+			if !isLazy(v.Object) {
+				items[k] = c.withPausedExpiration(k, v, now)
+			}
+		}
+		c.mu.RUnlock()
+		for k, v := range items {
+			if v, err = c.encodeValue(k, v); err != nil {
+				return err
+			}
+			if err := sw.write(k, v); err != nil {
+				return err
+			}
+		}
+	}
+	return sw.close()
+}
@@ -0,0 +1,343 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSnapshotFile(t *testing.T, n int) (string, []byte) {
+	tc := New(DefaultExpiration, 0)
+	for i := 0; i < n; i++ {
+		tc.Set("foo"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+	fname := filepath.Join(t.TempDir(), "cache.snapshot")
+	if err := tc.SaveFile(fname); err != nil {
+		t.Fatal("Couldn't save cache to file:", err)
+	}
+	b, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fname, b
+}
+
+func TestLoadFileTruncated(t *testing.T) {
+	fname, b := testSnapshotFile(t, 100)
+	for _, n := range []int{0, 3, len(snapshotMagic) + 1, len(b) / 3, len(b) / 2, len(b) - 12, len(b) - 1} {
+		if err := os.WriteFile(fname, b[:n], 0600); err != nil {
+			t.Fatal(err)
+		}
+		tc := New(DefaultExpiration, 0)
+		err := tc.LoadFile(fname)
+		if n >= len(snapshotMagic) && err != ErrCorruptSnapshot {
+			t.Errorf("truncated to %d bytes: got %v, not ErrCorruptSnapshot", n, err)
+		} else if err == nil {
+			t.Errorf("truncated to %d bytes: loaded without an error", n)
+		}
+		if tc.ItemCount() != 0 {
+			t.Errorf("truncated to %d bytes: %d items were loaded", n, tc.ItemCount())
+		}
+	}
+}
+
+func TestLoadFileBitFlip(t *testing.T) {
+	fname, b := testSnapshotFile(t, 100)
+	for _, i := range []int{len(snapshotMagic) + 3, len(b) / 2, len(b) - 13, len(b) - 5, len(b) - 1} {
+		c := append([]byte{}, b...)
+		c[i] ^= 0x10
+		if err := os.WriteFile(fname, c, 0600); err != nil {
+			t.Fatal(err)
+		}
+		tc := New(DefaultExpiration, 0)
+		if err := tc.LoadFile(fname); err != ErrCorruptSnapshot {
+			t.Errorf("bit flip at %d: got %v, not ErrCorruptSnapshot", i, err)
+		}
+		if tc.ItemCount() != 0 {
+			t.Errorf("bit flip at %d: %d items were loaded", i, tc.ItemCount())
+		}
+	}
+}
+
+func TestLoadBestEffort(t *testing.T) {
+	_, b := testSnapshotFile(t, 100)
+	tc := New(DefaultExpiration, 0)
+	n, err := tc.LoadBestEffort(bytes.NewReader(b[:len(b)/2]))
+	if err != ErrCorruptSnapshot {
+		t.Errorf("got %v, not ErrCorruptSnapshot", err)
+	}
+	if n < 30 || n >= 100 {
+		t.Errorf("%d items were recovered from half of a snapshot of 100", n)
+	}
+	if tc.ItemCount() != n {
+		t.Errorf("ItemCount is %d, not %d", tc.ItemCount(), n)
+	}
+	for k, v := range tc.Items() {
+		if "foo"+strconv.Itoa(v.Object.(int)) != k {
+			t.Errorf("recovered item %s has the wrong value %v", k, v.Object)
+		}
+	}
+
+	tc = New(DefaultExpiration, 0)
+	n, err = tc.LoadBestEffort(bytes.NewReader(b))
+	if err != nil || n != 100 || tc.ItemCount() != 100 {
+		t.Errorf("LoadBestEffort of an intact snapshot returned %d, %v", n, err)
+	}
+}
+
+func TestLoadLegacySnapshot(t *testing.T) {
+	items := map[string]Item{"a": {Object: 1}, "b": {Object: "b"}}
+	fp := &bytes.Buffer{}
+	if err := gob.NewEncoder(fp).Encode(&items); err != nil {
+		t.Fatal(err)
+	}
+	tc := New(DefaultExpiration, 0)
+	if err := tc.Load(fp); err != nil {
+		t.Fatal("Couldn't load a legacy snapshot:", err)
+	}
+	if x, found := tc.Get("b"); !found || x.(string) != "b" {
+		t.Error("b was not loaded from a legacy snapshot")
+	}
+}
+
+func TestSaveFileFailureKeepsOriginal(t *testing.T) {
+	fname, b := testSnapshotFile(t, 10)
+	tc := New(DefaultExpiration, 0)
+	tc.Set("ok", 1, DefaultExpiration)
+	// Gob can't encode functions, so saving fails partway through.
+	tc.Set("bad", func() {}, DefaultExpiration)
+	if err := tc.SaveFile(fname); err == nil {
+		t.Fatal("SaveFile of an unencodable item didn't fail")
+	}
+	got, err := os.ReadFile(fname)
+	if err != nil || !bytes.Equal(got, b) {
+		t.Error("the original file was modified by a failed save")
+	}
+	entries, _ := os.ReadDir(filepath.Dir(fname))
+	if len(entries) != 1 {
+		t.Errorf("%d files were left in the directory, not 1", len(entries))
+	}
+}
+
+func TestSaveFileKeepsPermissions(t *testing.T) {
+	fname, _ := testSnapshotFile(t, 10)
+	if err := os.Chmod(fname, 0640); err != nil {
+		t.Fatal(err)
+	}
+	tc := New(DefaultExpiration, 0, WithDirSync())
+	tc.Set("a", 1, DefaultExpiration)
+	if err := tc.SaveFile(fname); err != nil {
+		t.Fatal("Couldn't save cache to file:", err)
+	}
+	fi, err := os.Stat(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Errorf("file permissions are %v, not 0640", fi.Mode().Perm())
+	}
+	oc := New(DefaultExpiration, 0)
+	if err := oc.LoadFile(fname); err != nil {
+		t.Fatal("Couldn't load cache from file:", err)
+	}
+	if _, found := oc.Get("a"); !found || oc.ItemCount() != 1 {
+		t.Error("the saved file doesn't hold the new items")
+	}
+}
+
+func TestSaveFunc(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("tmp:a", 1, NoExpiration)
+	tc.Set("tmp:b", 2, NoExpiration)
+	tc.Set("short", 3, 30*time.Second)
+	tc.Set("long", 4, 1*time.Hour)
+	tc.Set("forever", 5, NoExpiration)
+	fp := &bytes.Buffer{}
+	skipped, err := tc.SaveFunc(fp, func(k string, it Item) bool {
+		if strings.HasPrefix(k, "tmp:") {
+			return false
+		}
+		return it.Expiration == 0 || time.Until(time.Unix(0, it.Expiration)) >= time.Minute
+	})
+	if err != nil {
+		t.Fatal("Couldn't save cache:", err)
+	}
+	if skipped != 3 {
+		t.Errorf("SaveFunc skipped %d items, not 3", skipped)
+	}
+	oc := New(DefaultExpiration, 0)
+	if err := oc.Load(fp); err != nil {
+		t.Fatal("Couldn't load cache:", err)
+	}
+	for _, k := range []string{"tmp:a", "tmp:b", "short"} {
+		if _, found := oc.Get(k); found {
+			t.Errorf("filtered item %s was saved", k)
+		}
+	}
+	for _, k := range []string{"long", "forever"} {
+		if _, found := oc.Get(k); !found {
+			t.Errorf("item %s was not saved", k)
+		}
+	}
+}
+
+func TestSaveFuncKeepMayUseCache(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	_, err := tc.SaveFunc(&bytes.Buffer{}, func(k string, it Item) bool {
+		tc.Set("b", 2, DefaultExpiration)
+		return true
+	})
+	if err != nil {
+		t.Fatal("Couldn't save cache:", err)
+	}
+}
+
+func testLoadAddSnapshot(t *testing.T) *bytes.Buffer {
+	// Expired on the real clock, which the caches it is loaded into use.
+	clk := &manualClock{t: time.Now().Add(-time.Hour)}
+	tc := New(DefaultExpiration, 0, WithClock(clk))
+	for i := 0; i < 100; i++ {
+		tc.Set("foo"+strconv.Itoa(i), "old", DefaultExpiration)
+	}
+	tc.Set("expired", "old", 1*time.Millisecond)
+	fp := &bytes.Buffer{}
+	if err := tc.Save(fp); err != nil {
+		t.Fatal("Couldn't save cache:", err)
+	}
+	return fp
+}
+
+func TestLoadAdd(t *testing.T) {
+	fp := testLoadAddSnapshot(t)
+	tc := New(DefaultExpiration, 0)
+	for i := 0; i < 10; i++ {
+		tc.Set("foo"+strconv.Itoa(i), "live", DefaultExpiration)
+	}
+	added, existing, expired, err := tc.LoadAdd(fp)
+	if err != nil {
+		t.Fatal("Couldn't load cache:", err)
+	}
+	if added != 90 || existing != 10 || expired != 1 {
+		t.Errorf("LoadAdd returned %d, %d, %d, not 90, 10, 1", added, existing, expired)
+	}
+	for i := 0; i < 100; i++ {
+		want := "old"
+		if i < 10 {
+			want = "live"
+		}
+		if x, _ := tc.Get("foo" + strconv.Itoa(i)); x != want {
+			t.Errorf("foo%d is %v, not %s", i, x, want)
+		}
+	}
+	if _, found := tc.Get("expired"); found || tc.ItemCount() != 100 {
+		t.Error("an expired item was loaded")
+	}
+}
+
+func TestLoadAddConcurrentSets(t *testing.T) {
+	fp := testLoadAddSnapshot(t)
+	tc := NewSharded(DefaultExpiration, 0, 8)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 99; i >= 0; i-- {
+			tc.Set("foo"+strconv.Itoa(i), "live", DefaultExpiration)
+		}
+	}()
+	added, existing, _, err := tc.LoadAdd(fp)
+	<-done
+	if err != nil {
+		t.Fatal("Couldn't load cache:", err)
+	}
+	if added+existing != 100 {
+		t.Errorf("LoadAdd added %d and skipped %d existing items, not 100 in total", added, existing)
+	}
+	for i := 0; i < 100; i++ {
+		if x, _ := tc.Get("foo" + strconv.Itoa(i)); x != "live" {
+			t.Errorf("foo%d is %v: a live value was overwritten", i, x)
+		}
+	}
+}
+
+func TestLoadAddFile(t *testing.T) {
+	fname, _ := testSnapshotFile(t, 10)
+	tc := New(DefaultExpiration, 0)
+	tc.Set("foo0", "live", DefaultExpiration)
+	added, existing, _, err := tc.LoadAddFile(fname)
+	if err != nil || added != 9 || existing != 1 {
+		t.Errorf("LoadAddFile returned %d, %d, %v", added, existing, err)
+	}
+	sc := NewSharded(DefaultExpiration, 0, 4)
+	added, _, _, err = sc.LoadAddFile(fname)
+	if err != nil || added != 10 || sc.ItemCount() != 10 {
+		t.Errorf("sharded LoadAddFile returned %d, %v", added, err)
+	}
+}
+
+func TestShardedSnapshotAsync(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 8)
+	for i := 0; i < 1000; i++ {
+		tc.Set("foo"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+	fp := &bytes.Buffer{}
+	if err := <-tc.SnapshotAsync(fp); err != nil {
+		t.Fatal("Couldn't snapshot cache:", err)
+	}
+	oc := New(DefaultExpiration, 0)
+	if err := oc.Load(bytes.NewReader(fp.Bytes())); err != nil {
+		t.Fatal("Couldn't load snapshot:", err)
+	}
+	if n := oc.ItemCount(); n != 1000 {
+		t.Errorf("%d items were loaded, not 1000", n)
+	}
+	sc := NewSharded(DefaultExpiration, 0, 3)
+	if added, _, _, err := sc.LoadAdd(fp); err != nil || added != 1000 {
+		t.Errorf("sharded LoadAdd returned %d, %v", added, err)
+	}
+}
+
+// A writer that is slow to encode into, like a disk under load.
+type slowWriter struct{}
+
+func (slowWriter) Write(p []byte) (int, error) {
+	<-time.After(10 * time.Microsecond)
+	return len(p), nil
+}
+
+func p99SetLatency(tc *ShardedCache, n int) time.Duration {
+	ds := make([]time.Duration, n)
+	for i := range ds {
+		start := time.Now()
+		tc.Set("bar"+strconv.Itoa(i), i, DefaultExpiration)
+		ds[i] = time.Since(start)
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	return ds[n*99/100]
+}
+
+func TestShardedSnapshotAsyncSetLatency(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping latency test in short mode")
+	}
+	tc := NewSharded(DefaultExpiration, 0, 256)
+	for i := 0; i < 200000; i++ {
+		tc.Set("foo"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+	baseline := p99SetLatency(tc, 10000)
+	errc := tc.SnapshotAsync(slowWriter{})
+	during := p99SetLatency(tc, 10000)
+	if err := <-errc; err != nil {
+		t.Fatal("Couldn't snapshot cache:", err)
+	}
+	// Copying one shard of ~800 items takes well under a millisecond.
+	if limit := 10*baseline + time.Millisecond; during > limit {
+		t.Errorf("p99 Set latency during a snapshot is %v, more than %v (baseline %v)", during, limit, baseline)
+	}
+}
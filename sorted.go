@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"sort"
+)
+
+// WithSortByExpiration makes KeysSorted and ItemsSorted order items by their
+// expiration time, soonest first, instead of by key. Items that never expire
+// come last. Items with the same expiration time are ordered by key.
+func WithSortByExpiration() Option {
+	return func(o *options) {
+		o.sortByExpiration = true
+	}
+}
+
+type sortedItem struct {
+	k string
+	v Item
+}
+
+// Sorts items by key, or by expiration time and then by key.
+func sortItems(items []sortedItem, byExpiration bool) {
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if byExpiration && a.v.Expiration != b.v.Expiration {
+			if a.v.Expiration <= 0 {
+				return false
+			}
+			if b.v.Expiration <= 0 {
+				return true
+			}
+			return a.v.Expiration < b.v.Expiration
+		}
+		return a.k < b.k
+	})
+}
+
+// Appends a copy of all unexpired items in the cache to items.
+func (c *cache) appendItems(items []sortedItem) []sortedItem {
+	c.itemsFunc(func(k string, v Item) bool {
+		items = append(items, sortedItem{k, v})
+		return true
+	})
+	return items
+}
+
+// KeysSorted returns the keys of all unexpired items in the cache in
+// lexicographic order, or in order of expiration if the cache was created using
+// WithSortByExpiration. The keys are sorted after being copied, so the cache
+// isn't locked while sorting, and the result doesn't reflect later changes.
+func (c *cache) KeysSorted() []string {
+	items := c.appendItems(nil)
+	sortItems(items, c.sortByExpiration)
+	keys := make([]string, len(items))
+	for i, it := range items {
+		keys[i] = it.k
+	}
+	return keys
+}
+
+// ItemsSorted calls f for each unexpired item in the cache in the same order as
+// KeysSorted, stopping if f returns false. The items are copied before being
+// sorted, so unlike ItemsFunc, f is called without holding the cache's lock
+// and may modify the cache; changes are not reflected in the visited items.
+func (c *cache) ItemsSorted(f func(k string, v Item) bool) {
+	items := c.appendItems(nil)
+	sortItems(items, c.sortByExpiration)
+	for _, it := range items {
+		if !f(it.k, it.v) {
+			return
+		}
+	}
+}
+
+// Copies the items in all shards, and sorts them as one list.
+func (sc *shardedCache) sortedItems() []sortedItem {
+	var items []sortedItem
+	for _, c := range sc.cs {
+		items = c.appendItems(items)
+	}
+	sortItems(items, len(sc.cs) > 0 && sc.cs[0].sortByExpiration)
+	return items
+}
+
+// KeysSorted returns the keys of all unexpired items in all shards in one
+// sorted list. See the cache's KeysSorted.
+func (sc *shardedCache) KeysSorted() []string {
+	items := sc.sortedItems()
+	keys := make([]string, len(items))
+	for i, it := range items {
+		keys[i] = it.k
+	}
+	return keys
+}
+
+// ItemsSorted calls f for each unexpired item in all shards in the same order
+// as KeysSorted. See the cache's ItemsSorted. The shards are copied one at a
+// time, so the visited items are not a consistent snapshot across shards.
+func (sc *shardedCache) ItemsSorted(f func(k string, v Item) bool) {
+	for _, it := range sc.sortedItems() {
+		if !f(it.k, it.v) {
+			return
+		}
+	}
+}
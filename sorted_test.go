@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestKeysSorted(t *testing.T) {
+	clk := &manualClock{t: time.Unix(1000, 0)}
+	tc := New(DefaultExpiration, 0, WithClock(clk))
+	for _, k := range []string{"b", "a", "c", "aa", "B"} {
+		tc.Set(k, k, DefaultExpiration)
+	}
+	tc.Set("expired", 1, time.Millisecond)
+	clk.Advance(5 * time.Millisecond)
+	want := []string{"B", "a", "aa", "b", "c"}
+	if keys := tc.KeysSorted(); !reflect.DeepEqual(keys, want) {
+		t.Errorf("KeysSorted returned %v, not %v", keys, want)
+	}
+
+	var visited []string
+	tc.ItemsSorted(func(k string, v Item) bool {
+		if v.Object.(string) != k {
+			t.Errorf("%s has value %v", k, v.Object)
+		}
+		visited = append(visited, k)
+		return len(visited) < 3
+	})
+	if !reflect.DeepEqual(visited, want[:3]) {
+		t.Errorf("ItemsSorted visited %v, not %v", visited, want[:3])
+	}
+}
+
+func TestItemsSortedMayModifyCache(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.ItemsSorted(func(k string, v Item) bool {
+		tc.Delete(k)
+		return true
+	})
+	if n := tc.ItemCount(); n != 0 {
+		t.Errorf("%d items remain after deleting them all", n)
+	}
+}
+
+func TestKeysSortedByExpiration(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithSortByExpiration())
+	tc.Set("never", 1, NoExpiration)
+	tc.Set("later", 1, time.Hour)
+	tc.Set("soon", 1, time.Minute)
+	tc.Set("a-never", 1, NoExpiration)
+	want := []string{"soon", "later", "a-never", "never"}
+	if keys := tc.KeysSorted(); !reflect.DeepEqual(keys, want) {
+		t.Errorf("KeysSorted returned %v, not %v", keys, want)
+	}
+}
+
+func TestShardedKeysSorted(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	var want []string
+	for i := 0; i < 100; i++ {
+		k := strconv.Itoa(1000 + i)
+		want = append(want, k)
+		tc.Set(k, i, DefaultExpiration)
+	}
+	if keys := tc.KeysSorted(); !reflect.DeepEqual(keys, want) {
+		t.Errorf("KeysSorted returned %v, not %v", keys, want)
+	}
+	i := 0
+	tc.ItemsSorted(func(k string, v Item) bool {
+		if k != want[i] || v.Object.(int) != i {
+			t.Errorf("item %d is %s: %v", i, k, v.Object)
+		}
+		i++
+		return true
+	})
+	if i != len(want) {
+		t.Errorf("ItemsSorted visited %d items, not %d", i, len(want))
+	}
+}
+
+func TestShardedKeysSortedByExpiration(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13, WithSortByExpiration())
+	var want []string
+	for i := 0; i < 50; i++ {
+		k := strconv.Itoa(i)
+		want = append(want, k)
+		tc.Set(k, i, time.Duration(i+1)*time.Minute)
+	}
+	tc.Set("never", 1, NoExpiration)
+	want = append(want, "never")
+	if keys := tc.KeysSorted(); !reflect.DeepEqual(keys, want) {
+		t.Errorf("KeysSorted returned %v, not %v", keys, want)
+	}
+}
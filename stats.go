@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DurationHistogramBounds are the inclusive upper bounds of the buckets of a
+// DurationHistogram. The last bucket holds longer durations and NoExpiration.
+var DurationHistogramBounds = [...]time.Duration{
+	1 * time.Second,
+	10 * time.Second,
+	1 * time.Minute,
+	10 * time.Minute,
+	1 * time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+}
+
+// DurationHistogram counts durations by bucket. Bucket i counts durations
+// no longer than DurationHistogramBounds[i] (and longer than the previous
+// bound); the last bucket counts longer durations and NoExpiration.
+type DurationHistogram [len(DurationHistogramBounds) + 1]uint64
+
+func durationBucket(d time.Duration) int {
+	if d < 0 {
+		return len(DurationHistogramBounds)
+	}
+	for i, b := range DurationHistogramBounds {
+		if d <= b {
+			return i
+		}
+	}
+	return len(DurationHistogramBounds)
+}
+
+// Adds d to the histogram with a single atomic operation.
+func (h *DurationHistogram) observe(d time.Duration) {
+	atomic.AddUint64(&h[durationBucket(d)], 1)
+}
+
+func (h *DurationHistogram) load() DurationHistogram {
+	var s DurationHistogram
+	for i := range h {
+		s[i] = atomic.LoadUint64(&h[i])
+	}
+	return s
+}
+
+// CallbackStats describes how long the OnEvicted callback took. Only one in
+// every callbackSampleRate calls is timed, to keep the overhead low.
+type CallbackStats struct {
+	// The number of calls that were timed.
+	Samples uint64
+	// The total and longest durations of the timed calls.
+	Total, Max time.Duration
+}
+
+// Mean returns the average duration of the timed calls, or 0 if there were
+// none.
+func (s CallbackStats) Mean() time.Duration {
+	if s.Samples == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Samples)
+}
+
+// One in every callbackSampleRate OnEvicted calls is timed.
+const callbackSampleRate = 8
+
+// Stats holds statistics about how a cache is used. See EnableStats.
+type Stats struct {
+	// Name is the name the cache was given with WithName, if any.
+	Name string
+	// TTLs counts the expiration durations items were set with (after
+	// substituting the cache's default for DefaultExpiration.)
+	TTLs DurationHistogram
+	// Lifetimes counts how long items were in the cache before they were
+	// removed, whether because they expired, were evicted or were deleted.
+	// Items that expired are counted as living until their expiration time,
+	// regardless of when they were cleaned up. Items that were overwritten
+	// aren't counted.
+	Lifetimes DurationHistogram
+	// EvictionCallbacks describes how long the OnEvicted callback took, e.g.
+	// to find a slow callback that stalls the janitor.
+	EvictionCallbacks CallbackStats
+}
+
+type stats struct {
+	ttls      DurationHistogram
+	lifetimes DurationHistogram
+
+	callbackCalls   uint64
+	callbackSamples uint64
+	callbackTotal   int64
+	callbackMax     int64
+}
+
+// Reports whether the next OnEvicted call should be timed.
+func (s *stats) sampleCallback() bool {
+	return (atomic.AddUint64(&s.callbackCalls, 1)-1)%callbackSampleRate == 0
+}
+
+// Records the duration of a timed OnEvicted call.
+func (s *stats) observeCallback(d time.Duration) {
+	atomic.AddUint64(&s.callbackSamples, 1)
+	atomic.AddInt64(&s.callbackTotal, int64(d))
+	for {
+		max := atomic.LoadInt64(&s.callbackMax)
+		if int64(d) <= max || atomic.CompareAndSwapInt64(&s.callbackMax, max, int64(d)) {
+			return
+		}
+	}
+}
+
+func (s *stats) callbacks() CallbackStats {
+	return CallbackStats{
+		Samples: atomic.LoadUint64(&s.callbackSamples),
+		Total:   time.Duration(atomic.LoadInt64(&s.callbackTotal)),
+		Max:     time.Duration(atomic.LoadInt64(&s.callbackMax)),
+	}
+}
+
+// Records the lifetime of an item being removed at now.
+func (s *stats) removed(v Item, now int64) {
+	if v.Created == 0 {
+		return
+	}
+	end := now
+	if v.Expiration > 0 && v.Expiration < end {
+		end = v.Expiration
+	}
+	s.lifetimes.observe(time.Duration(end - v.Created))
+}
+
+// EnableStats makes the cache collect the statistics returned by Stats. This
+// adds a little overhead to every write, and to every eighth OnEvicted call. Lifetimes are only recorded for items
+// set after stats were enabled.
+func (c *cache) EnableStats() {
+	c.mu.Lock()
+	if c.stats == nil {
+		c.stats = &stats{}
+	}
+	c.mu.Unlock()
+}
+
+// Stats returns a snapshot of the cache's statistics, which are all zero unless
+// EnableStats was called.
+func (c *cache) Stats() Stats {
+	c.mu.RLock()
+	s := c.stats
+	c.mu.RUnlock()
+	if s == nil {
+		return Stats{Name: c.name}
+	}
+	return Stats{
+		Name:              c.name,
+		TTLs:              s.ttls.load(),
+		Lifetimes:         s.lifetimes.load(),
+		EvictionCallbacks: s.callbacks(),
+	}
+}
+
+// EnableStats makes every shard collect statistics. See the cache's
+// EnableStats.
+func (sc *shardedCache) EnableStats() {
+	for _, v := range sc.cs {
+		v.EnableStats()
+	}
+}
+
+// Stats returns the sum of the statistics of all shards.
+func (sc *shardedCache) Stats() Stats {
+	res := Stats{Name: sc.name}
+	for _, v := range sc.cs {
+		s := v.Stats()
+		for i := range res.TTLs {
+			res.TTLs[i] += s.TTLs[i]
+			res.Lifetimes[i] += s.Lifetimes[i]
+		}
+		res.EvictionCallbacks.Samples += s.EvictionCallbacks.Samples
+		res.EvictionCallbacks.Total += s.EvictionCallbacks.Total
+		if s.EvictionCallbacks.Max > res.EvictionCallbacks.Max {
+			res.EvictionCallbacks.Max = s.EvictionCallbacks.Max
+		}
+	}
+	return res
+}
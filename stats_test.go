@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDurationBucket(t *testing.T) {
+	cases := []struct {
+		d    time.Duration
+		want int
+	}{
+		{0, 0},
+		{1 * time.Second, 0},
+		{1*time.Second + 1, 1},
+		{10 * time.Second, 1},
+		{1 * time.Minute, 2},
+		{1*time.Minute + 1, 3},
+		{10 * time.Minute, 3},
+		{1 * time.Hour, 4},
+		{6 * time.Hour, 5},
+		{24 * time.Hour, 6},
+		{24*time.Hour + 1, 7},
+		{NoExpiration, 7},
+	}
+	for _, c := range cases {
+		if got := durationBucket(c.d); got != c.want {
+			t.Errorf("durationBucket(%v) = %d, not %d", c.d, got, c.want)
+		}
+	}
+}
+
+func TestStatsTTLs(t *testing.T) {
+	tc := New(10*time.Minute, 0)
+	tc.Set("a", 1, 1*time.Second)
+	tc.Set("b", 1, 30*time.Second)
+	tc.SetDefault("c", 1)
+	if s := tc.Stats(); s != (Stats{}) {
+		t.Error("stats were collected before EnableStats was called")
+	}
+
+	tc.EnableStats()
+	tc.Set("a", 1, 1*time.Second)
+	tc.Set("b", 1, 30*time.Second)
+	tc.SetDefault("c", 1)
+	tc.Add("d", 1, NoExpiration)
+	tc.Replace("d", 1, 2*time.Hour)
+	s := tc.Stats()
+	want := DurationHistogram{1, 0, 1, 1, 0, 1, 0, 1}
+	if s.TTLs != want {
+		t.Errorf("TTLs are %v, not %v", s.TTLs, want)
+	}
+}
+
+func TestStatsLifetimes(t *testing.T) {
+	clk := &manualClock{t: time.Unix(1000, 0)}
+	tc := New(DefaultExpiration, 0, WithClock(clk))
+	tc.EnableStats()
+	tc.Set("a", 1, 1*time.Millisecond)
+	tc.Set("b", 1, DefaultExpiration)
+	tc.Set("c", 1, DefaultExpiration)
+	tc.Set("c", 2, DefaultExpiration)
+	clk.Advance(5 * time.Millisecond)
+	tc.DeleteExpired()
+	tc.Delete("b")
+	if s := tc.Stats(); s.Lifetimes[0] != 2 {
+		t.Errorf("Lifetimes are %v, not 2 in the first bucket", s.Lifetimes)
+	}
+	tc.Flush()
+	if s := tc.Stats(); s.Lifetimes[0] != 3 {
+		t.Errorf("Lifetimes are %v after Flush, not 3 in the first bucket", s.Lifetimes)
+	}
+
+	// An expired item counts as living until its expiration time, however
+	// late it is cleaned up.
+	var st stats
+	st.removed(Item{Created: 1, Expiration: 1 + int64(time.Second)}, 1+int64(time.Hour))
+	if st.lifetimes[0] != 1 {
+		t.Errorf("lifetime of an expired item was not capped at its expiration: %v", st.lifetimes)
+	}
+}
+
+func TestShardedStats(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	tc.EnableStats()
+	for _, v := range shardedKeys {
+		tc.Set(v, "value", 1*time.Second)
+	}
+	if n := tc.Stats().TTLs[0]; n != uint64(len(shardedKeys)) {
+		t.Errorf("%d TTLs were recorded in the first bucket, not %d", n, len(shardedKeys))
+	}
+}
+
+func TestStatsEvictionCallbacks(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.EnableStats()
+	tc.OnEvicted(func(k string, v interface{}) {
+		if k == "slow" {
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+	// The first call is always timed.
+	tc.Set("slow", 1, DefaultExpiration)
+	tc.Delete("slow")
+	for i := 0; i < 2*callbackSampleRate-1; i++ {
+		tc.Set("fast", i, DefaultExpiration)
+		tc.Delete("fast")
+	}
+	cs := tc.Stats().EvictionCallbacks
+	if cs.Samples != 2 {
+		t.Errorf("%d calls were timed, not 2", cs.Samples)
+	}
+	if cs.Max < 5*time.Millisecond {
+		t.Errorf("Max is %v, less than the slow callback took", cs.Max)
+	}
+	if m := cs.Mean(); m < cs.Max/2 || m > cs.Max {
+		t.Errorf("Mean is %v, with Max %v", m, cs.Max)
+	}
+}
+
+func TestShardedStatsEvictionCallbacks(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 4)
+	tc.EnableStats()
+	tc.OnEvicted(func(k string, v interface{}) {})
+	for i := 0; i < 100; i++ {
+		k := strconv.Itoa(i)
+		tc.Set(k, i, DefaultExpiration)
+		tc.Delete(k)
+	}
+	if cs := tc.Stats().EvictionCallbacks; cs.Samples < 100/callbackSampleRate {
+		t.Errorf("%d calls were timed, fewer than %d", cs.Samples, 100/callbackSampleRate)
+	}
+}
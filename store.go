@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"time"
+)
+
+// Store is the set of operations common to Cache and ShardedCache, so that
+// code can work with either.
+type Store interface {
+	Set(k string, x interface{}, d time.Duration)
+	Get(k string) (interface{}, bool)
+	Delete(k string)
+	// RangeTTL calls f for each unexpired item with its remaining time to
+	// live (NoExpiration if it never expires), stopping if f returns false.
+	RangeTTL(f func(k string, x interface{}, ttl time.Duration) bool)
+}
+
+var (
+	_ Store = (*Cache)(nil)
+	_ Store = (*ShardedCache)(nil)
+)
+
+// RangeTTL calls f for each unexpired item in the cache with its remaining time
+// to live, or NoExpiration if it never expires, stopping if f returns false. f
+// is called on a snapshot of the items taken when RangeTTL was called, without
+// any locks held, so it may modify the cache.
+func (c *cache) RangeTTL(f func(k string, x interface{}, ttl time.Duration) bool) {
+	c.rangeTTL(c.Items(), f)
+}
+
+// Calls f for each item in m that hasn't expired by the time it is visited.
+// Returns false if iteration was stopped early.
+func (c *cache) rangeTTL(m map[string]Item, f func(k string, x interface{}, ttl time.Duration) bool) bool {
+	for k, v := range m {
+		ttl := NoExpiration
+		if v.Expiration > 0 {
+			ttl = time.Duration(v.Expiration - c.now().UnixNano())
+			if ttl <= 0 {
+				continue
+			}
+		}
+		if !f(k, v.Object, ttl) {
+			return false
+		}
+	}
+	return true
+}
+
+// RangeTTL calls f for each unexpired item in the cache with its remaining time
+// to live. Each shard is snapshotted in turn just before its items are visited,
+// so f may modify the cache, but the items visited are not a consistent
+// snapshot across shards. See the cache's RangeTTL.
+func (sc *shardedCache) RangeTTL(f func(k string, x interface{}, ttl time.Duration) bool) {
+	for _, v := range sc.cs {
+		if !v.rangeTTL(v.Items(), f) {
+			return
+		}
+	}
+}
+
+// CopyBetween sets every unexpired item in src into dst with its remaining time
+// to live, and returns the number of items copied. It can be used to migrate
+// between a Cache and a ShardedCache.
+func CopyBetween(dst, src Store) int {
+	n := 0
+	src.RangeTTL(func(k string, x interface{}, ttl time.Duration) bool {
+		dst.Set(k, x, ttl)
+		n++
+		return true
+	})
+	return n
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCopyBetween(t *testing.T) {
+	clk := &manualClock{t: time.Unix(1000, 0)}
+	src := New(DefaultExpiration, 0, WithClock(clk))
+	src.Set("a", 1, NoExpiration)
+	src.Set("b", 2, 1*time.Hour)
+	src.Set("c", 3, 1*time.Millisecond)
+	clk.Advance(5 * time.Millisecond)
+
+	sc := NewSharded(DefaultExpiration, 0, 13, WithClock(clk))
+	if n := CopyBetween(sc, src); n != 2 {
+		t.Errorf("CopyBetween copied %d items, not 2", n)
+	}
+	if x, found := sc.Get("a"); !found || x.(int) != 1 {
+		t.Error("a was not copied")
+	}
+	if _, found := sc.Get("c"); found {
+		t.Error("c was copied even though it expired")
+	}
+	_, exp, found := sc.bucket("b").GetWithExpiration("b")
+	if !found {
+		t.Fatal("b was not copied")
+	}
+	if ttl := exp.Sub(clk.Now()); ttl != time.Hour-5*time.Millisecond {
+		t.Errorf("b's remaining TTL was not preserved: %v", ttl)
+	}
+	_, exp, _ = sc.bucket("a").GetWithExpiration("a")
+	if !exp.IsZero() {
+		t.Error("a was copied with an expiration time")
+	}
+
+	dst := New(DefaultExpiration, 0)
+	if n := CopyBetween(dst, sc); n != 2 {
+		t.Errorf("CopyBetween copied %d items back, not 2", n)
+	}
+	if x, found := dst.Get("b"); !found || x.(int) != 2 {
+		t.Error("b was not copied back")
+	}
+}
+
+func TestRangeTTLStops(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	for _, v := range shardedKeys {
+		tc.Set(v, "value", DefaultExpiration)
+	}
+	n := 0
+	tc.RangeTTL(func(k string, x interface{}, ttl time.Duration) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("RangeTTL did not stop; visited %d items", n)
+	}
+}
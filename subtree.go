@@ -0,0 +1,70 @@
+package cache
+
+import "strings"
+
+// Reports whether k is prefix itself or lies under it in a hierarchy of keys
+// whose levels are separated by sep.
+func inSubtree(k, prefix, sep string) bool {
+	if prefix == "" || sep == "" {
+		return strings.HasPrefix(k, prefix)
+	}
+	return strings.HasPrefix(k, prefix) && (len(k) == len(prefix) || strings.HasPrefix(k[len(prefix):], sep))
+}
+
+// DeleteSubtree deletes the item with the key prefix and every item whose key
+// lies under it in a hierarchy whose levels are separated by sep, and returns
+// the number of items deleted. For example, DeleteSubtree("a/b", "/") deletes
+// "a/b" and "a/b/c", but not "a/bc". A trailing separator on prefix is
+// ignored. An empty prefix deletes all items, and an empty sep matches keys
+// that merely start with prefix.
+func (c *cache) DeleteSubtree(prefix, sep string) int {
+	if sep != "" {
+		prefix = strings.TrimSuffix(prefix, sep)
+	}
+	if c.coalescer != nil {
+		c.coalescer.removeFunc(func(k string) bool {
+			return inSubtree(k, prefix, sep)
+		})
+	}
+	var evictedItems []keyAndValue
+	now := c.now().UnixNano()
+	c.mu.Lock()
+	n := 0
+	for k, v := range c.items {
+		if !inSubtree(k, prefix, sep) {
+			continue
+		}
+		n++
+		ov, evicted := c.delete(k)
+		if evicted {
+			reason := EvictionReasonDeleted
+			if v.Expiration > 0 && now > v.Expiration {
+				reason = EvictionReasonExpired
+			}
+			evictedItems = append(evictedItems, keyAndValue{k, ov, reason})
+		}
+	}
+	if c.disk != nil {
+		for k := range c.disk.index {
+			if inSubtree(k, prefix, sep) {
+				kv, _ := c.dropSpilled(k, EvictionReasonDeleted)
+				evictedItems = append(evictedItems, kv...)
+				n++
+			}
+		}
+	}
+	c.refreshBloom()
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+	return n
+}
+
+// DeleteSubtree deletes the items in every shard whose keys lie under prefix.
+// See the cache's DeleteSubtree.
+func (sc *shardedCache) DeleteSubtree(prefix, sep string) int {
+	n := 0
+	for _, c := range sc.cs {
+		n += c.DeleteSubtree(prefix, sep)
+	}
+	return n
+}
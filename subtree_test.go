@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestInSubtree(t *testing.T) {
+	cases := []struct {
+		k, prefix, sep string
+		want           bool
+	}{
+		{"a/b", "a/b", "/", true},
+		{"a/b/c", "a/b", "/", true},
+		{"a/b/c/d", "a/b", "/", true},
+		{"a/bc", "a/b", "/", false},
+		{"a", "a/b", "/", false},
+		{"x/a/b", "a/b", "/", false},
+		{"a::b", "a", "::", true},
+		{"a:b", "a", "::", false},
+		{"a/bc", "a/b", "", true},
+		{"anything", "", "/", true},
+	}
+	for _, c := range cases {
+		if got := inSubtree(c.k, c.prefix, c.sep); got != c.want {
+			t.Errorf("inSubtree(%q, %q, %q) = %v, not %v", c.k, c.prefix, c.sep, got, c.want)
+		}
+	}
+}
+
+func TestDeleteSubtree(t *testing.T) {
+	keys := []string{"a", "a/b", "a/b/c", "a/b/c/d", "a/bc", "a/x"}
+	tc := New(DefaultExpiration, 0)
+	for _, k := range keys {
+		tc.Set(k, k, DefaultExpiration)
+	}
+	var evicted []string
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = append(evicted, k)
+	})
+	if n := tc.DeleteSubtree("a/b/", "/"); n != 3 {
+		t.Errorf("DeleteSubtree deleted %d items, not 3", n)
+	}
+	sort.Strings(evicted)
+	if len(evicted) != 3 || evicted[0] != "a/b" || evicted[1] != "a/b/c" || evicted[2] != "a/b/c/d" {
+		t.Errorf("deleted %v", evicted)
+	}
+	for _, k := range []string{"a", "a/bc", "a/x"} {
+		if _, found := tc.Get(k); !found {
+			t.Errorf("%s was deleted", k)
+		}
+	}
+}
+
+func TestShardedDeleteSubtree(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 4)
+	for _, k := range []string{"cfg.db", "cfg.db.host", "cfg.db.port", "cfg.dbx", "cfg.cache.size"} {
+		tc.Set(k, k, DefaultExpiration)
+	}
+	if n := tc.DeleteSubtree("cfg.db", "."); n != 3 {
+		t.Errorf("DeleteSubtree deleted %d items, not 3", n)
+	}
+	if n := tc.ItemCount(); n != 2 {
+		t.Errorf("ItemCount is %d, not 2", n)
+	}
+	if _, found := tc.Get("cfg.dbx"); !found {
+		t.Error("cfg.dbx was deleted")
+	}
+}
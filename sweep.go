@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"runtime"
+)
+
+// WithSweepChunkSize makes DeleteExpired, and so the janitor, delete expired
+// items in chunks of at most n, so that a sweep of a large cache never holds
+// the write lock for longer than it takes to delete n items. The expired keys
+// are first found under the read lock, which doesn't block Get and the other
+// read methods, then deleted n at a time, yielding to other goroutines between
+// chunks. Items set again in the meantime are left alone. If n is 0 or less,
+// the default, the whole sweep is done under a single write lock, which is
+// faster overall but blocks readers for its whole duration.
+//
+// For a sharded cache, the limit applies to each shard.
+func WithSweepChunkSize(n int) Option {
+	return func(o *options) {
+		o.sweepChunk = n
+	}
+}
+
+// Like deleteExpired, but deletes the expired items c.sweepChunk at a time,
+// releasing the write lock between chunks. See WithSweepChunkSize.
+func (c *cache) deleteExpiredChunked(now int64, collect bool) (uint32, []KV) {
+	c.mu.RLock()
+	stream := c.expirations
+	collect = collect || stream != nil
+	var expired []string
+	expiring := false
+	for k, v := range c.items {
+		if v.Expiration > 0 && now <= v.Expiration {
+			expiring = true
+		} else if v.Expiration > 0 {
+			expired = append(expired, k)
+		}
+	}
+	if c.disk != nil {
+		expiring = expiring || c.disk.expiring()
+	}
+	// Items set from now on mark the cache as expiring themselves, as Set
+	// needs the write lock.
+	c.mayExpire.Store(expiring)
+	c.mu.RUnlock()
+
+	var (
+		evictedItems []keyAndValue
+		kvs          []KV
+		deleted      uint32
+	)
+	for {
+		n := len(expired)
+		if n > c.sweepChunk {
+			n = c.sweepChunk
+		}
+		c.mu.Lock()
+		for _, k := range expired[:n] {
+			// The item may have been deleted or set again since it
+			// was found.
+			v, found := c.items[k]
+			if !found || v.Expiration == 0 || now <= v.Expiration {
+				continue
+			}
+			deleted++
+			if collect {
+				kvs = append(kvs, KV{k, v.Object})
+			}
+			if ov, evicted := c.delete(k); evicted {
+				evictedItems = append(evictedItems, keyAndValue{k, ov, EvictionReasonExpired})
+			}
+		}
+		expired = expired[n:]
+		last := len(expired) == 0
+		if last {
+			if c.disk != nil {
+				evictedItems = append(evictedItems, c.deleteExpiredSpilled(now)...)
+			}
+			if c.tombstones != nil && c.purgeTombstones(now) {
+				c.mayExpire.Store(true)
+			}
+			c.refreshBloom()
+		}
+		c.mu.Unlock()
+		if last {
+			break
+		}
+		runtime.Gosched()
+	}
+	c.finishExpired(evictedItems, kvs, stream)
+	return deleted, kvs
+}
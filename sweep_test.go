@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSweepChunkSize(t *testing.T) {
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := New(DefaultExpiration, 0, WithClock(clk), WithSweepChunkSize(3))
+	var notified int32
+	tc.OnEvicted(func(k string, v interface{}) {
+		atomic.AddInt32(&notified, 1)
+	})
+	for i := 0; i < 10; i++ {
+		tc.Set("exp"+strconv.Itoa(i), i, time.Second)
+		tc.Set("keep"+strconv.Itoa(i), i, NoExpiration)
+	}
+	tc.Set("later", 1, time.Hour)
+	clk.Advance(2 * time.Second)
+
+	kvs := tc.DeleteExpiredReturn()
+	if len(kvs) != 10 {
+		t.Errorf("got %d expired items, want 10", len(kvs))
+	}
+	for _, kv := range kvs {
+		if want, _ := strconv.Atoi(kv.Key[len("exp"):]); kv.Value != want {
+			t.Errorf("got %v for %s, want %d", kv.Value, kv.Key, want)
+		}
+	}
+	if n := atomic.LoadInt32(&notified); n != 10 {
+		t.Errorf("OnEvicted called %d times, want 10", n)
+	}
+	if n := tc.ItemCount(); n != 11 {
+		t.Errorf("got item count %d, want 11", n)
+	}
+	if !tc.mayExpire.Load() {
+		t.Error("cache holding an item that expires later isn't marked as expiring")
+	}
+
+	clk.Advance(2 * time.Hour)
+	tc.DeleteExpired()
+	if tc.mayExpire.Load() {
+		t.Error("cache holding only items that never expire is marked as expiring")
+	}
+	if n := tc.ItemCount(); n != 10 {
+		t.Errorf("got item count %d, want 10", n)
+	}
+}
+
+func TestShardedSweepChunkSize(t *testing.T) {
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := NewShardedWithOptions(WithShards(4), WithClock(clk), WithSweepChunkSize(2))
+	for i := 0; i < 20; i++ {
+		tc.Set("foo"+strconv.Itoa(i), i, time.Second)
+	}
+	clk.Advance(2 * time.Second)
+	tc.DeleteExpired()
+	if n := tc.ItemCount(); n != 0 {
+		t.Errorf("got item count %d, want 0", n)
+	}
+}
+
+// Reports the longest a Get waits while DeleteExpired sweeps a large cache of
+// which half has expired, to compare sweeping under a single write lock with
+// sweeping in chunks.
+func benchmarkSweepContention(b *testing.B, opts ...Option) {
+	const n = 200000
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := New(DefaultExpiration, 0, append(opts, WithClock(clk))...)
+	var worst time.Duration
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		for j := 0; j < n; j++ {
+			d := NoExpiration
+			if j%2 == 0 {
+				d = time.Second
+			}
+			tc.Set("foo"+strconv.Itoa(j), j, d)
+		}
+		clk.Advance(2 * time.Second)
+		var (
+			stop int32
+			wg   sync.WaitGroup
+		)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; atomic.LoadInt32(&stop) == 0; j++ {
+				start := time.Now()
+				tc.Get("foo" + strconv.Itoa(j%n))
+				if d := time.Since(start); d > worst {
+					worst = d
+				}
+			}
+		}()
+		b.StartTimer()
+		tc.DeleteExpired()
+		b.StopTimer()
+		atomic.StoreInt32(&stop, 1)
+		wg.Wait()
+	}
+	b.ReportMetric(float64(worst), "max-get-ns")
+}
+
+func BenchmarkSweepContentionSingleLock(b *testing.B) {
+	benchmarkSweepContention(b)
+}
+
+func BenchmarkSweepContentionChunked(b *testing.B) {
+	benchmarkSweepContention(b, WithSweepChunkSize(1000))
+}
@@ -0,0 +1,239 @@
+package cache
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTooManyTags is the Kind of the CacheError returned by SetWithTags if
+// setting the item would exceed the limits set using WithMaxTagsPerItem or
+// WithMaxTags.
+var ErrTooManyTags = errors.New("Too many tags")
+
+// SetWithTags adds an item to the cache, replacing any existing item, and
+// associates it with the given tags so that it can later be removed together
+// with every other item carrying one of them using InvalidateTag. Overwriting
+// the item (e.g. using Set) or removing it drops its tags.
+//
+// Returns an error wrapping ErrTooManyTags, without setting the item, if it
+// would carry more tags than allowed by WithMaxTagsPerItem, or if it would take
+// the number of distinct tags in use in the cache beyond the limit set by
+// WithMaxTags.
+// Existing tags are never dropped to make room for new ones.
+func (c *cache) SetWithTags(k string, x interface{}, d time.Duration, tags ...string) error {
+	tags = distinctTags(tags)
+	if c.maxTagsPerItem > 0 && len(tags) > c.maxTagsPerItem {
+		return keyError("SetWithTags", k, ErrTooManyTags, "Item %s can't have %d tags", len(tags))
+	}
+	c.mu.Lock()
+	if c.maxTags > 0 && c.tagCountAfter(k, tags) > c.maxTags {
+		c.mu.Unlock()
+		return c.tooManyTags(k)
+	}
+	evictedItems, err := c.setTagged(k, x, d, tags)
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+	return err
+}
+
+// Like SetWithTags, once the tags have been checked, but c.mu must be held. The
+// OnEvicted callbacks for the returned items must be run once it has been
+// released.
+func (c *cache) setTagged(k string, x interface{}, d time.Duration, tags []string) ([]keyAndValue, error) {
+	if c.tombstoned(k) {
+		return nil, keyError("SetWithTags", k, ErrTombstoned, "Item %s was deleted too recently")
+	}
+	evictedItems := c.set(k, x, d)
+	if len(tags) > 0 {
+		c.tag(k, tags)
+	}
+	return evictedItems, nil
+}
+
+func (c *cache) tooManyTags(k string) error {
+	return keyError("SetWithTags", k, ErrTooManyTags, "Item %s would take the number of tags beyond %d", c.maxTags)
+}
+
+// Returns a copy of tags without duplicates, which the cache can keep without
+// being affected by changes the caller makes to tags.
+func distinctTags(tags []string) []string {
+	if len(tags) < 2 {
+		return append([]string(nil), tags...)
+	}
+	seen := make(map[string]struct{}, len(tags))
+	res := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if _, found := seen[tag]; !found {
+			seen[tag] = struct{}{}
+			res = append(res, tag)
+		}
+	}
+	return res
+}
+
+// Returns the number of distinct tags that would be in use if k were tagged
+// with tags instead of its current tags. c.mu must be held.
+func (c *cache) tagCountAfter(k string, tags []string) int {
+	onlyK := func(tag string) bool {
+		keys := c.tags[tag]
+		_, found := keys[k]
+		return found && len(keys) == 1
+	}
+	n := len(c.tags)
+	for _, tag := range c.keyTags[k] {
+		if onlyK(tag) {
+			n--
+		}
+	}
+	for _, tag := range tags {
+		if _, found := c.tags[tag]; !found || onlyK(tag) {
+			n++
+		}
+	}
+	return n
+}
+
+// InvalidateTag deletes all items carrying the given tag, and returns the
+// number of items that were deleted.
+func (c *cache) InvalidateTag(tag string) int {
+	var evictedItems []keyAndValue
+	c.mu.Lock()
+	keys := c.tags[tag]
+	n := len(keys)
+	for k := range keys {
+		ov, evicted := c.delete(k)
+		if evicted {
+			evictedItems = append(evictedItems, keyAndValue{k, ov, EvictionReasonDeleted})
+		}
+	}
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+	return n
+}
+
+// Tags returns each tag in use and the number of unexpired items carrying it.
+func (c *cache) Tags() map[string]int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m := make(map[string]int, len(c.tags))
+	now := c.now().UnixNano()
+	for tag, keys := range c.tags {
+		n := 0
+		for k := range keys {
+			// "Inlining" of Expired
+			if v := c.items[k]; v.Expiration > 0 && now > v.Expiration {
+				continue
+			}
+			n++
+		}
+		if n > 0 {
+			m[tag] = n
+		}
+	}
+	return m
+}
+
+// Associates k with tags. c.mu must be held, and k must not already be tagged.
+func (c *cache) tag(k string, tags []string) {
+	if c.tags == nil {
+		c.tags = map[string]map[string]struct{}{}
+		c.keyTags = map[string][]string{}
+	}
+	for _, tag := range tags {
+		keys, found := c.tags[tag]
+		if !found {
+			keys = map[string]struct{}{}
+			c.tags[tag] = keys
+		}
+		keys[k] = struct{}{}
+	}
+	c.keyTags[k] = tags
+}
+
+// Removes k from the tag index. c.mu must be held.
+func (c *cache) untag(k string) {
+	tags, found := c.keyTags[k]
+	if !found {
+		return
+	}
+	for _, tag := range tags {
+		keys := c.tags[tag]
+		delete(keys, k)
+		if len(keys) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+	delete(c.keyTags, k)
+}
+
+// SetWithTags adds an item to the shard owning k, associating it with tags.
+// The limit set by WithMaxTags applies to the number of distinct tags in use
+// across all shards, so while it is set, SetWithTags locks every shard.
+func (sc *shardedCache) SetWithTags(k string, x interface{}, d time.Duration, tags ...string) error {
+	c := sc.bucket(k)
+	if c.maxTags <= 0 {
+		return c.SetWithTags(k, x, d, tags...)
+	}
+	tags = distinctTags(tags)
+	if c.maxTagsPerItem > 0 && len(tags) > c.maxTagsPerItem {
+		return keyError("SetWithTags", k, ErrTooManyTags, "Item %s can't have %d tags", len(tags))
+	}
+	for _, v := range sc.cs {
+		v.mu.Lock()
+	}
+	var (
+		evictedItems []keyAndValue
+		err          error
+	)
+	if sc.tagCountAfter(c, k, tags) > c.maxTags {
+		err = c.tooManyTags(k)
+	} else {
+		evictedItems, err = c.setTagged(k, x, d, tags)
+	}
+	for _, v := range sc.cs {
+		v.mu.Unlock()
+	}
+	c.notifyEvicted(evictedItems)
+	return err
+}
+
+// Returns the number of distinct tags that would be in use in all shards if k,
+// which belongs to shard c, were tagged with tags instead of its current tags.
+// The mu of every shard must be held.
+func (sc *shardedCache) tagCountAfter(c *cache, k string, tags []string) int {
+	seen := map[string]struct{}{}
+	for _, v := range sc.cs {
+		for tag, keys := range v.tags {
+			if _, found := keys[k]; v == c && found && len(keys) == 1 {
+				continue
+			}
+			seen[tag] = struct{}{}
+		}
+	}
+	for _, tag := range tags {
+		seen[tag] = struct{}{}
+	}
+	return len(seen)
+}
+
+// InvalidateTag deletes all items carrying the given tag from every shard, and
+// returns the number of items that were deleted.
+func (sc *shardedCache) InvalidateTag(tag string) int {
+	n := 0
+	for _, v := range sc.cs {
+		n += v.InvalidateTag(tag)
+	}
+	return n
+}
+
+// Tags returns each tag in use and the number of unexpired items carrying it,
+// summed across all shards.
+func (sc *shardedCache) Tags() map[string]int {
+	m := map[string]int{}
+	for _, v := range sc.cs {
+		for tag, n := range v.Tags() {
+			m[tag] += n
+		}
+	}
+	return m
+}
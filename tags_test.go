@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestInvalidateTag(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.SetWithTags("foo", 1, DefaultExpiration, "a", "b")
+	tc.SetWithTags("bar", 2, DefaultExpiration, "a")
+	tc.SetWithTags("baz", 3, DefaultExpiration, "b")
+	if n := tc.InvalidateTag("a"); n != 2 {
+		t.Errorf("InvalidateTag removed %d items, not 2", n)
+	}
+	if _, found := tc.Get("foo"); found {
+		t.Error("foo was found, but it should have been invalidated")
+	}
+	if _, found := tc.Get("bar"); found {
+		t.Error("bar was found, but it should have been invalidated")
+	}
+	if _, found := tc.Get("baz"); !found {
+		t.Error("baz was not found")
+	}
+	if n := tc.InvalidateTag("a"); n != 0 {
+		t.Errorf("InvalidateTag removed %d items, not 0", n)
+	}
+}
+
+func TestTags(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.SetWithTags("foo", 1, DefaultExpiration, "a", "b")
+	tc.SetWithTags("bar", 2, DefaultExpiration, "a")
+	tc.SetWithTags("baz", 3, 1*time.Millisecond, "a", "c")
+	<-time.After(5 * time.Millisecond)
+
+	tags := tc.Tags()
+	if len(tags) != 2 {
+		t.Errorf("Tags returned %d tags, not 2: %v", len(tags), tags)
+	}
+	if tags["a"] != 2 {
+		t.Errorf("tag a counts %d keys, not 2", tags["a"])
+	}
+	if tags["b"] != 1 {
+		t.Errorf("tag b counts %d keys, not 1", tags["b"])
+	}
+	if _, found := tags["c"]; found {
+		t.Error("tag c is only carried by an expired item but was counted")
+	}
+
+	// Overwriting or deleting an item drops its tags.
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Delete("bar")
+	tags = tc.Tags()
+	if tags["a"] != 0 || tags["b"] != 0 {
+		t.Errorf("tags were not dropped: %v", tags)
+	}
+}
+
+func TestShardedTags(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	for _, v := range shardedKeys {
+		tc.SetWithTags(v, "value", DefaultExpiration, "all")
+	}
+	if n := tc.Tags()["all"]; n != len(shardedKeys) {
+		t.Errorf("tag all counts %d keys, not %d", n, len(shardedKeys))
+	}
+	if n := tc.InvalidateTag("all"); n != len(shardedKeys) {
+		t.Errorf("InvalidateTag removed %d items, not %d", n, len(shardedKeys))
+	}
+	if n := tc.ItemCount(); n != 0 {
+		t.Errorf("ItemCount is not 0 after invalidating all items: %d", n)
+	}
+}
+
+func TestMaxTagsPerItem(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithMaxTagsPerItem(2))
+	if err := tc.SetWithTags("foo", 1, DefaultExpiration, "a", "b", "a"); err != nil {
+		t.Errorf("SetWithTags with 2 distinct tags returned %v", err)
+	}
+	if err := tc.SetWithTags("bar", 2, DefaultExpiration, "a", "b", "c"); !errors.Is(err, ErrTooManyTags) {
+		t.Errorf("SetWithTags with 3 tags returned %v, not ErrTooManyTags", err)
+	}
+	if _, found := tc.Get("bar"); found {
+		t.Error("an item with too many tags was set")
+	}
+}
+
+func TestMaxTags(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithMaxTags(3))
+	tc.SetWithTags("foo", 1, DefaultExpiration, "a", "b")
+	tc.SetWithTags("bar", 2, DefaultExpiration, "c")
+	if err := tc.SetWithTags("baz", 3, DefaultExpiration, "a", "d"); !errors.Is(err, ErrTooManyTags) {
+		t.Errorf("SetWithTags beyond the cap returned %v, not ErrTooManyTags", err)
+	}
+	if err := tc.SetWithTags("baz", 3, DefaultExpiration, "a", "c"); err != nil {
+		t.Errorf("SetWithTags with existing tags returned %v", err)
+	}
+	// Retagging bar frees c, making room for d.
+	if err := tc.SetWithTags("bar", 2, DefaultExpiration, "d"); !errors.Is(err, ErrTooManyTags) {
+		t.Errorf("SetWithTags returned %v, but c is still used by baz", err)
+	}
+	tc.Delete("baz")
+	if err := tc.SetWithTags("bar", 2, DefaultExpiration, "d"); err != nil {
+		t.Errorf("SetWithTags replacing bar's only tag returned %v", err)
+	}
+	if n := len(tc.Tags()); n != 3 {
+		t.Errorf("%d tags are in use, not 3", n)
+	}
+}
+
+func TestShardedMaxTags(t *testing.T) {
+	tc := NewShardedWithOptions(WithShards(4), WithMaxTags(2))
+	// Find three keys in different shards.
+	var keys []string
+	shards := map[*cache]bool{}
+	for i := 0; len(keys) < 3; i++ {
+		k := strconv.Itoa(i)
+		if c := tc.bucket(k); !shards[c] {
+			shards[c] = true
+			keys = append(keys, k)
+		}
+	}
+	if err := tc.SetWithTags(keys[0], 0, DefaultExpiration, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.SetWithTags(keys[1], 1, DefaultExpiration, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.SetWithTags(keys[2], 2, DefaultExpiration, "c"); !errors.Is(err, ErrTooManyTags) {
+		t.Errorf("SetWithTags beyond the cap in another shard returned %v, not ErrTooManyTags", err)
+	}
+	if err := tc.SetWithTags(keys[2], 2, DefaultExpiration, "a"); err != nil {
+		t.Errorf("SetWithTags with a tag used in another shard returned %v", err)
+	}
+	if err := tc.SetWithTags(keys[1], 1, DefaultExpiration, "c"); err != nil {
+		t.Errorf("SetWithTags replacing %s's only tag returned %v", keys[1], err)
+	}
+	if n := len(tc.Tags()); n != 2 {
+		t.Errorf("%d tags are in use, not 2", n)
+	}
+}
+
+func TestSetWithTagsCopiesTags(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tags := []string{"a"}
+	tc.SetWithTags("foo", 1, DefaultExpiration, tags...)
+	tags[0] = "b"
+	if n := tc.InvalidateTag("a"); n != 1 {
+		t.Errorf("InvalidateTag removed %d items after the caller's tags changed, not 1", n)
+	}
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTombstoned is the Kind of the CacheError Add, Replace and SetWithTags
+// return when the key was deleted too recently to be set again. See
+// WithStrictTombstones.
+var ErrTombstoned = errors.New("Item was deleted too recently")
+
+// WithDeleteTombstones makes Delete (and DeleteAndGet) leave a tombstone for
+// the deleted key, recording when it was deleted, for retention. While the
+// tombstone is kept, SetIfNewer rejects values with a timestamp that isn't
+// after the deletion, so that a stale value arriving late, e.g. from a remote
+// tier or a replayed feed of changes, can't bring back a key that was
+// invalidated. Tombstones aren't items: Get misses them, and they aren't
+// included in Items or ItemCount. The janitor, or DeleteExpired, drops them
+// once retention has passed.
+//
+// Other writes are allowed, and drop the tombstone, unless the cache was also
+// created with WithStrictTombstones.
+func WithDeleteTombstones(retention time.Duration) Option {
+	return func(o *options) {
+		o.tombstoneRetention = retention
+	}
+}
+
+// WithStrictTombstones makes every write without a timestamp to a key that has
+// a tombstone (see WithDeleteTombstones) drop the value, so that nothing but
+// SetIfNewer can bring the key back until the tombstone is dropped: Add,
+// Replace and SetWithTags return an error wrapping ErrTombstoned, the methods
+// that report whether they stored the value, e.g. SetKeepTTL, report false,
+// and the others, e.g. Set, SetAt, SetManyReport or SetWithMeta, skip the key.
+func WithStrictTombstones() Option {
+	return func(o *options) {
+		o.strictTombstones = true
+	}
+}
+
+// Records a tombstone for k, which was just deleted. c.mu must be held.
+func (c *cache) addTombstone(k string) {
+	c.tombstones[k] = c.now().UnixNano()
+	c.mayExpire.Store(true)
+}
+
+// Reports whether a write to k with the timestamp ts, in Unix nanoseconds, or
+// 0 if it has none, must be rejected because of a tombstone. c.mu must be
+// held.
+func (c *cache) tombstoneRejects(k string, ts int64) bool {
+	t, found := c.tombstones[k]
+	if !found || c.now().UnixNano()-t > int64(c.tombstoneRetention) {
+		return false
+	}
+	if ts != 0 {
+		return ts <= t
+	}
+	return c.strictTombstones
+}
+
+// Reports whether a write to k without a timestamp must be rejected because of
+// a tombstone. c.mu must be held.
+func (c *cache) tombstoned(k string) bool {
+	return c.tombstones != nil && c.tombstoneRejects(k, 0)
+}
+
+// Drops the tombstones older than the retention period, and reports whether
+// any are left. c.mu must be held.
+func (c *cache) purgeTombstones(now int64) bool {
+	for k, t := range c.tombstones {
+		if now-t > int64(c.tombstoneRetention) {
+			delete(c.tombstones, k)
+		}
+	}
+	return len(c.tombstones) > 0
+}
@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// A value read from a remote tier before a key was deleted locally arrives
+// after the delete, and must not bring the key back.
+func TestDeleteTombstonesResurrection(t *testing.T) {
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := New(DefaultExpiration, 0, WithClock(clk), WithDeleteTombstones(time.Minute))
+	tc.SetIfNewer("foo", "v1", clk.Now(), DefaultExpiration)
+	staleAt := clk.Now()
+	clk.Advance(time.Second)
+	tc.Delete("foo")
+	if _, found := tc.Get("foo"); found {
+		t.Fatal("foo was found after Delete")
+	}
+	if n := tc.ItemCount(); n != 0 {
+		t.Errorf("got item count %d, want 0", n)
+	}
+	if len(tc.Items()) != 0 {
+		t.Error("Items includes a tombstone")
+	}
+
+	clk.Advance(time.Second)
+	if tc.SetIfNewer("foo", "stale", staleAt, DefaultExpiration) {
+		t.Error("a value older than the delete was set")
+	}
+	if _, found := tc.Get("foo"); found {
+		t.Error("foo was resurrected by a stale value")
+	}
+	if !tc.SetIfNewer("foo", "v2", clk.Now(), DefaultExpiration) {
+		t.Error("a value newer than the delete was rejected")
+	}
+	if x, _ := tc.Get("foo"); x != "v2" {
+		t.Errorf("got %v, want v2", x)
+	}
+}
+
+func TestDeleteTombstonesRetention(t *testing.T) {
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := NewShardedWithOptions(WithShards(2), WithClock(clk), WithDeleteTombstones(time.Minute), WithCleanupInterval(time.Hour))
+	defer tc.janitor.Stop()
+	staleAt := clk.Now()
+	clk.Advance(time.Second)
+	tc.Delete("foo")
+	c := tc.bucket("foo")
+	if len(c.tombstones) != 1 {
+		t.Fatalf("got %d tombstones, want 1", len(c.tombstones))
+	}
+	tc.deleteExpired(false)
+	if len(c.tombstones) != 1 {
+		t.Error("the janitor dropped a tombstone within its retention")
+	}
+	clk.Advance(time.Minute + time.Nanosecond)
+	tc.deleteExpired(false)
+	if len(c.tombstones) != 0 {
+		t.Error("the janitor didn't drop an old tombstone")
+	}
+	if !tc.SetIfNewer("foo", "late", staleAt, DefaultExpiration) {
+		t.Error("a value was rejected after the tombstone was dropped")
+	}
+}
+
+func TestDeleteTombstonesNotStrict(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithDeleteTombstones(time.Minute))
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Delete("foo")
+	tc.Set("foo", 2, DefaultExpiration)
+	if x, _ := tc.Get("foo"); x != 2 {
+		t.Errorf("got %v, want 2", x)
+	}
+	if len(tc.tombstones) != 0 {
+		t.Error("Set didn't drop the tombstone")
+	}
+}
+
+func TestStrictTombstones(t *testing.T) {
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := New(DefaultExpiration, 0, WithClock(clk), WithDeleteTombstones(time.Minute), WithStrictTombstones())
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Delete("foo")
+	tc.Set("foo", 2, DefaultExpiration)
+	if _, found := tc.Get("foo"); found {
+		t.Error("Set resurrected a tombstoned key")
+	}
+	err := tc.Add("foo", 3, DefaultExpiration)
+	var ce *CacheError
+	if !errors.Is(err, ErrTombstoned) || !errors.As(err, &ce) || ce.Key != "foo" {
+		t.Errorf("Add: got %v, want a CacheError wrapping ErrTombstoned", err)
+	}
+	clk.Advance(time.Minute + time.Nanosecond)
+	if err := tc.Add("foo", 4, DefaultExpiration); err != nil {
+		t.Errorf("Add after the retention: %v", err)
+	}
+}
+
+func TestStrictTombstonesOtherWrites(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithDeleteTombstones(time.Minute), WithStrictTombstones(), WithKeepTTLFallback())
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Delete("foo")
+
+	tc.SetAt("foo", 2, time.Time{})
+	tc.SetManyAt(map[string]interface{}{"foo": 2}, time.Time{})
+	if created, updated := tc.SetManyReport(map[string]interface{}{"foo": 2}, DefaultExpiration); len(created)+len(updated) != 0 {
+		t.Errorf("SetManyReport reported %v created, %v updated", created, updated)
+	}
+	tc.SetWithMeta("foo", 2, DefaultExpiration, nil)
+	tc.SetWithCost("foo", 2, DefaultExpiration, time.Second)
+	tc.SetWithPriority("foo", 2, DefaultExpiration, PriorityHigh)
+	if tc.SetKeepTTL("foo", 2) {
+		t.Error("SetKeepTTL reported storing the value")
+	}
+	if tc.SetDebounced("foo", 2, DefaultExpiration, time.Second) {
+		t.Error("SetDebounced reported storing the value")
+	}
+	for op, err := range map[string]error{
+		"Replace":     tc.Replace("foo", 2, DefaultExpiration),
+		"SetWithTags": tc.SetWithTags("foo", 2, DefaultExpiration, "t"),
+	} {
+		if !errors.Is(err, ErrTombstoned) {
+			t.Errorf("%s: got %v, want an error wrapping ErrTombstoned", op, err)
+		}
+	}
+	if _, found := tc.Get("foo"); found {
+		t.Error("a write without a timestamp resurrected a tombstoned key")
+	}
+	if len(tc.items) != 0 {
+		t.Errorf("got items %v, want none", tc.items)
+	}
+	if !tc.SetIfNewer("foo", 3, time.Now().Add(time.Second), DefaultExpiration) {
+		t.Error("SetIfNewer rejected a value newer than the delete")
+	}
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"time"
+)
+
+// GetAndTouch gets an item from the cache and resets its expiration time to d
+// from now (see Set for DefaultExpiration and NoExpiration), both under a
+// single write lock, so that an item that is live when read can't expire
+// before its expiration time is pushed out, as it can between a Get and a
+// Touch. A missing or expired item is a miss, and isn't changed.
+func (c *cache) GetAndTouch(k string, d time.Duration) (interface{}, bool) {
+	x, found := c.touch(k, d)
+	c.recordLookup(found)
+	if !found {
+		return nil, false
+	}
+	return c.value(k, x)
+}
+
+// Touch resets the expiration time of an unexpired item to d from now, keeping
+// its value, and reports whether there was such an item. See GetAndTouch.
+func (c *cache) Touch(k string, d time.Duration) bool {
+	_, found := c.touch(k, d)
+	return found
+}
+
+// Resets the expiration time of k, returning its stored value if it was live.
+func (c *cache) touch(k string, d time.Duration) (interface{}, bool) {
+	c.flushPending(k)
+	if d == DefaultExpiration {
+		d = c.defaultExpiration
+	}
+	c.mu.Lock()
+	item, found := c.items[k]
+	if !found || c.expired(item) {
+		c.mu.Unlock()
+		return nil, false
+	}
+	var e int64
+	if d > 0 {
+		e = c.now().Add(d).UnixNano()
+	}
+	item.Expiration = e
+	c.items[k] = item
+	c.noteExpiration(e)
+	if c.evictor != nil {
+		c.evictor.Access(k)
+	}
+	c.mu.Unlock()
+	return item.Object, true
+}
+
+// GetAndTouch gets an item from the shard owning k and resets its expiration
+// time. See the cache's GetAndTouch.
+func (sc *shardedCache) GetAndTouch(k string, d time.Duration) (interface{}, bool) {
+	return sc.bucket(k).GetAndTouch(k, d)
+}
+
+// Touch resets the expiration time of an item in the shard owning k. See the
+// cache's Touch.
+func (sc *shardedCache) Touch(k string, d time.Duration) bool {
+	return sc.bucket(k).Touch(k, d)
+}
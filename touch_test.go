@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// A Clock that moves forward by step every time it is read, standing in for
+// time passing between the steps of an operation.
+type tickingClock struct {
+	mu   sync.Mutex
+	t    time.Time
+	step time.Duration
+}
+
+func (c *tickingClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.t
+	c.t = c.t.Add(c.step)
+	return t
+}
+
+func TestGetAndTouch(t *testing.T) {
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := New(time.Minute, 0, WithClock(clk))
+	if _, found := tc.GetAndTouch("foo", time.Hour); found {
+		t.Error("missing key was found")
+	}
+	tc.Set("foo", "bar", time.Second)
+	v, found := tc.GetAndTouch("foo", time.Hour)
+	if !found || v != "bar" {
+		t.Errorf("got (%v, %v), want (bar, true)", v, found)
+	}
+	if e, want := tc.items["foo"].Expiration, clk.Now().Add(time.Hour).UnixNano(); e != want {
+		t.Errorf("got expiration %d, want %d", e, want)
+	}
+	tc.GetAndTouch("foo", NoExpiration)
+	if e := tc.items["foo"].Expiration; e != 0 {
+		t.Errorf("got expiration %d after touching with NoExpiration, want 0", e)
+	}
+	tc.GetAndTouch("foo", DefaultExpiration)
+	if e, want := tc.items["foo"].Expiration, clk.Now().Add(time.Minute).UnixNano(); e != want {
+		t.Errorf("got expiration %d after touching with DefaultExpiration, want %d", e, want)
+	}
+
+	tc.Set("exp", "bar", time.Second)
+	clk.Advance(time.Second + time.Nanosecond)
+	if _, found := tc.GetAndTouch("exp", time.Hour); found {
+		t.Error("expired key was found")
+	}
+	if e, want := tc.items["exp"].Expiration, time.Unix(101, 0).UnixNano(); e != want {
+		t.Errorf("expired item was touched: got expiration %d, want %d", e, want)
+	}
+}
+
+// With time passing between the read and the touch, Get followed by Touch can
+// see a live item and then fail to extend it, while GetAndTouch can't.
+func TestGetAndTouchRace(t *testing.T) {
+	clk := &tickingClock{t: time.Unix(100, 0), step: time.Second}
+	tc := New(DefaultExpiration, 0, WithClock(clk))
+
+	// Each item expires at the time the first lookup after SetAt reads,
+	// as reading the clock here and in SetAt moves it on by two steps.
+	tc.SetAt("racy", "session", clk.Now().Add(2*time.Second))
+	if _, found := tc.Get("racy"); !found {
+		t.Fatal("Get missed a live item")
+	}
+	if tc.Touch("racy", time.Hour) {
+		t.Error("Touch extended an item that expired after the Get")
+	}
+
+	tc.SetAt("atomic", "session", clk.Now().Add(2*time.Second))
+	if _, found := tc.GetAndTouch("atomic", time.Hour); !found {
+		t.Fatal("GetAndTouch missed a live item")
+	}
+	if _, found := tc.Get("atomic"); !found {
+		t.Error("GetAndTouch didn't extend the item")
+	}
+}
+
+func TestTouch(t *testing.T) {
+	clk := &manualClock{t: time.Unix(100, 0)}
+	tc := New(NoExpiration, 0, WithClock(clk))
+	tc.Set("foo", "bar", NoExpiration)
+	tc.mayExpire.Store(false)
+	if !tc.Touch("foo", time.Second) {
+		t.Error("Touch missed a live item")
+	}
+	if !tc.mayExpire.Load() {
+		t.Error("cache holding an item that expires isn't marked as expiring")
+	}
+	if tc.Touch("missing", time.Second) {
+		t.Error("Touch found a missing item")
+	}
+}
+
+func TestShardedGetAndTouch(t *testing.T) {
+	tc := NewShardedWithOptions(WithShards(3))
+	tc.Set("foo", "bar", time.Second)
+	if v, found := tc.GetAndTouch("foo", NoExpiration); !found || v != "bar" {
+		t.Errorf("got (%v, %v), want (bar, true)", v, found)
+	}
+	if e := tc.bucket("foo").items["foo"].Expiration; e != 0 {
+		t.Errorf("got expiration %d, want 0", e)
+	}
+	if !tc.Touch("foo", time.Hour) {
+		t.Error("Touch missed a live item")
+	}
+}
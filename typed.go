@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"errors"
+	"reflect"
+)
+
+// ErrWrongType is wrapped by the error returned by GetAs when an item exists,
+// but its value isn't of the requested type.
+var ErrWrongType = errors.New("Wrong type")
+
+// GetAs gets an item from a Cache or ShardedCache and returns its value as a T.
+// It returns the value and true if the item was found and holds a T, the zero
+// value and false if it wasn't found or has expired, and the zero value, true
+// and a *CacheError wrapping ErrWrongType, naming the key and both types, if it
+// holds something else. A nil value is returned as the zero value if T is an
+// interface, pointer, slice, map, channel or function type.
+func GetAs[T any](c Store, k string) (T, bool, error) {
+	var zero T
+	x, found := c.Get(k)
+	if !found {
+		return zero, false, nil
+	}
+	if v, ok := x.(T); ok {
+		return v, true, nil
+	}
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if x == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Slice, reflect.Map, reflect.Chan, reflect.Func:
+			return zero, true, nil
+		}
+	}
+	return zero, true, keyError("GetAs", k, ErrWrongType, "Item %s is of type %T, not %s", x, t)
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetAs(t *testing.T) {
+	clk := &manualClock{t: time.Unix(1000, 0)}
+	tc := New(DefaultExpiration, 0, WithClock(clk))
+	tc.Set("int", 1, DefaultExpiration)
+	tc.Set("expired", 1, time.Millisecond)
+	tc.Set("nil", nil, DefaultExpiration)
+	clk.Advance(5 * time.Millisecond)
+
+	if v, found, err := GetAs[int](tc, "int"); v != 1 || !found || err != nil {
+		t.Errorf("GetAs[int] returned %v, %v, %v", v, found, err)
+	}
+	v, found, err := GetAs[string](tc, "int")
+	if v != "" || !found || !errors.Is(err, ErrWrongType) {
+		t.Errorf("GetAs[string] of an int returned %q, %v, %v", v, found, err)
+	} else if msg := err.Error(); !strings.Contains(msg, "int") || !strings.Contains(msg, "string") {
+		t.Errorf("the error doesn't name both types: %s", msg)
+	}
+	if v, found, err := GetAs[int](tc, "expired"); v != 0 || found || err != nil {
+		t.Errorf("GetAs of an expired item returned %v, %v, %v", v, found, err)
+	}
+	if v, found, err := GetAs[int](tc, "missing"); v != 0 || found || err != nil {
+		t.Errorf("GetAs of a missing item returned %v, %v, %v", v, found, err)
+	}
+
+	if v, found, err := GetAs[fmt.Stringer](tc, "nil"); v != nil || !found || err != nil {
+		t.Errorf("GetAs[fmt.Stringer] of nil returned %v, %v, %v", v, found, err)
+	}
+	if _, found, err := GetAs[int](tc, "nil"); !found || !errors.Is(err, ErrWrongType) {
+		t.Errorf("GetAs[int] of nil returned %v, %v", found, err)
+	}
+}
+
+func TestGetAsSharded(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 13)
+	tc.Set("foo", []string{"a"}, DefaultExpiration)
+	if v, found, err := GetAs[[]string](tc, "foo"); len(v) != 1 || !found || err != nil {
+		t.Errorf("GetAs returned %v, %v, %v", v, found, err)
+	}
+	if _, _, err := GetAs[[]int](tc, "foo"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("GetAs[[]int] of a []string returned %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// A ValueCodec encodes the values of items written by Save and decodes them
+// when they are loaded, e.g. using protobuf or msgpack. Only the values go
+// through the codec: the keys, expiration times and the rest of the snapshot
+// format stay the same. See WithValueCodec.
+type ValueCodec interface {
+	Marshal(x interface{}) ([]byte, error)
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+// WithValueCodec makes Save, SnapshotAsync and the other methods that write
+// snapshots encode values using vc, and Load, LoadAdd, LoadBestEffort and
+// WithAutoReload decode them using it. By default values are encoded using
+// Gob, which requires their types to be registered (see gob.Register.)
+//
+// A snapshot must be loaded by a cache using the same codec it was written
+// with.
+func WithValueCodec(vc ValueCodec) Option {
+	return func(o *options) {
+		o.valueCodec = vc
+	}
+}
+
+// Prepares an item to be written to a snapshot: encodes its value using the
+// cache's ValueCodec, or registers its type with Gob if there is none. Gob
+// panics if the type can't be registered.
+func (c *cache) encodeValue(k string, v Item) (Item, error) {
+	if c.valueCodec == nil {
+		gob.Register(v.Object)
+		return v, nil
+	}
+	x, err := c.decompress(v.Object)
+	if err != nil {
+		return v, err
+	}
+	b, err := c.valueCodec.Marshal(x)
+	if err != nil {
+		return v, fmt.Errorf("Couldn't encode %s: %w", k, err)
+	}
+	v.Object = b
+	return v, nil
+}
+
+// Reads a snapshot like readSnapshot, and decodes the values using the
+// cache's ValueCodec, if it has one. Items whose values can't be decoded are
+// left out, and the first such error is returned unless reading the snapshot
+// failed too.
+func (c *cache) readSnapshot(r io.Reader) (map[string]Item, error) {
+	items, err := readSnapshot(r)
+	if c.valueCodec == nil {
+		return items, err
+	}
+	for k, v := range items {
+		b, ok := v.Object.([]byte)
+		if !ok {
+			delete(items, k)
+			if err == nil {
+				err = fmt.Errorf("Couldn't decode %s: value is a %T, not encoded bytes", k, v.Object)
+			}
+			continue
+		}
+		x, derr := c.valueCodec.Unmarshal(b)
+		if derr != nil {
+			delete(items, k)
+			if err == nil {
+				err = fmt.Errorf("Couldn't decode %s: %w", k, derr)
+			}
+			continue
+		}
+		v.Object = x
+		items[k] = v
+	}
+	return items, err
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// A value type that Gob can't encode, since it has no exported fields.
+type point struct {
+	x, y int
+}
+
+type pointCodec struct{}
+
+func (pointCodec) Marshal(x interface{}) ([]byte, error) {
+	p, ok := x.(point)
+	if !ok {
+		return nil, fmt.Errorf("not a point: %T", x)
+	}
+	return []byte(fmt.Sprintf("%d,%d", p.x, p.y)), nil
+}
+
+func (pointCodec) Unmarshal(data []byte) (interface{}, error) {
+	var p point
+	if _, err := fmt.Sscanf(string(data), "%d,%d", &p.x, &p.y); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func TestValueCodecSaveLoad(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithValueCodec(pointCodec{}))
+	tc.Set("a", point{1, 2}, DefaultExpiration)
+	tc.Set("b", point{3, 4}, NoExpiration)
+	var buf bytes.Buffer
+	if err := tc.Save(&buf); err != nil {
+		t.Fatalf("Save returned %v", err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("3,4")) {
+		t.Error("snapshot doesn't contain the encoded value")
+	}
+
+	oc := New(DefaultExpiration, 0, WithValueCodec(pointCodec{}))
+	if err := oc.Load(&buf); err != nil {
+		t.Fatalf("Load returned %v", err)
+	}
+	for k, want := range map[string]point{"a": {1, 2}, "b": {3, 4}} {
+		if x, found := oc.Get(k); !found || x.(point) != want {
+			t.Errorf("%s is %v, %v after loading, not %v", k, x, found, want)
+		}
+	}
+}
+
+func TestValueCodecErrors(t *testing.T) {
+	tc := New(DefaultExpiration, 0, WithValueCodec(pointCodec{}))
+	tc.Set("a", "not a point", DefaultExpiration)
+	var buf bytes.Buffer
+	if err := tc.Save(&buf); err == nil || !strings.Contains(err.Error(), "not a point") {
+		t.Errorf("Save of a value the codec can't encode returned %v", err)
+	}
+
+	// A snapshot written without the codec can't be decoded by it.
+	plain := New(DefaultExpiration, 0)
+	plain.Set("a", "x", DefaultExpiration)
+	buf.Reset()
+	plain.Save(&buf)
+	oc := New(DefaultExpiration, 0, WithValueCodec(pointCodec{}))
+	if err := oc.Load(&buf); err == nil {
+		t.Error("Load of values that weren't encoded by the codec succeeded")
+	}
+	if _, found := oc.Get("a"); found {
+		t.Error("a was loaded although it couldn't be decoded")
+	}
+}
+
+type failingPointCodec struct{ pointCodec }
+
+var errDecode = errors.New("can't decode")
+
+func (failingPointCodec) Unmarshal(data []byte) (interface{}, error) {
+	return nil, errDecode
+}
+
+func TestShardedValueCodec(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 4, WithValueCodec(pointCodec{}))
+	for i := 0; i < 10; i++ {
+		tc.Set(fmt.Sprint(i), point{i, -i}, DefaultExpiration)
+	}
+	var buf bytes.Buffer
+	if err := <-tc.SnapshotAsync(&buf); err != nil {
+		t.Fatalf("SnapshotAsync returned %v", err)
+	}
+	snap := buf.Bytes()
+
+	oc := NewSharded(DefaultExpiration, 0, 3, WithValueCodec(pointCodec{}))
+	added, _, _, err := oc.LoadAdd(bytes.NewReader(snap))
+	if err != nil || added != 10 {
+		t.Fatalf("LoadAdd returned %d, %v", added, err)
+	}
+	if x, found := oc.Get("7"); !found || x.(point) != (point{7, -7}) {
+		t.Errorf("7 is %v, %v", x, found)
+	}
+
+	fc := NewSharded(DefaultExpiration, 0, 3, WithValueCodec(failingPointCodec{}))
+	if _, _, _, err := fc.LoadAdd(bytes.NewReader(snap)); !errors.Is(err, errDecode) {
+		t.Errorf("LoadAdd with a failing codec returned %v", err)
+	}
+}
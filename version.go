@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"time"
+)
+
+// Returns a new item version. c.mu must be held. Versions are unique within a
+// cache, so an item that is deleted and set again doesn't get back a version
+// that was handed out for it before.
+func (c *cache) nextVersion() uint64 {
+	c.version++
+	return c.version
+}
+
+// GetVersioned gets an item from the cache like Get, along with its version,
+// which changes whenever the item is written, e.g. using Set or Increment. The
+// version can be passed to CompareVersionAndSwap to update the item only if it
+// hasn't been written since.
+func (c *cache) GetVersioned(k string) (interface{}, uint64, bool) {
+	c.mu.RLock()
+	item, found := c.items[k]
+	if !found || c.expired(item) {
+		c.mu.RUnlock()
+		return nil, 0, false
+	}
+	if c.evictor != nil {
+		c.evictor.Access(k)
+	}
+	c.mu.RUnlock()
+	x, found := c.value(k, item.Object)
+	if !found {
+		return nil, 0, false
+	}
+	return x, item.version, true
+}
+
+// CompareVersionAndSwap replaces the item with the given key with x, for the
+// duration d (see Set), only if it exists, hasn't expired, and its version is
+// still the given one, as returned by GetVersioned. Returns whether the item
+// was replaced.
+func (c *cache) CompareVersionAndSwap(k string, version uint64, x interface{}, d time.Duration) bool {
+	c.flushPending(k)
+	x = c.compress(x)
+	c.mu.Lock()
+	item, found := c.items[k]
+	if !found || c.expired(item) || item.version != version || c.tombstoned(k) {
+		c.mu.Unlock()
+		return false
+	}
+	evictedItems := c.set(k, x, d)
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+	return true
+}
+
+// GetVersioned gets an item and its version from the shard owning k. See the
+// cache's GetVersioned.
+func (sc *shardedCache) GetVersioned(k string) (interface{}, uint64, bool) {
+	return sc.bucket(k).GetVersioned(k)
+}
+
+// CompareVersionAndSwap replaces the item with the given key in the shard
+// owning it if its version matches. See the cache's CompareVersionAndSwap.
+func (sc *shardedCache) CompareVersionAndSwap(k string, version uint64, x interface{}, d time.Duration) bool {
+	return sc.bucket(k).CompareVersionAndSwap(k, version, x, d)
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestGetVersioned(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	if _, _, found := tc.GetVersioned("foo"); found {
+		t.Error("GetVersioned found a missing item")
+	}
+	tc.Set("foo", 1, DefaultExpiration)
+	x, v1, found := tc.GetVersioned("foo")
+	if !found || x.(int) != 1 {
+		t.Fatalf("GetVersioned returned %v, %v", x, found)
+	}
+	tc.Increment("foo", 1)
+	_, v2, _ := tc.GetVersioned("foo")
+	if v2 == v1 {
+		t.Error("Increment didn't change the version")
+	}
+	tc.Set("foo", 1, DefaultExpiration)
+	_, v3, _ := tc.GetVersioned("foo")
+	if v3 == v2 || v3 == v1 {
+		t.Error("Set didn't change the version")
+	}
+	tc.Get("foo")
+	if _, v, _ := tc.GetVersioned("foo"); v != v3 {
+		t.Error("Get changed the version")
+	}
+}
+
+func TestCompareVersionAndSwap(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	if tc.CompareVersionAndSwap("foo", 0, 1, DefaultExpiration) {
+		t.Error("CompareVersionAndSwap set a missing item")
+	}
+	tc.Set("foo", 1, DefaultExpiration)
+	_, v, _ := tc.GetVersioned("foo")
+	if !tc.CompareVersionAndSwap("foo", v, 2, DefaultExpiration) {
+		t.Error("CompareVersionAndSwap failed with the current version")
+	}
+	if tc.CompareVersionAndSwap("foo", v, 3, DefaultExpiration) {
+		t.Error("CompareVersionAndSwap succeeded with a stale version")
+	}
+	if x, _ := tc.Get("foo"); x.(int) != 2 {
+		t.Errorf("foo is %v, not 2", x)
+	}
+	// Deleting and setting the item again doesn't reuse the old version.
+	_, v, _ = tc.GetVersioned("foo")
+	tc.Delete("foo")
+	tc.Set("foo", 2, DefaultExpiration)
+	if tc.CompareVersionAndSwap("foo", v, 4, DefaultExpiration) {
+		t.Error("CompareVersionAndSwap succeeded after the item was replaced")
+	}
+}
+
+func TestCompareVersionAndSwapConcurrent(t *testing.T) {
+	tc := NewSharded(DefaultExpiration, 0, 4)
+	tc.Set("foo", 0, DefaultExpiration)
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for {
+					x, v, _ := tc.GetVersioned("foo")
+					if tc.CompareVersionAndSwap("foo", v, x.(int)+1, DefaultExpiration) {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if x, _ := tc.Get("foo"); x.(int) != 800 {
+		t.Errorf("foo is %v, not 800: updates were lost", x)
+	}
+}
@@ -0,0 +1,251 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WarmStatus is the outcome of warming one key. See Warm.
+type WarmStatus int
+
+const (
+	// WarmLoaded means the key was loaded and stored.
+	WarmLoaded WarmStatus = iota
+	// WarmSkipped means the key was already in the cache, so it wasn't
+	// loaded. See WarmForce.
+	WarmSkipped
+	// WarmFailed means the loader returned an error, which is stored in the
+	// result.
+	WarmFailed
+	// WarmCanceled means the context was done before the key was loaded.
+	WarmCanceled
+)
+
+func (s WarmStatus) String() string {
+	switch s {
+	case WarmLoaded:
+		return "loaded"
+	case WarmSkipped:
+		return "skipped"
+	case WarmFailed:
+		return "failed"
+	case WarmCanceled:
+		return "canceled"
+	}
+	return "unknown"
+}
+
+// WarmResult is the outcome of warming one key.
+type WarmResult struct {
+	Key    string
+	Status WarmStatus
+	// The loader's error, if Status is WarmFailed or WarmCanceled.
+	Err error
+	// How long the loader took, if it was called.
+	Duration time.Duration
+}
+
+// WarmReport describes a call to Warm.
+type WarmReport struct {
+	// The outcome for each key, in the order the keys were given.
+	Results                           []WarmResult
+	Loaded, Skipped, Failed, Canceled int
+	// How long Warm took.
+	Duration time.Duration
+}
+
+// A WarmOption configures a call to Warm.
+type WarmOption func(*warmConfig)
+
+type warmConfig struct {
+	force    bool
+	progress func(done, total int)
+}
+
+// WarmForce makes Warm load keys even if they are already in the cache,
+// replacing the cached items.
+func WarmForce() WarmOption {
+	return func(c *warmConfig) {
+		c.force = true
+	}
+}
+
+// WarmProgress makes Warm call f with the number of keys it has finished with
+// (loaded, skipped or failed) and the total number of keys each time it
+// finishes with one, e.g. to log progress. f is called from the loading
+// goroutines, so it must be safe for concurrent use.
+func WarmProgress(f func(done, total int)) WarmOption {
+	return func(c *warmConfig) {
+		c.progress = f
+	}
+}
+
+// How many loaded items are stored at a time. See Warm.
+const warmBatchSize = 64
+
+// An item loaded by Warm, waiting to be stored.
+type warmItem struct {
+	k string
+	x interface{}
+	d time.Duration
+}
+
+// Warm loads the items with the given keys by calling loader for each, using
+// at most concurrency goroutines, and stores them for the durations loader
+// returns (see Set.) Keys that are already in the cache are skipped unless
+// WarmForce is given. Loaded items are stored in batches, locking the cache
+// once per batch rather than once per item.
+//
+// Warm returns once all keys have been warmed, or ctx is done. The report has
+// the outcome and loading time of every key; the error is ctx.Err() if ctx was
+// done before all keys were warmed, in which case the remaining keys are
+// reported as WarmCanceled. Items loaded before that are stored.
+func (c *cache) Warm(ctx context.Context, keys []string, concurrency int, loader func(ctx context.Context, k string) (interface{}, time.Duration, error), opts ...WarmOption) (WarmReport, error) {
+	return warm(ctx, c.goroutines, keys, concurrency, loader, opts, func(k string) bool {
+		_, found := c.lookup(k)
+		return found
+	}, func(items []warmItem) {
+		c.setMany(items)
+	})
+}
+
+// Warm loads the items with the given keys into the shards owning them. See
+// the cache's Warm.
+func (sc *shardedCache) Warm(ctx context.Context, keys []string, concurrency int, loader func(ctx context.Context, k string) (interface{}, time.Duration, error), opts ...WarmOption) (WarmReport, error) {
+	return warm(ctx, sc.cs[0].goroutines, keys, concurrency, loader, opts, func(k string) bool {
+		_, found := sc.bucket(k).lookup(k)
+		return found
+	}, func(items []warmItem) {
+		byShard := map[*cache][]warmItem{}
+		for _, it := range items {
+			c := sc.bucket(it.k)
+			byShard[c] = append(byShard[c], it)
+		}
+		for c, items := range byShard {
+			c.setMany(items)
+		}
+	})
+}
+
+// Stores items while holding the lock once.
+func (c *cache) setMany(items []warmItem) {
+	var evictedItems []keyAndValue
+	c.mu.Lock()
+	for _, it := range items {
+		if c.tombstoned(it.k) {
+			continue
+		}
+		if c.keyTags != nil {
+			c.untag(it.k)
+		}
+		evictedItems = append(evictedItems, c.set(it.k, it.x, it.d)...)
+	}
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+}
+
+func warm(ctx context.Context, g *goroutines, keys []string, concurrency int, loader func(ctx context.Context, k string) (interface{}, time.Duration, error), opts []WarmOption, exists func(k string) bool, store func([]warmItem)) (WarmReport, error) {
+	var cfg warmConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	begin := time.Now()
+	report := WarmReport{Results: make([]WarmResult, len(keys))}
+	for i, k := range keys {
+		report.Results[i] = WarmResult{Key: k, Status: WarmCanceled}
+	}
+
+	var (
+		mu      sync.Mutex
+		pending []warmItem
+		done    int
+	)
+	// Records a finished key, and stores the pending items once there are
+	// enough of them.
+	finish := func(item *warmItem) {
+		var batch []warmItem
+		mu.Lock()
+		if item != nil {
+			pending = append(pending, *item)
+			if len(pending) >= warmBatchSize {
+				batch, pending = pending, nil
+			}
+		}
+		done++
+		n := done
+		mu.Unlock()
+		if batch != nil {
+			store(batch)
+		}
+		if cfg.progress != nil {
+			cfg.progress(n, len(keys))
+		}
+	}
+
+	work := make(chan int)
+	wg := new(sync.WaitGroup)
+	for i := 0; i < concurrency && i < len(keys); i++ {
+		wg.Add(1)
+		g.work(func() {
+			defer wg.Done()
+			for i := range work {
+				r := &report.Results[i]
+				if !cfg.force && exists(r.Key) {
+					r.Status = WarmSkipped
+					finish(nil)
+					continue
+				}
+				t := time.Now()
+				x, d, err := loader(ctx, r.Key)
+				r.Duration = time.Since(t)
+				switch {
+				case err == nil:
+					r.Status = WarmLoaded
+					finish(&warmItem{r.Key, x, d})
+					continue
+				case ctx.Err() != nil:
+					r.Status = WarmCanceled
+				default:
+					r.Status = WarmFailed
+				}
+				r.Err = err
+				finish(nil)
+			}
+		})
+	}
+feed:
+	for i := range keys {
+		select {
+		case work <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	if len(pending) > 0 {
+		store(pending)
+	}
+
+	for _, r := range report.Results {
+		switch r.Status {
+		case WarmLoaded:
+			report.Loaded++
+		case WarmSkipped:
+			report.Skipped++
+		case WarmFailed:
+			report.Failed++
+		case WarmCanceled:
+			report.Canceled++
+		}
+	}
+	report.Duration = time.Since(begin)
+	if report.Canceled > 0 {
+		return report, ctx.Err()
+	}
+	return report, nil
+}
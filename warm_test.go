@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type warmer interface {
+	Set(k string, x interface{}, d time.Duration)
+	Get(k string) (interface{}, bool)
+	Warm(ctx context.Context, keys []string, concurrency int, loader func(ctx context.Context, k string) (interface{}, time.Duration, error), opts ...WarmOption) (WarmReport, error)
+}
+
+func warmCaches() map[string]warmer {
+	return map[string]warmer{
+		"cache":   New(DefaultExpiration, 0),
+		"sharded": NewSharded(DefaultExpiration, 0, 4),
+	}
+}
+
+func warmItemCount(tc warmer) int {
+	switch tc := tc.(type) {
+	case *Cache:
+		return tc.ItemCount()
+	case *ShardedCache:
+		return int(tc.ItemCount())
+	}
+	return -1
+}
+
+func TestWarm(t *testing.T) {
+	errBad := errors.New("bad")
+	for name, tc := range warmCaches() {
+		tc.Set("k0", "old", DefaultExpiration)
+		keys := make([]string, 200)
+		for i := range keys {
+			keys[i] = "k" + strconv.Itoa(i)
+		}
+		var progress int32
+		report, err := tc.Warm(context.Background(), keys, 8, func(ctx context.Context, k string) (interface{}, time.Duration, error) {
+			if k == "k1" {
+				return nil, 0, errBad
+			}
+			return "new " + k, DefaultExpiration, nil
+		}, WarmProgress(func(done, total int) {
+			atomic.AddInt32(&progress, 1)
+		}))
+		if err != nil {
+			t.Fatalf("%s: Warm returned %v", name, err)
+		}
+		if report.Loaded != 198 || report.Skipped != 1 || report.Failed != 1 || report.Canceled != 0 {
+			t.Errorf("%s: unexpected report counts: %+v", name, report)
+		}
+		if r := report.Results[0]; r.Key != "k0" || r.Status != WarmSkipped {
+			t.Errorf("%s: unexpected result for k0: %+v", name, r)
+		}
+		if r := report.Results[1]; r.Status != WarmFailed || r.Err != errBad {
+			t.Errorf("%s: unexpected result for k1: %+v", name, r)
+		}
+		if progress != 200 {
+			t.Errorf("%s: progress was reported %d times, not 200", name, progress)
+		}
+		if x, _ := tc.Get("k0"); x != "old" {
+			t.Errorf("%s: k0 was replaced: %v", name, x)
+		}
+		if x, _ := tc.Get("k150"); x != "new k150" {
+			t.Errorf("%s: k150 is %v", name, x)
+		}
+		if n := warmItemCount(tc); n != 199 {
+			t.Errorf("%s: ItemCount is %d, not 199", name, n)
+		}
+	}
+}
+
+func TestWarmForce(t *testing.T) {
+	for name, tc := range warmCaches() {
+		tc.Set("foo", "old", DefaultExpiration)
+		report, err := tc.Warm(context.Background(), []string{"foo"}, 1, func(ctx context.Context, k string) (interface{}, time.Duration, error) {
+			return "new", DefaultExpiration, nil
+		}, WarmForce())
+		if err != nil || report.Loaded != 1 {
+			t.Errorf("%s: Warm returned %+v, %v", name, report, err)
+		}
+		if x, _ := tc.Get("foo"); x != "new" {
+			t.Errorf("%s: foo is %v", name, x)
+		}
+		if n := warmItemCount(tc); n != 1 {
+			t.Errorf("%s: ItemCount is %d, not 1", name, n)
+		}
+	}
+}
+
+func TestWarmCanceled(t *testing.T) {
+	for name, tc := range warmCaches() {
+		ctx, cancel := context.WithCancel(context.Background())
+		keys := []string{"a", "b", "c", "d"}
+		report, err := tc.Warm(ctx, keys, 1, func(ctx context.Context, k string) (interface{}, time.Duration, error) {
+			if k == "b" {
+				cancel()
+				<-ctx.Done()
+				return nil, 0, ctx.Err()
+			}
+			return k, DefaultExpiration, nil
+		})
+		if err != context.Canceled {
+			t.Errorf("%s: Warm returned %v, not context.Canceled", name, err)
+		}
+		if report.Loaded != 1 || report.Canceled != 3 {
+			t.Errorf("%s: unexpected report counts: %+v", name, report)
+		}
+		if _, found := tc.Get("a"); !found {
+			t.Errorf("%s: a, loaded before cancellation, wasn't stored", name)
+		}
+		if _, found := tc.Get("c"); found {
+			t.Errorf("%s: c was stored after cancellation", name)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// How often the watermark sweeper checks the cache's size if it isn't
+// triggered by an insert.
+const watermarkCheckInterval = time.Second
+
+// How many items the watermark sweeper evicts per lock of the cache, so that
+// writers aren't blocked for the whole sweep.
+const watermarkBatch = 64
+
+// WithWatermarks makes a capacity-limited cache (see NewWithCapacity) evict in
+// the background rather than on the insert that fills it: inserts are accepted
+// until the cache holds hard items, and once it holds more than soft, a
+// background sweep evicts items chosen by the eviction policy until target
+// are left. Only inserts into a cache holding hard items evict synchronously,
+// when the sweep can't keep up. hard replaces the capacity set using
+// WithMaxItems or NewWithCapacity, and makes the cache capacity-limited if it
+// wasn't.
+//
+// The watermarks are ignored unless 0 < target <= soft <= hard, and by
+// sharded caches. The sweeps are reported by SweepStats.
+func WithWatermarks(soft, hard, target int) Option {
+	return func(o *options) {
+		o.watermarkSoft = soft
+		o.watermarkHard = hard
+		o.watermarkTarget = target
+	}
+}
+
+// SweepStats describes the background sweeps of a cache created with
+// WithWatermarks.
+type SweepStats struct {
+	// The number of sweeps that evicted items, and the number of items
+	// they evicted.
+	Sweeps, Evicted uint64
+	// The total and longest durations of the sweeps.
+	Total, Max time.Duration
+}
+
+type watermarks struct {
+	soft, hard, target int
+	sweeper            *Janitor
+	triggered          atomic.Bool
+
+	sweeps  atomic.Uint64
+	evicted atomic.Uint64
+	total   atomic.Int64
+	max     atomic.Int64
+}
+
+func newWatermarks(o *options) *watermarks {
+	if o.watermarkTarget <= 0 || o.watermarkTarget > o.watermarkSoft || o.watermarkSoft > o.watermarkHard {
+		return nil
+	}
+	return &watermarks{
+		soft:   o.watermarkSoft,
+		hard:   o.watermarkHard,
+		target: o.watermarkTarget,
+	}
+}
+
+// Starts a sweep unless one has been triggered already.
+func (w *watermarks) trigger() {
+	if w.sweeper != nil && w.triggered.CompareAndSwap(false, true) {
+		w.sweeper.TriggerNow()
+	}
+}
+
+func runWatermarkSweeper(c *cache) {
+	c.watermarks.sweeper = NewJanitor(watermarkCheckInterval, c.sweepWatermarks)
+	c.watermarks.sweeper.goroutines = c.goroutines
+	c.watermarks.sweeper.Start()
+}
+
+// Evicts items down to the target watermark if the cache holds more than the
+// soft one.
+func (c *cache) sweepWatermarks() {
+	w := c.watermarks
+	w.triggered.Store(false)
+	c.mu.RLock()
+	n := len(c.items)
+	c.mu.RUnlock()
+	if n <= w.soft {
+		return
+	}
+	start := time.Now()
+	evicted := 0
+	for {
+		c.mu.Lock()
+		limit := len(c.items) - watermarkBatch
+		if limit < w.target {
+			limit = w.target
+		}
+		evictedItems, removed := c.evictDownTo("", limit)
+		done := len(c.items) <= w.target || removed == 0
+		c.mu.Unlock()
+		c.notifyEvicted(evictedItems)
+		evicted += removed
+		if done {
+			break
+		}
+	}
+	if evicted == 0 {
+		return
+	}
+	d := int64(time.Since(start))
+	w.sweeps.Add(1)
+	w.evicted.Add(uint64(evicted))
+	w.total.Add(d)
+	for {
+		max := w.max.Load()
+		if d <= max || w.max.CompareAndSwap(max, d) {
+			break
+		}
+	}
+}
+
+// SweepStats returns statistics about the background sweeps of a cache created
+// with WithWatermarks, which are all zero for other caches.
+func (c *cache) SweepStats() SweepStats {
+	w := c.watermarks
+	if w == nil {
+		return SweepStats{}
+	}
+	return SweepStats{
+		Sweeps:  w.sweeps.Load(),
+		Evicted: w.evicted.Load(),
+		Total:   time.Duration(w.total.Load()),
+		Max:     time.Duration(w.max.Load()),
+	}
+}
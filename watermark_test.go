@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWatermarks(t *testing.T) {
+	tc := NewWithCapacity(DefaultExpiration, 0, 0, EvictionPolicyLRU, WithWatermarks(80, 100, 50))
+	defer tc.Close()
+	for i := 0; i < 90; i++ {
+		tc.Set("foo"+strconv.Itoa(i), i, DefaultExpiration)
+		if n := tc.ItemCount(); n > 100 {
+			t.Fatalf("ItemCount is %d, more than the hard watermark", n)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for tc.ItemCount() > 50 && time.Now().Before(deadline) {
+		<-time.After(time.Millisecond)
+	}
+	if n := tc.ItemCount(); n != 50 {
+		t.Fatalf("ItemCount is %d after the sweep, not 50", n)
+	}
+	if _, found := tc.Get("foo89"); !found {
+		t.Error("the most recently set item was evicted")
+	}
+	s := tc.SweepStats()
+	if s.Sweeps == 0 || s.Evicted < 40 || s.Max <= 0 || s.Total < s.Max {
+		t.Errorf("unexpected SweepStats: %+v", s)
+	}
+}
+
+func TestWatermarksHardLimit(t *testing.T) {
+	tc := NewWithCapacity(DefaultExpiration, 0, 0, EvictionPolicyLRU, WithWatermarks(80, 100, 50))
+	// Without the sweeper, only the hard watermark limits the cache.
+	tc.Close()
+	for i := 0; i < 150; i++ {
+		tc.Set("foo"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+	if n := tc.ItemCount(); n != 100 {
+		t.Errorf("ItemCount is %d, not 100", n)
+	}
+	if s := tc.SweepStats(); s.Sweeps != 0 {
+		t.Errorf("%d sweeps were made after Close", s.Sweeps)
+	}
+}
+
+func TestWatermarksInvalid(t *testing.T) {
+	tc := NewWithCapacity(DefaultExpiration, 0, 3, EvictionPolicyLRU, WithWatermarks(10, 5, 1))
+	defer tc.Close()
+	for i := 0; i < 10; i++ {
+		tc.Set("foo"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+	if n := tc.ItemCount(); n != 3 {
+		t.Errorf("ItemCount is %d with invalid watermarks, not 3", n)
+	}
+}
+
+// Burns about d of CPU time, standing in for an OnEvicted callback that does
+// real work.
+func spin(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
+
+// Reports the 99th percentile latency of Set on a full cache whose OnEvicted
+// callback does some work, to compare evicting on every insert, which runs the
+// callback on the inserting goroutine, with evicting in the background. Items
+// are set in bursts, between which the sweeper (if any) can catch up.
+func benchmarkSetP99(b *testing.B, opts ...Option) {
+	tc := NewWithCapacity(DefaultExpiration, 0, 10000, EvictionPolicyLRU, opts...)
+	defer tc.Close()
+	for i := 0; i < 10000; i++ {
+		tc.Set("warm"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+	tc.OnEvicted(func(k string, v interface{}) {
+		spin(5 * time.Microsecond)
+	})
+	keys := make([]string, b.N)
+	for i := range keys {
+		keys[i] = "foo" + strconv.Itoa(i)
+	}
+	lat := make([]time.Duration, b.N)
+	b.ResetTimer()
+	for i, k := range keys {
+		if i%1000 == 0 && len(opts) > 0 {
+			b.StopTimer()
+			for tc.ItemCount() > 9000 {
+				<-time.After(time.Millisecond)
+			}
+			b.StartTimer()
+		}
+		start := time.Now()
+		tc.Set(k, i, DefaultExpiration)
+		lat[i] = time.Since(start)
+	}
+	b.StopTimer()
+	sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+	b.ReportMetric(float64(lat[len(lat)*99/100]), "p99-ns")
+}
+
+func BenchmarkSetEvictOnInsert(b *testing.B) {
+	benchmarkSetP99(b)
+}
+
+func BenchmarkSetWatermarks(b *testing.B) {
+	benchmarkSetP99(b, WithWatermarks(9000, 11000, 8000))
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"runtime"
+	"time"
+	"weak"
+)
+
+// SetWeak adds v to the cache like Set, but without keeping it alive: once v is
+// no longer referenced outside the cache, the garbage collector may reclaim it,
+// after which GetWeak reports a miss and the item is removed from the cache.
+// This suits caches of large, deduplicated objects that are also referenced
+// elsewhere. Items set using SetWeak must be read using GetWeak with the same
+// type T; Get returns the underlying weak.Pointer.
+//
+// This is experimental and best-effort: when, and whether, an unreachable v is
+// reclaimed depends entirely on the garbage collector, and the item is removed
+// some time after that (and passed to the OnEvicted function, with the
+// now-empty weak.Pointer as its value, as expired.) Until v is reclaimed,
+// GetWeak keeps returning it, and the item counts towards ItemCount and any
+// capacity limit.
+func SetWeak[T any](c *Cache, k string, v *T, d time.Duration) {
+	wp := weak.Make(v)
+	c.Set(k, wp, d)
+	cc := c.cache
+	runtime.AddCleanup(v, func(k string) {
+		cc.deleteWeak(k, wp)
+	}, k)
+}
+
+// GetWeak gets an item set using SetWeak. It reports a miss if the item isn't
+// found, has expired, isn't a weak reference to a T, or has been reclaimed.
+func GetWeak[T any](c *Cache, k string) (*T, bool) {
+	x, found := c.Get(k)
+	if !found {
+		return nil, false
+	}
+	wp, ok := x.(weak.Pointer[T])
+	if !ok {
+		return nil, false
+	}
+	v := wp.Value()
+	return v, v != nil
+}
+
+// Deletes k if it still holds the weak reference wp, i.e. it hasn't been
+// overwritten since.
+func (c *cache) deleteWeak(k string, wp interface{}) {
+	var evictedItems []keyAndValue
+	c.mu.Lock()
+	if v, found := c.items[k]; found && v.Object == wp {
+		if ov, evicted := c.delete(k); evicted {
+			evictedItems = append(evictedItems, keyAndValue{k, ov, EvictionReasonExpired})
+		}
+	}
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+type weakTestValue struct {
+	payload [1024]byte
+}
+
+func TestSetWeak(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	v := &weakTestValue{}
+	SetWeak(tc, "foo", v, DefaultExpiration)
+	x, found := GetWeak[weakTestValue](tc, "foo")
+	if !found || x != v {
+		t.Fatal("foo was not found while it was still referenced")
+	}
+	if _, found := GetWeak[int](tc, "foo"); found {
+		t.Error("foo was found as a weak reference of the wrong type")
+	}
+	runtime.KeepAlive(v)
+	v, x = nil, nil
+
+	for i := 0; i < 100 && tc.ItemCount() > 0; i++ {
+		runtime.GC()
+		<-time.After(1 * time.Millisecond)
+	}
+	if _, found := GetWeak[weakTestValue](tc, "foo"); found {
+		t.Error("foo was found after it became unreachable")
+	}
+	if n := tc.ItemCount(); n != 0 {
+		t.Errorf("ItemCount is %d after foo was reclaimed, not 0", n)
+	}
+}
+
+func TestSetWeakOverwritten(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	SetWeak(tc, "foo", &weakTestValue{}, DefaultExpiration)
+	tc.Set("foo", "bar", DefaultExpiration)
+	for i := 0; i < 10; i++ {
+		runtime.GC()
+		<-time.After(1 * time.Millisecond)
+	}
+	if x, found := tc.Get("foo"); !found || x.(string) != "bar" {
+		t.Error("overwritten item was removed when the weak value was reclaimed")
+	}
+}
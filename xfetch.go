@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"math"
+	insecurerand "math/rand"
+	"time"
+)
+
+// Returns a random number in (0, 1]. Replaced in tests.
+var earlyExpiryRand = func() float64 {
+	return 1 - insecurerand.Float64()
+}
+
+// SetWithCost adds an item to the cache like Set, recording how long it took to
+// compute x. The cost is used by GetWithEarlyExpiry to decide how early the
+// item should be treated as expired.
+func (c *cache) SetWithCost(k string, x interface{}, d time.Duration, cost time.Duration) {
+	c.mu.Lock()
+	if c.tombstoned(k) {
+		c.mu.Unlock()
+		return
+	}
+	evictedItems := c.set(k, x, d)
+	v := c.items[k]
+	v.Cost = cost
+	c.items[k] = v
+	c.mu.Unlock()
+	c.notifyEvicted(evictedItems)
+}
+
+// GetWithEarlyExpiry gets an item from the cache like Get, except that as the
+// item approaches its expiration time it is increasingly likely to be reported
+// as a miss, so that callers holding the same key recompute it at dispersed
+// times instead of all at once when it expires (probabilistic early expiration,
+// a.k.a. XFetch.) Only the caller seeing the miss should recompute and store
+// the item (using SetWithCost); the stored item is left in place for everyone
+// else.
+//
+// The probability depends on the item's recorded cost (see SetWithCost) and on
+// beta: 1 is a good default, values above 1 favor earlier recomputation, and 0
+// makes this equivalent to Get. Items without an expiration time or cost are
+// never expired early.
+func (c *cache) GetWithEarlyExpiry(k string, beta float64) (interface{}, bool) {
+	x, item, found := c.lookupItem(k)
+	if found && item.Expiration > 0 && expiresEarly(c.now().UnixNano(), item.Expiration, int64(item.Cost), beta, earlyExpiryRand()) {
+		x, found = nil, false
+	}
+	c.recordLookup(found)
+	if found && c.evictor != nil {
+		c.mu.RLock()
+		if _, ok := c.items[k]; ok {
+			c.evictor.Access(k)
+		}
+		c.mu.RUnlock()
+	}
+	return x, found
+}
+
+// Implements the XFetch test: an item expires early if
+// now - cost * beta * ln(r) >= expiration, where r is uniform in (0, 1].
+func expiresEarly(now, expiration, cost int64, beta, r float64) bool {
+	return float64(now)-float64(cost)*beta*math.Log(r) >= float64(expiration)
+}
+
+// SetWithCost adds an item to the shard owning k, recording its cost.
+func (sc *shardedCache) SetWithCost(k string, x interface{}, d time.Duration, cost time.Duration) {
+	sc.bucket(k).SetWithCost(k, x, d, cost)
+}
+
+// GetWithEarlyExpiry gets an item from the shard owning k, possibly reporting
+// a miss before it expires. See the cache's GetWithEarlyExpiry.
+func (sc *shardedCache) GetWithEarlyExpiry(k string, beta float64) (interface{}, bool) {
+	return sc.bucket(k).GetWithEarlyExpiry(k, beta)
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"math"
+	insecurerand "math/rand"
+	"testing"
+	"time"
+)
+
+func TestGetWithEarlyExpiry(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.SetWithCost("foo", "bar", 1*time.Minute, 1*time.Second)
+	tc.Set("baz", "qux", NoExpiration)
+
+	r := earlyExpiryRand
+	defer func() { earlyExpiryRand = r }()
+
+	// ln(1) == 0, i.e. the luckiest possible draw never expires early.
+	earlyExpiryRand = func() float64 { return 1 }
+	if x, found := tc.GetWithEarlyExpiry("foo", 1); !found || x.(string) != "bar" {
+		t.Error("foo was expired early with r == 1")
+	}
+	// -ln(1e-300) * 1s is far more than a minute.
+	earlyExpiryRand = func() float64 { return 1e-300 }
+	if _, found := tc.GetWithEarlyExpiry("foo", 1); found {
+		t.Error("foo was not expired early with a tiny r")
+	}
+	if _, found := tc.GetWithEarlyExpiry("foo", 0); !found {
+		t.Error("foo was expired early with beta == 0")
+	}
+	if _, found := tc.GetWithEarlyExpiry("baz", 1); !found {
+		t.Error("baz, which never expires, was expired early")
+	}
+	if _, found := tc.Get("foo"); !found {
+		t.Error("GetWithEarlyExpiry removed foo from the cache")
+	}
+	if _, found := tc.GetWithEarlyExpiry("missing", 1); found {
+		t.Error("a missing key was found")
+	}
+}
+
+func TestGetWithEarlyExpiryLikeGet(t *testing.T) {
+	tc := NewWithOptions(WithWriteCoalescing(time.Hour), WithRecentHitRate(time.Minute))
+	defer tc.Close()
+	tc.Set("foo", "bar", NoExpiration)
+	if x, found := tc.GetWithEarlyExpiry("foo", 1); !found || x != "bar" {
+		t.Errorf("a buffered write was read as %v, %v", x, found)
+	}
+	tc.GetWithEarlyExpiry("missing", 1)
+	if r := tc.RecentHitRate(); r != 0.5 {
+		t.Errorf("RecentHitRate is %v, not 0.5", r)
+	}
+
+	tc = NewWithOptions(WithMaxItems(2), WithEvictionPolicy(EvictionPolicyLRU))
+	tc.Set("a", 1, NoExpiration)
+	tc.Set("b", 2, NoExpiration)
+	tc.GetWithEarlyExpiry("a", 1)
+	tc.Set("c", 3, NoExpiration)
+	if _, found := tc.Get("a"); !found {
+		t.Error("a was evicted, although GetWithEarlyExpiry used it more recently than b")
+	}
+}
+
+// Simulates many clients each polling an item once every 10ms, recording when
+// each would first have recomputed it. With early expiration the
+// recomputations should be spread out before the deadline; without it they all
+// happen at once.
+func TestEarlyExpiryDispersesRecomputation(t *testing.T) {
+	const (
+		clients    = 1000
+		ttl        = int64(60 * time.Second)
+		cost       = int64(1 * time.Second)
+		step       = int64(10 * time.Millisecond)
+		expiration = ttl
+	)
+	rnd := insecurerand.New(insecurerand.NewSource(1))
+	simulate := func(beta float64) (mean, stddev float64) {
+		times := make([]float64, clients)
+		for i := range times {
+			now := int64(0)
+			for !expiresEarly(now, expiration, cost, beta, 1-rnd.Float64()) {
+				now += step
+			}
+			if now > expiration+step {
+				t.Fatalf("client %d recomputed after the item expired: %d", i, now)
+			}
+			times[i] = float64(now)
+		}
+		for _, v := range times {
+			mean += v
+		}
+		mean /= clients
+		for _, v := range times {
+			stddev += (v - mean) * (v - mean)
+		}
+		return mean, math.Sqrt(stddev / clients)
+	}
+
+	mean, stddev := simulate(0)
+	if stddev != 0 || mean < float64(expiration) {
+		t.Errorf("without early expiration recomputations weren't clustered at the deadline: mean %v, stddev %v", time.Duration(mean), time.Duration(stddev))
+	}
+	mean, stddev = simulate(1)
+	if mean >= float64(expiration) {
+		t.Errorf("recomputations did not happen before the deadline on average: mean %v", time.Duration(mean))
+	}
+	if stddev < float64(100*time.Millisecond) {
+		t.Errorf("recomputations were not dispersed: stddev %v", time.Duration(stddev))
+	}
+}